@@ -0,0 +1,67 @@
+// Command rollups rebuilds the hourly stats rollups from the raw tables,
+// e.g. after an import or a campaign's cost model changed:
+//
+//	go run ./cmd/rollups                        # everything
+//	go run ./cmd/rollups -from 2024-05-01 -to 2024-05-07
+//
+// from and to are UTC days (both included) or RFC 3339 times.
+package main
+
+import (
+	"flag"
+	"log"
+	"time"
+
+	"unchained-tracker/internal/config"
+	"unchained-tracker/internal/db"
+	"unchained-tracker/internal/db/migrations"
+)
+
+func main() {
+	fromFlag := flag.String("from", "", "first day or time to rebuild (default: the first visit)")
+	toFlag := flag.String("to", "", "last day or time to rebuild (default: the current hour)")
+	flag.Parse()
+
+	from, err := parseTime(*fromFlag, false)
+	if err != nil {
+		log.Fatalf("Invalid -from: %v", err)
+	}
+	to, err := parseTime(*toFlag, true)
+	if err != nil {
+		log.Fatalf("Invalid -to: %v", err)
+	}
+
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatalf("Failed to load config: %v", err)
+	}
+	database, err := db.Connect(cfg.DatabaseURL)
+	if err != nil {
+		log.Fatalf("Failed to connect to database: %v", err)
+	}
+	defer database.Close()
+	if err := migrations.Run(database.DB(), database.Driver()); err != nil {
+		log.Fatalf("Failed to run migrations: %v", err)
+	}
+
+	start := time.Now()
+	if err := database.RebuildRollups(from, to); err != nil {
+		log.Fatalf("Failed to rebuild rollups: %v", err)
+	}
+	log.Printf("Rebuilt rollups in %v", time.Since(start).Round(time.Millisecond))
+}
+
+// parseTime parses a day or an RFC 3339 time, taking the end of the day
+// for the end of a range
+func parseTime(value string, end bool) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse("2006-01-02", value); err == nil {
+		if end {
+			t = t.AddDate(0, 0, 1)
+		}
+		return t, nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+    "context"
     "database/sql"
     "encoding/json"
     "fmt"
@@ -8,13 +9,14 @@ import (
     "net/http"
     "strings"
     "time"
-    "github.com/google/uuid"
     
     "unchained-tracker/internal/api"
     "unchained-tracker/internal/config"
     "unchained-tracker/internal/db"
     "unchained-tracker/internal/geo"
     "unchained-tracker/internal/db/migrations"
+    "unchained-tracker/internal/outbox"
+    "unchained-tracker/internal/rollup"
 )
 
 // Helper functions
@@ -77,19 +79,49 @@ func main() {
     defer database.Close()
 
     // Run migrations
-    if err := migrations.Run(database.DB()); err != nil {
+    if err := migrations.Run(database.DB(), database.Driver()); err != nil {
         log.Fatalf("Failed to run migrations: %v", err)
     }
 
     // Initialize geolocation service
-    geo, err := geo.NewService("GeoLite2-City.mmdb")
+    geoOptions := geo.Options{
+        CityDB:           cfg.GeoCityDB,
+        ASNDB:            cfg.GeoASNDB,
+        ConnectionTypeDB: cfg.GeoConnectionTypeDB,
+        CacheSize:        cfg.GeoCacheSize,
+        ReloadInterval:   cfg.GeoReloadInterval,
+    }
+    switch cfg.GeoFallback {
+    case "":
+    case "ip-api":
+        geoOptions.Fallback = geo.NewIPAPI()
+    default:
+        log.Fatalf("Unknown GEOIP_FALLBACK: %s", cfg.GeoFallback)
+    }
+    geo, err := geo.NewService(geoOptions)
     if err != nil {
         log.Printf("Warning: Geolocation service not available: %v", err)
     }
     defer geo.Close()
+    go geo.Run(context.Background())
 
     // Create API server with geo service
     server := api.NewServer(database, cfg, geo)
+    go server.Run(context.Background())
+
+    // Deliver queued connector events and traffic source postbacks
+    deliveries := outbox.NewWorker(database, outbox.Options{
+        Workers:   cfg.OutboxWorkers,
+        Authorize: server.AuthorizeDelivery,
+    })
+    go deliveries.Run(context.Background())
+
+    // Keep the hourly stats rollups up to date
+    rollups := rollup.NewJob(database, rollup.Options{
+        Interval: cfg.RollupInterval,
+        Lookback: cfg.RollupLookback,
+    })
+    go rollups.Run(context.Background())
 
     // Create router
     mux := http.NewServeMux()
@@ -145,61 +177,29 @@ func main() {
         w.Header().Set("Content-Type", "application/json")
         server.HandleVisit(w, r)
     })
-    mux.HandleFunc("/click", func(w http.ResponseWriter, r *http.Request) {
-        // Get campaign token from query
-        token := r.URL.Query().Get("rtkck")
-        if token == "" {
-            http.Error(w, "Missing campaign token", http.StatusBadRequest)
-            return
-        }
-
-        // Look up campaign by token
-        var campaignID string
-        var offerURL string
-        log.Printf("Looking up campaign with token: %s", token)
-        err := database.QueryRow(
-            "SELECT campaign_id, offer_url FROM campaign WHERE campaign_token = ?", 
-            token,
-        ).Scan(&campaignID, &offerURL)
-        if err != nil {
-            log.Printf("Error finding campaign: %v", err)
-            http.Error(w, "Invalid campaign token", http.StatusBadRequest)
-            return
-        }
-        log.Printf("Found campaign: id=%s, offer_url=%s", campaignID, offerURL)
-
-        // Generate click ID
-        clickID := fmt.Sprintf("%x", time.Now().UnixNano())
-
-        // Save click
-        _, err = database.Exec(`
-            INSERT INTO click (
-                click_id, visitor_id, campaign_token, 
-                campaign_id, ip_address, user_agent, referrer
-            ) VALUES (?, ?, ?, ?, ?, ?, ?)`,
-            clickID,
-            uuid.New().String(), // Generate visitor ID
-            token,
-            campaignID,
-            r.RemoteAddr,
-            r.UserAgent(),
-            r.Referer(),
-        )
-        if err != nil {
-            log.Printf("Error saving click: %v", err)
-            http.Error(w, "Error tracking click", http.StatusInternalServerError)
-            return
-        }
-
-        // Redirect to offer URL with click ID
-        redirectURL := fmt.Sprintf("%s?clickid=%s&source=%s", 
-            offerURL, clickID, campaignID)
-        http.Redirect(w, r, redirectURL, http.StatusFound)
-    })
+    mux.HandleFunc("/click", server.HandleClick)
     mux.HandleFunc("/postback", server.HandleConversion)
     mux.HandleFunc("/network/postback", server.HandleNetworkPostback)
+    mux.HandleFunc("/postback/{network}", server.HandleNetworkPostback)
+    mux.HandleFunc("/api/conversions/status", server.HandleConversionStatus)
+    mux.HandleFunc("/api/conversions/history", server.HandleConversionHistory)
+    mux.HandleFunc("/api/networks", server.HandleAffiliateNetworks)
+    mux.HandleFunc("/api/networks/presets", server.HandleNetworkPresets)
+    mux.HandleFunc("/api/traffic-sources", server.HandleTrafficSources)
+    mux.HandleFunc("/api/deliveries", server.HandleDeliveries)
+    mux.HandleFunc("/api/deliveries/replay", server.HandleReplayDelivery)
+    mux.HandleFunc("/api/postbacks/rejections", server.HandlePostbackRejections)
     mux.HandleFunc("/api/campaigns", server.HandleCampaigns)
+    mux.HandleFunc("/api/campaigns/offers", server.HandleCampaignOffers)
+    mux.HandleFunc("/api/campaigns/paths", server.HandleCampaignPaths)
+    mux.HandleFunc("/api/campaigns/subs", server.HandleSubStats)
+    mux.HandleFunc("/api/campaigns/connectors", server.HandleCampaignConnectors)
+    mux.HandleFunc("/api/campaigns/cost", server.HandleCostUpdate)
+    mux.HandleFunc("/api/connectors/google-ads.csv", server.HandleGoogleAdsFeed)
     mux.HandleFunc("/api/dashboard/stats", server.GetDashboardStats)
+    mux.HandleFunc("/api/reports", server.HandleReports)
+    mux.HandleFunc("/api/export/{file}", server.HandleExport)
+    mux.HandleFunc("/api/stream", server.HandleStream)
 
     // Single debug endpoint that combines all debug information
     mux.HandleFunc("/debug", func(w http.ResponseWriter, r *http.Request) {
@@ -221,116 +221,18 @@ func main() {
         debug["counts"] = counts
 
         // 2. Get all visits with full details
-        visitRows, err := database.Query(`
-            SELECT 
-                v.id,
-                v.visitor_id,
-                v.click_id,
-                v.campaign_id,
-                v.ip_address,
-                v.browser,
-                v.os,
-                v.device_type,
-                v.screen_resolution,
-                v.viewport_size,
-                DATE_FORMAT(v.created_at, '%Y-%m-%d %H:%i:%s') as created_at,
-                COUNT(c.id) as conversion_count,
-                GROUP_CONCAT(c.id) as conversion_ids,
-                GROUP_CONCAT(CAST(c.amount as CHAR)) as conversion_amounts,
-                GROUP_CONCAT(DATE_FORMAT(c.created_at, '%Y-%m-%d %H:%i:%s')) as conversion_times
-            FROM visit v 
-            LEFT JOIN conversion c ON v.visitor_id = c.visitor_id 
-            GROUP BY v.id
-            ORDER BY v.created_at DESC
-            LIMIT 100
-        `)
+        visits, err := database.DebugVisits(100)
         if err != nil {
             log.Printf("Error querying visits: %v", err)
         } else {
-            defer visitRows.Close()
-            visits := make([]map[string]interface{}, 0)
-            cols, _ := visitRows.Columns()
-            for visitRows.Next() {
-                values := make([]interface{}, len(cols))
-                valuePtrs := make([]interface{}, len(cols))
-                for i := range values {
-                    valuePtrs[i] = &values[i]
-                }
-                if err := visitRows.Scan(valuePtrs...); err != nil {
-                    log.Printf("Error scanning visit: %v", err)
-                    continue
-                }
-                row := make(map[string]interface{})
-                for i, col := range cols {
-                    if values[i] == nil {
-                        continue
-                    }
-                    switch v := values[i].(type) {
-                    case []byte:
-                        row[col] = string(v)
-                    default:
-                        row[col] = v
-                    }
-                }
-                visits = append(visits, row)
-            }
             debug["visits"] = visits
         }
 
         // 3. Get all conversions with full details
-        convRows, err := database.Query(`
-            SELECT 
-                c.id,
-                c.visitor_id,
-                c.click_id,
-                c.campaign_id,
-                CAST(c.amount as DECIMAL(10,2)) as amount,
-                c.status,
-                DATE_FORMAT(c.created_at, '%Y-%m-%d %H:%i:%s') as created_at,
-                v.browser,
-                v.os,
-                v.device_type,
-                v.screen_resolution,
-                v.viewport_size,
-                v.ip_address,
-                camp.name as campaign_name,
-                TIMESTAMPDIFF(SECOND, v.created_at, c.created_at) as seconds_to_convert
-            FROM conversion c
-            LEFT JOIN visit v ON c.visitor_id = v.visitor_id
-            LEFT JOIN campaign camp ON c.campaign_id = camp.campaign_id
-            ORDER BY c.created_at DESC
-            LIMIT 100
-        `)
+        conversions, err := database.DebugConversions(100)
         if err != nil {
             log.Printf("Error querying conversions: %v", err)
         } else {
-            defer convRows.Close()
-            conversions := make([]map[string]interface{}, 0)
-            cols, _ := convRows.Columns()
-            for convRows.Next() {
-                values := make([]interface{}, len(cols))
-                valuePtrs := make([]interface{}, len(cols))
-                for i := range values {
-                    valuePtrs[i] = &values[i]
-                }
-                if err := convRows.Scan(valuePtrs...); err != nil {
-                    log.Printf("Error scanning conversion: %v", err)
-                    continue
-                }
-                row := make(map[string]interface{})
-                for i, col := range cols {
-                    if values[i] == nil {
-                        continue
-                    }
-                    switch v := values[i].(type) {
-                    case []byte:
-                        row[col] = string(v)
-                    default:
-                        row[col] = v
-                    }
-                }
-                conversions = append(conversions, row)
-            }
             debug["conversions"] = conversions
         }
 
@@ -394,45 +296,23 @@ func main() {
         lastDay := time.Now().Add(-24 * time.Hour)
         
         // Get last visit time and 24h count
-        var lastVisitTime sql.NullString
-        var last24hVisits int
-        err = database.QueryRow(`
-            SELECT 
-                DATE_FORMAT(MAX(created_at), '%Y-%m-%d %H:%i:%s'),
-                COUNT(*) 
-            FROM visit 
-            WHERE created_at >= ?
-        `, lastDay).Scan(&lastVisitTime, &last24hVisits)
+        lastVisitTime, last24hVisits, err := database.RecentActivity("visit", lastDay)
         if err != nil {
             log.Printf("Error getting recent visit stats: %v", err)
         } else {
-            if lastVisitTime.Valid {
-                t, err := time.Parse("2006-01-02 15:04:05", lastVisitTime.String)
-                if err == nil {
-                    summary["recent_activity"].(map[string]interface{})["last_visit_time"] = t
-                }
+            if lastVisitTime != nil {
+                summary["recent_activity"].(map[string]interface{})["last_visit_time"] = *lastVisitTime
             }
             summary["recent_activity"].(map[string]interface{})["last_24h_visits"] = last24hVisits
         }
 
         // Get last conversion time and 24h count
-        var lastConvTime sql.NullString
-        var last24hConvs int
-        err = database.QueryRow(`
-            SELECT 
-                DATE_FORMAT(MAX(created_at), '%Y-%m-%d %H:%i:%s'),
-                COUNT(*) 
-            FROM conversion 
-            WHERE created_at >= ?
-        `, lastDay).Scan(&lastConvTime, &last24hConvs)
+        lastConvTime, last24hConvs, err := database.RecentActivity("conversion", lastDay)
         if err != nil {
             log.Printf("Error getting recent conversion stats: %v", err)
         } else {
-            if lastConvTime.Valid {
-                t, err := time.Parse("2006-01-02 15:04:05", lastConvTime.String)
-                if err == nil {
-                    summary["recent_activity"].(map[string]interface{})["last_conversion_time"] = t
-                }
+            if lastConvTime != nil {
+                summary["recent_activity"].(map[string]interface{})["last_conversion_time"] = *lastConvTime
             }
             summary["recent_activity"].(map[string]interface{})["last_24h_conversions"] = last24hConvs
         }
@@ -617,6 +497,12 @@ func main() {
 
     // Add migration endpoint (only in development)
     mux.HandleFunc("/debug/migrate", func(w http.ResponseWriter, r *http.Request) {
+        // SQLite databases are created with these columns
+        if database.Driver() == db.DriverSQLite {
+            http.Error(w, "Not available on SQLite", http.StatusNotImplemented)
+            return
+        }
+
         // Add location columns
         for _, column := range []string{"country", "region", "city"} {
             // Check if column exists
@@ -691,69 +577,12 @@ func main() {
 
     mux.HandleFunc("/debug/clicks", func(w http.ResponseWriter, r *http.Request) {
         log.Printf("Fetching click debug data")
-        rows, err := database.Query(`
-            SELECT 
-                c.id,
-                c.click_id,
-                c.campaign_token,
-                c.campaign_id,
-                c.ip_address,
-                DATE_FORMAT(c.created_at, '%Y-%m-%d %H:%i:%s') as created_at,
-                camp.name as campaign_name,
-                COALESCE(camp.offer_url, 'http://localhost:8080/test-offer') as offer_url
-            FROM click c
-            LEFT JOIN campaign camp ON c.campaign_id = camp.campaign_id
-            ORDER BY c.created_at DESC
-            LIMIT 10
-        `)
+        clicks, err := database.DebugClicks(10)
         if err != nil {
             log.Printf("Error querying clicks: %v", err)
             http.Error(w, err.Error(), http.StatusInternalServerError)
             return
         }
-        defer rows.Close()
-
-        var clicks []map[string]interface{}
-        for rows.Next() {
-            var (
-                id            int64
-                clickID       string
-                campaignToken string
-                campaignID    string
-                ipAddress     string
-                createdAt     string
-                campaignName  string
-                offerURL      string
-            )
-            
-            err := rows.Scan(
-                &id,
-                &clickID,
-                &campaignToken,
-                &campaignID,
-                &ipAddress,
-                &createdAt,
-                &campaignName,
-                &offerURL,
-            )
-            if err != nil {
-                log.Printf("Error scanning row: %v", err)
-                continue
-            }
-            
-            click := map[string]interface{}{
-                "id":             id,
-                "click_id":       clickID,
-                "campaign_token": campaignToken,
-                "campaign_id":    campaignID,
-                "ip_address":     ipAddress,
-                "created_at":     createdAt,
-                "campaign_name":  campaignName,
-                "offer_url":      offerURL,
-            }
-            
-            clicks = append(clicks, click)
-        }
 
         w.Header().Set("Content-Type", "application/json")
         json.NewEncoder(w).Encode(clicks)
@@ -770,6 +599,8 @@ func main() {
             <hr>
             <h2>Test Actions</h2>
             <button onclick="testConversion()">Track Conversion ($99.99)</button>
+            <p>Browser conversions are recorded as unverified and only count as revenue once
+            approved with <code>PUT /api/conversions/status</code>.</p>
             <script>
                 async function testConversion() {
                     try {
@@ -783,7 +614,9 @@ func main() {
                             })
                         });
                         if (response.ok) {
-                            alert('Conversion tracked successfully!');
+                            const result = await response.json();
+                            alert('Conversion ' + result.conversion_id + ' tracked as ' + result.conversion_status +
+                                '; approve it to count it as revenue.');
                         } else {
                             alert('Error tracking conversion');
                         }
@@ -10,6 +10,11 @@ class AffiliateTracker {
         return urlParams.get('click_id') || '';
     }
 
+    getCookie(name) {
+        const match = document.cookie.match(new RegExp('(?:^|; )' + name + '=([^;]*)'));
+        return match ? decodeURIComponent(match[1]) : '';
+    }
+
     async trackVisit() {
         try {
             const response = await fetch(`${this.endpoint}/track`, {
@@ -19,7 +24,13 @@ class AffiliateTracker {
                 },
                 body: JSON.stringify({
                     click_id: this.clickId,
-                    campaign_id: this.campaignId
+                    campaign_id: this.campaignId,
+                    screen_resolution: `${screen.width}x${screen.height}`,
+                    timezone: Intl.DateTimeFormat().resolvedOptions().timeZone,
+                    webdriver: navigator.webdriver === true,
+                    params: Object.fromEntries(new URLSearchParams(window.location.search)),
+                    fbc: this.getCookie('_fbc'),
+                    fbp: this.getCookie('_fbp')
                 })
             });
 
@@ -31,7 +42,9 @@ class AffiliateTracker {
         }
     }
 
-    async trackConversion(amount) {
+    // eventId should match the event_id sent with the browser pixel's
+    // event so Facebook counts the conversion once
+    async trackConversion(amount, eventId) {
         const visitorId = localStorage.getItem('visitor_id');
         
         try {
@@ -44,7 +57,8 @@ class AffiliateTracker {
                     visitor_id: visitorId,
                     click_id: this.clickId,
                     campaign_id: this.campaignId,
-                    amount: amount
+                    amount: amount,
+                    event_id: eventId || ''
                 })
             });
         } catch (error) {
@@ -0,0 +1,44 @@
+package api
+
+import (
+	"log"
+	"net"
+
+	"unchained-tracker/internal/bots"
+	"unchained-tracker/internal/db"
+	"unchained-tracker/internal/geo"
+)
+
+// botPolicy is the campaign's bot policy; unknown campaigns flag bots
+func botPolicy(campaign *db.Campaign) string {
+	if campaign == nil || campaign.BotPolicy == "" {
+		return db.BotPolicyFlag
+	}
+	return campaign.BotPolicy
+}
+
+// checkBot runs the detector unless the policy is off. signals gets the
+// address and its network filled in from loc.
+func (s *Server) checkBot(policy string, signals bots.Signals, ip string, loc *geo.Location) bots.Verdict {
+	if policy == db.BotPolicyOff || s.bots == nil {
+		return bots.Verdict{}
+	}
+	signals.IP = net.ParseIP(ip)
+	if loc != nil {
+		signals.ASN = loc.ASN
+		signals.IPTimezone = loc.TimeZone
+	}
+	return s.bots.Check(signals)
+}
+
+// lookup geolocates an address, logging rather than failing
+func (s *Server) lookup(ip string) *geo.Location {
+	if s.geo == nil {
+		return nil
+	}
+	loc, err := s.geo.Lookup(ip)
+	if err != nil {
+		log.Printf("Error getting location: %v", err)
+	}
+	return loc
+}
@@ -0,0 +1,88 @@
+package api
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"unchained-tracker/internal/db"
+)
+
+func TestBotPolicies(t *testing.T) {
+	server, database := newTestServer(t)
+
+	botClick := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/click?rtkck=1234567890", nil)
+		req.RemoteAddr = "127.0.0.1:5555"
+		req.Header.Set("User-Agent", "curl/8.4.0")
+		w := httptest.NewRecorder()
+		server.HandleClick(w, req)
+		return w
+	}
+	clickIDOf := func(w *httptest.ResponseRecorder) string {
+		location, _ := url.Parse(w.Header().Get("Location"))
+		return location.Query().Get("clickid")
+	}
+	visit := func(body string) {
+		req := httptest.NewRequest("POST", "/track", bytes.NewBufferString(body))
+		req.RemoteAddr = "127.0.0.1:1234"
+		w := httptest.NewRecorder()
+		server.HandleVisit(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("visit: status %d", w.Code)
+		}
+	}
+
+	// Campaigns flag bots by default: recorded, but reported apart
+	doClick(server, "/click?rtkck=1234567890")
+	click, err := database.GetClickByID(clickIDOf(botClick()))
+	if err != nil || !click.IsBot || click.BotReason != "user_agent,no_accept_language,no_accept" {
+		t.Errorf("flagged click = %+v, %v", click, err)
+	}
+	visit(`{"campaign_id": "test-campaign", "click_id": "v1", "user_agent": "` + browserUA + `", "screen_resolution": "1280x720", "webdriver": true}`)
+	visit(`{"campaign_id": "test-campaign", "click_id": "v2", "user_agent": "` + browserUA + `", "screen_resolution": "1280x720"}`)
+
+	report, err := database.RunReport(db.ReportQuery{From: time.Now().Add(-time.Hour), To: time.Now().Add(time.Hour)})
+	if err != nil {
+		t.Fatalf("RunReport: %v", err)
+	}
+	if totals := report.Totals; totals.Clicks != 1 || totals.BotClicks != 1 || totals.Visits != 1 || totals.BotVisits != 1 {
+		t.Errorf("totals = %+v", totals)
+	}
+
+	// Dropped bots still get where they were going
+	campaign, _ := database.GetCampaignByID("test-campaign")
+	campaign.BotPolicy = db.BotPolicyDrop
+	if err := database.UpdateCampaign(campaign); err != nil {
+		t.Fatalf("UpdateCampaign: %v", err)
+	}
+	w := botClick()
+	if w.Code != http.StatusFound {
+		t.Errorf("dropped click: status %d", w.Code)
+	}
+	if _, err := database.GetClickByID(clickIDOf(w)); err == nil {
+		t.Error("dropped click was saved")
+	}
+	visit(`{"campaign_id": "test-campaign", "click_id": "v3", "user_agent": "HeadlessChrome/124.0", "screen_resolution": "1280x720"}`)
+	if _, err := database.GetVisitorIDByClickID("v3"); err == nil {
+		t.Error("dropped visit was saved")
+	}
+
+	// With detection off, bots are people
+	campaign.BotPolicy = db.BotPolicyOff
+	if err := database.UpdateCampaign(campaign); err != nil {
+		t.Fatalf("UpdateCampaign: %v", err)
+	}
+	click, err = database.GetClickByID(clickIDOf(botClick()))
+	if err != nil || click.IsBot {
+		t.Errorf("click without detection = %+v, %v", click, err)
+	}
+
+	campaign.BotPolicy = "block"
+	if err := database.UpdateCampaign(campaign); err == nil {
+		t.Error("no error for an unknown bot policy")
+	}
+}
@@ -23,6 +23,11 @@ type CampaignRequest struct {
     LandingPage   string `json:"landing_page"`
     TrafficSource string `json:"traffic_source"`
     OfferURL      string `json:"offer_url"`
+    Offers        []db.CampaignOffer `json:"offers"`
+    CustomParams  db.CustomParams `json:"custom_params"`
+    CostModel     string `json:"cost_model"`
+    DefaultBid    float64 `json:"default_bid"`
+    BotPolicy     string `json:"bot_policy"`
 }
 
 type CampaignResponse struct {
@@ -32,11 +37,18 @@ type CampaignResponse struct {
     CampaignToken string    `json:"campaign_token"`
     LandingPage   string    `json:"landing_page"`
     TrafficSource string    `json:"traffic_source"`
+    CostModel     string    `json:"cost_model"`
+    DefaultBid    float64   `json:"default_bid"`
+    BotPolicy     string    `json:"bot_policy"`
     CreatedAt     time.Time `json:"created_at"`
     Stats         struct {
         Visits      int64   `json:"visits"`
+        Clicks      int64   `json:"clicks"`
+        BotVisits   int64   `json:"bot_visits"`
+        BotClicks   int64   `json:"bot_clicks"`
         Conversions int64   `json:"conversions"`
         Revenue     float64 `json:"revenue"`
+        db.Metrics
     } `json:"stats"`
 }
 
@@ -47,6 +59,8 @@ func (s *Server) HandleCampaigns(w http.ResponseWriter, r *http.Request) {
     case http.MethodPost:
         log.Printf("Received campaign creation request")
         s.createCampaign(w, r)
+    case http.MethodPut:
+        s.updateCampaign(w, r)
     default:
         http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
     }
@@ -65,6 +79,14 @@ func (s *Server) createCampaign(w http.ResponseWriter, r *http.Request) {
         http.Error(w, "Missing required fields", http.StatusBadRequest)
         return
     }
+    if !db.ValidCostModel(req.CostModel) || req.DefaultBid < 0 {
+        http.Error(w, "Invalid cost model or default bid", http.StatusBadRequest)
+        return
+    }
+    if !db.ValidBotPolicy(req.BotPolicy) {
+        http.Error(w, "Invalid bot policy", http.StatusBadRequest)
+        return
+    }
 
     // Generate unique campaign ID
     campaignID := uuid.New().String()
@@ -75,6 +97,10 @@ func (s *Server) createCampaign(w http.ResponseWriter, r *http.Request) {
         OfferURL:      req.OfferURL,
         LandingPage:   req.LandingPage,
         TrafficSource: req.TrafficSource,
+        CustomParams:  req.CustomParams,
+        CostModel:     req.CostModel,
+        DefaultBid:    req.DefaultBid,
+        BotPolicy:     req.BotPolicy,
         CreatedAt:     time.Now(),
     }
 
@@ -91,6 +117,14 @@ func (s *Server) createCampaign(w http.ResponseWriter, r *http.Request) {
         return
     }
 
+    if len(req.Offers) > 0 {
+        if err := s.db.SetCampaignOffers(campaignID, req.Offers); err != nil {
+            log.Printf("Error saving campaign offers: %v", err)
+            http.Error(w, "Error saving campaign offers", http.StatusBadRequest)
+            return
+        }
+    }
+
     log.Printf("Campaign created successfully: %+v", campaign)
 
     w.Header().Set("Content-Type", "application/json")
@@ -101,9 +135,65 @@ func (s *Server) createCampaign(w http.ResponseWriter, r *http.Request) {
     })
 }
 
+// updateCampaign applies the fields present in the request body, including
+// the offer rotation, to the campaign named by ?id=
+func (s *Server) updateCampaign(w http.ResponseWriter, r *http.Request) {
+    campaignID := r.URL.Query().Get("id")
+    if campaignID == "" {
+        http.Error(w, "Missing campaign ID", http.StatusBadRequest)
+        return
+    }
+
+    campaign, err := s.db.GetCampaignByID(campaignID)
+    if err != nil {
+        http.Error(w, "Campaign not found", http.StatusNotFound)
+        return
+    }
+
+    if err := json.NewDecoder(r.Body).Decode(campaign); err != nil {
+        http.Error(w, "Invalid request body", http.StatusBadRequest)
+        return
+    }
+    // Identity fields are not editable
+    campaign.CampaignID = campaignID
+
+    if err := s.db.UpdateCampaign(campaign); err != nil {
+        log.Printf("Error updating campaign: %v", err)
+        http.Error(w, err.Error(), http.StatusBadRequest)
+        return
+    }
+    // An offers list, even an empty one, replaces the rotation
+    if campaign.Offers != nil {
+        if err := s.db.SetCampaignOffers(campaignID, campaign.Offers); err != nil {
+            log.Printf("Error saving campaign offers: %v", err)
+            http.Error(w, "Error saving campaign offers", http.StatusBadRequest)
+            return
+        }
+    }
+
+    updated, err := s.db.GetCampaignByID(campaignID)
+    if err != nil {
+        http.Error(w, "Error loading campaign", http.StatusInternalServerError)
+        return
+    }
+    updated.Offers, err = s.db.GetCampaignOffers(campaignID)
+    if err != nil {
+        http.Error(w, "Error loading campaign offers", http.StatusInternalServerError)
+        return
+    }
+
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(updated)
+}
+
 func (s *Server) listCampaigns(w http.ResponseWriter, r *http.Request) {
     log.Printf("Fetching campaign list")
-    stats, err := s.db.GetCampaignStats()
+    statsRange, _, err := s.statsRange(r)
+    if err != nil {
+        http.Error(w, err.Error(), http.StatusBadRequest)
+        return
+    }
+    stats, err := s.db.GetCampaignStats(statsRange)
     if err != nil {
         log.Printf("Error getting campaign stats: %+v", err)
         http.Error(w, "Error fetching campaigns", http.StatusInternalServerError)
@@ -129,11 +219,18 @@ func (s *Server) listCampaigns(w http.ResponseWriter, r *http.Request) {
             CampaignToken: stat.CampaignToken,
             LandingPage:   stat.LandingPage,
             TrafficSource: stat.TrafficSource,
+            CostModel:     stat.CostModel,
+            DefaultBid:    stat.DefaultBid,
+            BotPolicy:     stat.BotPolicy,
             CreatedAt:     stat.CreatedAt,
         }
         resp.Stats.Visits = stat.Visits
+        resp.Stats.Clicks = stat.Clicks
+        resp.Stats.BotVisits = stat.BotVisits
+        resp.Stats.BotClicks = stat.BotClicks
         resp.Stats.Conversions = stat.Conversions
         resp.Stats.Revenue = stat.Revenue
+        resp.Stats.Metrics = stat.Metrics
         response = append(response, resp)
     }
 
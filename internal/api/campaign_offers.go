@@ -0,0 +1,94 @@
+package api
+
+import (
+    "encoding/json"
+    "log"
+    "net/http"
+    "unchained-tracker/internal/db"
+)
+
+type CampaignOffersRequest struct {
+    CampaignID string             `json:"campaign_id"`
+    Offers     []db.CampaignOffer `json:"offers"`
+}
+
+// HandleCampaignOffers manages a campaign's weighted offer rotation.
+// GET returns the rotation with per-offer stats, PUT replaces it.
+func (s *Server) HandleCampaignOffers(w http.ResponseWriter, r *http.Request) {
+    switch r.Method {
+    case http.MethodGet:
+        s.getCampaignOffers(w, r)
+    case http.MethodPut:
+        s.setCampaignOffers(w, r)
+    default:
+        http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+    }
+}
+
+func (s *Server) getCampaignOffers(w http.ResponseWriter, r *http.Request) {
+    campaignID := r.URL.Query().Get("campaign_id")
+    if campaignID == "" {
+        http.Error(w, "Missing campaign_id", http.StatusBadRequest)
+        return
+    }
+
+    offers, err := s.db.GetCampaignOffers(campaignID)
+    if err != nil {
+        log.Printf("Error getting campaign offers: %v", err)
+        http.Error(w, "Error getting campaign offers", http.StatusInternalServerError)
+        return
+    }
+
+    statsRange, _, err := s.statsRange(r)
+    if err != nil {
+        http.Error(w, err.Error(), http.StatusBadRequest)
+        return
+    }
+
+    stats, err := s.db.GetOfferStats(campaignID, statsRange)
+    if err != nil {
+        log.Printf("Error getting offer stats: %v", err)
+        http.Error(w, "Error getting offer stats", http.StatusInternalServerError)
+        return
+    }
+
+    if offers == nil {
+        offers = []db.CampaignOffer{}
+    }
+    if stats == nil {
+        stats = []db.OfferStats{}
+    }
+
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(map[string]interface{}{
+        "campaign_id": campaignID,
+        "offers":      offers,
+        "stats":       stats,
+    })
+}
+
+func (s *Server) setCampaignOffers(w http.ResponseWriter, r *http.Request) {
+    var req CampaignOffersRequest
+    if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+        http.Error(w, "Invalid request body", http.StatusBadRequest)
+        return
+    }
+
+    if req.CampaignID == "" {
+        http.Error(w, "Missing campaign_id", http.StatusBadRequest)
+        return
+    }
+
+    if err := s.db.SetCampaignOffers(req.CampaignID, req.Offers); err != nil {
+        log.Printf("Error saving campaign offers: %v", err)
+        http.Error(w, err.Error(), http.StatusBadRequest)
+        return
+    }
+
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(map[string]interface{}{
+        "status":      "success",
+        "campaign_id": req.CampaignID,
+        "offers":      req.Offers,
+    })
+}
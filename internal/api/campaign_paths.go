@@ -0,0 +1,118 @@
+package api
+
+import (
+    "database/sql"
+    "encoding/json"
+    "log"
+    "net/http"
+    "strconv"
+    "unchained-tracker/internal/db"
+    "unchained-tracker/internal/routing"
+)
+
+// HandleCampaignPaths manages a campaign's routing paths. GET lists them,
+// POST creates or (with an id) updates one, DELETE removes one by id.
+func (s *Server) HandleCampaignPaths(w http.ResponseWriter, r *http.Request) {
+    switch r.Method {
+    case http.MethodGet:
+        s.listCampaignPaths(w, r)
+    case http.MethodPost:
+        s.saveCampaignPath(w, r)
+    case http.MethodDelete:
+        s.deleteCampaignPath(w, r)
+    default:
+        http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+    }
+}
+
+func (s *Server) listCampaignPaths(w http.ResponseWriter, r *http.Request) {
+    campaignID := r.URL.Query().Get("campaign_id")
+    if campaignID == "" {
+        http.Error(w, "Missing campaign_id", http.StatusBadRequest)
+        return
+    }
+
+    paths, err := s.db.GetCampaignPaths(campaignID)
+    if err != nil {
+        log.Printf("Error getting campaign paths: %v", err)
+        http.Error(w, "Error getting campaign paths", http.StatusInternalServerError)
+        return
+    }
+    if paths == nil {
+        paths = []db.CampaignPath{}
+    }
+
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(paths)
+}
+
+func (s *Server) saveCampaignPath(w http.ResponseWriter, r *http.Request) {
+    var path db.CampaignPath
+    if err := json.NewDecoder(r.Body).Decode(&path); err != nil {
+        http.Error(w, "Invalid request body", http.StatusBadRequest)
+        return
+    }
+
+    if path.CampaignID == "" || path.Name == "" {
+        http.Error(w, "campaign_id and name are required", http.StatusBadRequest)
+        return
+    }
+    if msg := validatePathConditions(path.Conditions); msg != "" {
+        http.Error(w, msg, http.StatusBadRequest)
+        return
+    }
+
+    if err := s.db.SaveCampaignPath(&path); err != nil {
+        if err == sql.ErrNoRows {
+            http.Error(w, "Path not found", http.StatusNotFound)
+            return
+        }
+        log.Printf("Error saving campaign path: %v", err)
+        http.Error(w, err.Error(), http.StatusBadRequest)
+        return
+    }
+
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(path)
+}
+
+func (s *Server) deleteCampaignPath(w http.ResponseWriter, r *http.Request) {
+    id, err := strconv.ParseInt(r.URL.Query().Get("id"), 10, 64)
+    if err != nil {
+        http.Error(w, "Invalid ID", http.StatusBadRequest)
+        return
+    }
+
+    if err := s.db.DeleteCampaignPath(id); err != nil {
+        http.Error(w, err.Error(), http.StatusInternalServerError)
+        return
+    }
+
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(map[string]string{
+        "status": "success",
+    })
+}
+
+// validatePathConditions returns a message describing the first invalid
+// condition, or "" when they are all usable.
+func validatePathConditions(conditions []db.PathCondition) string {
+    for _, c := range conditions {
+        switch c.Field {
+        case routing.FieldCountry, routing.FieldDeviceType, routing.FieldOS,
+            routing.FieldBrowser, routing.FieldLanguage, routing.FieldReferrer,
+            routing.FieldHour:
+        default:
+            return "Unknown condition field: " + c.Field
+        }
+        switch c.Operator {
+        case "", routing.OperatorIs, routing.OperatorIsNot:
+        default:
+            return "Unknown condition operator: " + c.Operator
+        }
+        if len(c.Values) == 0 {
+            return "Condition on " + c.Field + " has no values"
+        }
+    }
+    return ""
+}
@@ -1,12 +1,20 @@
 package api
 
 import (
+	"math"
 	"net/http"
 	"net/url"
 	"crypto/rand"
 	"time"
 	"fmt"
+	"strconv"
+	"github.com/google/uuid"
+	"unchained-tracker/internal/bots"
 	"unchained-tracker/internal/db"
+	"unchained-tracker/internal/events"
+	"unchained-tracker/internal/macro"
+	"unchained-tracker/internal/routing"
+	"unchained-tracker/internal/useragent"
 	"log"
 	"strings"
 )
@@ -19,78 +27,312 @@ func generateClickID() string {
 	return fmt.Sprintf("%x%x", timestamp, random)
 }
 
+const visitorCookie = "visitor_id"
+
+// getVisitorID reuses the visitor cookie when it holds a valid ID
 func getVisitorID(r *http.Request) string {
-	// First try to get from cookie
-	if cookie, err := r.Cookie("visitor_id"); err == nil {
-		return cookie.Value
+	if cookie, err := r.Cookie(visitorCookie); err == nil {
+		if id, err := uuid.Parse(cookie.Value); err == nil {
+			return id.String()
+		}
 	}
-
-	// If no cookie, generate new ID
-	random := make([]byte, 16)
-	rand.Read(random)
-	return fmt.Sprintf("%x", random)
+	return uuid.New().String()
 }
 
-func getIPAddress(r *http.Request) string {
-	// Check X-Forwarded-For header
-	forwarded := r.Header.Get("X-Forwarded-For")
-	if forwarded != "" {
-		return strings.Split(forwarded, ",")[0]
-	}
-	// Fall back to RemoteAddr
-	return strings.Split(r.RemoteAddr, ":")[0]
+// clientIP is the visitor's address, behind the trusted proxies
+func (s *Server) clientIP(r *http.Request) string {
+	return s.clientIPs.IP(r)
 }
 
+// HandleClick records a click on a campaign link (/click?rtkck=<token>),
+// sets the visitor cookie and redirects to the lander or offer.
 func (s *Server) HandleClick(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	campaignToken := r.URL.Query().Get("rtkck")
+	if campaignToken == "" {
+		http.Error(w, "Missing campaign token", http.StatusBadRequest)
+		return
+	}
+
 	// Get click parameters
 	clickID := generateClickID()
 	visitorID := getVisitorID(r)
-	campaignToken := r.URL.Query().Get("rtkck")
 
 	// Validate campaign token
 	campaign, err := s.db.GetCampaignByToken(campaignToken)
 	if err != nil {
-		http.Error(w, "Invalid campaign", http.StatusBadRequest)
+		log.Printf("Error finding campaign with token %s: %v", campaignToken, err)
+		http.Error(w, "Invalid campaign token", http.StatusBadRequest)
 		return
 	}
 
+	// Route the click through the campaign's paths, then pick an offer from
+	// the resulting rotation, falling back to the campaign's offer URL
+	agent := s.parseAgent(r, r.UserAgent())
+	visitor := clickVisitor(r, agent, s.workspaceLocation())
+	route := s.routeClick(r, campaign, &visitor)
+	offerURL := campaign.OfferURL
+	var offerID int64
+	if offer := pickOffer(route.Offers); offer != nil {
+		offerURL = offer.OfferURL
+		offerID = offer.OfferID
+	}
+
 	// Record click
 	click := &db.Click{
-		ClickID:       clickID,
-		VisitorID:     visitorID,
-		CampaignToken: campaignToken,
-		CampaignID:    campaign.CampaignID,
-		IPAddress:     getIPAddress(r),
-		UserAgent:     r.UserAgent(),
-		Referrer:      r.Referer(),
+		ClickID:        clickID,
+		VisitorID:      visitorID,
+		CampaignToken:  campaignToken,
+		CampaignID:     campaign.CampaignID,
+		OfferID:        offerID,
+		PathID:         route.PathID,
+		LandingPageID:  route.LandingPageID,
+		ExternalID:     truncate(r.URL.Query().Get(s.externalIDParam(campaign)), 255),
+		IPAddress:      s.clientIP(r),
+		UserAgent:      r.UserAgent(),
+		DeviceType:     agent.DeviceType,
+		OS:             agent.OS,
+		Browser:        agent.Browser,
+		BrowserVersion: agent.BrowserVersion,
+		Referrer:       r.Referer(),
+		Subs:           captureSubs(r.URL.Query(), campaign.CustomParams),
 	}
+	click.FBC, click.FBP = facebookIDs(r, r.URL.Query())
+	click.TTCLID = truncate(r.URL.Query().Get("ttclid"), 255)
+	click.GCLID = truncate(r.URL.Query().Get("gclid"), 255)
+	click.Cost = clickCost(r.URL.Query().Get("cost"), campaign)
+
+	policy := botPolicy(campaign)
+	verdict := s.checkBot(policy, bots.Signals{UserAgent: r.UserAgent(), Header: r.Header}, click.IPAddress, s.lookup(click.IPAddress))
+	click.IsBot, click.BotReason = verdict.Bot, verdict.Reason()
+	s.scoreClick(click)
 	
-	if err := s.db.SaveClick(click); err != nil {
+	// Send the visitor to the path's landing page if it has one, otherwise
+	// straight to the offer
+	destination := offerURL
+	if route.LandingPageURL != "" {
+		destination = route.LandingPageURL
+	}
+	if macro.Has(destination, "country") {
+		s.resolveCountry(r, &visitor)
+	}
+	values := clickMacros(r, campaign, click, visitor)
+
+	var redirectURL string
+	if route.LandingPageURL != "" {
+		redirectURL, err = buildLandingPageURL(route.LandingPageURL, click, values)
+	} else {
+		redirectURL, err = buildNetworkURL(offerURL, click, values)
+	}
+	if err != nil {
+		log.Printf("Error building redirect for campaign %s: %v", campaign.CampaignID, err)
+		http.Error(w, "Campaign has no valid destination", http.StatusInternalServerError)
+		return
+	}
+
+	if click.IsBot && policy == db.BotPolicyDrop {
+		// Bots still follow the link, they just aren't recorded
+		log.Printf("Dropped bot click on campaign %s (%s)", campaign.CampaignID, click.BotReason)
+	} else if err := s.db.SaveClick(click); err != nil {
 		log.Printf("Error saving click: %v", err)
 		// Continue anyway to not disrupt user experience
+	} else {
+		s.publish(events.TypeClick, click.CampaignID, click)
 	}
 
+	requestClientHints(w)
+
 	// Set visitor cookie
 	http.SetCookie(w, &http.Cookie{
-		Name:     "visitor_id",
+		Name:     visitorCookie,
 		Value:    visitorID,
 		MaxAge:   86400 * 30,  // 30 days
 		Path:     "/",
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
 	})
 
-	// Build redirect URL with parameters
-	redirectURL := buildNetworkURL(campaign.OfferURL, click)
-
 	// Perform redirect
 	http.Redirect(w, r, redirectURL, http.StatusFound)
 }
 
-func buildNetworkURL(baseURL string, click *db.Click) string {
-	u, _ := url.Parse(baseURL)
+// clickCost is the cost the traffic source passed with the click as
+// cost={cost}, else what the campaign's cost model charges per click
+func clickCost(passed string, campaign *db.Campaign) float64 {
+	if passed != "" {
+		if cost, err := strconv.ParseFloat(passed, 64); err == nil && cost >= 0 && !math.IsInf(cost, 0) {
+			return cost
+		}
+	}
+	return campaign.ClickCost()
+}
+
+// externalIDParam is the /click parameter carrying the traffic source's own
+// click ID: the one its traffic source names, or external_id
+func (s *Server) externalIDParam(campaign *db.Campaign) string {
+	if campaign.TrafficSource != "" {
+		source, err := s.db.GetTrafficSourceByName(campaign.TrafficSource)
+		if err == nil && source.ClickIDParam != "" {
+			return source.ClickIDParam
+		}
+	}
+	return "external_id"
+}
+
+// clickRoute is where the routing paths sent a click
+type clickRoute struct {
+	PathID         int64
+	LandingPageID  int64
+	LandingPageURL string
+	Offers         []db.CampaignOffer
+}
+
+// routeClick evaluates the campaign's paths against the request. Campaigns
+// without paths, or clicks no path matches, use the campaign's own rotation.
+func (s *Server) routeClick(r *http.Request, campaign *db.Campaign, visitor *routing.Visitor) clickRoute {
+	var route clickRoute
+
+	paths, err := s.db.GetCampaignPaths(campaign.CampaignID)
+	if err != nil {
+		log.Printf("Error loading paths for campaign %s: %v", campaign.CampaignID, err)
+	}
+
+	if len(paths) > 0 {
+		s.resolveCountry(r, visitor)
+		if path := routing.SelectPath(paths, *visitor); path != nil {
+			log.Printf("Click routed to path %d (%s)", path.ID, path.Name)
+			route.PathID = path.ID
+			route.LandingPageID = path.LandingPageID
+			route.LandingPageURL = path.LandingPageURL
+			route.Offers = path.Offers
+			if len(route.Offers) > 0 {
+				return route
+			}
+		}
+	}
+
+	route.Offers, err = s.db.GetCampaignOffers(campaign.CampaignID)
+	if err != nil {
+		log.Printf("Error loading offers for campaign %s: %v", campaign.CampaignID, err)
+	}
+	return route
+}
+
+// clickVisitor collects the click attributes known without a geo lookup.
+// Hour conditions see the time in loc, the workspace's report timezone, so
+// a path fires at the hours it is reported under.
+func clickVisitor(r *http.Request, agent useragent.Agent, loc *time.Location) routing.Visitor {
+	visitor := routing.Visitor{
+		Language:       r.Header.Get("Accept-Language"),
+		ReferrerDomain: routing.ReferrerDomain(r.Referer()),
+		Time:           time.Now().In(loc),
+	}
+	visitor.DeviceType, visitor.OS, visitor.Browser = agent.DeviceType, agent.OS, agent.Browser
+	return visitor
+}
+
+// resolveCountry geolocates the click once, on demand
+func (s *Server) resolveCountry(r *http.Request, visitor *routing.Visitor) {
+	if visitor.Country != "" || s.geo == nil {
+		return
+	}
+	country, _, _, err := s.geo.GetLocation(s.clientIP(r))
+	if err != nil {
+		log.Printf("Error getting location: %v", err)
+	}
+	visitor.Country = country
+}
+
+// clickMacros returns the values offer and lander URL templates can use,
+// e.g. https://network.example/?aff=12&s1={clickid}&s2={sub1}
+func clickMacros(r *http.Request, campaign *db.Campaign, click *db.Click, visitor routing.Visitor) map[string]string {
+	query := r.URL.Query()
+	values := map[string]string{
+		"clickid":      click.ClickID,
+		"click_id":     click.ClickID,
+		"visitor_id":   click.VisitorID,
+		"campaign_id":  click.CampaignID,
+		"offer_id":     formatID(click.OfferID),
+		"lander_id":    formatID(click.LandingPageID),
+		"external_id":  click.ExternalID,
+		"cost":         strconv.FormatFloat(click.Cost, 'f', -1, 64),
+		"country":      visitor.Country,
+		"device":       visitor.DeviceType,
+		"os":           visitor.OS,
+		"browser":      visitor.Browser,
+		"utm_source":   query.Get("utm_source"),
+		"utm_medium":   query.Get("utm_medium"),
+		"utm_campaign": query.Get("utm_campaign"),
+		"utm_content":  query.Get("utm_content"),
+		"utm_term":     query.Get("utm_term"),
+	}
+	// Captured custom parameters are available both as {subN} and by their
+	// declared name, e.g. {zoneid}
+	for i, value := range click.Subs {
+		values[fmt.Sprintf("sub%d", i+1)] = value
+		if _, taken := values[strings.ToLower(campaign.CustomParams.Param(i))]; !taken {
+			values[strings.ToLower(campaign.CustomParams.Param(i))] = value
+		}
+	}
+	return values
+}
+
+func formatID(id int64) string {
+	if id == 0 {
+		return ""
+	}
+	return strconv.FormatInt(id, 10)
+}
+
+// buildLandingPageURL expands the lander's macros and passes the click ID,
+// which track.js picks up from the click_id parameter.
+func buildLandingPageURL(baseURL string, click *db.Click, values map[string]string) (string, error) {
+	u, err := parseDestination(macro.Expand(baseURL, values))
+	if err != nil {
+		return "", err
+	}
+	q := u.Query()
+	q.Set("click_id", click.ClickID)
+	u.RawQuery = q.Encode()
+	return u.String(), nil
+}
+
+// buildNetworkURL expands the macros in an offer URL template. Offer URLs
+// without any known macro get the click ID and campaign appended as clickid and
+// source, which is what offers set up before macros expect.
+func buildNetworkURL(baseURL string, click *db.Click, values map[string]string) (string, error) {
+	if macro.HasAny(baseURL, values) {
+		expanded := macro.Expand(baseURL, values)
+		if _, err := parseDestination(expanded); err != nil {
+			return "", err
+		}
+		return expanded, nil
+	}
+
+	u, err := parseDestination(baseURL)
+	if err != nil {
+		return "", err
+	}
 	q := u.Query()
 	q.Set("clickid", click.ClickID)
-	q.Set("aff_id", "YOUR_AFF_ID") // From config
 	q.Set("source", click.CampaignID)
 	u.RawQuery = q.Encode()
-	return u.String()
+	return u.String(), nil
+}
+
+// parseDestination only accepts absolute http(s) URLs, anything else would
+// turn into a redirect relative to the tracker.
+func parseDestination(rawURL string) (*url.URL, error) {
+	u, err := url.Parse(strings.TrimSpace(rawURL))
+	if err != nil {
+		return nil, err
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("not an absolute http(s) URL: %q", rawURL)
+	}
+	return u, nil
 } 
\ No newline at end of file
@@ -0,0 +1,271 @@
+package api
+
+import (
+    "bytes"
+    "net"
+    "net/http"
+    "net/http/httptest"
+    "net/url"
+    "strconv"
+    "testing"
+    "time"
+    "unchained-tracker/internal/clientip"
+    "unchained-tracker/internal/db"
+    "unchained-tracker/internal/routing"
+)
+
+// browserUA is a person's browser, which bot detection lets through
+const browserUA = "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/124.0 Safari/537.36"
+
+func doClick(server *Server, target string, cookies ...*http.Cookie) *httptest.ResponseRecorder {
+    req := httptest.NewRequest("GET", target, nil)
+    req.RemoteAddr = "127.0.0.1:5555"
+    req.Header.Set("User-Agent", browserUA)
+    req.Header.Set("Accept", "text/html")
+    req.Header.Set("Accept-Language", "en-US")
+    for _, c := range cookies {
+        req.AddCookie(c)
+    }
+    w := httptest.NewRecorder()
+    server.HandleClick(w, req)
+    return w
+}
+
+func visitorCookieFrom(t *testing.T, w *httptest.ResponseRecorder) *http.Cookie {
+    t.Helper()
+    for _, c := range w.Result().Cookies() {
+        if c.Name == visitorCookie {
+            return c
+        }
+    }
+    t.Fatalf("visitor cookie not set")
+    return nil
+}
+
+func TestClickRedirectsToOffer(t *testing.T) {
+    server, store := newTestServer(t)
+
+    w := doClick(server, "/click?rtkck=1234567890")
+    if w.Code != http.StatusFound {
+        t.Fatalf("Expected 302, got %d: %s", w.Code, w.Body.String())
+    }
+
+    location, err := url.Parse(w.Header().Get("Location"))
+    if err != nil {
+        t.Fatalf("Invalid redirect: %v", err)
+    }
+    if location.Host != "localhost:8080" || location.Path != "/test-offer" {
+        t.Errorf("Unexpected redirect target: %s", location)
+    }
+    clickID := location.Query().Get("clickid")
+    if location.Query().Get("source") != "test-campaign" || clickID == "" {
+        t.Errorf("Missing click parameters in redirect: %s", location)
+    }
+
+    click, err := store.GetClickByID(clickID)
+    if err != nil {
+        t.Fatalf("Click not saved: %v", err)
+    }
+    if click.CampaignID != "test-campaign" || click.IPAddress != "127.0.0.1" {
+        t.Errorf("Unexpected click row: %+v", click)
+    }
+    if cookie := visitorCookieFrom(t, w); cookie.Value != click.VisitorID || !cookie.HttpOnly {
+        t.Errorf("Cookie %+v does not match click visitor %s", cookie, click.VisitorID)
+    }
+}
+
+func TestClickReusesVisitorCookie(t *testing.T) {
+    server, store := newTestServer(t)
+
+    first := visitorCookieFrom(t, doClick(server, "/click?rtkck=1234567890"))
+    w := doClick(server, "/click?rtkck=1234567890", first)
+
+    location, _ := url.Parse(w.Header().Get("Location"))
+    click, err := store.GetClickByID(location.Query().Get("clickid"))
+    if err != nil {
+        t.Fatalf("Click not saved: %v", err)
+    }
+    if click.VisitorID != first.Value {
+        t.Errorf("Expected visitor %s to be reused, got %s", first.Value, click.VisitorID)
+    }
+
+    // A tampered cookie gets replaced rather than stored
+    w = doClick(server, "/click?rtkck=1234567890", &http.Cookie{Name: visitorCookie, Value: "<script>"})
+    if visitorCookieFrom(t, w).Value == "<script>" {
+        t.Errorf("Invalid visitor cookie was reused")
+    }
+}
+
+func TestClickRejectsBadTokens(t *testing.T) {
+    server, _ := newTestServer(t)
+
+    if w := doClick(server, "/click"); w.Code != http.StatusBadRequest {
+        t.Errorf("Missing token: expected 400, got %d", w.Code)
+    }
+    if w := doClick(server, "/click?rtkck=0000000000"); w.Code != http.StatusBadRequest {
+        t.Errorf("Unknown token: expected 400, got %d", w.Code)
+    }
+}
+
+func TestClickEncodesOfferURL(t *testing.T) {
+    server, store := newTestServer(t)
+
+    offer := &db.Offer{Name: "Encoded", Network: "net", OfferURL: "https://offer.example/go?aff=7&note=a%20b&tpl={x}"}
+    if err := store.SaveOffer(offer); err != nil {
+        t.Fatalf("SaveOffer: %v", err)
+    }
+    if err := store.SetCampaignOffers("test-campaign", []db.CampaignOffer{{OfferID: offer.ID, Weight: 1}}); err != nil {
+        t.Fatalf("SetCampaignOffers: %v", err)
+    }
+
+    w := doClick(server, "/click?rtkck=1234567890")
+    location, err := url.Parse(w.Header().Get("Location"))
+    if err != nil {
+        t.Fatalf("Invalid redirect: %v", err)
+    }
+    q := location.Query()
+    if location.Host != "offer.example" || q.Get("aff") != "7" || q.Get("note") != "a b" || q.Get("tpl") != "{x}" || q.Get("clickid") == "" {
+        t.Errorf("Offer URL not preserved: %s", location)
+    }
+
+    click, err := store.GetClickByID(q.Get("clickid"))
+    if err != nil || click.OfferID != offer.ID {
+        t.Errorf("Expected offer %d on click, got %+v (%v)", offer.ID, click, err)
+    }
+}
+
+func TestClientIP(t *testing.T) {
+    server, database := newTestServer(t)
+    server.clientIPs = clientip.New([]*net.IPNet{{IP: net.IPv4(10, 0, 0, 0), Mask: net.CIDRMask(8, 32)}}, nil)
+
+    tests := []struct {
+        remoteAddr string
+        forwarded  string
+        want       string
+    }{
+        {"203.0.113.7:4000", "", "203.0.113.7"},
+        {"[2001:db8::1]:4000", "", "2001:db8::1"},
+        {"10.0.0.1:80", "198.51.100.2, 10.0.0.1", "198.51.100.2"},
+        {"10.0.0.1:80", "2001:db8::2", "2001:db8::2"},
+        // Only trusted proxies are believed
+        {"203.0.113.7:4000", "198.51.100.2", "203.0.113.7"},
+    }
+    for _, tt := range tests {
+        req := httptest.NewRequest("GET", "/click", nil)
+        req.RemoteAddr = tt.remoteAddr
+        if tt.forwarded != "" {
+            req.Header.Set("X-Forwarded-For", tt.forwarded)
+        }
+        if got := server.clientIP(req); got != tt.want {
+            t.Errorf("clientIP(%s, %q) = %s, want %s", tt.remoteAddr, tt.forwarded, got, tt.want)
+        }
+    }
+
+    // Visits store the client's address, without the port
+    req := httptest.NewRequest("POST", "/track", bytes.NewBufferString(`{"campaign_id": "test-campaign", "click_id": "ip1"}`))
+    req.RemoteAddr = "10.0.0.1:80"
+    req.Header.Set("X-Forwarded-For", "127.0.0.1")
+    server.HandleVisit(httptest.NewRecorder(), req)
+    var ip string
+    if err := database.QueryRow("SELECT ip_address FROM visit WHERE click_id = 'ip1'").Scan(&ip); err != nil || ip != "127.0.0.1" {
+        t.Errorf("visit ip_address = %q, %v", ip, err)
+    }
+}
+
+func TestClickExpandsOfferMacros(t *testing.T) {
+    server, store := newTestServer(t)
+
+    offer := &db.Offer{Name: "Macros", Network: "net", OfferURL: "https://net.example/aff?id=9&s1={clickid}&s2={sub1}&geo={country}&cmp={campaign_id}"}
+    if err := store.SaveOffer(offer); err != nil {
+        t.Fatalf("SaveOffer: %v", err)
+    }
+    if err := store.SetCampaignOffers("test-campaign", []db.CampaignOffer{{OfferID: offer.ID, Weight: 1}}); err != nil {
+        t.Fatalf("SetCampaignOffers: %v", err)
+    }
+
+    w := doClick(server, "/click?rtkck=1234567890&sub1=zone+7%26x")
+    location, err := url.Parse(w.Header().Get("Location"))
+    if err != nil {
+        t.Fatalf("Invalid redirect: %v", err)
+    }
+    q := location.Query()
+    if q.Get("s1") == "" || q.Get("s2") != "zone 7&x" || q.Get("geo") != "LO" || q.Get("cmp") != "test-campaign" || q.Get("id") != "9" {
+        t.Errorf("Macros not expanded: %s", location)
+    }
+    if q.Has("clickid") || q.Has("aff_id") {
+        t.Errorf("Legacy parameters appended to a macro URL: %s", location)
+    }
+}
+
+func TestClickCapturesCustomParams(t *testing.T) {
+    server, store := newTestServer(t)
+
+    campaign, err := store.GetCampaignByID("test-campaign")
+    if err != nil {
+        t.Fatalf("GetCampaignByID: %v", err)
+    }
+    campaign.CustomParams = db.CustomParams{"zoneid", "", "campaignid"}
+    if err := store.UpdateCampaign(campaign); err != nil {
+        t.Fatalf("UpdateCampaign: %v", err)
+    }
+
+    w := doClick(server, "/click?rtkck=1234567890&zoneid=4411&sub2=banner&campaignid=77&sub1=ignored")
+    location, _ := url.Parse(w.Header().Get("Location"))
+    click, err := store.GetClickByID(location.Query().Get("clickid"))
+    if err != nil {
+        t.Fatalf("Click not saved: %v", err)
+    }
+    if click.Subs[0] != "4411" || click.Subs[1] != "banner" || click.Subs[2] != "77" {
+        t.Errorf("Unexpected subs: %q", click.Subs)
+    }
+
+    stats, err := store.GetSubStats("test-campaign", campaign.CustomParams.Slot("zoneid"), db.TimeRange{})
+    if err != nil || len(stats) != 1 || stats[0].Value != "4411" || stats[0].Clicks != 1 {
+        t.Errorf("Unexpected zoneid stats: %+v (%v)", stats, err)
+    }
+}
+
+func TestClickCost(t *testing.T) {
+    server, database := newTestServer(t)
+    campaign, _ := database.GetCampaignByID("test-campaign")
+    campaign.CostModel = db.CostModelCPC
+    campaign.DefaultBid = 0.2
+    if err := database.UpdateCampaign(campaign); err != nil {
+        t.Fatalf("UpdateCampaign: %v", err)
+    }
+
+    for target, want := range map[string]float64{
+        "/click?rtkck=1234567890&cost=0.35":  0.35,
+        "/click?rtkck=1234567890":            0.2,
+        "/click?rtkck=1234567890&cost={cost}": 0.2,
+    } {
+        w := doClick(server, target)
+        location, _ := url.Parse(w.Header().Get("Location"))
+        click, err := database.GetClickByID(location.Query().Get("clickid"))
+        if err != nil || click.Cost != want {
+            t.Errorf("%s: click = %+v, %v, want cost %v", target, click, err, want)
+        }
+    }
+}
+
+func TestClickPathHoursUseReportTimezone(t *testing.T) {
+    server, database := newTestServer(t)
+    server.config.ReportLocation = time.FixedZone("UTC+5", 5*3600)
+
+    hour := strconv.Itoa(time.Now().In(server.config.ReportLocation).Hour())
+    path := &db.CampaignPath{
+        CampaignID: "test-campaign",
+        Name:       "Local office hours",
+        Conditions: []db.PathCondition{{Field: routing.FieldHour, Operator: routing.OperatorIs, Values: []string{hour}}},
+    }
+    if err := database.SaveCampaignPath(path); err != nil {
+        t.Fatalf("SaveCampaignPath: %v", err)
+    }
+
+    w := doClick(server, "/click?rtkck=1234567890")
+    location, _ := url.Parse(w.Header().Get("Location"))
+    click, err := database.GetClickByID(location.Query().Get("clickid"))
+    if err != nil || click.PathID != path.ID {
+        t.Errorf("click = %+v, %v, want path %d for hour %s", click, err, path.ID, hour)
+    }
+}
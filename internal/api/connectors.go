@@ -0,0 +1,293 @@
+package api
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"unchained-tracker/internal/config"
+	"unchained-tracker/internal/connectors"
+	"unchained-tracker/internal/db"
+)
+
+func newConnectors(cfg *config.Config) connectors.Registry {
+	return connectors.NewRegistry(
+		&connectors.Facebook{
+			PixelID:       cfg.FacebookPixelID,
+			AccessToken:   cfg.FacebookToken,
+			APIVersion:    cfg.FacebookAPIVersion,
+			EventNames:    cfg.FacebookEventNames,
+			DefaultEvent:  cfg.FacebookDefaultEvent,
+			Currency:      cfg.Currency,
+			TestEventCode: cfg.FacebookTestEventCode,
+		},
+		&connectors.TikTok{
+			PixelCode:     cfg.TikTokPixelCode,
+			AccessToken:   cfg.TikTokToken,
+			EventNames:    cfg.TikTokEventNames,
+			DefaultEvent:  cfg.TikTokDefaultEvent,
+			Currency:      cfg.Currency,
+			TestEventCode: cfg.TikTokTestEventCode,
+		},
+		&connectors.GoogleAds{
+			ConversionName: cfg.GoogleAdsConversionName,
+			Currency:       cfg.Currency,
+		},
+	)
+}
+
+// sendToConnectors queues the conversion for the ad platforms its campaign
+// reports to and that haven't been sent it yet, so a conversion reaches each
+// platform once however often it changes. Errors are logged; the outbox
+// takes care of delivery.
+func (s *Server) sendToConnectors(conversion *db.Conversion, contact connectors.Contact) {
+	event := s.connectorEvent(conversion, contact)
+	for _, enabled := range s.campaignConnectors(event.CampaignID()) {
+		connector := s.connectors[enabled.Connector]
+		if connector == nil {
+			continue
+		}
+		sent, err := s.db.HasDelivery(enabled.Connector, conversion.ID)
+		if err != nil {
+			log.Printf("Error checking %s events of conversion %d: %v", enabled.Connector, conversion.ID, err)
+			continue
+		}
+		if sent {
+			continue
+		}
+		delivery, err := connector.Delivery(event, enabled.Settings)
+		if err != nil {
+			log.Printf("Error building %s event for conversion %d: %v", enabled.Connector, conversion.ID, err)
+			continue
+		}
+		if delivery == nil {
+			continue
+		}
+		delivery.ConversionID = conversion.ID
+		if err := s.db.EnqueueDelivery(delivery); err != nil {
+			log.Printf("Error queueing %s event for conversion %d: %v", enabled.Connector, conversion.ID, err)
+		}
+	}
+}
+
+// AuthorizeDelivery adds a connector's credentials to the request sending
+// d, using the settings of the campaign behind d's conversion
+func (s *Server) AuthorizeDelivery(d *db.Delivery, req *http.Request) error {
+	authorizer, ok := s.connectors[d.Kind].(connectors.Authorizer)
+	if !ok {
+		return nil
+	}
+
+	var settings map[string]string
+	if d.ConversionID != 0 {
+		conversion, err := s.db.GetConversionByID(d.ConversionID)
+		if err != nil {
+			return fmt.Errorf("error loading conversion %d: %v", d.ConversionID, err)
+		}
+		event := s.connectorEvent(conversion, connectors.Contact{})
+		for _, enabled := range s.campaignConnectors(event.CampaignID()) {
+			if enabled.Connector == d.Kind {
+				settings = enabled.Settings
+			}
+		}
+	}
+	return authorizer.Authorize(req, settings)
+}
+
+// campaignConnectors returns the connectors enabled on a campaign.
+// Campaigns without any report to Facebook when FB_ENABLED is set.
+func (s *Server) campaignConnectors(campaignID string) []db.CampaignConnector {
+	var enabled []db.CampaignConnector
+	if campaignID != "" {
+		var err error
+		enabled, err = s.db.GetCampaignConnectors(campaignID)
+		if err != nil {
+			log.Printf("Error loading connectors for campaign %s: %v", campaignID, err)
+			return nil
+		}
+	}
+	if len(enabled) == 0 && s.config.FacebookEnabled {
+		enabled = []db.CampaignConnector{{CampaignID: campaignID, Connector: "facebook"}}
+	}
+	return enabled
+}
+
+// connectorEvent collects the visit and click a conversion came from
+func (s *Server) connectorEvent(conversion *db.Conversion, contact connectors.Contact) *connectors.Event {
+	event := &connectors.Event{Conversion: conversion, Contact: contact}
+
+	var err error
+	if conversion.ClickID != "" {
+		event.Visit, err = s.db.GetVisitByClickID(conversion.ClickID)
+	}
+	if event.Visit == nil && conversion.VisitorID != "" {
+		event.Visit, err = s.db.GetVisitByVisitorID(conversion.VisitorID)
+	}
+	if err != nil {
+		event.Visit = nil
+	}
+
+	clickID := conversion.ClickID
+	if clickID == "" && event.Visit != nil {
+		clickID = event.Visit.ClickID
+	}
+	if clickID != "" {
+		if click, err := s.db.GetClickByID(clickID); err == nil {
+			event.Click = click
+		}
+	}
+	return event
+}
+
+type CampaignConnectorsRequest struct {
+	CampaignID string                 `json:"campaign_id"`
+	Connectors []db.CampaignConnector `json:"connectors"`
+}
+
+// HandleCampaignConnectors manages the ad platforms a campaign reports its
+// conversions to. GET returns them with the available connectors, PUT
+// replaces them.
+func (s *Server) HandleCampaignConnectors(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		s.getCampaignConnectors(w, r)
+	case http.MethodPut:
+		s.setCampaignConnectors(w, r)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (s *Server) getCampaignConnectors(w http.ResponseWriter, r *http.Request) {
+	campaignID := r.URL.Query().Get("campaign_id")
+	if campaignID == "" {
+		http.Error(w, "Missing campaign_id", http.StatusBadRequest)
+		return
+	}
+
+	enabled, err := s.db.GetCampaignConnectors(campaignID)
+	if err != nil {
+		log.Printf("Error getting campaign connectors: %v", err)
+		http.Error(w, "Error getting campaign connectors", http.StatusInternalServerError)
+		return
+	}
+	if enabled == nil {
+		enabled = []db.CampaignConnector{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"campaign_id": campaignID,
+		"connectors":  enabled,
+		"available":   s.connectors.Names(),
+	})
+}
+
+func (s *Server) setCampaignConnectors(w http.ResponseWriter, r *http.Request) {
+	var req CampaignConnectorsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if req.CampaignID == "" {
+		http.Error(w, "Missing campaign_id", http.StatusBadRequest)
+		return
+	}
+	if err := s.validateConnectors(req.Connectors); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := s.db.SetCampaignConnectors(req.CampaignID, req.Connectors); err != nil {
+		log.Printf("Error saving campaign connectors: %v", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status":      "success",
+		"campaign_id": req.CampaignID,
+		"connectors":  req.Connectors,
+	})
+}
+
+func (s *Server) validateConnectors(enabled []db.CampaignConnector) error {
+	seen := map[string]bool{}
+	for _, c := range enabled {
+		if s.connectors[c.Connector] == nil {
+			return fmt.Errorf("unknown connector %q", c.Connector)
+		}
+		if seen[c.Connector] {
+			return fmt.Errorf("connector %s is listed twice", c.Connector)
+		}
+		seen[c.Connector] = true
+	}
+	return nil
+}
+
+// defaultFeedDays is how far back the Google Ads feed goes by default
+const defaultFeedDays = 90
+
+// HandleGoogleAdsFeed serves the offline conversions of campaigns using the
+// google_ads connector as a CSV for a Google Ads scheduled upload
+// (?days=, ?campaign_id=). With GOOGLE_ADS_FEED_TOKEN set the token must
+// be passed as ?token= or as the basic auth password.
+func (s *Server) HandleGoogleAdsFeed(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !s.feedAuthorized(r) {
+		w.Header().Set("WWW-Authenticate", `Basic realm="feed"`)
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	googleAds, ok := s.connectors["google_ads"].(*connectors.GoogleAds)
+	if !ok {
+		http.Error(w, "Google Ads connector not available", http.StatusNotFound)
+		return
+	}
+
+	days := defaultFeedDays
+	if v := r.URL.Query().Get("days"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			http.Error(w, "Invalid days", http.StatusBadRequest)
+			return
+		}
+		days = n
+	}
+	since := time.Now().AddDate(0, 0, -days)
+
+	conversions, err := s.db.GetConnectorConversions(googleAds.Name(), since, r.URL.Query().Get("campaign_id"))
+	if err != nil {
+		log.Printf("Error getting Google Ads conversions: %v", err)
+		http.Error(w, "Error getting conversions", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", `attachment; filename="google-ads-conversions.csv"`)
+	if err := googleAds.WriteFeed(w, conversions); err != nil {
+		log.Printf("Error writing Google Ads feed: %v", err)
+	}
+}
+
+func (s *Server) feedAuthorized(r *http.Request) bool {
+	token := s.config.GoogleAdsFeedToken
+	if token == "" {
+		return true
+	}
+	given := r.URL.Query().Get("token")
+	if _, password, ok := r.BasicAuth(); ok {
+		given = password
+	}
+	return subtle.ConstantTimeCompare([]byte(given), []byte(token)) == 1
+}
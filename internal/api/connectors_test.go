@@ -0,0 +1,270 @@
+package api
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"unchained-tracker/internal/connectors"
+	"unchained-tracker/internal/db"
+	"unchained-tracker/internal/outbox"
+)
+
+func TestFacebookEventPayload(t *testing.T) {
+	server, database := newTestServer(t)
+	server.connectors = connectors.NewRegistry(&connectors.Facebook{
+		PixelID:       "123",
+		AccessToken:   "token",
+		APIVersion:    "v99.0",
+		EventNames:    map[string]string{"lead": "Lead"},
+		DefaultEvent:  "Purchase",
+		Currency:      "USD",
+		TestEventCode: "TEST42",
+	})
+	addNetwork(t, database, "net")
+	if err := database.SetCampaignConnectors("test-campaign", []db.CampaignConnector{{Connector: "facebook"}}); err != nil {
+		t.Fatalf("SetCampaignConnectors: %v", err)
+	}
+
+	w := doClick(server, "/click?rtkck=1234567890&fbclid=AbC")
+	location, _ := url.Parse(w.Header().Get("Location"))
+	clickID := location.Query().Get("clickid")
+	click, err := database.GetClickByID(clickID)
+	if err != nil || !strings.HasPrefix(click.FBC, "fb.1.") || !strings.HasSuffix(click.FBC, ".AbC") {
+		t.Fatalf("click = %+v, %v", click, err)
+	}
+
+	// The lander reports _fbp; _fbc comes from the click
+	visit := &db.Visit{VisitorID: click.VisitorID, ClickID: clickID, CampaignID: "test-campaign", CreatedAt: time.Now()}
+	visit.FBC, visit.FBP = visitFacebookIDs(&VisitRequest{ClickID: clickID, FBP: "fb.1.1.99"}, click)
+	if err := database.SaveVisit(visit); err != nil {
+		t.Fatalf("SaveVisit: %v", err)
+	}
+
+	code, resp := postback(t, server, "network=net&clickid="+clickID+"&payout=4&currency=eur&type=lead&txid=T9&email=%20Jane@Example.com")
+	if code != 200 {
+		t.Fatalf("postback = %d %v", code, resp)
+	}
+
+	deliveries, err := database.GetDeliveries("", 0, 10)
+	if err != nil || len(deliveries) != 1 {
+		t.Fatalf("deliveries = %+v, %v", deliveries, err)
+	}
+	if deliveries[0].Kind != "facebook" || deliveries[0].URL != "https://graph.facebook.com/v99.0/123/events" {
+		t.Errorf("delivery = %s %s", deliveries[0].Kind, deliveries[0].URL)
+	}
+
+	var payload struct {
+		TestEventCode string `json:"test_event_code"`
+		Data          []struct {
+			EventName string `json:"event_name"`
+			EventID   string `json:"event_id"`
+			UserData  struct {
+				FBC   string   `json:"fbc"`
+				FBP   string   `json:"fbp"`
+				Email []string `json:"em"`
+			} `json:"user_data"`
+			CustomData struct {
+				Currency string `json:"currency"`
+			} `json:"custom_data"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal([]byte(deliveries[0].Body), &payload); err != nil {
+		t.Fatalf("body: %v", err)
+	}
+	event := payload.Data[0]
+	if event.EventName != "Lead" || event.EventID != "T9" || event.CustomData.Currency != "EUR" || payload.TestEventCode != "TEST42" {
+		t.Errorf("event = %+v, payload = %+v", event, payload)
+	}
+	if event.UserData.FBC != click.FBC || event.UserData.FBP != "fb.1.1.99" {
+		t.Errorf("fbc/fbp = %q/%q", event.UserData.FBC, event.UserData.FBP)
+	}
+	// sha256("jane@example.com")
+	if len(event.UserData.Email) != 1 || event.UserData.Email[0] != "8c87b489ce35cf2e2f39f80e282cb2e804932a56a213983eeeb428407d43b52d" {
+		t.Errorf("em = %v", event.UserData.Email)
+	}
+	if strings.Contains(deliveries[0].Body, "jane@") {
+		t.Error("email sent unhashed")
+	}
+
+	// The access token is only added when the event is sent
+	if strings.Contains(deliveries[0].Body, "token") {
+		t.Errorf("access token stored in body %s", deliveries[0].Body)
+	}
+	req := httptest.NewRequest("POST", deliveries[0].URL, strings.NewReader(deliveries[0].Body))
+	if err := server.AuthorizeDelivery(deliveries[0], req); err != nil || req.Header.Get("Authorization") != "Bearer token" {
+		t.Errorf("authorized headers = %v, %v", req.Header, err)
+	}
+	if req.URL.RawQuery != "" {
+		t.Errorf("authorized url = %s", req.URL)
+	}
+
+	// Failed attempts record the transport error, which quotes the URL
+	failing := &http.Client{Transport: roundTripFunc(func(*http.Request) (*http.Response, error) {
+		return nil, errors.New("connection reset")
+	})}
+	worker := outbox.NewWorker(database, outbox.Options{Client: failing, Authorize: server.AuthorizeDelivery})
+	worker.Deliver(deliveries[0])
+	failed, err := database.GetDeliveries("", 0, 10)
+	if err != nil || len(failed) != 1 || failed[0].LastError == "" || strings.Contains(failed[0].LastError, "token") {
+		t.Errorf("failed delivery = %+v, %v", failed, err)
+	}
+}
+
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(r *http.Request) (*http.Response, error) { return f(r) }
+
+func TestCampaignConnectors(t *testing.T) {
+	server, database := newTestServer(t)
+	server.config.GoogleAdsFeedToken = "secret"
+	server.connectors = connectors.NewRegistry(
+		&connectors.Facebook{PixelID: "123", AccessToken: "token", APIVersion: "v99.0"},
+		&connectors.TikTok{PixelCode: "TT1", AccessToken: "tt-token", DefaultEvent: "CompletePayment", Currency: "USD"},
+		&connectors.GoogleAds{ConversionName: "Offline Sale", Currency: "USD"},
+	)
+	addNetwork(t, database, "net")
+	err := database.SetCampaignConnectors("test-campaign", []db.CampaignConnector{
+		{Connector: "tiktok", Settings: map[string]string{"pixel_code": "TT2"}},
+		{Connector: "google_ads"},
+	})
+	if err != nil {
+		t.Fatalf("SetCampaignConnectors: %v", err)
+	}
+
+	w := doClick(server, "/click?rtkck=1234567890&ttclid=TTC&gclid=GCL")
+	location, _ := url.Parse(w.Header().Get("Location"))
+	clickID := location.Query().Get("clickid")
+	click, err := database.GetClickByID(clickID)
+	if err != nil || click.TTCLID != "TTC" || click.GCLID != "GCL" {
+		t.Fatalf("click = %+v, %v", click, err)
+	}
+	visit := &db.Visit{VisitorID: click.VisitorID, ClickID: clickID, CampaignID: "test-campaign", CreatedAt: time.Now()}
+	if err := database.SaveVisit(visit); err != nil {
+		t.Fatalf("SaveVisit: %v", err)
+	}
+
+	if code, resp := postback(t, server, "network=net&clickid="+clickID+"&payout=7.5&phone=%2B1%20555%200100"); code != 200 {
+		t.Fatalf("postback = %d %v", code, resp)
+	}
+
+	// Facebook isn't enabled on the campaign and Google Ads isn't pushed
+	deliveries, err := database.GetDeliveries("", 0, 10)
+	if err != nil || len(deliveries) != 1 {
+		t.Fatalf("deliveries = %+v, %v", deliveries, err)
+	}
+	d := deliveries[0]
+	if d.Kind != "tiktok" || d.Target != "TT2" || d.Headers["Access-Token"] != "" {
+		t.Errorf("delivery = %+v", d)
+	}
+	send := httptest.NewRequest("POST", d.URL, strings.NewReader(d.Body))
+	if err := server.AuthorizeDelivery(d, send); err != nil || send.Header.Get("Access-Token") != "tt-token" {
+		t.Errorf("authorized headers = %v, %v", send.Header, err)
+	}
+	var payload struct {
+		EventSourceID string `json:"event_source_id"`
+		Data          []struct {
+			Event string `json:"event"`
+			User  struct {
+				TTCLID string `json:"ttclid"`
+				Phone  string `json:"phone"`
+			} `json:"user"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal([]byte(d.Body), &payload); err != nil {
+		t.Fatalf("body: %v", err)
+	}
+	if payload.EventSourceID != "TT2" || payload.Data[0].Event != "CompletePayment" || payload.Data[0].User.TTCLID != "TTC" ||
+		payload.Data[0].User.Phone != connectors.Hash("+15550100") {
+		t.Errorf("payload = %+v", payload)
+	}
+
+	req := httptest.NewRequest("GET", "/api/connectors/google-ads.csv", nil)
+	rec := httptest.NewRecorder()
+	server.HandleGoogleAdsFeed(rec, req)
+	if rec.Code != 401 {
+		t.Fatalf("feed without token = %d", rec.Code)
+	}
+
+	req = httptest.NewRequest("GET", "/api/connectors/google-ads.csv?token=secret", nil)
+	rec = httptest.NewRecorder()
+	server.HandleGoogleAdsFeed(rec, req)
+	reader := csv.NewReader(rec.Body)
+	reader.FieldsPerRecord = -1
+	records, err := reader.ReadAll()
+	if err != nil {
+		t.Fatalf("feed: %v", err)
+	}
+	if len(records) != 3 || records[0][0] != "Parameters:TimeZone=+0000" {
+		t.Fatalf("feed = %v", records)
+	}
+	if row := records[2]; row[0] != "GCL" || row[1] != "Offline Sale" || row[3] != "7.5" || row[4] != "USD" {
+		t.Errorf("row = %v", row)
+	}
+}
+
+func TestRejectedPostbackSkipsConnectors(t *testing.T) {
+	server, database := newTestServer(t)
+	server.connectors = connectors.NewRegistry(&connectors.Facebook{PixelID: "123", AccessToken: "token", APIVersion: "v99.0"})
+	addNetwork(t, database, "net")
+	if err := database.SetCampaignConnectors("test-campaign", []db.CampaignConnector{{Connector: "facebook"}}); err != nil {
+		t.Fatalf("SetCampaignConnectors: %v", err)
+	}
+	visit := &db.Visit{VisitorID: "v1", ClickID: "c1", CampaignID: "test-campaign", CreatedAt: time.Now()}
+	if err := database.SaveVisit(visit); err != nil {
+		t.Fatalf("SaveVisit: %v", err)
+	}
+
+	for _, status := range []string{"rejected", "chargeback"} {
+		code, resp := postback(t, server, "network=net&clickid=c1&payout=5&txid="+status+"&status="+status)
+		if code != 200 || resp["status"] != "success" {
+			t.Fatalf("%s postback = %d %v", status, code, resp)
+		}
+	}
+
+	deliveries, err := database.GetDeliveries("", 0, 10)
+	if err != nil || len(deliveries) != 0 {
+		t.Errorf("deliveries = %+v, %v", deliveries, err)
+	}
+}
+
+func TestConnectorsSendEachConversionOnce(t *testing.T) {
+	server, database := newTestServer(t)
+	server.connectors = connectors.NewRegistry(&connectors.Facebook{PixelID: "123", AccessToken: "token", APIVersion: "v99.0"})
+	addNetwork(t, database, "net")
+	if err := database.SetCampaignConnectors("test-campaign", []db.CampaignConnector{{Connector: "facebook"}}); err != nil {
+		t.Fatalf("SetCampaignConnectors: %v", err)
+	}
+	visit := &db.Visit{VisitorID: "v1", ClickID: "c1", CampaignID: "test-campaign", CreatedAt: time.Now()}
+	if err := database.SaveVisit(visit); err != nil {
+		t.Fatalf("SaveVisit: %v", err)
+	}
+
+	// Rejected first, approved on appeal, then rejected and approved by hand
+	var id interface{}
+	for _, status := range []string{"rejected", "approved", "rejected"} {
+		code, resp := postback(t, server, "network=net&clickid=c1&payout=5&txid=t1&status="+status)
+		if code != 200 {
+			t.Fatalf("%s postback = %d %v", status, code, resp)
+		}
+		id = resp["conversion_id"]
+	}
+	body := fmt.Sprintf(`{"conversion_id": %v, "status": "approved"}`, id)
+	w := httptest.NewRecorder()
+	server.HandleConversionStatus(w, httptest.NewRequest("PUT", "/api/conversions/status", strings.NewReader(body)))
+	if w.Code != 200 {
+		t.Fatalf("approve = %d %s", w.Code, w.Body.String())
+	}
+
+	deliveries, err := database.GetDeliveries("", 0, 10)
+	if err != nil || len(deliveries) != 1 || deliveries[0].Kind != "facebook" {
+		t.Errorf("deliveries = %+v, %v", deliveries, err)
+	}
+}
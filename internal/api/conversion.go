@@ -1,54 +1,32 @@
 package api
 
 import (
-    "bytes"
+    "database/sql"
     "encoding/json"
+    "errors"
+    "io"
     "fmt"
-    "io/ioutil"
     "log"
     "net/http"
     "time"
+    "unchained-tracker/internal/connectors"
     "unchained-tracker/internal/db"
 )
 
 type ConversionRequest struct {
-    VisitorID  string  `json:"visitor_id"`
-    ClickID    string  `json:"click_id"`
-    CampaignID string  `json:"campaign_id"`
-    Amount     float64 `json:"amount"`
-}
-
-type FacebookEvent struct {
-    Data []struct {
-        EventName string `json:"event_name"`
-        EventTime int64  `json:"event_time"`
-        UserData  struct {
-            ClientIPAddress string `json:"client_ip_address"`
-            ClientUserAgent string `json:"client_user_agent"`
-        } `json:"user_data"`
-        CustomData struct {
-            Value      float64 `json:"value"`
-            Currency   string  `json:"currency"`
-            CampaignID string  `json:"campaign_id"`
-            ClickID    string  `json:"click_id"`
-        } `json:"custom_data"`
-    } `json:"data"`
-    AccessToken string `json:"access_token"`
-}
-
-// Facebook cookie helper functions
-func getFBCookie(r *http.Request) string {
-    if cookie, err := r.Cookie("_fbc"); err == nil {
-        return cookie.Value
-    }
-    return ""
-}
-
-func getFBPCookie(r *http.Request) string {
-    if cookie, err := r.Cookie("_fbp"); err == nil {
-        return cookie.Value
-    }
-    return ""
+    VisitorID     string  `json:"visitor_id"`
+    ClickID       string  `json:"click_id"`
+    CampaignID    string  `json:"campaign_id"`
+    Amount        float64 `json:"amount"`
+    Status        string  `json:"status"`
+    TransactionID string  `json:"transaction_id"`
+    Network       string  `json:"network"`
+    // Type picks the Facebook event name, e.g. lead or purchase
+    Type          string  `json:"type"`
+    // EventID is the event_id the browser pixel used for this conversion
+    EventID       string  `json:"event_id"`
+    Email         string  `json:"email"`
+    Phone         string  `json:"phone"`
 }
 
 func (s *Server) HandleConversion(w http.ResponseWriter, r *http.Request) {
@@ -57,11 +35,20 @@ func (s *Server) HandleConversion(w http.ResponseWriter, r *http.Request) {
         return
     }
 
+    body, err := io.ReadAll(r.Body)
+    if err != nil {
+        http.Error(w, err.Error(), http.StatusBadRequest)
+        return
+    }
+
     var req ConversionRequest
-    if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+    if err := json.Unmarshal(body, &req); err != nil {
         http.Error(w, err.Error(), http.StatusBadRequest)
         return
     }
+    if req.Network == "" {
+        req.Network = r.URL.Query().Get("network")
+    }
 
     log.Printf("Received conversion request: %+v", req)
 
@@ -71,88 +58,147 @@ func (s *Server) HandleConversion(w http.ResponseWriter, r *http.Request) {
         return
     }
 
+    status := db.StatusApproved
+    if req.Status != "" {
+        var ok bool
+        if status, ok = db.NormalizeStatus(req.Status); !ok {
+            http.Error(w, "Invalid status: "+req.Status, http.StatusBadRequest)
+            return
+        }
+    }
+
+    if req.Network != "" {
+        if _, ok := s.authorizePostback(w, r, req.Network, body); !ok {
+            return
+        }
+    } else {
+        // Browser pixels can't hold a secret, so their conversions don't
+        // count until approved and can't touch a network's transactions
+        status = db.StatusUnverified
+        req.TransactionID = ""
+    }
+
     conversion := &db.Conversion{
-        VisitorID:  req.VisitorID,
-        ClickID:    req.ClickID,
-        CampaignID: req.CampaignID,
-        Amount:     req.Amount,
-        Status:     "completed",
-        CreatedAt:  time.Now(),
+        VisitorID:     req.VisitorID,
+        ClickID:       req.ClickID,
+        CampaignID:    req.CampaignID,
+        Amount:        req.Amount,
+        Status:        status,
+        TransactionID: req.TransactionID,
+        Network:       req.Network,
+        Type:          truncate(req.Type, 50),
+        EventID:       truncate(req.EventID, 100),
+        CreatedAt:     time.Now(),
     }
 
-    if err := s.db.SaveConversion(conversion); err != nil {
-        http.Error(w, err.Error(), http.StatusInternalServerError)
+    // Browser conversions come from the visitor, network ones from the network
+    ip := ""
+    if req.Network == "" {
+        ip = s.clientIP(r)
+    }
+    result, previous, err := s.recordConversion(conversion, req.Amount != 0, "postback", ip)
+    if err != nil {
+        writeRecordError(w, err)
         return
     }
 
-    // Optional: Send to Facebook Conversion API
-    if s.config.FacebookEnabled {
-        go s.sendToFacebook(conversion, r)
+    // Report conversions to the campaign's ad platforms once they count
+    if result != resultDuplicate && db.CountsAsRevenue(conversion.Status) {
+        s.sendToConnectors(conversion, connectors.Contact{Email: req.Email, Phone: req.Phone})
     }
+    s.notifyTrafficSource(conversion, result)
+    s.publishConversion(conversion, result, previous)
 
     w.Header().Set("Content-Type", "application/json")
     json.NewEncoder(w).Encode(map[string]interface{}{
-        "status":        "success",
-        "conversion_id": conversion.ID,
-        "amount":        conversion.Amount,
-        "created_at":    conversion.CreatedAt,
-        "visitor_id":    conversion.VisitorID,
-        "campaign_id":   conversion.CampaignID,
+        "status":            result,
+        "conversion_id":     conversion.ID,
+        "conversion_status": conversion.Status,
+        "previous_status":   previous,
+        "fraud_score":       conversion.FraudScore,
+        "amount":            conversion.Amount,
+        "created_at":        conversion.CreatedAt,
+        "visitor_id":        conversion.VisitorID,
+        "campaign_id":       conversion.CampaignID,
     })
 }
 
-func (s *Server) sendToFacebook(conversion *db.Conversion, r *http.Request) error {
-    if !s.config.FacebookEnabled {
-        return nil
+// Outcomes of recordConversion, reported as "status" in postback responses
+const (
+    resultCreated   = "success"
+    resultUpdated   = "updated"
+    resultDuplicate = "duplicate"
+)
+
+// errInvalidTransition is returned by recordConversion when a network
+// reports a status the existing conversion can't move to
+var errInvalidTransition = errors.New("invalid status transition")
+
+// recordConversion saves c as a new conversion. When c.Network already
+// reported c.TransactionID, the existing conversion is moved to c's status
+// instead, or left alone if nothing changed so that network retries are
+// counted once; either way c is filled from it. hasAmount tells whether
+// the caller supplied an amount; without one an update keeps the current
+// amount, which is how most networks report chargebacks. previous is the
+// status before the call, or "" for a new conversion. New conversions are
+// scored for fraud, with ip the address a browser conversion came from.
+func (s *Server) recordConversion(c *db.Conversion, hasAmount bool, source, ip string) (result, previous string, err error) {
+    if c.TransactionID == "" {
+        s.scoreConversion(c, ip)
+        if err := s.db.SaveConversion(c); err != nil {
+            return "", "", err
+        }
+        return resultCreated, "", nil
     }
 
-    // Get visit info for the conversion
-    visit, err := s.db.GetVisitByVisitorID(conversion.VisitorID)
-    if err != nil {
-        return fmt.Errorf("error getting visit info: %v", err)
-    }
-
-    // Prepare Facebook event data
-    event := map[string]interface{}{
-        "data": []map[string]interface{}{
-            {
-                "event_name": "Purchase",
-                "event_time": time.Now().Unix(),
-                "user_data": map[string]interface{}{
-                    "client_ip_address": visit.IPAddress,
-                    "client_user_agent": visit.UserAgent,
-                    "fbc":              getFBCookie(r),
-                    "fbp":              getFBPCookie(r),
-                },
-                "custom_data": map[string]interface{}{
-                    "value": conversion.Amount,
-                    "currency": "USD",
-                    "campaign_id": conversion.CampaignID,
-                    "click_id": conversion.ClickID,
-                },
-            },
-        },
-        "access_token": s.config.FacebookToken,
-        "pixel_id":     s.config.FacebookPixelID,
-    }
-
-    // Send to Facebook
-    jsonData, err := json.Marshal(event)
+    existing, err := s.db.GetConversionByTransactionID(c.Network, c.TransactionID)
+    if err == sql.ErrNoRows {
+        s.scoreConversion(c, ip)
+        if err := s.db.SaveConversion(c); err != nil {
+            // A concurrent retry may have won the unique (network, transaction_id) key
+            existing, lookupErr := s.db.GetConversionByTransactionID(c.Network, c.TransactionID)
+            if lookupErr != nil {
+                return "", "", err
+            }
+            *c = *existing
+            return resultDuplicate, existing.Status, nil
+        }
+        return resultCreated, "", nil
+    }
     if err != nil {
-        return fmt.Errorf("error marshaling event: %v", err)
+        return "", "", err
     }
 
-    url := fmt.Sprintf("https://graph.facebook.com/v13.0/%s/events", s.config.FacebookPixelID)
-    resp, err := http.Post(url, "application/json", bytes.NewBuffer(jsonData))
-    if err != nil {
-        return fmt.Errorf("error sending to Facebook: %v", err)
+    previous = existing.Status
+    // Only a manual status change releases a held conversion
+    if existing.Status == db.StatusHeld && db.CountsAsRevenue(c.Status) {
+        log.Printf("Conversion %d stays held for review, fraud score %d", existing.ID, existing.FraudScore)
+        c.Status = db.StatusHeld
+    }
+    amount := existing.Amount
+    if hasAmount {
+        amount = c.Amount
+    }
+    if c.Status == existing.Status && amount == existing.Amount {
+        *c = *existing
+        return resultDuplicate, previous, nil
     }
-    defer resp.Body.Close()
 
-    if resp.StatusCode != http.StatusOK {
-        body, _ := ioutil.ReadAll(resp.Body)
-        return fmt.Errorf("Facebook API error (status %d): %s", resp.StatusCode, string(body))
+    if !db.CanTransition(existing.Status, c.Status) {
+        return "", "", fmt.Errorf("%w from %s to %s", errInvalidTransition, existing.Status, c.Status)
+    }
+    if err := s.db.UpdateConversionStatus(existing, c.Status, amount, source); err != nil {
+        return "", "", err
     }
+    *c = *existing
+    return resultUpdated, previous, nil
+}
 
-    return nil
-} 
\ No newline at end of file
+func writeRecordError(w http.ResponseWriter, err error) {
+    if errors.Is(err, errInvalidTransition) {
+        http.Error(w, err.Error(), http.StatusConflict)
+        return
+    }
+    log.Printf("Error recording conversion: %v", err)
+    http.Error(w, err.Error(), http.StatusInternalServerError)
+}
@@ -0,0 +1,109 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+
+	"unchained-tracker/internal/connectors"
+	"unchained-tracker/internal/db"
+)
+
+// ConversionStatusRequest changes a conversion's status by hand
+type ConversionStatusRequest struct {
+	ConversionID int64    `json:"conversion_id"`
+	Status       string   `json:"status"`
+	Amount       *float64 `json:"amount"`
+}
+
+// HandleConversionStatus lets a user approve, reject or charge back a
+// conversion from the dashboard
+func (s *Server) HandleConversionStatus(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPut && r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req ConversionStatusRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	status, ok := db.NormalizeStatus(req.Status)
+	if !ok {
+		http.Error(w, "Invalid status: "+req.Status, http.StatusBadRequest)
+		return
+	}
+
+	conversion, err := s.db.GetConversionByID(req.ConversionID)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Conversion not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("Error getting conversion %d: %v", req.ConversionID, err)
+		http.Error(w, "Error getting conversion", http.StatusInternalServerError)
+		return
+	}
+
+	if !db.CanTransition(conversion.Status, status) {
+		http.Error(w, "Cannot move conversion from "+conversion.Status+" to "+status, http.StatusConflict)
+		return
+	}
+
+	amount := conversion.Amount
+	if req.Amount != nil {
+		amount = *req.Amount
+	}
+
+	previous := conversion.Status
+	if err := s.db.UpdateConversionStatus(conversion, status, amount, "manual"); err != nil {
+		log.Printf("Error updating conversion %d: %v", conversion.ID, err)
+		http.Error(w, "Error updating conversion", http.StatusInternalServerError)
+		return
+	}
+	// Conversions that start counting reach the ad platforms now
+	if db.CountsAsRevenue(conversion.Status) {
+		s.sendToConnectors(conversion, connectors.Contact{})
+	}
+	s.notifyTrafficSource(conversion, resultUpdated)
+	s.publishConversion(conversion, resultUpdated, previous)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"conversion_id":   conversion.ID,
+		"status":          conversion.Status,
+		"previous_status": previous,
+		"amount":          conversion.Amount,
+	})
+}
+
+// HandleConversionHistory returns the status changes of ?id=
+func (s *Server) HandleConversionHistory(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	id, err := strconv.ParseInt(r.URL.Query().Get("id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid conversion id", http.StatusBadRequest)
+		return
+	}
+
+	history, err := s.db.GetConversionHistory(id)
+	if err != nil {
+		log.Printf("Error getting history for conversion %d: %v", id, err)
+		http.Error(w, "Error getting conversion history", http.StatusInternalServerError)
+		return
+	}
+	if history == nil {
+		history = []db.ConversionStatusChange{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(history)
+}
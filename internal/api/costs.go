@@ -0,0 +1,106 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+)
+
+type CostUpdateRequest struct {
+	CampaignID string  `json:"campaign_id"`
+	Amount     float64 `json:"amount"`
+	Start      string  `json:"start"`
+	End        string  `json:"end"`
+	Timezone   string  `json:"timezone"`
+}
+
+// HandleCostUpdate imports what a campaign cost over a date range, e.g. from
+// the traffic source's spend report. The amount is spread evenly over the
+// campaign's clicks in the range, replacing their cost. Start and end are
+// days (both included) in the request's or workspace's report timezone, or
+// RFC 3339 times (end excluded).
+func (s *Server) HandleCostUpdate(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost && r.Method != http.MethodPut {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req CostUpdateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.CampaignID == "" {
+		http.Error(w, "Missing campaign_id", http.StatusBadRequest)
+		return
+	}
+	if req.Amount < 0 {
+		http.Error(w, "Amount can't be negative", http.StatusBadRequest)
+		return
+	}
+	loc, err := s.reportLocation(req.Timezone)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	start, end, err := parseCostRange(req.Start, req.End, loc)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if _, err := s.db.GetCampaignByID(req.CampaignID); err != nil {
+		http.Error(w, "Campaign not found", http.StatusNotFound)
+		return
+	}
+
+	clicks, err := s.db.DistributeCost(req.CampaignID, req.Amount, start, end)
+	if err != nil {
+		log.Printf("Error updating cost of campaign %s: %v", req.CampaignID, err)
+		http.Error(w, "Error updating cost", http.StatusInternalServerError)
+		return
+	}
+	if clicks == 0 {
+		http.Error(w, "No clicks in that date range", http.StatusConflict)
+		return
+	}
+	log.Printf("Distributed cost %.2f over %d clicks of campaign %s", req.Amount, clicks, req.CampaignID)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status":         "success",
+		"campaign_id":    req.CampaignID,
+		"clicks":         clicks,
+		"cost_per_click": req.Amount / float64(clicks),
+		"start":          start,
+		"end":            end,
+	})
+}
+
+// parseCostRange turns a cost update's start and end into [start, end)
+func parseCostRange(startStr, endStr string, loc *time.Location) (time.Time, time.Time, error) {
+	start, _, err := parseCostTime(startStr, loc)
+	if err != nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("invalid start: %v", err)
+	}
+	end, isDay, err := parseCostTime(endStr, loc)
+	if err != nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("invalid end: %v", err)
+	}
+	if isDay {
+		end = end.AddDate(0, 0, 1)
+	}
+	if !end.After(start) {
+		return time.Time{}, time.Time{}, fmt.Errorf("end must be after start")
+	}
+	return start, end, nil
+}
+
+func parseCostTime(value string, loc *time.Location) (time.Time, bool, error) {
+	if value == "" {
+		return time.Time{}, false, fmt.Errorf("missing")
+	}
+	return parseReportTime(value, loc)
+}
@@ -76,10 +76,14 @@ func (s *Server) GetDashboardStats(w http.ResponseWriter, r *http.Request) {
     }
 
     stats := &DashboardStats{}
-    var err error
+    statsRange, loc, err := s.statsRange(r)
+    if err != nil {
+        http.Error(w, err.Error(), http.StatusBadRequest)
+        return
+    }
 
-    // Get today's visits
-    today := time.Now().Truncate(24 * time.Hour)
+    // Get today's visits, today starting at midnight in the report timezone
+    today := startOfDay(time.Now(), loc)
     stats.TodayVisits, err = s.db.GetVisitCountSince(today)
     if err != nil {
         http.Error(w, "Error getting today's visits", http.StatusInternalServerError)
@@ -138,14 +142,16 @@ func (s *Server) GetDashboardStats(w http.ResponseWriter, r *http.Request) {
                 CreatedAt: conv.CreatedAt,
             }
             visitData.Conversions = append(visitData.Conversions, convData)
-            stats.Revenue += conv.Amount
+            if db.CountsAsRevenue(conv.Status) {
+                stats.Revenue += conv.Amount
+            }
         }
 
         stats.RecentVisits = append(stats.RecentVisits, visitData)
     }
 
     // Get campaign stats
-    stats.Campaigns, err = s.db.GetCampaignStats()
+    stats.Campaigns, err = s.db.GetCampaignStats(statsRange)
     if err != nil {
         http.Error(w, "Error getting campaign stats", http.StatusInternalServerError)
         return
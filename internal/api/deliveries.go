@@ -0,0 +1,90 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+
+	"unchained-tracker/internal/db"
+)
+
+// HandleDeliveries lists outbox deliveries, newest first. ?status= and
+// ?conversion_id= narrow the list, e.g. status=dead for failed ones.
+func (s *Server) HandleDeliveries(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	query := r.URL.Query()
+	status := query.Get("status")
+	switch status {
+	case "", db.DeliveryPending, db.DeliverySending, db.DeliveryDelivered, db.DeliveryDead:
+	default:
+		http.Error(w, "Unknown status: "+status, http.StatusBadRequest)
+		return
+	}
+
+	var conversionID int64
+	if v := query.Get("conversion_id"); v != "" {
+		var err error
+		if conversionID, err = strconv.ParseInt(v, 10, 64); err != nil {
+			http.Error(w, "Invalid conversion_id", http.StatusBadRequest)
+			return
+		}
+	}
+
+	limit := 100
+	if v := query.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			http.Error(w, "Invalid limit", http.StatusBadRequest)
+			return
+		}
+		limit = n
+	}
+
+	deliveries, err := s.db.GetDeliveries(status, conversionID, limit)
+	if err != nil {
+		log.Printf("Error getting deliveries: %v", err)
+		http.Error(w, "Error getting deliveries", http.StatusInternalServerError)
+		return
+	}
+	if deliveries == nil {
+		deliveries = []*db.Delivery{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(deliveries)
+}
+
+// HandleReplayDelivery queues a dead or delivered delivery (?id=) again
+func (s *Server) HandleReplayDelivery(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	id, err := strconv.ParseInt(r.URL.Query().Get("id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid ID", http.StatusBadRequest)
+		return
+	}
+
+	if err := s.db.ReplayDelivery(id); err != nil {
+		if err == sql.ErrNoRows {
+			http.Error(w, "Delivery not found or still queued", http.StatusNotFound)
+			return
+		}
+		log.Printf("Error replaying delivery %d: %v", id, err)
+		http.Error(w, "Error replaying delivery", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{
+		"status": "success",
+	})
+}
@@ -0,0 +1,169 @@
+package api
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"unchained-tracker/internal/db"
+	"unchained-tracker/internal/export"
+)
+
+// reportMeasures are the report columns after the dimensions, in order
+var reportMeasures = []string{"visits", "clicks", "conversions", "revenue", "cost", "profit", "roi", "epc", "cpa", "cr", "bot_visits", "bot_clicks"}
+
+// HandleExport downloads a report or a raw log as CSV or XLSX, written out
+// while the rows are read:
+//
+//	/api/export/report.xlsx?group_by=campaign,day&from=2024-05-01&to=2024-05-07
+//	/api/export/clicks.csv?from=2024-05-01&to=2024-05-07&campaign_id=...
+//
+// Reports take the parameters of /api/reports. Logs (clicks, visits and
+// conversions) take from, to and timezone like reports, and campaign_id.
+func (s *Server) HandleExport(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	name, format, _ := strings.Cut(r.PathValue("file"), ".")
+	if format != export.FormatCSV && format != export.FormatXLSX {
+		http.Error(w, "Export as .csv or .xlsx", http.StatusNotFound)
+		return
+	}
+
+	switch name {
+	case "report":
+		s.exportReport(w, r, format)
+	case db.LogClicks, db.LogVisits, db.LogConversions:
+		s.exportLog(w, r, name, format)
+	default:
+		http.Error(w, "Unknown export: "+name, http.StatusNotFound)
+	}
+}
+
+func (s *Server) exportReport(w http.ResponseWriter, r *http.Request, format string) {
+	req := reportRequestFromQuery(r)
+	report, q, ok := s.runReport(w, &req)
+	if !ok {
+		return
+	}
+
+	// Name columns follow the campaign, offer and lander IDs
+	var columns []db.ExportColumn
+	for _, dim := range report.GroupBy {
+		columns = append(columns, db.ExportColumn{Name: dim})
+		if labeledDimension(dim) {
+			columns = append(columns, db.ExportColumn{Name: dim + "_name"})
+		}
+	}
+	for _, measure := range reportMeasures {
+		columns = append(columns, db.ExportColumn{Name: measure, Numeric: true})
+	}
+
+	out, ok := startExport(w, "report", format, q.From, q.To, q.Location, columns)
+	if !ok {
+		return
+	}
+	// The totals come last, in a row labeled Total
+	rows := append(report.Rows, report.Totals)
+	values := make([]string, 0, len(columns))
+	for i, row := range rows {
+		values = values[:0]
+		for _, dim := range report.GroupBy {
+			values = append(values, row.Dimensions[dim])
+			if labeledDimension(dim) {
+				values = append(values, row.Labels[dim])
+			}
+		}
+		if i == len(rows)-1 && len(values) > 0 {
+			values[0] = "Total"
+		}
+		for _, measure := range reportMeasures {
+			value, _ := reportMeasure(measure)
+			values = append(values, formatMeasure(value(&row)))
+		}
+		if err := out.WriteRow(values); err != nil {
+			log.Printf("Error exporting report: %v", err)
+			return
+		}
+	}
+	if err := out.Close(); err != nil {
+		log.Printf("Error exporting report: %v", err)
+	}
+}
+
+func (s *Server) exportLog(w http.ResponseWriter, r *http.Request, name, format string) {
+	query := r.URL.Query()
+	loc, err := s.reportLocation(query.Get("timezone"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	from, to, err := reportRange(query.Get("from"), query.Get("to"), loc, time.Now())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	cursor, err := s.db.ExportLog(name, db.LogQuery{
+		Range:      db.TimeRange{From: from, To: to},
+		CampaignID: query.Get("campaign_id"),
+		Location:   loc,
+	})
+	if err != nil {
+		log.Printf("Error exporting %s: %v", name, err)
+		http.Error(w, "Error exporting "+name, http.StatusInternalServerError)
+		return
+	}
+	defer cursor.Close()
+
+	out, ok := startExport(w, name, format, from, to, loc, cursor.Columns())
+	if !ok {
+		return
+	}
+	rows := 0
+	for cursor.Next() {
+		if err := out.WriteRow(cursor.Values()); err != nil {
+			log.Printf("Error exporting %s after %d rows: %v", name, rows, err)
+			return
+		}
+		rows++
+	}
+	if err := cursor.Err(); err != nil {
+		log.Printf("Error exporting %s after %d rows: %v", name, rows, err)
+		return
+	}
+	if err := out.Close(); err != nil {
+		log.Printf("Error exporting %s: %v", name, err)
+	}
+}
+
+// startExport sends the headers of a download named after its range and
+// writes its header row. Errors from here on can only be logged.
+func startExport(w http.ResponseWriter, name, format string, from, to time.Time, loc *time.Location, columns []db.ExportColumn) (export.Writer, bool) {
+	filename := fmt.Sprintf("%s-%s-%s.%s", name,
+		from.In(loc).Format("2006-01-02"), to.In(loc).Add(-time.Second).Format("2006-01-02"), format)
+	w.Header().Set("Content-Type", export.ContentType(format))
+	w.Header().Set("Content-Disposition", `attachment; filename="`+filename+`"`)
+
+	out, err := export.New(w, format, columns)
+	if err != nil {
+		log.Printf("Error starting %s export: %v", name, err)
+		return nil, false
+	}
+	return out, true
+}
+
+func labeledDimension(dim string) bool {
+	return dim == "campaign" || dim == "offer" || dim == "lander"
+}
+
+// formatMeasure writes a measure with up to 4 decimals
+func formatMeasure(v float64) string {
+	return strconv.FormatFloat(math.Round(v*10000)/10000, 'f', -1, 64)
+}
@@ -0,0 +1,74 @@
+package api
+
+import (
+	"encoding/csv"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"unchained-tracker/internal/db"
+)
+
+func TestExports(t *testing.T) {
+	server, database := newTestServer(t)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/export/{file}", server.HandleExport)
+
+	for _, id := range []string{"a", "b"} {
+		click := &db.Click{ClickID: id, VisitorID: "v" + id, CampaignToken: "1234567890", CampaignID: "test-campaign", Cost: 0.5, Subs: db.Subs{"=1+1"}}
+		if err := database.SaveClick(click); err != nil {
+			t.Fatalf("SaveClick: %v", err)
+		}
+	}
+	database.Exec("UPDATE click SET created_at = '2024-05-01 02:00:00' WHERE click_id = 'a'")
+	database.Exec("UPDATE click SET created_at = '2024-05-03 02:00:00' WHERE click_id = 'b'")
+
+	get := func(target string) (*httptest.ResponseRecorder, [][]string) {
+		t.Helper()
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, target, nil))
+		if w.Code != http.StatusOK {
+			return w, nil
+		}
+		reader := csv.NewReader(w.Body)
+		records, err := reader.ReadAll()
+		if err != nil {
+			t.Fatalf("%s: %v", target, err)
+		}
+		return w, records
+	}
+
+	w, records := get("/api/export/clicks.csv?from=2024-04-30&to=2024-05-01&timezone=America/New_York")
+	if len(records) != 2 {
+		t.Fatalf("clicks export = %v", records)
+	}
+	header, row := records[0], records[1]
+	if header[0] != "created_at" || row[0] != "2024-04-30 22:00:00" || row[1] != "a" || row[6] != "0.5" {
+		t.Errorf("clicks export = %v", records)
+	}
+	for i, name := range header {
+		if name == "sub1" && row[i] != "'=1+1" {
+			t.Errorf("sub1 = %q, want it escaped", row[i])
+		}
+	}
+	if got := w.Header().Get("Content-Disposition"); got != `attachment; filename="clicks-2024-04-30-2024-05-01.csv"` {
+		t.Errorf("Content-Disposition = %s", got)
+	}
+
+	_, records = get("/api/export/report.csv?group_by=campaign&from=2024-05-01&to=2024-05-07")
+	if len(records) != 3 || records[1][0] != "test-campaign" || records[2][0] != "Total" || records[2][3] != "2" {
+		t.Errorf("report export = %v", records)
+	}
+
+	for _, target := range []string{"/api/export/clicks.pdf", "/api/export/payouts.csv"} {
+		if w, _ := get(target); w.Code != http.StatusNotFound {
+			t.Errorf("%s: status %d", target, w.Code)
+		}
+	}
+
+	w = httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/export/visits.xlsx?from=2024-05-01&to=2024-05-01", nil))
+	if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet" {
+		t.Errorf("xlsx export: status %d, %s", w.Code, w.Header().Get("Content-Type"))
+	}
+}
@@ -0,0 +1,32 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// facebookIDs reads the Facebook browser identifiers from a request to the
+// tracker: the _fbc and _fbp cookies, or an fbc built from fbclid when the
+// click cookie hasn't been set yet.
+func facebookIDs(r *http.Request, query url.Values) (fbc, fbp string) {
+	if cookie, err := r.Cookie("_fbc"); err == nil {
+		fbc = cookie.Value
+	}
+	if cookie, err := r.Cookie("_fbp"); err == nil {
+		fbp = cookie.Value
+	}
+	if fbc == "" {
+		fbc = fbcFromClickID(query.Get("fbclid"), time.Now())
+	}
+	return truncate(fbc, 255), truncate(fbp, 255)
+}
+
+// fbcFromClickID formats fbclid the way the Meta pixel stores it in _fbc
+func fbcFromClickID(fbclid string, at time.Time) string {
+	if fbclid == "" {
+		return ""
+	}
+	return fmt.Sprintf("fb.1.%d.%s", at.UnixMilli(), fbclid)
+}
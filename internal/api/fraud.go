@@ -0,0 +1,80 @@
+package api
+
+import (
+	"log"
+	"time"
+
+	"unchained-tracker/internal/db"
+	"unchained-tracker/internal/fraud"
+)
+
+// scoreClick scores a click on the clicks its address and visitor made in
+// the last hour
+func (s *Server) scoreClick(c *db.Click) {
+	byIP, byVisitor, err := s.db.ClickVelocity(c.IPAddress, c.VisitorID, time.Now().Add(-time.Hour))
+	if err != nil {
+		log.Printf("Error counting recent clicks: %v", err)
+		return
+	}
+	score := s.fraud.ScoreClick(fraud.ClickSignals{IPClicks: byIP + 1, VisitorClicks: byVisitor + 1})
+	c.FraudScore, c.FraudReason = score.Score, score.Reason()
+}
+
+// scoreConversion scores a new conversion against its click and visit,
+// holding it for review when it scores too high
+func (s *Server) scoreConversion(c *db.Conversion, ip string) {
+	var click *db.Click
+	var visit *db.Visit
+	if c.ClickID != "" {
+		click, _ = s.db.GetClickByID(c.ClickID)
+		visit, _ = s.db.GetVisitByClickID(c.ClickID)
+	} else if c.VisitorID != "" {
+		visit, _ = s.db.GetVisitByVisitorID(c.VisitorID)
+		if visit != nil && visit.ClickID != "" {
+			click, _ = s.db.GetClickByID(visit.ClickID)
+		}
+	}
+
+	createdAt := c.CreatedAt
+	if createdAt.IsZero() {
+		createdAt = time.Now()
+	}
+	var signals fraud.ConversionSignals
+	switch {
+	case click != nil:
+		signals.ClickScore, signals.ClickReasons = click.FraudScore, click.FraudReason
+		signals.TimeToConvert = createdAt.Sub(click.CreatedAt)
+		n, err := s.db.CountClickConversions(click.ClickID, c.Type)
+		if err != nil {
+			log.Printf("Error counting conversions of click %s: %v", click.ClickID, err)
+		}
+		signals.PriorConversions = n
+		signals.Countries = append(signals.Countries, s.country(click.IPAddress))
+	case visit != nil:
+		signals.TimeToConvert = createdAt.Sub(visit.CreatedAt)
+	}
+	if visit != nil {
+		signals.Countries = append(signals.Countries, visit.Country)
+	}
+	if ip != "" {
+		signals.Countries = append(signals.Countries, s.country(ip))
+	}
+
+	score := s.fraud.ScoreConversion(signals)
+	c.FraudScore, c.FraudReason = score.Score, score.Reason()
+	if s.fraud.Hold(score) && db.CountsAsRevenue(c.Status) {
+		log.Printf("Holding conversion on click %s for review, fraud score %d (%s)", c.ClickID, c.FraudScore, c.FraudReason)
+		c.Status = db.StatusHeld
+	}
+}
+
+// country is where an address is, or "" when unknown
+func (s *Server) country(ip string) string {
+	if ip == "" {
+		return ""
+	}
+	if loc := s.lookup(ip); loc != nil {
+		return loc.Country
+	}
+	return ""
+}
@@ -0,0 +1,157 @@
+package api
+
+import (
+	"fmt"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"unchained-tracker/internal/connectors"
+	"unchained-tracker/internal/db"
+	"unchained-tracker/internal/fraud"
+)
+
+func TestFraudScoring(t *testing.T) {
+	server, database := newTestServer(t)
+	server.fraud = fraud.NewScorer(fraud.Options{IPClicksPerHour: 2, VisitorClicksPerHour: 100})
+
+	var clickID string
+	for i := 0; i < 3; i++ {
+		location, _ := url.Parse(doClick(server, "/click?rtkck=1234567890").Header().Get("Location"))
+		clickID = location.Query().Get("clickid")
+	}
+	click, err := database.GetClickByID(clickID)
+	if err != nil || click.FraudScore != 40 || click.FraudReason != fraud.ReasonIPVelocity {
+		t.Fatalf("third click = %+v, %v", click, err)
+	}
+	visit := &db.Visit{VisitorID: click.VisitorID, ClickID: clickID, CampaignID: "test-campaign", CreatedAt: time.Now()}
+	if err := database.SaveVisit(visit); err != nil {
+		t.Fatalf("SaveVisit: %v", err)
+	}
+
+	// Converting seconds after a flooded click is held for review, and the
+	// network can't approve it
+	approved := func() *db.Conversion {
+		return &db.Conversion{VisitorID: visit.VisitorID, ClickID: clickID, CampaignID: "test-campaign", Amount: 10, Status: db.StatusApproved,
+			TransactionID: "t1", Network: "net", CreatedAt: time.Now()}
+	}
+	c := approved()
+	if result, _, err := server.recordConversion(c, true, "network:net", ""); err != nil || result != resultCreated {
+		t.Fatalf("recordConversion = %s, %v", result, err)
+	}
+	if c.Status != db.StatusHeld || c.FraudScore != 100 || c.FraudReason != "ip_velocity,fast_conversion" {
+		t.Errorf("conversion = %+v", c)
+	}
+	c = approved()
+	if result, _, err := server.recordConversion(c, true, "network:net", ""); err != nil || result != resultDuplicate || c.Status != db.StatusHeld {
+		t.Errorf("approval of a held conversion = %s %s, %v", result, c.Status, err)
+	}
+
+	// A second conversion of the same type on the click is a duplicate
+	second := &db.Conversion{VisitorID: visit.VisitorID, ClickID: clickID, CampaignID: "test-campaign", Status: db.StatusApproved, CreatedAt: time.Now().Add(time.Hour)}
+	if _, _, err := server.recordConversion(second, false, "postback", ""); err != nil {
+		t.Fatalf("recordConversion: %v", err)
+	}
+	if second.FraudReason != "ip_velocity,duplicate_click" || second.Status != db.StatusHeld {
+		t.Errorf("second conversion = %+v", second)
+	}
+
+	report := func(risk string) db.ReportRow {
+		t.Helper()
+		r, err := database.RunReport(db.ReportQuery{
+			Filters: map[string][]string{"fraud_risk": {risk}},
+			From:    time.Now().Add(-time.Hour), To: time.Now().Add(2 * time.Hour),
+		})
+		if err != nil {
+			t.Fatalf("RunReport: %v", err)
+		}
+		return r.Totals
+	}
+	if low := report(db.FraudRiskLow); low.Clicks != 2 || low.Conversions != 0 {
+		t.Errorf("low risk = %+v", low)
+	}
+	if medium := report(db.FraudRiskMedium); medium.Clicks != 1 || medium.Conversions != 0 {
+		t.Errorf("medium risk = %+v", medium)
+	}
+	// Held conversions count once released
+	if high := report(db.FraudRiskHigh); high.Clicks != 0 || high.Conversions != 0 {
+		t.Errorf("high risk while held = %+v", high)
+	}
+	if err := database.UpdateConversionStatus(c, db.StatusApproved, c.Amount, "manual"); err != nil {
+		t.Fatalf("UpdateConversionStatus: %v", err)
+	}
+	if high := report(db.FraudRiskHigh); high.Clicks != 0 || high.Conversions != 1 || high.Revenue != 10 {
+		t.Errorf("high risk = %+v", high)
+	}
+}
+
+func TestHeldConversionsSendNothingUntilReleased(t *testing.T) {
+	server, database := newTestServer(t)
+	server.fraud = fraud.NewScorer(fraud.Options{HoldScore: 50})
+	server.connectors = connectors.NewRegistry(&connectors.Facebook{PixelID: "123", AccessToken: "token", APIVersion: "v99.0"})
+	if err := database.SetCampaignConnectors("test-campaign", []db.CampaignConnector{{Connector: "facebook"}}); err != nil {
+		t.Fatalf("SetCampaignConnectors: %v", err)
+	}
+	source := &db.TrafficSource{Name: "adsnet", PostbackURL: "https://ads.example/cv?clickid={external_id}"}
+	if err := database.SaveTrafficSource(source); err != nil {
+		t.Fatalf("SaveTrafficSource: %v", err)
+	}
+	campaign, err := database.GetCampaignByID("test-campaign")
+	if err != nil {
+		t.Fatalf("GetCampaignByID: %v", err)
+	}
+	campaign.TrafficSource = "adsnet"
+	if err := database.UpdateCampaign(campaign); err != nil {
+		t.Fatalf("UpdateCampaign: %v", err)
+	}
+	addNetwork(t, database, "net")
+
+	location, _ := url.Parse(doClick(server, "/click?rtkck=1234567890").Header().Get("Location"))
+	clickID := location.Query().Get("clickid")
+	visit := &db.Visit{VisitorID: "v1", ClickID: clickID, CampaignID: "test-campaign", CreatedAt: time.Now()}
+	if err := database.SaveVisit(visit); err != nil {
+		t.Fatalf("SaveVisit: %v", err)
+	}
+
+	// Converting right after the click is held, and so is its approval
+	for _, status := range []string{"pending", "approved"} {
+		code, resp := postback(t, server, "network=net&clickid="+clickID+"&payout=8&txid=t1&status="+status)
+		if code != 200 || resp["conversion_status"] != db.StatusHeld {
+			t.Fatalf("%s postback = %d %v", status, code, resp)
+		}
+	}
+	deliveries, err := database.GetDeliveries("", 0, 10)
+	if err != nil || len(deliveries) != 0 {
+		t.Fatalf("deliveries while held = %+v, %v", deliveries, err)
+	}
+	stats, err := database.GetAllStats()
+	if err != nil || stats.Summary.TotalRevenue != 0 {
+		t.Fatalf("summary while held = %+v, %v", stats.Summary, err)
+	}
+
+	conversion, err := database.GetConversionByTransactionID("net", "t1")
+	if err != nil {
+		t.Fatalf("GetConversionByTransactionID: %v", err)
+	}
+	body := fmt.Sprintf(`{"conversion_id": %d, "status": "approved"}`, conversion.ID)
+	w := httptest.NewRecorder()
+	server.HandleConversionStatus(w, httptest.NewRequest("PUT", "/api/conversions/status", strings.NewReader(body)))
+	if w.Code != 200 {
+		t.Fatalf("release = %d %s", w.Code, w.Body.String())
+	}
+
+	deliveries, err = database.GetDeliveries("", 0, 10)
+	if err != nil || len(deliveries) != 2 {
+		t.Fatalf("deliveries after release = %+v, %v", deliveries, err)
+	}
+	kinds := map[string]bool{deliveries[0].Kind: true, deliveries[1].Kind: true}
+	if !kinds["facebook"] || !kinds[deliveryTrafficSource] {
+		t.Errorf("delivery kinds = %v", kinds)
+	}
+	stats, err = database.GetAllStats()
+	if err != nil || stats.Summary.TotalRevenue != 8 {
+		t.Errorf("summary after release = %+v, %v", stats.Summary, err)
+	}
+}
@@ -5,9 +5,13 @@ import (
     "net/http"
     "time"
     "github.com/google/uuid"
+    "unchained-tracker/internal/bots"
     "unchained-tracker/internal/db"
+    "unchained-tracker/internal/events"
+    "unchained-tracker/internal/geo"
     "database/sql"
     "log"
+    "net/url"
 )
 
 type VisitRequest struct {
@@ -29,6 +33,14 @@ type VisitRequest struct {
     UTMCampaign      string `json:"utm_campaign"`
     UTMContent       string `json:"utm_content"`
     UTMTerm          string `json:"utm_term"`
+    // Params carries the lander's query string so the campaign's custom
+    // parameters can be captured from it
+    Params           map[string]string `json:"params"`
+    // FBC and FBP are the lander's _fbc and _fbp cookies
+    FBC              string `json:"fbc"`
+    FBP              string `json:"fbp"`
+    // Webdriver is navigator.webdriver, set in automated browsers
+    Webdriver        bool   `json:"webdriver"`
 }
 
 func (s *Server) HandleVisit(w http.ResponseWriter, r *http.Request) {
@@ -44,9 +56,8 @@ func (s *Server) HandleVisit(w http.ResponseWriter, r *http.Request) {
     }
 
     // Check if visit already exists for this click_id
-    var existingVisitorID string
     log.Printf("Checking for existing visit with click_id: %s", req.ClickID)
-    err := s.db.QueryRow("SELECT visitor_id FROM visit WHERE click_id = ?", req.ClickID).Scan(&existingVisitorID)
+    existingVisitorID, err := s.db.GetVisitorIDByClickID(req.ClickID)
     if err != sql.ErrNoRows {
         if err == nil {
             log.Printf("Found existing visit: visitor_id=%s", existingVisitorID)
@@ -71,22 +82,29 @@ func (s *Server) HandleVisit(w http.ResponseWriter, r *http.Request) {
     log.Printf("Creating new visit: click_id=%s visitor_id=%s", req.ClickID, visitorID)
 
     // Get location info
-    country, region, city, err := s.geo.GetLocation(r.RemoteAddr)
-    if err != nil {
-        log.Printf("Error getting location: %v", err)
-        // Don't fail the request, just log the error
+    ip := s.clientIP(r)
+    loc := s.lookup(ip)
+    if loc == nil {
+        loc = &geo.Location{}
+    }
+    country, region, city := loc.Country, loc.Region, loc.City
+
+    userAgent := req.UserAgent
+    if userAgent == "" {
+        userAgent = r.UserAgent()
     }
+    agent := s.visitAgent(r, &req, userAgent)
 
     visit := &db.Visit{
         VisitorID:        visitorID,
         ClickID:          req.ClickID,
         CampaignID:       req.CampaignID,
-        IPAddress:        r.RemoteAddr,
-        UserAgent:        req.UserAgent,
-        Browser:          req.Browser,
-        BrowserVersion:   req.BrowserVersion,
-        OS:              req.OS,
-        DeviceType:       req.DeviceType,
+        IPAddress:        ip,
+        UserAgent:        userAgent,
+        Browser:          agent.Browser,
+        BrowserVersion:   agent.BrowserVersion,
+        OS:               agent.OS,
+        DeviceType:       agent.DeviceType,
         ScreenResolution: req.ScreenResolution,
         ViewportSize:     req.ViewportSize,
         Language:         req.Language,
@@ -104,15 +122,104 @@ func (s *Server) HandleVisit(w http.ResponseWriter, r *http.Request) {
         CreatedAt:        time.Now(),
     }
 
+    // The click the lander was reached from, nil when unknown
+    var click *db.Click
+    if req.ClickID != "" {
+        click, _ = s.db.GetClickByID(req.ClickID)
+    }
+
+    visit.Subs = s.visitSubs(&req, click)
+    visit.FBC, visit.FBP = visitFacebookIDs(&req, click)
+
+    policy := s.visitBotPolicy(&req, click)
+    verdict := s.checkBot(policy, bots.Signals{
+        UserAgent: userAgent,
+        Screen:    req.ScreenResolution,
+        Timezone:  req.Timezone,
+        Webdriver: req.Webdriver,
+        Script:    true,
+    }, ip, loc)
+    visit.IsBot, visit.BotReason = verdict.Bot, verdict.Reason()
+
+    if visit.IsBot && policy == db.BotPolicyDrop {
+        // Answer as usual so the tracking script carries on
+        log.Printf("Dropped bot visit on campaign %s (%s)", visit.CampaignID, visit.BotReason)
+        w.Header().Set("Content-Type", "application/json")
+        json.NewEncoder(w).Encode(map[string]interface{}{
+            "status":     "success",
+            "visitor_id": visitorID,
+        })
+        return
+    }
+
     if err := s.db.SaveVisit(visit); err != nil {
         log.Printf("Error saving visit: %v", err)
         http.Error(w, err.Error(), http.StatusInternalServerError)
         return
     }
+    s.publish(events.TypeVisit, visit.CampaignID, visit)
 
+    requestClientHints(w)
     w.Header().Set("Content-Type", "application/json")
     json.NewEncoder(w).Encode(map[string]interface{}{
         "status":     "success",
         "visitor_id": visitorID,
     })
-} 
\ No newline at end of file
+} 
+
+// visitBotPolicy is the bot policy of the visit's campaign, or of its
+// click's when the lander doesn't name one
+func (s *Server) visitBotPolicy(req *VisitRequest, click *db.Click) string {
+    campaignID := req.CampaignID
+    if campaignID == "" && click != nil {
+        campaignID = click.CampaignID
+    }
+    if campaignID == "" {
+        return db.BotPolicyFlag
+    }
+    campaign, err := s.db.GetCampaignByID(campaignID)
+    if err != nil {
+        return db.BotPolicyFlag
+    }
+    return botPolicy(campaign)
+}
+
+// visitSubs captures the campaign's custom parameters from the lander's query
+// string, falling back to what the click captured when the lander has none.
+func (s *Server) visitSubs(req *VisitRequest, click *db.Click) db.Subs {
+    var subs db.Subs
+    if req.CampaignID != "" && len(req.Params) > 0 {
+        if campaign, err := s.db.GetCampaignByID(req.CampaignID); err == nil {
+            query := url.Values{}
+            for k, v := range req.Params {
+                query.Set(k, v)
+            }
+            subs = captureSubs(query, campaign.CustomParams)
+        }
+    }
+
+    if subs == (db.Subs{}) && click != nil {
+        subs = click.Subs
+    }
+    return subs
+}
+
+// visitFacebookIDs takes the lander's _fbc/_fbp cookies, an fbclid in its
+// query string, or else what the click recorded
+func visitFacebookIDs(req *VisitRequest, click *db.Click) (fbc, fbp string) {
+    fbc = truncate(req.FBC, 255)
+    fbp = truncate(req.FBP, 255)
+    if fbc == "" {
+        fbc = truncate(fbcFromClickID(req.Params["fbclid"], time.Now()), 255)
+    }
+
+    if click != nil {
+        if fbc == "" {
+            fbc = click.FBC
+        }
+        if fbp == "" {
+            fbp = click.FBP
+        }
+    }
+    return fbc, fbp
+}
@@ -5,19 +5,42 @@ import (
     "net/http/httptest"
     "encoding/json"
     "bytes"
+    "unchained-tracker/internal/config"
+    "unchained-tracker/internal/db"
+    "unchained-tracker/internal/db/migrations"
+    "unchained-tracker/internal/geo"
 )
 
+// newTestServer returns a Server backed by a migrated in-memory SQLite store
+func newTestServer(t *testing.T) (*Server, *db.Database) {
+    t.Helper()
+
+    testDB, err := db.Connect("sqlite::memory:")
+    if err != nil {
+        t.Fatalf("Error opening test database: %v", err)
+    }
+    t.Cleanup(func() { testDB.Close() })
+
+    if err := migrations.Run(testDB.DB(), testDB.Driver()); err != nil {
+        t.Fatalf("Error migrating test database: %v", err)
+    }
+
+    geoService, _ := geo.NewService(geo.Options{})
+    return NewServer(testDB, &config.Config{}, geoService), testDB
+}
+
 func TestTrackVisit(t *testing.T) {
     // Create test server
-    server := NewServer(testDB, testConfig)
+    server, _ := newTestServer(t)
 
     // Create test request
     body := map[string]interface{}{
-        "campaign_id": "test_campaign",
+        "campaign_id": "test-campaign",
         "click_id": "test123",
     }
     jsonBody, _ := json.Marshal(body)
     req := httptest.NewRequest("POST", "/track", bytes.NewBuffer(jsonBody))
+    req.RemoteAddr = "127.0.0.1:1234" // Loopback skips the geo lookup
     w := httptest.NewRecorder()
 
     // Handle request
@@ -33,4 +56,4 @@ func TestTrackVisit(t *testing.T) {
     if response["status"] != "success" {
         t.Errorf("Expected success status, got %v", response["status"])
     }
-} 
\ No newline at end of file
+}
@@ -6,7 +6,9 @@ import (
     "log"
     "net/http"
     "strconv"
+    "strings"
     "time"
+    "unchained-tracker/internal/connectors"
     "unchained-tracker/internal/db"
 )
 
@@ -17,21 +19,50 @@ type NetworkPostback struct {
     Network    string  `json:"network"`
     Status     string  `json:"status"`
     ExternalID string  `json:"external_id"`
+    Currency   string  `json:"currency"`
+    Type       string  `json:"type"`
+    EventID    string  `json:"event_id"`
+    HasAmount  bool    `json:"-"`
+    // Contact is forwarded hashed to Facebook and never stored
+    Contact    connectors.Contact `json:"-"`
 }
 
+// HandleNetworkPostback records a server postback from an affiliate
+// network, named by the /postback/{network} path or the network parameter.
+// The network's mapping says which parameters carry which values.
 func (s *Server) HandleNetworkPostback(w http.ResponseWriter, r *http.Request) {
     log.Printf("Received network postback: %s %s", r.Method, r.URL.String())
 
-    // Parse parameters based on known network formats
-    postback := parseNetworkParameters(r)
-    
-    log.Printf("Parsed postback parameters: %+v", postback)
-    
+    networkName := r.PathValue("network")
+    if networkName == "" {
+        networkName = r.URL.Query().Get("network")
+    }
+    network, ok := s.authorizePostback(w, r, networkName, nil)
+    if !ok {
+        return
+    }
+
+    // Parse parameters based on the network's format
+    postback := parseNetworkParameters(r, network.Mapping, s.config.TransactionIDParam)
+    postback.Network = network.Name
+
+    log.Printf("Parsed postback parameters: click_id=%s amount=%.2f status=%s txid=%s", postback.ClickID, postback.Amount, postback.Status, postback.ExternalID)
+
     if postback.ClickID == "" {
         http.Error(w, "Missing click_id parameter", http.StatusBadRequest)
         return
     }
 
+    status, ok := network.Mapping.MapStatus(postback.Status)
+    if !ok {
+        http.Error(w, "Invalid status: "+postback.Status, http.StatusBadRequest)
+        return
+    }
+
+    if postback.Currency != "" && !validCurrency(postback.Currency) {
+        http.Error(w, "Invalid currency: "+postback.Currency, http.StatusBadRequest)
+        return
+    }
     log.Printf("Looking for visit with click_id: %s", postback.ClickID)
 
     // Get visit info from click_id
@@ -44,60 +75,112 @@ func (s *Server) HandleNetworkPostback(w http.ResponseWriter, r *http.Request) {
 
     log.Printf("Found visit: %+v", visit)
 
-    // Create conversion
+    // Create conversion, or update the one this transaction already created
     conversion := &db.Conversion{
-        VisitorID:  visit.VisitorID,
-        ClickID:    postback.ClickID,
-        CampaignID: visit.CampaignID,
-        Amount:     postback.Amount,
-        Status:     postback.Status,
-        CreatedAt:  time.Now(),
+        VisitorID:     visit.VisitorID,
+        ClickID:       postback.ClickID,
+        CampaignID:    visit.CampaignID,
+        Amount:        postback.Amount,
+        Status:        status,
+        TransactionID: postback.ExternalID,
+        Network:       postback.Network,
+        Currency:      postback.Currency,
+        Type:          postback.Type,
+        EventID:       postback.EventID,
+        CreatedAt:     time.Now(),
     }
 
-    if err := s.db.SaveConversion(conversion); err != nil {
-        log.Printf("Error saving conversion: %v", err)
-        http.Error(w, err.Error(), http.StatusInternalServerError)
+    result, previous, err := s.recordConversion(conversion, postback.HasAmount, "network:"+postback.Network, "")
+    if err != nil {
+        writeRecordError(w, err)
         return
     }
 
-    log.Printf("Saved conversion: id=%d amount=%.2f", conversion.ID, conversion.Amount)
+    switch result {
+    case resultDuplicate:
+        log.Printf("Duplicate postback: id=%d network=%s transaction_id=%s", conversion.ID, conversion.Network, conversion.TransactionID)
+    case resultUpdated:
+        log.Printf("Updated conversion: id=%d status=%s->%s amount=%.2f", conversion.ID, previous, conversion.Status, conversion.Amount)
+    default:
+        log.Printf("Saved conversion: id=%d amount=%.2f", conversion.ID, conversion.Amount)
+    }
 
-    // Optional: Send to Facebook
-    if s.config.FacebookEnabled {
-        go s.sendToFacebook(conversion, r)
+    // Report conversions to the campaign's ad platforms once they count
+    if result != resultDuplicate && db.CountsAsRevenue(conversion.Status) {
+        s.sendToConnectors(conversion, postback.Contact)
     }
 
+    s.notifyTrafficSource(conversion, result)
+    s.publishConversion(conversion, result, previous)
+
     w.Header().Set("Content-Type", "application/json")
     json.NewEncoder(w).Encode(map[string]interface{}{
-        "status":        "success",
-        "conversion_id": conversion.ID,
-        "amount":        conversion.Amount,
-        "click_id":      conversion.ClickID,
-        "network":       postback.Network,
+        "status":            result,
+        "conversion_id":     conversion.ID,
+        "conversion_status": conversion.Status,
+        "previous_status":   previous,
+        "amount":            conversion.Amount,
+        "click_id":          conversion.ClickID,
+        "currency":          conversion.Currency,
+        "network":           postback.Network,
     })
 }
 
-func parseNetworkParameters(r *http.Request) NetworkPostback {
+// parseNetworkParameters reads a postback's query string. Each value is
+// taken from the parameter the network's mapping names, or when it names
+// none from the usual guesses. txidParam names an extra parameter carrying
+// the transaction ID, checked before the usual txid and transaction_id.
+func parseNetworkParameters(r *http.Request, mapping db.PostbackMapping, txidParam string) NetworkPostback {
+    query := r.URL.Query()
+
     // Get all possible parameter names
     clickIDParams := []string{"click_id", "clickid", "click", "id"}
     amountParams := []string{"amount", "payout", "revenue"}
-    
-    var postback NetworkPostback
-    
-    // Find click_id
-    for _, param := range clickIDParams {
-        if val := r.URL.Query().Get(param); val != "" {
-            postback.ClickID = val
-            break
+    txidParams := []string{"txid", "transaction_id"}
+    if txidParam != "" {
+        txidParams = append([]string{txidParam}, txidParams...)
+    }
+    statusParams := []string{"status"}
+    currencyParams := []string{"currency"}
+
+    // The network's mapping replaces the guesses
+    mapped := func(param string, guesses []string) []string {
+        if param != "" {
+            return []string{param}
+        }
+        return guesses
+    }
+    clickIDParams = mapped(mapping.ClickIDParam, clickIDParams)
+    amountParams = mapped(mapping.PayoutParam, amountParams)
+    txidParams = mapped(mapping.TransactionIDParam, txidParams)
+    statusParams = mapped(mapping.StatusParam, statusParams)
+    currencyParams = mapped(mapping.CurrencyParam, currencyParams)
+
+    first := func(params []string) string {
+        for _, param := range params {
+            if val := query.Get(param); val != "" {
+                return val
+            }
         }
+        return ""
     }
 
+    var postback NetworkPostback
+    postback.ClickID = first(clickIDParams)
+    postback.ExternalID = first(txidParams)
+    postback.Status = first(statusParams)
+    postback.Currency = strings.ToUpper(first(currencyParams))
+    postback.Type = truncate(first([]string{"type", "event"}), 50)
+    postback.EventID = truncate(query.Get("event_id"), 100)
+    postback.Contact = connectors.Contact{Email: query.Get("email"), Phone: query.Get("phone")}
+
     // Find amount
     for _, param := range amountParams {
-        if val := r.URL.Query().Get(param); val != "" {
+        if val := query.Get(param); val != "" {
             amount, err := strconv.ParseFloat(val, 64)
             if err == nil {
                 postback.Amount = amount
+                postback.HasAmount = true
                 break
             }
         }
@@ -105,15 +188,21 @@ func parseNetworkParameters(r *http.Request) NetworkPostback {
 
     // Set defaults
     if postback.Status == "" {
-        postback.Status = "completed"
-    }
-    
-    // Try to identify network
-    if r.URL.Query().Get("network") != "" {
-        postback.Network = r.URL.Query().Get("network")
-    } else {
-        postback.Network = "unknown"
+        postback.Status = db.StatusApproved
     }
 
     return postback
-} 
\ No newline at end of file
+}
+
+// validCurrency reports whether code looks like an ISO 4217 code
+func validCurrency(code string) bool {
+    if len(code) != 3 {
+        return false
+    }
+    for _, c := range code {
+        if c < 'A' || c > 'Z' {
+            return false
+        }
+    }
+    return true
+}
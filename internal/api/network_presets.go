@@ -0,0 +1,112 @@
+package api
+
+import (
+	"sort"
+
+	"unchained-tracker/internal/db"
+)
+
+// NetworkPreset is a ready-made postback mapping for a common affiliate
+// platform. Query is what to paste into the platform after
+// /postback/{network}?, with the platform's own macros filled in.
+type NetworkPreset struct {
+	Name    string             `json:"name"`
+	Label   string             `json:"label"`
+	Mapping db.PostbackMapping `json:"mapping"`
+	Query   string             `json:"query"`
+}
+
+var networkPresets = map[string]NetworkPreset{
+	"everflow": {
+		Label: "Everflow",
+		Mapping: db.PostbackMapping{
+			ClickIDParam:       "sub1",
+			PayoutParam:        "payout_amount",
+			TransactionIDParam: "conversion_id",
+			CurrencyParam:      "currency",
+		},
+		Query: "sub1={sub1}&payout_amount={payout_amount}&conversion_id={conversion_id}&currency={currency}",
+	},
+	"cake": {
+		Label: "CAKE",
+		Mapping: db.PostbackMapping{
+			ClickIDParam:       "s2",
+			PayoutParam:        "price",
+			TransactionIDParam: "tid",
+		},
+		Query: "s2=#s2#&price=#price#&tid=#tid#",
+	},
+	"tune": {
+		Label: "TUNE (HasOffers)",
+		Mapping: db.PostbackMapping{
+			ClickIDParam:       "aff_sub",
+			PayoutParam:        "payout",
+			TransactionIDParam: "transaction_id",
+			CurrencyParam:      "currency",
+		},
+		Query: "aff_sub={aff_sub}&payout={payout}&transaction_id={transaction_id}&currency={currency}",
+	},
+	"impact": {
+		Label: "Impact",
+		Mapping: db.PostbackMapping{
+			ClickIDParam:       "subid1",
+			PayoutParam:        "payout",
+			StatusParam:        "status",
+			StatusValues:       map[string]string{"approved": "approved", "pending": "pending", "reversed": "chargeback"},
+			TransactionIDParam: "action_id",
+			CurrencyParam:      "currency",
+		},
+		Query: "subid1={SubId1}&payout={Payout}&status={ActionStatus}&action_id={ActionId}&currency={Currency}",
+	},
+}
+
+func init() {
+	for name, preset := range networkPresets {
+		preset.Name = name
+		networkPresets[name] = preset
+	}
+}
+
+// applyPreset fills the mapping fields n leaves empty from its preset.
+// Status values set on n win over the preset's. ok is false for an
+// unknown preset.
+func applyPreset(n *db.AffiliateNetwork) (ok bool) {
+	if n.Preset == "" {
+		return true
+	}
+	preset, ok := networkPresets[n.Preset]
+	if !ok {
+		return false
+	}
+
+	m, p := &n.Mapping, preset.Mapping
+	fill := func(field *string, value string) {
+		if *field == "" {
+			*field = value
+		}
+	}
+	fill(&m.ClickIDParam, p.ClickIDParam)
+	fill(&m.PayoutParam, p.PayoutParam)
+	fill(&m.StatusParam, p.StatusParam)
+	fill(&m.TransactionIDParam, p.TransactionIDParam)
+	fill(&m.CurrencyParam, p.CurrencyParam)
+
+	values := make(map[string]string, len(p.StatusValues)+len(m.StatusValues))
+	for k, v := range p.StatusValues {
+		values[k] = v
+	}
+	for k, v := range m.StatusValues {
+		values[k] = v
+	}
+	m.StatusValues = values
+	return true
+}
+
+func sortedPresets() []NetworkPreset {
+	presets := make([]NetworkPreset, 0, len(networkPresets))
+	for _, preset := range networkPresets {
+		presets = append(presets, preset)
+	}
+	sort.Slice(presets, func(i, j int) bool { return presets[i].Name < presets[j].Name })
+	return presets
+}
@@ -0,0 +1,180 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net"
+	"net/http"
+	"regexp"
+	"strconv"
+
+	"unchained-tracker/internal/db"
+)
+
+// networkName is what a network may be called; the name appears in
+// postback URLs
+var networkName = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]*$`)
+
+// AffiliateNetworkRequest creates or updates a network. Its secrets are
+// write-only: listings leave them out, and an update without them keeps
+// the stored ones.
+type AffiliateNetworkRequest struct {
+	db.AffiliateNetwork
+	Secret     string `json:"secret,omitempty"`
+	HMACSecret string `json:"hmac_secret,omitempty"`
+}
+
+// HandleAffiliateNetworks manages the networks allowed to send postbacks.
+// GET lists them, POST creates or (with an id) updates one, DELETE removes
+// one by id.
+func (s *Server) HandleAffiliateNetworks(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		networks, err := s.db.GetAffiliateNetworks()
+		if err != nil {
+			log.Printf("Error getting networks: %v", err)
+			http.Error(w, "Error getting networks", http.StatusInternalServerError)
+			return
+		}
+		if networks == nil {
+			networks = []*db.AffiliateNetwork{}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(networks)
+
+	case http.MethodPost:
+		var req AffiliateNetworkRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		network := req.AffiliateNetwork
+		network.Secret, network.HMACSecret = req.Secret, req.HMACSecret
+		if network.ID != 0 {
+			existing, err := s.db.GetAffiliateNetworkByID(network.ID)
+			if err == sql.ErrNoRows {
+				http.Error(w, "Network not found", http.StatusNotFound)
+				return
+			}
+			if err != nil {
+				log.Printf("Error getting network %d: %v", network.ID, err)
+				http.Error(w, "Error getting network", http.StatusInternalServerError)
+				return
+			}
+			if network.Secret == "" {
+				network.Secret = existing.Secret
+			}
+			if network.HMACSecret == "" {
+				network.HMACSecret = existing.HMACSecret
+			}
+		}
+		if !applyPreset(&network) {
+			http.Error(w, "Unknown preset: "+network.Preset, http.StatusBadRequest)
+			return
+		}
+		if msg := validateNetwork(&network); msg != "" {
+			http.Error(w, msg, http.StatusBadRequest)
+			return
+		}
+
+		if err := s.db.SaveAffiliateNetwork(&network); err != nil {
+			if err == sql.ErrNoRows {
+				http.Error(w, "Network not found", http.StatusNotFound)
+				return
+			}
+			log.Printf("Error saving network: %v", err)
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if req.ID != 0 {
+			json.NewEncoder(w).Encode(network)
+			return
+		}
+		// The secrets are shown this once, when the network is created
+		req.AffiliateNetwork = network
+		json.NewEncoder(w).Encode(req)
+
+	case http.MethodDelete:
+		id, err := strconv.ParseInt(r.URL.Query().Get("id"), 10, 64)
+		if err != nil {
+			http.Error(w, "Invalid ID", http.StatusBadRequest)
+			return
+		}
+		if err := s.db.DeleteAffiliateNetwork(id); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{
+			"status": "success",
+		})
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// validateNetwork returns a message describing what's wrong with n, or ""
+func validateNetwork(n *db.AffiliateNetwork) string {
+	if !networkName.MatchString(n.Name) {
+		return "name must be lowercase letters, digits, - or _"
+	}
+	if n.Secret == "" && n.HMACSecret == "" && len(n.AllowedIPs) == 0 {
+		return "a network needs a secret, an hmac_secret or allowed_ips"
+	}
+	for _, entry := range n.AllowedIPs {
+		if _, _, err := net.ParseCIDR(entry); err != nil && net.ParseIP(entry) == nil {
+			return "Invalid IP or CIDR range: " + entry
+		}
+	}
+	for value, status := range n.Mapping.StatusValues {
+		if _, ok := db.NormalizeStatus(status); !ok {
+			return "Status value " + value + " maps to unknown status " + status
+		}
+	}
+	return ""
+}
+
+// HandleNetworkPresets lists the built-in network mappings
+func (s *Server) HandleNetworkPresets(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(sortedPresets())
+}
+
+// HandlePostbackRejections lists the most recent rejected postbacks
+func (s *Server) HandlePostbackRejections(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	limit := 100
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			http.Error(w, "Invalid limit", http.StatusBadRequest)
+			return
+		}
+		limit = n
+	}
+
+	rejections, err := s.db.GetPostbackRejections(limit)
+	if err != nil {
+		log.Printf("Error getting postback rejections: %v", err)
+		http.Error(w, "Error getting postback rejections", http.StatusInternalServerError)
+		return
+	}
+	if rejections == nil {
+		rejections = []db.PostbackRejection{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(rejections)
+}
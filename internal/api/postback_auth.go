@@ -0,0 +1,124 @@
+package api
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/hex"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+
+	"unchained-tracker/internal/db"
+)
+
+// authorizePostback checks a server postback against the credentials of
+// the network it claims to come from. Rejected attempts are logged to the
+// postback_rejection table and answered with 403; the caller must stop
+// when ok is false. body is the raw request body, signed instead of the
+// query string when present.
+func (s *Server) authorizePostback(w http.ResponseWriter, r *http.Request, networkName string, body []byte) (network *db.AffiliateNetwork, ok bool) {
+	ip := s.clientIP(r)
+
+	network, err := s.db.GetAffiliateNetworkByName(networkName)
+	reason := ""
+	switch {
+	case err == sql.ErrNoRows:
+		reason = "unknown network"
+	case err != nil:
+		log.Printf("Error getting network %q: %v", networkName, err)
+		http.Error(w, "Error authenticating postback", http.StatusInternalServerError)
+		return nil, false
+	default:
+		reason = checkPostbackCredentials(r, body, ip, network)
+	}
+
+	if reason == "" {
+		return network, true
+	}
+
+	log.Printf("Rejected postback from %s for network %q: %s", ip, networkName, reason)
+	rejection := &db.PostbackRejection{
+		Network:    networkName,
+		IPAddress:  ip,
+		Reason:     reason,
+		RequestURL: r.URL.String(),
+	}
+	if err := s.db.SavePostbackRejection(rejection); err != nil {
+		log.Printf("Error saving postback rejection: %v", err)
+	}
+	http.Error(w, "Postback rejected", http.StatusForbidden)
+	return nil, false
+}
+
+// checkPostbackCredentials returns why r fails network's checks, or ""
+func checkPostbackCredentials(r *http.Request, body []byte, ip string, network *db.AffiliateNetwork) string {
+	if len(network.AllowedIPs) > 0 && !ipAllowed(ip, network.AllowedIPs) {
+		return "ip not allowed"
+	}
+
+	if network.Secret != "" {
+		token := r.URL.Query().Get("token")
+		if token == "" {
+			token = r.Header.Get("X-Postback-Token")
+		}
+		if subtle.ConstantTimeCompare([]byte(token), []byte(network.Secret)) != 1 {
+			return "invalid token"
+		}
+	}
+
+	if network.HMACSecret != "" {
+		signature := r.URL.Query().Get("signature")
+		if signature == "" {
+			signature = r.Header.Get("X-Signature")
+		}
+		if !validSignature(r, body, network.HMACSecret, signature) {
+			return "invalid signature"
+		}
+	}
+
+	return ""
+}
+
+// validSignature checks a hex HMAC-SHA256 of the body, or for bodiless
+// requests of the sorted query string without the signature parameter.
+// A "sha256=" prefix is accepted.
+func validSignature(r *http.Request, body []byte, secret, signature string) bool {
+	got, err := hex.DecodeString(strings.TrimPrefix(strings.ToLower(signature), "sha256="))
+	if err != nil || len(got) == 0 {
+		return false
+	}
+	return hmac.Equal(got, postbackSignature(r, body, secret))
+}
+
+func postbackSignature(r *http.Request, body []byte, secret string) []byte {
+	message := body
+	if len(message) == 0 {
+		query := r.URL.Query()
+		query.Del("signature")
+		message = []byte(query.Encode())
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(message)
+	return mac.Sum(nil)
+}
+
+// ipAllowed reports whether ip matches one of the IPs or CIDR ranges
+func ipAllowed(ip string, allowed []string) bool {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return false
+	}
+	for _, entry := range allowed {
+		if _, cidr, err := net.ParseCIDR(entry); err == nil {
+			if cidr.Contains(parsed) {
+				return true
+			}
+		} else if allowedIP := net.ParseIP(entry); allowedIP != nil && allowedIP.Equal(parsed) {
+			return true
+		}
+	}
+	return false
+}
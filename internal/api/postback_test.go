@@ -0,0 +1,296 @@
+package api
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"unchained-tracker/internal/db"
+)
+
+// postback sends a network postback and decodes the JSON response
+func postback(t *testing.T, server *Server, query string) (int, map[string]interface{}) {
+	t.Helper()
+
+	req := httptest.NewRequest("GET", "/network/postback?"+query, nil)
+	w := httptest.NewRecorder()
+	server.HandleNetworkPostback(w, req)
+
+	var response map[string]interface{}
+	json.NewDecoder(w.Body).Decode(&response)
+	return w.Code, response
+}
+
+// addNetwork registers a network that accepts postbacks from httptest's
+// default remote address
+func addNetwork(t *testing.T, database *db.Database, name string) {
+	t.Helper()
+
+	network := &db.AffiliateNetwork{Name: name, AllowedIPs: []string{"192.0.2.0/24"}}
+	if err := database.SaveAffiliateNetwork(network); err != nil {
+		t.Fatalf("SaveAffiliateNetwork: %v", err)
+	}
+}
+
+func TestNetworkPostbackStatusUpdates(t *testing.T) {
+	server, database := newTestServer(t)
+	addNetwork(t, database, "test")
+
+	visit := &db.Visit{VisitorID: "v1", ClickID: "c1", CampaignID: "test-campaign", CreatedAt: time.Now()}
+	if err := database.SaveVisit(visit); err != nil {
+		t.Fatalf("SaveVisit: %v", err)
+	}
+
+	code, resp := postback(t, server, "clickid=c1&payout=5&status=pending&transaction_id=tx1&network=test")
+	if code != 200 || resp["status"] != "success" || resp["conversion_status"] != db.StatusPending {
+		t.Fatalf("first postback = %d %v", code, resp)
+	}
+	id := resp["conversion_id"]
+
+	// A chargeback without a payout keeps the amount but isn't allowed
+	// straight from pending
+	code, _ = postback(t, server, "clickid=c1&status=chargeback&transaction_id=tx1&network=test")
+	if code != 409 {
+		t.Fatalf("pending -> chargeback = %d, want 409", code)
+	}
+
+	code, resp = postback(t, server, "clickid=c1&status=approved&transaction_id=tx1&network=test")
+	if code != 200 || resp["status"] != "updated" || resp["conversion_id"] != id ||
+		resp["previous_status"] != db.StatusPending || resp["amount"] != 5.0 {
+		t.Fatalf("approve postback = %d %v", code, resp)
+	}
+
+	code, _ = postback(t, server, "clickid=c1&status=bogus&transaction_id=tx1&network=test")
+	if code != 400 {
+		t.Fatalf("unknown status = %d, want 400", code)
+	}
+
+	history, err := database.GetConversionHistory(int64(id.(float64)))
+	if err != nil || len(history) != 2 || history[1].Source != "network:test" {
+		t.Fatalf("history = %+v, %v", history, err)
+	}
+}
+
+func TestNetworkPostbackRetriesAreIdempotent(t *testing.T) {
+	server, database := newTestServer(t)
+	server.config.TransactionIDParam = "oid"
+	addNetwork(t, database, "everflow")
+	addNetwork(t, database, "cake")
+
+	visit := &db.Visit{VisitorID: "v1", ClickID: "c1", CampaignID: "test-campaign", CreatedAt: time.Now()}
+	if err := database.SaveVisit(visit); err != nil {
+		t.Fatalf("SaveVisit: %v", err)
+	}
+
+	code, first := postback(t, server, "clickid=c1&payout=5&txid=abc&network=everflow")
+	if code != 200 || first["status"] != "success" {
+		t.Fatalf("first postback = %d %v", code, first)
+	}
+
+	code, retry := postback(t, server, "clickid=c1&payout=5&transaction_id=abc&network=everflow")
+	if code != 200 || retry["status"] != "duplicate" || retry["conversion_id"] != first["conversion_id"] {
+		t.Fatalf("retry = %d %v", code, retry)
+	}
+
+	// The same transaction ID from another network is a different sale
+	code, other := postback(t, server, "clickid=c1&payout=5&oid=abc&network=cake")
+	if code != 200 || other["status"] != "success" || other["conversion_id"] == first["conversion_id"] {
+		t.Fatalf("other network = %d %v", code, other)
+	}
+
+	stats, err := database.GetAllStats()
+	if err != nil {
+		t.Fatalf("GetAllStats: %v", err)
+	}
+	if stats.Summary.TotalConversions != 2 || stats.Summary.TotalRevenue != 10 {
+		t.Errorf("summary = %+v, want 2 conversions worth 10", stats.Summary)
+	}
+}
+
+func TestNetworkPostbackAuthentication(t *testing.T) {
+	server, database := newTestServer(t)
+
+	visit := &db.Visit{VisitorID: "v1", ClickID: "c1", CampaignID: "test-campaign", CreatedAt: time.Now()}
+	if err := database.SaveVisit(visit); err != nil {
+		t.Fatalf("SaveVisit: %v", err)
+	}
+	network := &db.AffiliateNetwork{
+		Name:       "signed",
+		Secret:     "s3cret",
+		HMACSecret: "k3y",
+		AllowedIPs: []string{"192.0.2.0/24", "2001:db8::1"},
+	}
+	if err := database.SaveAffiliateNetwork(network); err != nil {
+		t.Fatalf("SaveAffiliateNetwork: %v", err)
+	}
+
+	sign := func(query string) string {
+		values, _ := url.ParseQuery(query)
+		mac := hmac.New(sha256.New, []byte("k3y"))
+		mac.Write([]byte(values.Encode()))
+		return query + "&signature=" + hex.EncodeToString(mac.Sum(nil))
+	}
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		query      string
+		want       int
+	}{
+		{"unknown network", "192.0.2.1:1234", sign("clickid=c1&network=other&token=s3cret"), 403},
+		{"wrong token", "192.0.2.1:1234", sign("clickid=c1&network=signed&token=nope"), 403},
+		{"bad signature", "192.0.2.1:1234", "clickid=c1&network=signed&token=s3cret&signature=00", 403},
+		{"ip outside allowlist", "198.51.100.7:1234", sign("clickid=c1&network=signed&token=s3cret"), 403},
+		{"valid", "192.0.2.1:1234", sign("clickid=c1&network=signed&token=s3cret&payout=3"), 200},
+		{"valid ipv6", "[2001:db8::1]:1234", sign("clickid=c1&network=signed&token=s3cret&payout=4"), 200},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest("GET", "/network/postback?"+tt.query, nil)
+		req.RemoteAddr = tt.remoteAddr
+		w := httptest.NewRecorder()
+		server.HandleNetworkPostback(w, req)
+		if w.Code != tt.want {
+			t.Errorf("%s: got %d, want %d (%s)", tt.name, w.Code, tt.want, w.Body.String())
+		}
+	}
+
+	rejections, err := database.GetPostbackRejections(10)
+	if err != nil || len(rejections) != 4 {
+		t.Fatalf("rejections = %+v, %v", rejections, err)
+	}
+	if rejections[0].Reason != "ip not allowed" || rejections[0].IPAddress != "198.51.100.7" {
+		t.Errorf("latest rejection = %+v", rejections[0])
+	}
+}
+
+func TestBrowserConversionsAreUnverified(t *testing.T) {
+	server, database := newTestServer(t)
+
+	visit := &db.Visit{VisitorID: "v1", ClickID: "c1", CampaignID: "test-campaign", CreatedAt: time.Now()}
+	if err := database.SaveVisit(visit); err != nil {
+		t.Fatalf("SaveVisit: %v", err)
+	}
+
+	body := `{"visitor_id": "v1", "click_id": "c1", "campaign_id": "test-campaign", "amount": 9, "status": "approved"}`
+	req := httptest.NewRequest("POST", "/postback", strings.NewReader(body))
+	w := httptest.NewRecorder()
+	server.HandleConversion(w, req)
+
+	var response map[string]interface{}
+	json.NewDecoder(w.Body).Decode(&response)
+	if w.Code != 200 || response["conversion_status"] != db.StatusUnverified {
+		t.Fatalf("browser conversion = %d %v", w.Code, response)
+	}
+
+	stats, err := database.GetAllStats()
+	if err != nil {
+		t.Fatalf("GetAllStats: %v", err)
+	}
+	if stats.Summary.TotalConversions != 0 || stats.Summary.TotalRevenue != 0 {
+		t.Errorf("summary = %+v, want no revenue", stats.Summary)
+	}
+	queued, err := database.GetDeliveries("", 0, 10)
+	if err != nil || len(queued) != 0 {
+		t.Errorf("deliveries = %+v, %v", queued, err)
+	}
+
+	body = fmt.Sprintf(`{"conversion_id": %v, "status": "approved"}`, response["conversion_id"])
+	req = httptest.NewRequest("PUT", "/api/conversions/status", strings.NewReader(body))
+	w = httptest.NewRecorder()
+	server.HandleConversionStatus(w, req)
+	if w.Code != 200 {
+		t.Fatalf("approve = %d %s", w.Code, w.Body.String())
+	}
+
+	stats, err = database.GetAllStats()
+	if err != nil {
+		t.Fatalf("GetAllStats: %v", err)
+	}
+	if stats.Summary.TotalConversions != 1 || stats.Summary.TotalRevenue != 9 {
+		t.Errorf("summary after approval = %+v, want 1 conversion worth 9", stats.Summary)
+	}
+}
+
+func TestPresetNetworkPostback(t *testing.T) {
+	server, database := newTestServer(t)
+
+	visit := &db.Visit{VisitorID: "v1", ClickID: "c1", CampaignID: "test-campaign", CreatedAt: time.Now()}
+	if err := database.SaveVisit(visit); err != nil {
+		t.Fatalf("SaveVisit: %v", err)
+	}
+
+	network := &db.AffiliateNetwork{Name: "acme", Preset: "impact", AllowedIPs: []string{"192.0.2.1"}}
+	network.Mapping.StatusValues = map[string]string{"LOCKED": "approved"}
+	if !applyPreset(network) {
+		t.Fatal("impact preset missing")
+	}
+	if err := database.SaveAffiliateNetwork(network); err != nil {
+		t.Fatalf("SaveAffiliateNetwork: %v", err)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/postback/{network}", server.HandleNetworkPostback)
+	send := func(query string) (int, map[string]interface{}) {
+		req := httptest.NewRequest("GET", "/postback/acme?"+query, nil)
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, req)
+		var response map[string]interface{}
+		json.NewDecoder(w.Body).Decode(&response)
+		return w.Code, response
+	}
+
+	// clickid is no longer guessed once the mapping names subid1
+	if code, _ := send("clickid=c1&payout=7"); code != 400 {
+		t.Fatalf("unmapped click id = %d, want 400", code)
+	}
+
+	code, resp := send("subid1=c1&payout=7&status=Locked&action_id=a1&currency=eur")
+	if code != 200 || resp["conversion_status"] != db.StatusApproved || resp["currency"] != "EUR" || resp["network"] != "acme" {
+		t.Fatalf("postback = %d %v", code, resp)
+	}
+
+	code, resp = send("subid1=c1&status=REVERSED&action_id=a1")
+	if code != 200 || resp["conversion_status"] != db.StatusChargeback || resp["amount"] != 7.0 {
+		t.Fatalf("reversal = %d %v", code, resp)
+	}
+}
+
+func TestNetworkSecretsAreWriteOnly(t *testing.T) {
+	server, database := newTestServer(t)
+
+	send := func(method, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		server.HandleAffiliateNetworks(w, httptest.NewRequest(method, "/api/networks", strings.NewReader(body)))
+		return w
+	}
+
+	w := send("POST", `{"name": "acme", "secret": "s3cret", "hmac_secret": "k3y"}`)
+	var created map[string]interface{}
+	json.NewDecoder(w.Body).Decode(&created)
+	if w.Code != 200 || created["secret"] != "s3cret" || created["hmac_secret"] != "k3y" {
+		t.Fatalf("create = %d %v", w.Code, created)
+	}
+
+	w = send("GET", "")
+	if w.Code != 200 || strings.Contains(w.Body.String(), "s3cret") || strings.Contains(w.Body.String(), "k3y") {
+		t.Errorf("list = %d %s", w.Code, w.Body.String())
+	}
+
+	// Editing the network without its secrets keeps them
+	w = send("POST", fmt.Sprintf(`{"id": %v, "name": "acme", "allowed_ips": ["192.0.2.0/24"]}`, created["id"]))
+	if w.Code != 200 || strings.Contains(w.Body.String(), "s3cret") {
+		t.Fatalf("update = %d %s", w.Code, w.Body.String())
+	}
+	network, err := database.GetAffiliateNetworkByName("acme")
+	if err != nil || network.Secret != "s3cret" || network.HMACSecret != "k3y" || len(network.AllowedIPs) != 1 {
+		t.Errorf("network = %+v, %v", network, err)
+	}
+}
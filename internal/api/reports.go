@@ -0,0 +1,312 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"unchained-tracker/internal/db"
+)
+
+// ReportRequest is the body of POST /api/reports. GET takes the same
+// fields as query parameters, with group_by comma separated and each filter
+// as a dimension parameter, e.g. ?group_by=day&country=US,DE.
+type ReportRequest struct {
+	GroupBy  []string            `json:"group_by"`
+	Filters  map[string][]string `json:"filters"`
+	From     string              `json:"from"`
+	To       string              `json:"to"`
+	Timezone string              `json:"timezone"`
+	Sort     string              `json:"sort"`
+	Order    string              `json:"order"`
+	Limit    int                 `json:"limit"`
+}
+
+// maxReportDimensions keeps group-bys to what a report table can show
+const maxReportDimensions = 5
+
+// defaultReportDays is the range reports cover without from/to
+const defaultReportDays = 7
+
+// HandleReports groups visits, clicks, conversions, revenue and cost by
+// any of db.ReportDimensions over a date range. from and to are days in
+// the report timezone (both included) or RFC 3339 times (to excluded).
+func (s *Server) HandleReports(w http.ResponseWriter, r *http.Request) {
+	var req ReportRequest
+	switch r.Method {
+	case http.MethodGet:
+		req = reportRequestFromQuery(r)
+	case http.MethodPost:
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	report, q, ok := s.runReport(w, &req)
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"group_by": report.GroupBy,
+		"from":     q.From.In(q.Location),
+		"to":       q.To.In(q.Location),
+		"timezone": q.Location.String(),
+		"rows":     report.Rows,
+		"totals":   report.Totals,
+	})
+}
+
+// runReport runs, sorts and limits the report req asks for, answering the
+// request itself when that fails
+func (s *Server) runReport(w http.ResponseWriter, req *ReportRequest) (*db.Report, db.ReportQuery, bool) {
+	q, err := s.reportQuery(req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return nil, q, false
+	}
+
+	report, err := s.db.RunReport(q)
+	if err != nil {
+		log.Printf("Error running report: %v", err)
+		http.Error(w, "Error running report", http.StatusInternalServerError)
+		return nil, q, false
+	}
+	sortReport(report.Rows, req.Sort, req.Order)
+	if req.Limit > 0 && len(report.Rows) > req.Limit {
+		report.Rows = report.Rows[:req.Limit]
+	}
+	return report, q, true
+}
+
+func reportRequestFromQuery(r *http.Request) ReportRequest {
+	query := r.URL.Query()
+	req := ReportRequest{
+		From:     query.Get("from"),
+		To:       query.Get("to"),
+		Timezone: query.Get("timezone"),
+		Sort:     query.Get("sort"),
+		Order:    query.Get("order"),
+		Filters:  map[string][]string{},
+	}
+	req.Limit, _ = strconv.Atoi(query.Get("limit"))
+	if groupBy := query.Get("group_by"); groupBy != "" {
+		req.GroupBy = strings.Split(groupBy, ",")
+	}
+	for name, values := range query {
+		if !db.IsReportDimension(name) {
+			continue
+		}
+		for _, v := range values {
+			req.Filters[name] = append(req.Filters[name], strings.Split(v, ",")...)
+		}
+	}
+	return req
+}
+
+func (s *Server) reportQuery(req *ReportRequest) (db.ReportQuery, error) {
+	q := db.ReportQuery{Filters: req.Filters}
+
+	if len(req.GroupBy) > maxReportDimensions {
+		return q, fmt.Errorf("at most %d group_by dimensions are supported", maxReportDimensions)
+	}
+	seen := map[string]bool{}
+	for _, name := range req.GroupBy {
+		name = strings.TrimSpace(name)
+		if !db.IsReportDimension(name) {
+			return q, fmt.Errorf("unknown dimension %q, use one of %s", name, strings.Join(db.ReportDimensions(), ", "))
+		}
+		if !seen[name] {
+			q.GroupBy = append(q.GroupBy, name)
+			seen[name] = true
+		}
+	}
+	for name := range req.Filters {
+		if name == db.DimensionDay || name == db.DimensionHour || !db.IsReportDimension(name) {
+			return q, fmt.Errorf("can't filter on %q", name)
+		}
+	}
+	if req.Sort != "" {
+		if _, err := reportMeasure(req.Sort); err != nil {
+			return q, err
+		}
+	}
+
+	loc, err := s.reportLocation(req.Timezone)
+	if err != nil {
+		return q, err
+	}
+	q.Location = loc
+
+	if q.From, q.To, err = reportRange(req.From, req.To, q.Location, time.Now()); err != nil {
+		return q, err
+	}
+	return q, nil
+}
+
+// workspaceLocation is REPORT_TIMEZONE, UTC when unset
+func (s *Server) workspaceLocation() *time.Location {
+	if s.config != nil && s.config.ReportLocation != nil {
+		return s.config.ReportLocation
+	}
+	return time.UTC
+}
+
+// reportLocation is the timezone a request asks for, or the workspace's
+// REPORT_TIMEZONE
+func (s *Server) reportLocation(name string) (*time.Location, error) {
+	if name == "" {
+		return s.workspaceLocation(), nil
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, fmt.Errorf("unknown timezone %q", name)
+	}
+	return loc, nil
+}
+
+// statsRange reads the optional from, to and timezone of a stats request,
+// leaving the range open where they're missing
+func (s *Server) statsRange(r *http.Request) (db.TimeRange, *time.Location, error) {
+	query := r.URL.Query()
+	loc, err := s.reportLocation(query.Get("timezone"))
+	if err != nil {
+		return db.TimeRange{}, nil, err
+	}
+	tr, err := parseRange(query.Get("from"), query.Get("to"), loc)
+	return tr, loc, err
+}
+
+// parseRange turns from and to into [from, to). They are days in loc, both
+// included, or RFC 3339 times. Missing bounds are left zero.
+func parseRange(fromStr, toStr string, loc *time.Location) (db.TimeRange, error) {
+	var tr db.TimeRange
+	if fromStr != "" {
+		t, _, err := parseReportTime(fromStr, loc)
+		if err != nil {
+			return tr, fmt.Errorf("invalid from: %v", err)
+		}
+		tr.From = t
+	}
+	if toStr != "" {
+		t, isDay, err := parseReportTime(toStr, loc)
+		if err != nil {
+			return tr, fmt.Errorf("invalid to: %v", err)
+		}
+		if isDay {
+			t = t.AddDate(0, 0, 1)
+		}
+		tr.To = t
+	}
+	if !tr.From.IsZero() && !tr.To.IsZero() && !tr.To.After(tr.From) {
+		return tr, fmt.Errorf("to must be after from")
+	}
+	return tr, nil
+}
+
+// reportRange is parseRange defaulting to the last defaultReportDays days
+// in loc, today included
+func reportRange(fromStr, toStr string, loc *time.Location, now time.Time) (time.Time, time.Time, error) {
+	tr, err := parseRange(fromStr, toStr, loc)
+	if err != nil {
+		return tr.From, tr.To, err
+	}
+	if tr.To.IsZero() {
+		tr.To = startOfDay(now, loc).AddDate(0, 0, 1)
+	}
+	if tr.From.IsZero() {
+		tr.From = tr.To.AddDate(0, 0, -defaultReportDays)
+	}
+	if !tr.To.After(tr.From) {
+		return tr.From, tr.To, fmt.Errorf("to must be after from")
+	}
+	return tr.From, tr.To, nil
+}
+
+// startOfDay is midnight of t's day in loc
+func startOfDay(t time.Time, loc *time.Location) time.Time {
+	t = t.In(loc)
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, loc)
+}
+
+func parseReportTime(value string, loc *time.Location) (time.Time, bool, error) {
+	if t, err := time.ParseInLocation("2006-01-02", value, loc); err == nil {
+		return t, true, nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	return t, false, err
+}
+
+// sortReport orders rows by a dimension or measure, keeping the report's
+// own order (by dimension values) when field is empty
+func sortReport(rows []db.ReportRow, field, order string) {
+	if field == "" {
+		return
+	}
+	desc := order != "asc"
+	if db.IsReportDimension(field) {
+		desc = order == "desc"
+	}
+
+	value, err := reportMeasure(field)
+	if err != nil {
+		return
+	}
+	sort.SliceStable(rows, func(i, j int) bool {
+		if value == nil {
+			c := db.CompareDimension(field, rows[i].Dimensions[field], rows[j].Dimensions[field])
+			if desc {
+				return c > 0
+			}
+			return c < 0
+		}
+		if desc {
+			return value(&rows[i]) > value(&rows[j])
+		}
+		return value(&rows[i]) < value(&rows[j])
+	})
+}
+
+// reportMeasure returns the getter for a measure, or nil for dimensions
+func reportMeasure(field string) (func(*db.ReportRow) float64, error) {
+	switch field {
+	case "visits":
+		return func(r *db.ReportRow) float64 { return float64(r.Visits) }, nil
+	case "clicks":
+		return func(r *db.ReportRow) float64 { return float64(r.Clicks) }, nil
+	case "bot_visits":
+		return func(r *db.ReportRow) float64 { return float64(r.BotVisits) }, nil
+	case "bot_clicks":
+		return func(r *db.ReportRow) float64 { return float64(r.BotClicks) }, nil
+	case "conversions":
+		return func(r *db.ReportRow) float64 { return float64(r.Conversions) }, nil
+	case "revenue":
+		return func(r *db.ReportRow) float64 { return r.Revenue }, nil
+	case "cost":
+		return func(r *db.ReportRow) float64 { return r.Cost }, nil
+	case "profit":
+		return func(r *db.ReportRow) float64 { return r.Profit }, nil
+	case "roi":
+		return func(r *db.ReportRow) float64 { return r.ROI }, nil
+	case "epc":
+		return func(r *db.ReportRow) float64 { return r.EPC }, nil
+	case "cpa":
+		return func(r *db.ReportRow) float64 { return r.CPA }, nil
+	case "cr":
+		return func(r *db.ReportRow) float64 { return r.CR }, nil
+	}
+	if db.IsReportDimension(field) {
+		return nil, nil
+	}
+	return nil, fmt.Errorf("can't sort by %q", field)
+}
@@ -0,0 +1,67 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"unchained-tracker/internal/db"
+)
+
+func TestReportTimezones(t *testing.T) {
+	server, database := newTestServer(t)
+
+	// 02:00 UTC on May 1st is still April 30th in New York, and the visit is
+	// saved in yet another zone
+	tokyo := time.FixedZone("JST", 9*3600)
+	at := time.Date(2024, 5, 1, 2, 0, 0, 0, time.UTC).In(tokyo)
+	visit := &db.Visit{VisitorID: "v1", ClickID: "c1", CampaignID: "test-campaign", CreatedAt: at}
+	if err := database.SaveVisit(visit); err != nil {
+		t.Fatalf("SaveVisit: %v", err)
+	}
+
+	report := func(query string) map[string]interface{} {
+		t.Helper()
+		w := httptest.NewRecorder()
+		server.HandleReports(w, httptest.NewRequest(http.MethodGet, "/api/reports?group_by=day&"+query, nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s: status %d: %s", query, w.Code, w.Body.String())
+		}
+		var body map[string]interface{}
+		json.NewDecoder(w.Body).Decode(&body)
+		return body
+	}
+	days := func(body map[string]interface{}) map[string]float64 {
+		days := map[string]float64{}
+		for _, row := range body["rows"].([]interface{}) {
+			row := row.(map[string]interface{})
+			days[row["dimensions"].(map[string]interface{})["day"].(string)] = row["visits"].(float64)
+		}
+		return days
+	}
+
+	if got := days(report("from=2024-04-30&to=2024-05-01")); got["2024-05-01"] != 1 || len(got) != 1 {
+		t.Errorf("UTC days = %v", got)
+	}
+	if got := days(report("from=2024-04-30&to=2024-05-01&timezone=America/New_York")); got["2024-04-30"] != 1 || len(got) != 1 {
+		t.Errorf("New York days = %v", got)
+	}
+	if got := days(report("from=2024-05-01&to=2024-05-01&timezone=America/New_York")); len(got) != 0 {
+		t.Errorf("May 1st in New York = %v", got)
+	}
+
+	// The workspace timezone applies without ?timezone=
+	server.config.ReportLocation, _ = time.LoadLocation("America/New_York")
+	body := report("from=2024-04-30&to=2024-04-30")
+	if got := days(body); got["2024-04-30"] != 1 || body["timezone"] != "America/New_York" {
+		t.Errorf("workspace days = %v, timezone %v", got, body["timezone"])
+	}
+
+	w := httptest.NewRecorder()
+	server.HandleReports(w, httptest.NewRequest(http.MethodGet, "/api/reports?timezone=Mars/Olympus", nil))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("unknown timezone: status %d", w.Code)
+	}
+}
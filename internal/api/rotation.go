@@ -0,0 +1,34 @@
+package api
+
+import (
+	"math/rand"
+
+	"unchained-tracker/internal/db"
+)
+
+// pickOffer chooses an offer from a campaign's rotation with probability
+// proportional to its weight. It returns nil when no offer has a positive
+// weight, in which case the campaign's own offer URL is used.
+func pickOffer(offers []db.CampaignOffer) *db.CampaignOffer {
+	total := 0
+	for _, o := range offers {
+		if o.Weight > 0 {
+			total += o.Weight
+		}
+	}
+	if total == 0 {
+		return nil
+	}
+
+	n := rand.Intn(total)
+	for i := range offers {
+		if offers[i].Weight <= 0 {
+			continue
+		}
+		if n < offers[i].Weight {
+			return &offers[i]
+		}
+		n -= offers[i].Weight
+	}
+	return nil
+}
@@ -0,0 +1,72 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"unchained-tracker/internal/db"
+)
+
+func TestPickOfferRespectsWeights(t *testing.T) {
+	offers := []db.CampaignOffer{
+		{OfferID: 1, Weight: 75},
+		{OfferID: 2, Weight: 25},
+		{OfferID: 3, Weight: 0},
+	}
+
+	counts := make(map[int64]int)
+	for i := 0; i < 10000; i++ {
+		counts[pickOffer(offers).OfferID]++
+	}
+
+	if counts[3] != 0 {
+		t.Errorf("paused offer was picked %d times", counts[3])
+	}
+	if share := float64(counts[1]) / 10000; share < 0.70 || share > 0.80 {
+		t.Errorf("offer 1 share = %.2f, want ~0.75", share)
+	}
+}
+
+func TestPickOfferWithoutActiveOffers(t *testing.T) {
+	if o := pickOffer(nil); o != nil {
+		t.Errorf("expected nil for empty rotation, got %+v", o)
+	}
+	if o := pickOffer([]db.CampaignOffer{{OfferID: 1, Weight: 0}}); o != nil {
+		t.Errorf("expected nil for paused rotation, got %+v", o)
+	}
+}
+
+func TestUpdateCampaignOffers(t *testing.T) {
+	server, database := newTestServer(t)
+
+	offer := &db.Offer{Name: "Offer", Network: "net", OfferURL: "https://offer.example/"}
+	if err := database.SaveOffer(offer); err != nil {
+		t.Fatalf("SaveOffer: %v", err)
+	}
+	update := func(body string) db.Campaign {
+		t.Helper()
+		w := httptest.NewRecorder()
+		server.HandleCampaigns(w, httptest.NewRequest("PUT", "/api/campaigns?id=test-campaign", strings.NewReader(body)))
+		if w.Code != 200 {
+			t.Fatalf("PUT %s = %d %s", body, w.Code, w.Body.String())
+		}
+		var campaign db.Campaign
+		json.NewDecoder(w.Body).Decode(&campaign)
+		return campaign
+	}
+
+	body, _ := json.Marshal(map[string]interface{}{"offers": []db.CampaignOffer{{OfferID: offer.ID, Weight: 3}}})
+	if campaign := update(string(body)); len(campaign.Offers) != 1 || campaign.Offers[0].Weight != 3 {
+		t.Errorf("offers = %+v", campaign.Offers)
+	}
+	// Leaving offers out keeps the rotation
+	update(`{"default_bid": 1}`)
+	if offers, err := database.GetCampaignOffers("test-campaign"); err != nil || len(offers) != 1 {
+		t.Errorf("offers after update = %+v, %v", offers, err)
+	}
+	if campaign := update(`{"offers": []}`); len(campaign.Offers) != 0 {
+		t.Errorf("offers after clearing = %+v", campaign.Offers)
+	}
+}
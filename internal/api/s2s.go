@@ -0,0 +1,97 @@
+package api
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+
+	"unchained-tracker/internal/db"
+	"unchained-tracker/internal/macro"
+)
+
+// deliveryTrafficSource is the outbox kind of traffic source postbacks.
+// Connector deliveries are kinded by connector name.
+const deliveryTrafficSource = "traffic_source"
+
+// notifyTrafficSource tells the traffic source that bought the click about
+// a conversion recordConversion just created or updated, so its bidding
+// sees our conversions. It only fires once per conversion: when it first
+// counts as revenue, or for sources with PostbackOn "approved" when it is
+// first approved. Later rejections and re-approvals aren't reported.
+func (s *Server) notifyTrafficSource(c *db.Conversion, result string) {
+	if c.ClickID == "" || result == resultDuplicate {
+		return
+	}
+
+	click, err := s.db.GetClickByID(c.ClickID)
+	if err != nil {
+		// Conversions tracked without a click have nothing to report
+		return
+	}
+	campaign, err := s.db.GetCampaignByID(click.CampaignID)
+	if err != nil || campaign.TrafficSource == "" {
+		return
+	}
+	source, err := s.db.GetTrafficSourceByName(campaign.TrafficSource)
+	if err != nil || source.PostbackURL == "" {
+		return
+	}
+	if !shouldFirePostback(source, c.Status) {
+		return
+	}
+	sent, err := s.db.HasDelivery(deliveryTrafficSource, c.ID)
+	if err != nil {
+		log.Printf("Error checking postbacks of conversion %d: %v", c.ID, err)
+		return
+	}
+	if sent {
+		return
+	}
+
+	postbackURL, err := parseDestination(macro.Expand(source.PostbackURL, conversionMacros(c, click)))
+	if err != nil {
+		log.Printf("Invalid postback URL for traffic source %s: %v", source.Name, err)
+		return
+	}
+	delivery := &db.Delivery{
+		Kind:         deliveryTrafficSource,
+		Target:       source.Name,
+		Method:       http.MethodGet,
+		URL:          postbackURL.String(),
+		ConversionID: c.ID,
+	}
+	if err := s.db.EnqueueDelivery(delivery); err != nil {
+		log.Printf("Error queueing postback for conversion %d to %s: %v", c.ID, source.Name, err)
+	}
+}
+
+func shouldFirePostback(source *db.TrafficSource, status string) bool {
+	if source.PostbackOn == db.PostbackOnApproved {
+		return status == db.StatusApproved
+	}
+	return db.CountsAsRevenue(status)
+}
+
+// conversionMacros returns the values traffic source postback templates can
+// use, e.g. https://ads.example/cv?clickid={external_id}&payout={payout}
+func conversionMacros(c *db.Conversion, click *db.Click) map[string]string {
+	payout := strconv.FormatFloat(c.Amount, 'f', -1, 64)
+	values := map[string]string{
+		"external_id":    click.ExternalID,
+		"clickid":        click.ClickID,
+		"click_id":       click.ClickID,
+		"campaign_id":    click.CampaignID,
+		"offer_id":       formatID(click.OfferID),
+		"conversion_id":  formatID(c.ID),
+		"payout":         payout,
+		"amount":         payout,
+		"status":         c.Status,
+		"transaction_id": c.TransactionID,
+		"currency":       c.Currency,
+	}
+	for i, value := range click.Subs {
+		values[fmt.Sprintf("sub%d", i+1)] = value
+	}
+	return values
+}
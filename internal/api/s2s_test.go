@@ -0,0 +1,125 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"unchained-tracker/internal/db"
+	"unchained-tracker/internal/outbox"
+)
+
+func TestTrafficSourcePostbackFiresOnConversion(t *testing.T) {
+	server, database := newTestServer(t)
+
+	received := make(chan url.Values, 1)
+	adsnet := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received <- r.URL.Query()
+	}))
+	defer adsnet.Close()
+
+	source := &db.TrafficSource{
+		Name:         "adsnet",
+		ClickIDParam: "cid",
+		PostbackURL:  adsnet.URL + "/cv?clickid={external_id}&payout={payout}&s={sub1}",
+		PostbackOn:   db.PostbackOnApproved,
+	}
+	if err := database.SaveTrafficSource(source); err != nil {
+		t.Fatalf("SaveTrafficSource: %v", err)
+	}
+	campaign, err := database.GetCampaignByID("test-campaign")
+	if err != nil {
+		t.Fatalf("GetCampaignByID: %v", err)
+	}
+	campaign.TrafficSource = "adsnet"
+	campaign.CustomParams = db.CustomParams{"zone"}
+	if err := database.UpdateCampaign(campaign); err != nil {
+		t.Fatalf("UpdateCampaign: %v", err)
+	}
+	addNetwork(t, database, "net")
+
+	w := doClick(server, "/click?rtkck=1234567890&cid=ext-42&zone=7")
+	location, _ := url.Parse(w.Header().Get("Location"))
+	clickID := location.Query().Get("clickid")
+	click, err := database.GetClickByID(clickID)
+	if err != nil || click.ExternalID != "ext-42" {
+		t.Fatalf("click = %+v, %v", click, err)
+	}
+
+	visit := &db.Visit{VisitorID: click.VisitorID, ClickID: clickID, CampaignID: "test-campaign", CreatedAt: time.Now()}
+	if err := database.SaveVisit(visit); err != nil {
+		t.Fatalf("SaveVisit: %v", err)
+	}
+
+	// Pending conversions don't fire for sources waiting on approval
+	postback(t, server, "network=net&clickid="+clickID+"&payout=2.5&status=pending&txid=t1")
+	queued, err := database.GetDeliveries("", 0, 10)
+	if err != nil || len(queued) != 0 {
+		t.Fatalf("deliveries after pending = %+v, %v", queued, err)
+	}
+
+	postback(t, server, "network=net&clickid="+clickID+"&status=approved&txid=t1")
+	claimed, err := database.ClaimDeliveries(time.Now(), 10)
+	if err != nil || len(claimed) != 1 || claimed[0].Kind != deliveryTrafficSource {
+		t.Fatalf("claimed = %+v, %v", claimed, err)
+	}
+	outbox.NewWorker(database, outbox.Options{}).Deliver(claimed[0])
+
+	select {
+	case q := <-received:
+		if q.Get("clickid") != "ext-42" || q.Get("payout") != "2.5" || q.Get("s") != "7" {
+			t.Errorf("postback query = %v", q)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("traffic source postback not sent")
+	}
+
+	delivered, err := database.GetDeliveries(db.DeliveryDelivered, claimed[0].ConversionID, 10)
+	if err != nil || len(delivered) != 1 || delivered[0].ResponseStatus != 200 || delivered[0].DeliveredAt == nil {
+		t.Fatalf("delivered = %+v, %v", delivered, err)
+	}
+}
+
+func TestTrafficSourcePostbackFiresOnce(t *testing.T) {
+	server, database := newTestServer(t)
+
+	source := &db.TrafficSource{
+		Name:        "adsnet",
+		PostbackURL: "https://ads.example/cv?clickid={external_id}&payout={payout}",
+		PostbackOn:  db.PostbackOnApproved,
+	}
+	if err := database.SaveTrafficSource(source); err != nil {
+		t.Fatalf("SaveTrafficSource: %v", err)
+	}
+	campaign, err := database.GetCampaignByID("test-campaign")
+	if err != nil {
+		t.Fatalf("GetCampaignByID: %v", err)
+	}
+	campaign.TrafficSource = "adsnet"
+	if err := database.UpdateCampaign(campaign); err != nil {
+		t.Fatalf("UpdateCampaign: %v", err)
+	}
+	addNetwork(t, database, "net")
+
+	w := doClick(server, "/click?rtkck=1234567890")
+	location, _ := url.Parse(w.Header().Get("Location"))
+	clickID := location.Query().Get("clickid")
+	visit := &db.Visit{VisitorID: "v1", ClickID: clickID, CampaignID: "test-campaign", CreatedAt: time.Now()}
+	if err := database.SaveVisit(visit); err != nil {
+		t.Fatalf("SaveVisit: %v", err)
+	}
+
+	// Rejected, then approved again on appeal
+	for _, status := range []string{"approved", "rejected", "approved"} {
+		if code, resp := postback(t, server, "network=net&clickid="+clickID+"&payout=3&txid=t1&status="+status); code != 200 {
+			t.Fatalf("%s postback = %d %v", status, code, resp)
+		}
+	}
+
+	queued, err := database.GetDeliveries("", 0, 10)
+	if err != nil || len(queued) != 1 {
+		t.Fatalf("deliveries = %+v, %v", queued, err)
+	}
+}
@@ -1,21 +1,74 @@
 package api
 
 import (
+	"context"
+	"log"
+
+	"unchained-tracker/internal/bots"
+	"unchained-tracker/internal/clientip"
 	"unchained-tracker/internal/config"  // Updated import path
+	"unchained-tracker/internal/connectors"
 	"unchained-tracker/internal/db"      // Updated import path
+	"unchained-tracker/internal/events"
+	"unchained-tracker/internal/fraud"
 	"unchained-tracker/internal/geo"     // Updated import path
+	"unchained-tracker/internal/useragent"
 )
 
 type Server struct {
-	db     *db.Database
-	config *config.Config
-	geo    *geo.Service
+	db         db.Store
+	config     *config.Config
+	geo        *geo.Service
+	connectors connectors.Registry
+	events     *events.Bus
+	clientIPs  *clientip.Resolver
+	bots       *bots.Detector
+	fraud      *fraud.Scorer
+	ua         *useragent.Parser
 }
 
-func NewServer(db *db.Database, config *config.Config, geo *geo.Service) *Server {
+func NewServer(db db.Store, config *config.Config, geo *geo.Service) *Server {
 	return &Server{
-		db:     db,
-		config: config,
-		geo:    geo,
+		db:         db,
+		config:     config,
+		geo:        geo,
+		connectors: newConnectors(config),
+		events:     events.NewBus(),
+		clientIPs:  clientip.New(config.TrustedProxies, config.ClientIPHeaders),
+		bots:       newBotDetector(config),
+		fraud: fraud.NewScorer(fraud.Options{
+			HoldScore:            config.FraudHoldScore,
+			IPClicksPerHour:      config.FraudIPClicksPerHour,
+			VisitorClicksPerHour: config.FraudVisitorClicksPerHour,
+			MinTimeToConvert:     config.FraudMinTimeToConvert,
+		}),
+		ua: newUAParser(config),
+	}
+}
+
+// Run keeps the server's reloadable definitions current until ctx is done
+func (s *Server) Run(ctx context.Context) {
+	s.ua.Run(ctx)
+}
+
+// newBotDetector loads the hosting list; without it bots are still told
+// apart by everything else
+func newBotDetector(config *config.Config) *bots.Detector {
+	detector := bots.NewDetector()
+	if config.BotHostingList != "" {
+		if err := detector.LoadHostingList(config.BotHostingList); err != nil {
+			log.Printf("Error loading bot hosting list: %v", err)
+		}
 	}
-} 
\ No newline at end of file
+	return detector
+}
+
+// newUAParser loads the user agent definitions file; a broken one leaves
+// the built-in definitions in use
+func newUAParser(config *config.Config) *useragent.Parser {
+	parser, err := useragent.NewParser(useragent.Options{File: config.UARegexes})
+	if err != nil {
+		log.Printf("Error loading user agent definitions: %v", err)
+	}
+	return parser
+}
@@ -0,0 +1,120 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"unchained-tracker/internal/db"
+	"unchained-tracker/internal/events"
+)
+
+// streamHeartbeat keeps idle streams from being closed by proxies
+const streamHeartbeat = 15 * time.Second
+
+// conversionStatusEvent is the data of a conversion_status event
+type conversionStatusEvent struct {
+	*db.Conversion
+	PreviousStatus string `json:"previous_status"`
+}
+
+func (s *Server) publish(eventType, campaignID string, data interface{}) {
+	s.events.Publish(events.Event{Type: eventType, CampaignID: campaignID, Data: data})
+}
+
+// publishConversion publishes a recorded conversion as a conversion event,
+// or as a conversion_status event when it changed an existing one
+func (s *Server) publishConversion(c *db.Conversion, result, previous string) {
+	switch result {
+	case resultCreated:
+		s.publish(events.TypeConversion, c.CampaignID, c)
+	case resultUpdated:
+		s.publish(events.TypeConversionStatus, c.CampaignID, conversionStatusEvent{c, previous})
+	}
+}
+
+// HandleStream sends visits, clicks and conversions as Server-Sent Events
+// as they are recorded:
+//
+//	/api/stream?campaign_id=summer-sale,black-friday&types=click,conversion
+//
+// Without campaign_id every campaign is streamed, without types every event
+// type. A client that can't keep up misses events and is sent a dropped
+// event with the count, after which it should reload its stats.
+func (s *Server) HandleStream(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	query := r.URL.Query()
+	filter := events.Filter{
+		CampaignIDs: splitList(query.Get("campaign_id")),
+		Types:       splitList(query.Get("types")),
+	}
+	for _, t := range filter.Types {
+		switch t {
+		case events.TypeVisit, events.TypeClick, events.TypeConversion, events.TypeConversionStatus:
+		default:
+			http.Error(w, "Unknown event type: "+t, http.StatusBadRequest)
+			return
+		}
+	}
+
+	rc := http.NewResponseController(w)
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	fmt.Fprint(w, "retry: 3000\n: connected\n\n")
+	if err := rc.Flush(); err != nil {
+		log.Printf("Error starting event stream: %v", err)
+		return
+	}
+
+	sub := s.events.Subscribe(filter, 0)
+	defer sub.Close()
+
+	heartbeat := time.NewTicker(streamHeartbeat)
+	defer heartbeat.Stop()
+	var dropped int64
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-heartbeat.C:
+			fmt.Fprint(w, ": ping\n\n")
+		case e := <-sub.C:
+			if n := sub.Dropped(); n > dropped {
+				writeStreamEvent(w, "dropped", map[string]int64{"dropped": n - dropped})
+				dropped = n
+			}
+			writeStreamEvent(w, e.Type, e)
+		}
+		if err := rc.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+func writeStreamEvent(w http.ResponseWriter, eventType string, data interface{}) {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		log.Printf("Error encoding %s event: %v", eventType, err)
+		return
+	}
+	fmt.Fprintf(w, "event: %s\ndata: %s\n\n", eventType, payload)
+}
+
+// splitList splits a comma-separated query parameter, skipping blanks
+func splitList(value string) []string {
+	var values []string
+	for _, v := range strings.Split(value, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			values = append(values, v)
+		}
+	}
+	return values
+}
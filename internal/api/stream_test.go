@@ -0,0 +1,83 @@
+package api
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"unchained-tracker/internal/events"
+)
+
+func TestStream(t *testing.T) {
+	server, _ := newTestServer(t)
+	ts := httptest.NewServer(http.HandlerFunc(server.HandleStream))
+	defer ts.Close()
+
+	resp, err := http.Get(ts.URL + "?campaign_id=test-campaign&types=click,conversion")
+	if err != nil {
+		t.Fatalf("GET: %v", err)
+	}
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("Content-Type = %s", ct)
+	}
+
+	lines := bufio.NewScanner(resp.Body)
+	// Once the stream is open the handler is subscribed
+	for lines.Scan() && lines.Text() != ": connected" {
+	}
+
+	body, _ := json.Marshal(map[string]interface{}{"campaign_id": "test-campaign", "click_id": "c1"})
+	req := httptest.NewRequest("POST", "/track", bytes.NewBuffer(body))
+	req.RemoteAddr = "127.0.0.1:1234"
+	server.HandleVisit(httptest.NewRecorder(), req)
+	server.publish(events.TypeClick, "other-campaign", nil)
+	before := time.Now().UTC().Truncate(time.Second)
+	doClick(server, "/click?rtkck=1234567890")
+
+	done := time.AfterFunc(5*time.Second, func() { resp.Body.Close() })
+	defer done.Stop()
+	var eventType, data string
+	for lines.Scan() {
+		line := lines.Text()
+		if v, ok := strings.CutPrefix(line, "event: "); ok {
+			eventType = v
+		} else if v, ok := strings.CutPrefix(line, "data: "); ok {
+			data = v
+			break
+		}
+	}
+
+	var e struct {
+		Type       string `json:"type"`
+		CampaignID string `json:"campaign_id"`
+		Data       struct {
+			ID        int64     `json:"id"`
+			ClickID   string    `json:"click_id"`
+			CreatedAt time.Time `json:"created_at"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal([]byte(data), &e); err != nil {
+		t.Fatalf("event %q: %v", data, err)
+	}
+	if eventType != events.TypeClick || e.Type != events.TypeClick || e.CampaignID != "test-campaign" || e.Data.ClickID == "" {
+		t.Errorf("first event = %s %s", eventType, data)
+	}
+	if e.Data.ID == 0 || e.Data.CreatedAt.Before(before) || e.Data.CreatedAt.After(time.Now()) {
+		t.Errorf("click id %d created at %v, want a saved click from after %v", e.Data.ID, e.Data.CreatedAt, before)
+	}
+}
+
+func TestStreamRejectsUnknownTypes(t *testing.T) {
+	server, _ := newTestServer(t)
+	w := httptest.NewRecorder()
+	server.HandleStream(w, httptest.NewRequest(http.MethodGet, "/api/stream?types=click,purchase", nil))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("status %d, want 400", w.Code)
+	}
+}
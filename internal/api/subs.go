@@ -0,0 +1,78 @@
+package api
+
+import (
+    "encoding/json"
+    "log"
+    "net/http"
+    "net/url"
+    "unchained-tracker/internal/db"
+)
+
+// captureSubs reads a campaign's custom parameters from a query string
+func captureSubs(query url.Values, params db.CustomParams) db.Subs {
+    var subs db.Subs
+    for i := range subs {
+        subs[i] = truncate(query.Get(params.Param(i)), 255)
+    }
+    return subs
+}
+
+func truncate(s string, n int) string {
+    if len(s) > n {
+        return s[:n]
+    }
+    return s
+}
+
+// HandleSubStats reports a campaign broken down by one custom parameter,
+// e.g. /api/campaigns/subs?campaign_id=...&param=zoneid, optionally over
+// the clicks from one day to another (&from=2024-05-01&to=2024-05-07)
+func (s *Server) HandleSubStats(w http.ResponseWriter, r *http.Request) {
+    if r.Method != http.MethodGet {
+        http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+        return
+    }
+
+    campaignID := r.URL.Query().Get("campaign_id")
+    param := r.URL.Query().Get("param")
+    if campaignID == "" || param == "" {
+        http.Error(w, "campaign_id and param are required", http.StatusBadRequest)
+        return
+    }
+
+    campaign, err := s.db.GetCampaignByID(campaignID)
+    if err != nil {
+        http.Error(w, "Campaign not found", http.StatusNotFound)
+        return
+    }
+
+    slot := campaign.CustomParams.Slot(param)
+    if slot < 0 {
+        http.Error(w, "Unknown parameter: "+param, http.StatusBadRequest)
+        return
+    }
+
+    statsRange, _, err := s.statsRange(r)
+    if err != nil {
+        http.Error(w, err.Error(), http.StatusBadRequest)
+        return
+    }
+
+    stats, err := s.db.GetSubStats(campaignID, slot, statsRange)
+    if err != nil {
+        log.Printf("Error getting sub stats: %v", err)
+        http.Error(w, "Error getting stats", http.StatusInternalServerError)
+        return
+    }
+    if stats == nil {
+        stats = []db.SubStats{}
+    }
+
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(map[string]interface{}{
+        "campaign_id": campaignID,
+        "param":       campaign.CustomParams.Param(slot),
+        "sub":         slot + 1,
+        "stats":       stats,
+    })
+}
@@ -0,0 +1,90 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+
+	"unchained-tracker/internal/db"
+)
+
+// HandleTrafficSources manages traffic sources and their postback
+// templates. GET lists them, POST creates or (with an id) updates one,
+// DELETE removes one by id.
+func (s *Server) HandleTrafficSources(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		sources, err := s.db.GetTrafficSources()
+		if err != nil {
+			log.Printf("Error getting traffic sources: %v", err)
+			http.Error(w, "Error getting traffic sources", http.StatusInternalServerError)
+			return
+		}
+		if sources == nil {
+			sources = []*db.TrafficSource{}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(sources)
+
+	case http.MethodPost:
+		var source db.TrafficSource
+		if err := json.NewDecoder(r.Body).Decode(&source); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		if msg := validateTrafficSource(&source); msg != "" {
+			http.Error(w, msg, http.StatusBadRequest)
+			return
+		}
+
+		if err := s.db.SaveTrafficSource(&source); err != nil {
+			if err == sql.ErrNoRows {
+				http.Error(w, "Traffic source not found", http.StatusNotFound)
+				return
+			}
+			log.Printf("Error saving traffic source: %v", err)
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(source)
+
+	case http.MethodDelete:
+		id, err := strconv.ParseInt(r.URL.Query().Get("id"), 10, 64)
+		if err != nil {
+			http.Error(w, "Invalid ID", http.StatusBadRequest)
+			return
+		}
+		if err := s.db.DeleteTrafficSource(id); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{
+			"status": "success",
+		})
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// validateTrafficSource returns a message describing what's wrong with t, or ""
+func validateTrafficSource(t *db.TrafficSource) string {
+	if t.Name == "" {
+		return "name is required"
+	}
+	switch t.PostbackOn {
+	case "", db.PostbackOnCreated, db.PostbackOnApproved:
+	default:
+		return "postback_on must be created or approved"
+	}
+	if t.PostbackURL != "" {
+		if _, err := parseDestination(t.PostbackURL); err != nil {
+			return "postback_url must be an absolute http(s) URL"
+		}
+	}
+	return ""
+}
@@ -0,0 +1,36 @@
+package api
+
+import (
+	"net/http"
+
+	"unchained-tracker/internal/useragent"
+)
+
+// parseAgent works out the browser, OS and device type of a request from
+// ua and the request's client hints
+func (s *Server) parseAgent(r *http.Request, ua string) useragent.Agent {
+	return s.ua.ParseRequest(ua, r.Header)
+}
+
+// requestClientHints asks Chromium browsers to send their full client
+// hints on the visitor's later requests to the tracker
+func requestClientHints(w http.ResponseWriter) {
+	w.Header().Set("Accept-CH", useragent.AcceptCH)
+}
+
+// visitAgent parses the visit's user agent. What the tracking script
+// reports only fills in what the parse leaves blank, so visits and clicks
+// agree on the same browser.
+func (s *Server) visitAgent(r *http.Request, req *VisitRequest, ua string) useragent.Agent {
+	agent := s.parseAgent(r, ua)
+	if agent.Browser == "" {
+		agent.Browser, agent.BrowserVersion = req.Browser, req.BrowserVersion
+	}
+	if agent.OS == "" {
+		agent.OS = req.OS
+	}
+	if agent.DeviceType == "" {
+		agent.DeviceType = req.DeviceType
+	}
+	return agent
+}
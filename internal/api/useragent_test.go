@@ -0,0 +1,90 @@
+package api
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"unchained-tracker/internal/db"
+	"unchained-tracker/internal/useragent"
+)
+
+const iPhoneUA = "Mozilla/5.0 (iPhone; CPU iPhone OS 17_4_1 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.4.1 Mobile/15E148 Safari/604.1"
+
+func TestUserAgentParsing(t *testing.T) {
+	server, database := newTestServer(t)
+
+	// Direct-link clicks get device data from the user agent alone
+	req := httptest.NewRequest("GET", "/click?rtkck=1234567890", nil)
+	req.RemoteAddr = "127.0.0.1:5555"
+	req.Header.Set("User-Agent", iPhoneUA)
+	req.Header.Set("Accept", "text/html")
+	req.Header.Set("Accept-Language", "en-US")
+	w := httptest.NewRecorder()
+	server.HandleClick(w, req)
+	if got := w.Header().Get("Accept-CH"); got != useragent.AcceptCH {
+		t.Errorf("Accept-CH = %q", got)
+	}
+	location, _ := url.Parse(w.Header().Get("Location"))
+	click, err := database.GetClickByID(location.Query().Get("clickid"))
+	if err != nil {
+		t.Fatalf("GetClickByID: %v", err)
+	}
+	if click.DeviceType != "mobile" || click.OS != "iOS" || click.Browser != "Safari" || click.BrowserVersion != "17.4.1" {
+		t.Errorf("click = %s %s %s %s", click.DeviceType, click.OS, click.Browser, click.BrowserVersion)
+	}
+
+	// The server's parse wins over what the tracking script says
+	body := `{"campaign_id": "test-campaign", "click_id": "` + click.ClickID + `", "user_agent": "` + iPhoneUA +
+		`", "browser": "Mobile Safari", "os": "Mac", "device_type": "desktop", "screen_resolution": "390x844"}`
+	req = httptest.NewRequest("POST", "/track", bytes.NewBufferString(body))
+	req.RemoteAddr = "127.0.0.1:1234"
+	w = httptest.NewRecorder()
+	server.HandleVisit(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("visit: status %d", w.Code)
+	}
+	visit, err := database.GetVisitByClickID(click.ClickID)
+	if err != nil {
+		t.Fatalf("GetVisitByClickID: %v", err)
+	}
+	if visit.DeviceType != click.DeviceType || visit.OS != click.OS || visit.Browser != click.Browser || visit.BrowserVersion != click.BrowserVersion {
+		t.Errorf("visit = %s %s %s %s", visit.DeviceType, visit.OS, visit.Browser, visit.BrowserVersion)
+	}
+
+	report, err := database.RunReport(db.ReportQuery{
+		GroupBy: []string{"device", "os", "browser"},
+		From:    time.Now().Add(-time.Hour), To: time.Now().Add(time.Hour),
+	})
+	if err != nil {
+		t.Fatalf("RunReport: %v", err)
+	}
+	if len(report.Rows) != 1 || report.Rows[0].Dimensions["device"] != "mobile" || report.Rows[0].Clicks != 1 || report.Rows[0].Visits != 1 {
+		t.Errorf("rows = %+v", report.Rows)
+	}
+}
+
+func TestVisitUserAgentFromHeader(t *testing.T) {
+	server, database := newTestServer(t)
+
+	// Without a user_agent in the body the request's header is stored
+	body := `{"campaign_id": "test-campaign", "click_id": "c1"}`
+	req := httptest.NewRequest("POST", "/track", bytes.NewBufferString(body))
+	req.RemoteAddr = "127.0.0.1:1234"
+	req.Header.Set("User-Agent", iPhoneUA)
+	w := httptest.NewRecorder()
+	server.HandleVisit(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("visit: status %d", w.Code)
+	}
+	visit, err := database.GetVisitByClickID("c1")
+	if err != nil {
+		t.Fatalf("GetVisitByClickID: %v", err)
+	}
+	if visit.UserAgent != iPhoneUA || visit.OS != "iOS" {
+		t.Errorf("visit user agent = %q, os %q", visit.UserAgent, visit.OS)
+	}
+}
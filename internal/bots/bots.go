@@ -0,0 +1,256 @@
+// Package bots tells crawlers, scripts and headless browsers apart from
+// people. A request is scored on its user agent, the network it comes
+// from, the headers browsers always send and, for lander visits, what the
+// tracking script saw in the page.
+package bots
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Threshold is the score at which a request is a bot. Strong signals reach
+// it on their own, weak ones only together.
+const Threshold = 100
+
+// Signal weights
+const (
+	weightStrong           = 100
+	weightNoAcceptLang     = 40
+	weightNoAccept         = 30
+	weightNoScreen         = 60
+	weightTimezoneMismatch = 40
+)
+
+// Reasons recorded with a verdict
+const (
+	ReasonUserAgent        = "user_agent"
+	ReasonEmptyUserAgent   = "empty_user_agent"
+	ReasonWebdriver        = "webdriver"
+	ReasonHosting          = "hosting_network"
+	ReasonNoAcceptLanguage = "no_accept_language"
+	ReasonNoAccept         = "no_accept"
+	ReasonNoScreen         = "no_screen"
+	ReasonTimezone         = "timezone_mismatch"
+)
+
+// signatures match the user agents of crawlers, link preview fetchers,
+// HTTP libraries and headless browsers
+var signatures = regexp.MustCompile(`(?i)` + strings.Join([]string{
+	`bot\b`, `bot/`, `crawl`, `spider`, `slurp`, `scrape`, `archiver`,
+	`facebookexternalhit`, `facebookcatalog`, `meta-externalagent`, `embedly`,
+	`whatsapp`, `telegram`, `skypeuripreview`, `slackbot`, `discordbot`,
+	`headlesschrome`, `phantomjs`, `puppeteer`, `playwright`, `selenium`,
+	`lighthouse`, `pagespeed`, `gtmetrix`, `pingdom`, `uptime`, `monitor`,
+	`curl/`, `wget/`, `python-requests`, `python-urllib`, `aiohttp`, `httpx`,
+	`go-http-client`, `java/`, `okhttp`, `apache-httpclient`, `libwww-perl`,
+	`node-fetch`, `axios/`, `scrapy`, `postmanruntime`, `insomnia`,
+}, "|"))
+
+// Signals are what is known about a click or visit
+type Signals struct {
+	UserAgent string
+	// Header holds the headers of a click. Lander visits are posted by the
+	// tracking script, whose requests always carry them, so they leave it
+	// nil.
+	Header http.Header
+	IP     net.IP
+	ASN    uint
+	// Screen, Timezone and Webdriver come from the tracking script: the
+	// screen resolution, the browser's IANA time zone and
+	// navigator.webdriver. IPTimezone is the time zone of the IP address.
+	Screen     string
+	Timezone   string
+	IPTimezone string
+	Webdriver  bool
+	// Script is set when the request came from the tracking script
+	Script bool
+}
+
+// Verdict is the outcome of a check
+type Verdict struct {
+	Bot     bool
+	Score   int
+	Reasons []string
+}
+
+// Reason joins the reasons into the bot_reason column
+func (v Verdict) Reason() string {
+	reason := strings.Join(v.Reasons, ",")
+	if len(reason) > 255 {
+		reason = reason[:255]
+	}
+	return reason
+}
+
+// Detector checks requests against the user agent signatures and the list
+// of hosting networks
+type Detector struct {
+	mu       sync.RWMutex
+	asns     map[uint]bool
+	networks []*net.IPNet
+	now      func() time.Time
+}
+
+func NewDetector() *Detector {
+	return &Detector{asns: map[uint]bool{}, now: time.Now}
+}
+
+// LoadHostingList replaces the hosting networks with those in a file of
+// AS numbers (AS16509 or 16509) and CIDR ranges, one per line. Text after
+// a # is a comment.
+func (d *Detector) LoadHostingList(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	asns := map[uint]bool{}
+	var networks []*net.IPNet
+	scanner := bufio.NewScanner(file)
+	for line := 1; scanner.Scan(); line++ {
+		entry, _, _ := strings.Cut(scanner.Text(), "#")
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		if strings.Contains(entry, "/") {
+			_, network, err := net.ParseCIDR(entry)
+			if err != nil {
+				return fmt.Errorf("%s:%d: invalid network %q", path, line, entry)
+			}
+			networks = append(networks, network)
+			continue
+		}
+		number := strings.TrimPrefix(strings.ToUpper(entry), "AS")
+		asn, err := strconv.ParseUint(number, 10, 32)
+		if err != nil {
+			return fmt.Errorf("%s:%d: invalid AS number %q", path, line, entry)
+		}
+		asns[uint(asn)] = true
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	d.mu.Lock()
+	d.asns, d.networks = asns, networks
+	d.mu.Unlock()
+	return nil
+}
+
+// Check scores the signals
+func (d *Detector) Check(s Signals) Verdict {
+	var v Verdict
+	add := func(weight int, reason string) {
+		v.Score += weight
+		v.Reasons = append(v.Reasons, reason)
+	}
+
+	switch {
+	case strings.TrimSpace(s.UserAgent) == "":
+		add(weightStrong, ReasonEmptyUserAgent)
+	case signatures.MatchString(s.UserAgent):
+		add(weightStrong, ReasonUserAgent)
+	}
+	if s.Webdriver {
+		add(weightStrong, ReasonWebdriver)
+	}
+	if d.hosting(s.IP, s.ASN) {
+		add(weightStrong, ReasonHosting)
+	}
+
+	if s.Header != nil {
+		if s.Header.Get("Accept-Language") == "" {
+			add(weightNoAcceptLang, ReasonNoAcceptLanguage)
+		}
+		if s.Header.Get("Accept") == "" {
+			add(weightNoAccept, ReasonNoAccept)
+		}
+	}
+	if s.Script {
+		if noScreen(s.Screen) {
+			add(weightNoScreen, ReasonNoScreen)
+		}
+		if d.timezoneMismatch(s.Timezone, s.IPTimezone) {
+			add(weightTimezoneMismatch, ReasonTimezone)
+		}
+	}
+
+	v.Bot = v.Score >= Threshold
+	return v
+}
+
+func (d *Detector) hosting(ip net.IP, asn uint) bool {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	if asn != 0 && d.asns[asn] {
+		return true
+	}
+	if ip != nil {
+		for _, network := range d.networks {
+			if network.Contains(ip) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// noScreen is a missing or empty screen resolution, as headless browsers
+// report
+func noScreen(screen string) bool {
+	w, h, ok := strings.Cut(strings.ToLower(strings.TrimSpace(screen)), "x")
+	if !ok {
+		return true
+	}
+	width, err1 := strconv.Atoi(strings.TrimSpace(w))
+	height, err2 := strconv.Atoi(strings.TrimSpace(h))
+	return err1 != nil || err2 != nil || width <= 0 || height <= 0
+}
+
+// timezoneMismatch compares the browser's and the IP address's current UTC
+// offsets, so zones that share an offset match. Either being unknown is no
+// mismatch.
+func (d *Detector) timezoneMismatch(browser, ip string) bool {
+	if browser == "" || ip == "" {
+		return false
+	}
+	browserLoc, err := loadLocation(browser)
+	if err != nil {
+		return false
+	}
+	ipLoc, err := loadLocation(ip)
+	if err != nil {
+		return false
+	}
+	now := d.now()
+	_, browserOffset := now.In(browserLoc).Zone()
+	_, ipOffset := now.In(ipLoc).Zone()
+	return browserOffset != ipOffset
+}
+
+var locations sync.Map
+
+// loadLocation caches time.LoadLocation, which reads the zone database
+// every time
+func loadLocation(name string) (*time.Location, error) {
+	if loc, ok := locations.Load(name); ok {
+		return loc.(*time.Location), nil
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, err
+	}
+	locations.Store(name, loc)
+	return loc, nil
+}
@@ -0,0 +1,82 @@
+package bots
+
+import (
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+const chrome = "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/124.0 Safari/537.36"
+
+func browserHeader() http.Header {
+	return http.Header{"Accept": {"text/html"}, "Accept-Language": {"en-GB"}}
+}
+
+func TestCheck(t *testing.T) {
+	d := NewDetector()
+	d.now = func() time.Time { return time.Date(2026, 1, 15, 12, 0, 0, 0, time.UTC) }
+	d.asns[16509] = true
+	_, network, _ := net.ParseCIDR("198.51.100.0/24")
+	d.networks = append(d.networks, network)
+
+	tests := []struct {
+		name    string
+		signals Signals
+		bot     bool
+		reason  string
+	}{
+		{"browser", Signals{UserAgent: chrome, Header: browserHeader()}, false, ""},
+		{"crawler", Signals{UserAgent: "Mozilla/5.0 (compatible; Googlebot/2.1)", Header: browserHeader()}, true, ReasonUserAgent},
+		{"preview", Signals{UserAgent: "facebookexternalhit/1.1", Header: browserHeader()}, true, ReasonUserAgent},
+		{"library", Signals{UserAgent: "python-requests/2.31", Header: http.Header{}}, true, "user_agent,no_accept_language,no_accept"},
+		{"empty user agent", Signals{Header: browserHeader()}, true, ReasonEmptyUserAgent},
+		{"hosting asn", Signals{UserAgent: chrome, Header: browserHeader(), ASN: 16509}, true, ReasonHosting},
+		{"hosting range", Signals{UserAgent: chrome, Header: browserHeader(), IP: net.ParseIP("198.51.100.7")}, true, ReasonHosting},
+		{"one missing header", Signals{UserAgent: chrome, Header: http.Header{"Accept": {"*/*"}}}, false, ReasonNoAcceptLanguage},
+		{"missing headers", Signals{UserAgent: chrome, Header: http.Header{}}, false, "no_accept_language,no_accept"},
+		{"webdriver", Signals{UserAgent: chrome, Script: true, Screen: "1920x1080", Webdriver: true}, true, ReasonWebdriver},
+		{"visit", Signals{UserAgent: chrome, Script: true, Screen: "1920x1080", Timezone: "Europe/Dublin", IPTimezone: "Europe/London"}, false, ""},
+		{"no screen and other timezone", Signals{UserAgent: chrome, Script: true, Screen: "0x0", Timezone: "America/New_York", IPTimezone: "Europe/London"}, true, "no_screen,timezone_mismatch"},
+		{"unknown timezone", Signals{UserAgent: chrome, Script: true, Screen: "390x844", Timezone: "Nowhere/Land", IPTimezone: "Europe/London"}, false, ""},
+	}
+	for _, tt := range tests {
+		v := d.Check(tt.signals)
+		if v.Bot != tt.bot || v.Reason() != tt.reason {
+			t.Errorf("%s: Check = %v %q (score %d), want %v %q", tt.name, v.Bot, v.Reason(), v.Score, tt.bot, tt.reason)
+		}
+	}
+}
+
+func TestLoadHostingList(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "hosting.txt")
+	list := "# clouds\nAS16509  # AWS\n14061\n\n203.0.113.0/24\n2001:db8::/32\n"
+	if err := os.WriteFile(path, []byte(list), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	d := NewDetector()
+	if err := d.LoadHostingList(path); err != nil {
+		t.Fatalf("LoadHostingList: %v", err)
+	}
+	for _, s := range []Signals{{ASN: 16509}, {ASN: 14061}, {IP: net.ParseIP("203.0.113.5")}, {IP: net.ParseIP("2001:db8::1")}} {
+		if !d.hosting(s.IP, s.ASN) {
+			t.Errorf("%v %d is not hosting", s.IP, s.ASN)
+		}
+	}
+	if d.hosting(net.ParseIP("192.0.2.1"), 13335) {
+		t.Error("unlisted network is hosting")
+	}
+
+	if err := os.WriteFile(path, []byte("AS-amazon\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.LoadHostingList(path); err == nil {
+		t.Error("no error for an invalid entry")
+	}
+	if !d.hosting(nil, 16509) {
+		t.Error("a failed load replaced the list")
+	}
+}
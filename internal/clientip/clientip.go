@@ -0,0 +1,235 @@
+// Package clientip finds the address of the client behind the proxies a
+// request came through. Forwarding headers are only believed when they
+// were set by a trusted proxy, since anyone can send them.
+package clientip
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// Headers the resolver reads the client address from
+const (
+	HeaderCloudflare   = "CF-Connecting-IP"
+	HeaderRealIP       = "X-Real-IP"
+	HeaderForwardedFor = "X-Forwarded-For"
+)
+
+// DefaultHeaders are read in this order when none are configured
+var DefaultHeaders = []string{HeaderCloudflare, HeaderRealIP, HeaderForwardedFor}
+
+// Cloudflare is the keyword ParseNetworks expands to Cloudflare's ranges
+const Cloudflare = "cloudflare"
+
+// cloudflareRanges are Cloudflare's published edge ranges, from
+// https://www.cloudflare.com/ips/
+var cloudflareRanges = []string{
+	"173.245.48.0/20", "103.21.244.0/22", "103.22.200.0/22", "103.31.4.0/22",
+	"141.101.64.0/18", "108.162.192.0/18", "190.93.240.0/20", "188.114.96.0/20",
+	"197.234.240.0/22", "198.41.128.0/17", "162.158.0.0/15", "104.16.0.0/13",
+	"104.24.0.0/14", "172.64.0.0/13", "131.0.72.0/22",
+	"2400:cb00::/32", "2606:4700::/32", "2803:f800::/32", "2405:b500::/32",
+	"2405:8100::/32", "2a06:98c0::/29", "2c0f:f248::/32",
+}
+
+var cloudflareNetworks = parseCIDRs(cloudflareRanges)
+
+// ParseNetworks parses CIDR ranges and single addresses, plus the
+// cloudflare keyword for Cloudflare's ranges
+func ParseNetworks(entries []string) ([]*net.IPNet, error) {
+	var networks []*net.IPNet
+	for _, entry := range entries {
+		entry = strings.TrimSpace(entry)
+		switch {
+		case entry == "":
+			continue
+		case strings.EqualFold(entry, Cloudflare):
+			networks = append(networks, cloudflareNetworks...)
+			continue
+		}
+		if _, network, err := net.ParseCIDR(entry); err == nil {
+			networks = append(networks, network)
+			continue
+		}
+		ip := parseIP(entry)
+		if ip == nil {
+			return nil, fmt.Errorf("invalid network %q", entry)
+		}
+		bits := 8 * len(ip)
+		networks = append(networks, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+	}
+	return networks, nil
+}
+
+func parseCIDRs(cidrs []string) []*net.IPNet {
+	networks := make([]*net.IPNet, len(cidrs))
+	for i, cidr := range cidrs {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			panic(err)
+		}
+		networks[i] = network
+	}
+	return networks
+}
+
+// CheckHeaders returns an error for headers the resolver can't read
+func CheckHeaders(headers []string) error {
+	for _, h := range headers {
+		if canonicalHeader(h) == "" {
+			return fmt.Errorf("unsupported client IP header %q", h)
+		}
+	}
+	return nil
+}
+
+func canonicalHeader(h string) string {
+	for _, known := range DefaultHeaders {
+		if http.CanonicalHeaderKey(strings.TrimSpace(h)) == http.CanonicalHeaderKey(known) {
+			return known
+		}
+	}
+	return ""
+}
+
+// Resolver finds client addresses, believing the headers it reads only
+// from the trusted proxies
+type Resolver struct {
+	trusted []*net.IPNet
+	headers []string
+}
+
+// New returns a resolver trusting the given proxies and reading headers,
+// in order (DefaultHeaders if none)
+func New(trusted []*net.IPNet, headers []string) *Resolver {
+	if len(headers) == 0 {
+		headers = DefaultHeaders
+	}
+	r := &Resolver{trusted: trusted}
+	for _, h := range headers {
+		if h = canonicalHeader(h); h != "" {
+			r.headers = append(r.headers, h)
+		}
+	}
+	return r
+}
+
+// IP returns the client address of req, without a port. It is the
+// connection's address unless that is a trusted proxy, in which case the
+// first configured header that holds an address decides:
+//
+//   - CF-Connecting-IP, if the request came through Cloudflare
+//   - X-Real-IP, which the trusted proxy must set itself
+//   - X-Forwarded-For, read from the right up to the first untrusted hop
+func (r *Resolver) IP(req *http.Request) string {
+	peer := parseIP(req.RemoteAddr)
+	if peer == nil {
+		return req.RemoteAddr
+	}
+	if !r.isTrusted(peer) {
+		return peer.String()
+	}
+
+	for _, h := range r.headers {
+		var ip net.IP
+		switch h {
+		case HeaderCloudflare:
+			if r.viaCloudflare(peer, req.Header) {
+				ip = parseIP(req.Header.Get(h))
+			}
+		case HeaderRealIP:
+			ip = parseIP(req.Header.Get(h))
+		case HeaderForwardedFor:
+			ip = r.forwardedClient(req.Header)
+		}
+		if ip != nil {
+			return ip.String()
+		}
+	}
+	return peer.String()
+}
+
+func (r *Resolver) isTrusted(ip net.IP) bool {
+	return contains(r.trusted, ip)
+}
+
+func contains(networks []*net.IPNet, ip net.IP) bool {
+	for _, network := range networks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// forwarded lists the X-Forwarded-For hops, nearest first. It returns
+// false if one of them isn't an address.
+func forwarded(header http.Header) ([]net.IP, bool) {
+	var entries []string
+	for _, value := range header.Values(HeaderForwardedFor) {
+		entries = append(entries, strings.Split(value, ",")...)
+	}
+	hops := make([]net.IP, 0, len(entries))
+	for i := len(entries) - 1; i >= 0; i-- {
+		ip := parseIP(entries[i])
+		if ip == nil {
+			return nil, false
+		}
+		hops = append(hops, ip)
+	}
+	return hops, true
+}
+
+// forwardedClient is the nearest untrusted X-Forwarded-For hop, or the
+// farthest one if all are trusted
+func (r *Resolver) forwardedClient(header http.Header) net.IP {
+	hops, ok := forwarded(header)
+	if !ok || len(hops) == 0 {
+		return nil
+	}
+	for _, ip := range hops {
+		if !r.isTrusted(ip) {
+			return ip
+		}
+	}
+	return hops[len(hops)-1]
+}
+
+// viaCloudflare reports whether a Cloudflare edge is among the hops
+// between the trusted peer and the nearest untrusted one. Only then was
+// CF-Connecting-IP set by Cloudflare rather than by the client.
+func (r *Resolver) viaCloudflare(peer net.IP, header http.Header) bool {
+	if contains(cloudflareNetworks, peer) {
+		return true
+	}
+	hops, _ := forwarded(header)
+	for _, ip := range hops {
+		if contains(cloudflareNetworks, ip) {
+			return true
+		}
+		if !r.isTrusted(ip) {
+			return false
+		}
+	}
+	return false
+}
+
+// parseIP parses an address with or without a port, brackets or zone.
+// IPv4-mapped IPv6 addresses come back as IPv4.
+func parseIP(s string) net.IP {
+	s = strings.Trim(strings.TrimSpace(s), `"`)
+	if host, _, err := net.SplitHostPort(s); err == nil {
+		s = host
+	}
+	s = strings.TrimSuffix(strings.TrimPrefix(s, "["), "]")
+	if i := strings.IndexByte(s, '%'); i >= 0 {
+		s = s[:i]
+	}
+	ip := net.ParseIP(s)
+	if ip4 := ip.To4(); ip4 != nil {
+		return ip4
+	}
+	return ip
+}
@@ -0,0 +1,67 @@
+package clientip
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestResolver(t *testing.T) {
+	trusted, err := ParseNetworks([]string{"127.0.0.1", "::1", "10.0.0.0/8", "fd00::/8"})
+	if err != nil {
+		t.Fatalf("ParseNetworks: %v", err)
+	}
+	r := New(trusted, nil)
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		headers    map[string]string
+		want       string
+	}{
+		{"direct", "198.51.100.2:4000", nil, "198.51.100.2"},
+		{"direct ipv6", "[2001:db8::1]:4000", nil, "2001:db8::1"},
+		{"ipv4-mapped", "[::ffff:198.51.100.2]:4000", nil, "198.51.100.2"},
+		{"untrusted peer", "198.51.100.2:4000", map[string]string{"X-Forwarded-For": "203.0.113.9", "X-Real-IP": "203.0.113.9"}, "198.51.100.2"},
+		{"forwarded", "127.0.0.1:4000", map[string]string{"X-Forwarded-For": "203.0.113.9"}, "203.0.113.9"},
+		{"forwarded ipv6", "[::1]:4000", map[string]string{"X-Forwarded-For": "2001:db8::7, fd00::1"}, "2001:db8::7"},
+		{"forwarded with port and zone", "127.0.0.1:4000", map[string]string{"X-Forwarded-For": "[fe80::1%eth0]:99"}, "fe80::1"},
+		{"spoofed hops are skipped", "127.0.0.1:4000", map[string]string{"X-Forwarded-For": "1.1.1.1, 203.0.113.9, 10.0.0.5"}, "203.0.113.9"},
+		{"all hops trusted", "127.0.0.1:4000", map[string]string{"X-Forwarded-For": "10.0.0.9, 10.0.0.5"}, "10.0.0.9"},
+		{"malformed forwarded", "127.0.0.1:4000", map[string]string{"X-Forwarded-For": "unknown, 203.0.113.9"}, "127.0.0.1"},
+		{"real ip", "127.0.0.1:4000", map[string]string{"X-Real-IP": "203.0.113.9", "X-Forwarded-For": "198.51.100.2"}, "203.0.113.9"},
+		{"through cloudflare", "127.0.0.1:4000", map[string]string{"CF-Connecting-IP": "2001:db8::9", "X-Forwarded-For": "2001:db8::9, 172.70.1.1"}, "2001:db8::9"},
+		{"cloudflare header without cloudflare", "127.0.0.1:4000", map[string]string{"CF-Connecting-IP": "1.1.1.1", "X-Forwarded-For": "203.0.113.9"}, "203.0.113.9"},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest("GET", "/click", nil)
+		req.RemoteAddr = tt.remoteAddr
+		for k, v := range tt.headers {
+			req.Header.Set(k, v)
+		}
+		if got := r.IP(req); got != tt.want {
+			t.Errorf("%s: IP = %s, want %s", tt.name, got, tt.want)
+		}
+	}
+
+	// Repeated headers are one list
+	req := httptest.NewRequest("GET", "/click", nil)
+	req.RemoteAddr = "127.0.0.1:4000"
+	req.Header.Add("X-Forwarded-For", "203.0.113.9")
+	req.Header.Add("X-Forwarded-For", "198.51.100.2, 10.0.0.5")
+	if got := New(trusted, []string{"x-forwarded-for"}).IP(req); got != "198.51.100.2" {
+		t.Errorf("repeated X-Forwarded-For: IP = %s", got)
+	}
+}
+
+func TestParseNetworks(t *testing.T) {
+	networks, err := ParseNetworks([]string{"cloudflare", " 192.0.2.1 ", ""})
+	if err != nil || len(networks) != len(cloudflareRanges)+1 {
+		t.Errorf("ParseNetworks = %d networks, %v", len(networks), err)
+	}
+	if _, err := ParseNetworks([]string{"10.0.0.0/33"}); err == nil {
+		t.Error("no error for an invalid network")
+	}
+	if err := CheckHeaders([]string{"x-real-ip", "Forwarded"}); err == nil {
+		t.Error("no error for an unsupported header")
+	}
+}
@@ -2,24 +2,106 @@ package config
 
 import (
     "os"
+    "strconv"
+    "strings"
+    "time"
+    "net"
     "github.com/joho/godotenv"
     "fmt"
+    "unchained-tracker/internal/clientip"
 )
 
 type Config struct {
     DatabaseURL    string
     ServerAddr     string
+    // FacebookEnabled reports campaigns without any connectors to
+    // Facebook; connectors are otherwise enabled per campaign
     FacebookEnabled bool
     FacebookToken  string
     FacebookPixelID string
+    // FacebookAPIVersion is the Graph API version events are sent to
+    FacebookAPIVersion string
+    // FacebookEventNames maps conversion types to event names, e.g.
+    // lead -> Lead; other types use FacebookDefaultEvent
+    FacebookEventNames   map[string]string
+    FacebookDefaultEvent string
+    FacebookTestEventCode string
+    // Currency is reported for conversions that don't carry one
+    Currency string
+    TikTokPixelCode string
+    TikTokToken     string
+    // TikTokEventNames maps conversion types to event names, e.g.
+    // lead -> SubmitForm; other types use TikTokDefaultEvent
+    TikTokEventNames    map[string]string
+    TikTokDefaultEvent  string
+    TikTokTestEventCode string
+    // GoogleAdsConversionName is the conversion action the offline
+    // conversion feed is imported into
+    GoogleAdsConversionName string
+    // GoogleAdsFeedToken, when set, is required to fetch the feed
+    GoogleAdsFeedToken string
     CloudflareToken string
     ServerIP        string
+    // TransactionIDParam is an extra postback parameter holding the
+    // network's transaction ID, besides txid and transaction_id
+    TransactionIDParam string
+    // OutboxWorkers is how many outbound deliveries run at once
+    OutboxWorkers int
+    // RollupInterval is how often the hourly rollups are updated, and
+    // RollupLookback how far back rolled up hours are redone
+    RollupInterval time.Duration
+    RollupLookback time.Duration
+    // ReportLocation is the workspace's reporting time zone: where "today"
+    // and report days start. Requests can pick another with ?timezone=.
+    ReportLocation *time.Location
+    // GeoCityDB, GeoASNDB and GeoConnectionTypeDB are the MaxMind
+    // databases visitors are located with. They are reloaded every
+    // GeoReloadInterval when their files change.
+    GeoCityDB           string
+    GeoASNDB            string
+    GeoConnectionTypeDB string
+    GeoReloadInterval   time.Duration
+    GeoCacheSize        int
+    // GeoFallback is "ip-api" to look up on ip-api.com what the
+    // databases can't place in a country
+    GeoFallback string
+    // TrustedProxies are the proxies whose ClientIPHeaders are believed
+    // when they forward a visit or click
+    TrustedProxies  []*net.IPNet
+    ClientIPHeaders []string
+    // BotHostingList is the file of hosting AS numbers and ranges whose
+    // clicks and visits are bots
+    BotHostingList string
+    // FraudHoldScore is the fraud score conversions are held for review
+    // at. Clicks beyond FraudIPClicksPerHour from an address or
+    // FraudVisitorClicksPerHour from a visitor, and conversions sooner
+    // than FraudMinTimeToConvert after the click, score higher.
+    FraudHoldScore            int
+    FraudIPClicksPerHour      int
+    FraudVisitorClicksPerHour int
+    FraudMinTimeToConvert     time.Duration
+    // UARegexes is a user agent definitions file replacing the built-in
+    // ones, reloaded when it changes
+    UARegexes string
 }
 
 func Load() (*Config, error) {
     // Load .env file if it exists
     godotenv.Load()
 
+    reportLocation, err := time.LoadLocation(getEnv("REPORT_TIMEZONE", "UTC"))
+    if err != nil {
+        return nil, fmt.Errorf("invalid REPORT_TIMEZONE: %v", err)
+    }
+    trustedProxies, err := clientip.ParseNetworks(strings.Split(getEnv("TRUSTED_PROXIES", "127.0.0.0/8,::1"), ","))
+    if err != nil {
+        return nil, fmt.Errorf("invalid TRUSTED_PROXIES: %v", err)
+    }
+    clientIPHeaders := getEnvList("CLIENT_IP_HEADERS")
+    if err := clientip.CheckHeaders(clientIPHeaders); err != nil {
+        return nil, fmt.Errorf("invalid CLIENT_IP_HEADERS: %v", err)
+    }
+
     return &Config{
         DatabaseURL:     getEnv("DATABASE_URL", fmt.Sprintf("%s:%s@tcp(%s:%s)/%s", 
             getEnv("DB_USER", "tracker"),
@@ -31,8 +113,39 @@ func Load() (*Config, error) {
         FacebookEnabled: getEnv("FB_ENABLED", "false") == "true",
         FacebookToken:   getEnv("FB_ACCESS_TOKEN", ""),
         FacebookPixelID: getEnv("FB_PIXEL_ID", ""),
+        FacebookAPIVersion:    getEnv("FB_API_VERSION", "v21.0"),
+        FacebookEventNames:    getEnvMap("FB_EVENT_NAMES"),
+        FacebookDefaultEvent:  getEnv("FB_DEFAULT_EVENT", "Purchase"),
+        FacebookTestEventCode: os.Getenv("FB_TEST_EVENT_CODE"),
+        Currency:              getEnv("CURRENCY", getEnv("FB_CURRENCY", "USD")),
+        TikTokPixelCode:       os.Getenv("TIKTOK_PIXEL_CODE"),
+        TikTokToken:           os.Getenv("TIKTOK_ACCESS_TOKEN"),
+        TikTokEventNames:      getEnvMap("TIKTOK_EVENT_NAMES"),
+        TikTokDefaultEvent:    getEnv("TIKTOK_DEFAULT_EVENT", "CompletePayment"),
+        TikTokTestEventCode:   os.Getenv("TIKTOK_TEST_EVENT_CODE"),
+        GoogleAdsConversionName: getEnv("GOOGLE_ADS_CONVERSION_NAME", "Offline Conversion"),
+        GoogleAdsFeedToken:      os.Getenv("GOOGLE_ADS_FEED_TOKEN"),
         CloudflareToken: os.Getenv("CLOUDFLARE_TOKEN"),
         ServerIP:        os.Getenv("SERVER_IP"),
+        TransactionIDParam: os.Getenv("POSTBACK_TXID_PARAM"),
+        OutboxWorkers:   getEnvInt("OUTBOX_WORKERS", 4),
+        RollupInterval:  time.Duration(getEnvInt("ROLLUP_INTERVAL_MINUTES", 5)) * time.Minute,
+        RollupLookback:  time.Duration(getEnvInt("ROLLUP_LOOKBACK_HOURS", 48)) * time.Hour,
+        ReportLocation:  reportLocation,
+        GeoCityDB:           getEnv("GEOIP_CITY_DB", "GeoLite2-City.mmdb"),
+        GeoASNDB:            getEnv("GEOIP_ASN_DB", "GeoLite2-ASN.mmdb"),
+        GeoConnectionTypeDB: getEnv("GEOIP_CONNECTION_TYPE_DB", "GeoIP2-Connection-Type.mmdb"),
+        GeoReloadInterval:   time.Duration(getEnvInt("GEOIP_RELOAD_SECONDS", 60)) * time.Second,
+        GeoCacheSize:        getEnvInt("GEOIP_CACHE_SIZE", 10000),
+        GeoFallback:         os.Getenv("GEOIP_FALLBACK"),
+        TrustedProxies:      trustedProxies,
+        ClientIPHeaders:     clientIPHeaders,
+        BotHostingList:      getEnv("BOT_HOSTING_LIST", "configs/hosting-asns.txt"),
+        FraudHoldScore:            getEnvInt("FRAUD_HOLD_SCORE", 70),
+        FraudIPClicksPerHour:      getEnvInt("FRAUD_IP_CLICKS_PER_HOUR", 20),
+        FraudVisitorClicksPerHour: getEnvInt("FRAUD_VISITOR_CLICKS_PER_HOUR", 10),
+        FraudMinTimeToConvert:     time.Duration(getEnvInt("FRAUD_MIN_SECONDS_TO_CONVERT", 10)) * time.Second,
+        UARegexes:                 os.Getenv("UA_REGEXES"),
     }, nil
 }
 
@@ -41,4 +154,36 @@ func getEnv(key, defaultValue string) string {
         return value
     }
     return defaultValue
-} 
\ No newline at end of file
+}
+
+func getEnvInt(key string, defaultValue int) int {
+    if value, exists := os.LookupEnv(key); exists {
+        if n, err := strconv.Atoi(value); err == nil {
+            return n
+        }
+    }
+    return defaultValue
+}
+
+// getEnvList parses comma-separated lists, skipping blanks
+func getEnvList(key string) []string {
+    var values []string
+    for _, v := range strings.Split(os.Getenv(key), ",") {
+        if v = strings.TrimSpace(v); v != "" {
+            values = append(values, v)
+        }
+    }
+    return values
+}
+
+// getEnvMap parses "key:value,key:value" lists. Keys are lowercased.
+func getEnvMap(key string) map[string]string {
+    values := map[string]string{}
+    for _, pair := range strings.Split(os.Getenv(key), ",") {
+        k, v, ok := strings.Cut(pair, ":")
+        if ok && strings.TrimSpace(k) != "" {
+            values[strings.ToLower(strings.TrimSpace(k))] = strings.TrimSpace(v)
+        }
+    }
+    return values
+}
@@ -0,0 +1,179 @@
+// Package connectors reports conversions to the ad platforms that sent the
+// traffic, so their bidding optimizes on them. Each platform is a Connector
+// turning a conversion into an outbox delivery; campaigns choose which
+// connectors they report to.
+package connectors
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+
+	"unchained-tracker/internal/db"
+)
+
+// Contact is personal data a conversion arrived with. It is only
+// forwarded hashed, never stored.
+type Contact struct {
+	Email string
+	Phone string
+}
+
+// Event is a conversion with what we know about the visitor behind it.
+// Visit and Click are nil when the conversion wasn't tracked through them.
+type Event struct {
+	Conversion *db.Conversion
+	Visit      *db.Visit
+	Click      *db.Click
+	Contact    Contact
+}
+
+// Connector reports conversions to one ad platform. Settings are the
+// campaign's overrides of the connector's configuration, e.g. pixel_id.
+type Connector interface {
+	Name() string
+	// Delivery builds the request reporting e, or returns nil when the
+	// platform isn't pushed to or has nothing to match e with
+	Delivery(e *Event, settings map[string]string) (*db.Delivery, error)
+}
+
+// Authorizer is implemented by connectors whose credentials are added to
+// the request when a delivery is sent, so they never sit in the outbox.
+// Settings are the same campaign overrides Delivery got.
+type Authorizer interface {
+	Authorize(req *http.Request, settings map[string]string) error
+}
+
+// Registry holds the available connectors by name
+type Registry map[string]Connector
+
+func NewRegistry(connectors ...Connector) Registry {
+	r := Registry{}
+	for _, c := range connectors {
+		r[c.Name()] = c
+	}
+	return r
+}
+
+// Names lists the registered connectors alphabetically
+func (r Registry) Names() []string {
+	names := make([]string, 0, len(r))
+	for name := range r {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// setting returns the campaign's value for key, else fallback
+func setting(settings map[string]string, key, fallback string) string {
+	if v := settings[key]; v != "" {
+		return v
+	}
+	return fallback
+}
+
+// eventName maps a conversion type through names, else returns fallback
+func eventName(names map[string]string, conversionType, fallback string) string {
+	if name := names[strings.ToLower(conversionType)]; name != "" {
+		return name
+	}
+	return fallback
+}
+
+// EventID is shared with the browser pixels so the platforms count the
+// conversion once: the event_id the conversion was reported with, else the
+// network's transaction ID, else our conversion ID
+func EventID(c *db.Conversion) string {
+	if c.EventID != "" {
+		return c.EventID
+	}
+	if c.TransactionID != "" {
+		return c.TransactionID
+	}
+	return fmt.Sprintf("conv-%d", c.ID)
+}
+
+// CampaignID is the conversion's campaign, else its click's
+func (e *Event) CampaignID() string {
+	if e.Conversion.CampaignID == "" && e.Click != nil {
+		return e.Click.CampaignID
+	}
+	return e.Conversion.CampaignID
+}
+
+func (e *Event) ipAddress() string {
+	if e.Visit != nil && e.Visit.IPAddress != "" {
+		return e.Visit.IPAddress
+	}
+	if e.Click != nil {
+		return e.Click.IPAddress
+	}
+	return ""
+}
+
+func (e *Event) userAgent() string {
+	if e.Visit != nil && e.Visit.UserAgent != "" {
+		return e.Visit.UserAgent
+	}
+	if e.Click != nil {
+		return e.Click.UserAgent
+	}
+	return ""
+}
+
+func (e *Event) pageURL() string {
+	if e.Visit != nil {
+		return e.Visit.LandingPage
+	}
+	return ""
+}
+
+func (e *Event) visitorID() string {
+	if e.Visit != nil && e.Visit.VisitorID != "" {
+		return e.Visit.VisitorID
+	}
+	return e.Conversion.VisitorID
+}
+
+var sha256Hex = regexp.MustCompile(`^[0-9a-f]{64}$`)
+
+// Hash returns value SHA-256 hashed, or "" for an empty value. Values
+// that are already hashed are passed through.
+func Hash(value string) string {
+	if value == "" || sha256Hex.MatchString(value) {
+		return value
+	}
+	sum := sha256.Sum256([]byte(value))
+	return hex.EncodeToString(sum[:])
+}
+
+// hashedValues returns Hash(value) as a one element list, or nil
+func hashedValues(value string) []string {
+	if value == "" {
+		return nil
+	}
+	return []string{Hash(value)}
+}
+
+func normalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// normalizePhone keeps the digits, which include the country code
+func normalizePhone(phone string) string {
+	if trimmed := strings.ToLower(strings.TrimSpace(phone)); sha256Hex.MatchString(trimmed) {
+		return trimmed
+	}
+	var digits strings.Builder
+	for _, c := range phone {
+		if c >= '0' && c <= '9' {
+			digits.WriteRune(c)
+		}
+	}
+	return digits.String()
+}
@@ -0,0 +1,140 @@
+package connectors
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"unchained-tracker/internal/db"
+)
+
+// Facebook sends conversions to the Meta Conversions API. Campaigns can
+// override pixel_id, access_token and test_event_code.
+type Facebook struct {
+	PixelID     string
+	AccessToken string
+	APIVersion  string
+	// EventNames maps conversion types to event names, e.g. lead -> Lead;
+	// other types use DefaultEvent
+	EventNames    map[string]string
+	DefaultEvent  string
+	Currency      string
+	TestEventCode string
+}
+
+func (f *Facebook) Name() string { return "facebook" }
+
+// facebookPayload is a Conversions API request body
+type facebookPayload struct {
+	Data          []facebookEvent `json:"data"`
+	TestEventCode string          `json:"test_event_code,omitempty"`
+}
+
+type facebookEvent struct {
+	EventName      string             `json:"event_name"`
+	EventTime      int64              `json:"event_time"`
+	EventID        string             `json:"event_id"`
+	ActionSource   string             `json:"action_source"`
+	EventSourceURL string             `json:"event_source_url,omitempty"`
+	UserData       facebookUserData   `json:"user_data"`
+	CustomData     facebookCustomData `json:"custom_data"`
+}
+
+// facebookUserData holds the match keys. Email, phone and external ID are
+// SHA-256 hashed as the API requires.
+type facebookUserData struct {
+	ClientIPAddress string   `json:"client_ip_address,omitempty"`
+	ClientUserAgent string   `json:"client_user_agent,omitempty"`
+	FBC             string   `json:"fbc,omitempty"`
+	FBP             string   `json:"fbp,omitempty"`
+	Email           []string `json:"em,omitempty"`
+	Phone           []string `json:"ph,omitempty"`
+	ExternalID      []string `json:"external_id,omitempty"`
+}
+
+type facebookCustomData struct {
+	Value      float64 `json:"value"`
+	Currency   string  `json:"currency"`
+	CampaignID string  `json:"campaign_id,omitempty"`
+	ClickID    string  `json:"click_id,omitempty"`
+}
+
+func (f *Facebook) Delivery(e *Event, settings map[string]string) (*db.Delivery, error) {
+	pixelID := setting(settings, "pixel_id", f.PixelID)
+	if pixelID == "" || setting(settings, "access_token", f.AccessToken) == "" {
+		return nil, fmt.Errorf("no Facebook pixel configured")
+	}
+
+	conversion := e.Conversion
+	currency := conversion.Currency
+	if currency == "" {
+		currency = f.Currency
+	}
+
+	var fbc, fbp string
+	if e.Visit != nil {
+		fbc, fbp = e.Visit.FBC, e.Visit.FBP
+	}
+	if e.Click != nil {
+		if fbc == "" {
+			fbc = e.Click.FBC
+		}
+		if fbp == "" {
+			fbp = e.Click.FBP
+		}
+	}
+
+	event := facebookEvent{
+		EventName:      eventName(f.EventNames, conversion.Type, f.DefaultEvent),
+		EventTime:      conversion.CreatedAt.Unix(),
+		EventID:        EventID(conversion),
+		ActionSource:   "website",
+		EventSourceURL: e.pageURL(),
+		UserData: facebookUserData{
+			ClientIPAddress: e.ipAddress(),
+			ClientUserAgent: e.userAgent(),
+			FBC:             fbc,
+			FBP:             fbp,
+			ExternalID:      hashedValues(e.visitorID()),
+			Email:           hashedValues(normalizeEmail(e.Contact.Email)),
+			Phone:           hashedValues(normalizePhone(e.Contact.Phone)),
+		},
+		CustomData: facebookCustomData{
+			Value:      conversion.Amount,
+			Currency:   currency,
+			CampaignID: conversion.CampaignID,
+			ClickID:    conversion.ClickID,
+		},
+	}
+	if event.EventName == "" {
+		event.EventName = "Purchase"
+	}
+
+	body, err := json.Marshal(facebookPayload{
+		Data:          []facebookEvent{event},
+		TestEventCode: setting(settings, "test_event_code", f.TestEventCode),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error marshaling event: %v", err)
+	}
+
+	return &db.Delivery{
+		Kind:        f.Name(),
+		Target:      pixelID,
+		Method:      http.MethodPost,
+		URL:         fmt.Sprintf("https://graph.facebook.com/%s/%s/events", f.APIVersion, pixelID),
+		ContentType: "application/json",
+		Body:        string(body),
+	}, nil
+}
+
+// Authorize adds the access token as a bearer token. It stays out of the
+// URL, which transport errors quote and the outbox records.
+func (f *Facebook) Authorize(req *http.Request, settings map[string]string) error {
+	accessToken := setting(settings, "access_token", f.AccessToken)
+	if accessToken == "" {
+		return fmt.Errorf("no Facebook access token configured")
+	}
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+	return nil
+}
@@ -0,0 +1,56 @@
+package connectors
+
+import (
+	"encoding/csv"
+	"io"
+	"strconv"
+	"strings"
+
+	"unchained-tracker/internal/db"
+)
+
+// GoogleAds reports conversions as an offline conversion import. Nothing is
+// pushed: Google Ads fetches the feed WriteFeed renders on a schedule.
+// Campaigns can override conversion_name, the conversion action the rows
+// are imported into.
+type GoogleAds struct {
+	ConversionName string
+	Currency       string
+}
+
+func (g *GoogleAds) Name() string { return "google_ads" }
+
+func (g *GoogleAds) Delivery(e *Event, settings map[string]string) (*db.Delivery, error) {
+	return nil, nil
+}
+
+// googleAdsTimeLayout is the conversion time format of the import template
+const googleAdsTimeLayout = "2006-01-02 15:04:05"
+
+// WriteFeed writes conversions as a Google Ads offline conversion CSV,
+// with times in UTC. Conversions without a gclid are skipped.
+func (g *GoogleAds) WriteFeed(w io.Writer, conversions []db.ConnectorConversion) error {
+	out := csv.NewWriter(w)
+	out.Write([]string{"Parameters:TimeZone=+0000"})
+	out.Write([]string{"Google Click ID", "Conversion Name", "Conversion Time", "Conversion Value", "Conversion Currency"})
+
+	for _, c := range conversions {
+		if c.GCLID == "" {
+			continue
+		}
+		currency := strings.ToUpper(c.Currency)
+		if currency == "" {
+			currency = g.Currency
+		}
+		out.Write([]string{
+			c.GCLID,
+			setting(c.Settings, "conversion_name", g.ConversionName),
+			c.CreatedAt.UTC().Format(googleAdsTimeLayout),
+			strconv.FormatFloat(c.Amount, 'f', -1, 64),
+			currency,
+		})
+	}
+
+	out.Flush()
+	return out.Error()
+}
@@ -0,0 +1,141 @@
+package connectors
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"unchained-tracker/internal/db"
+)
+
+const tiktokEventsURL = "https://business-api.tiktok.com/open_api/v1.3/event/track/"
+
+// TikTok sends conversions to the TikTok Events API, matched on the ttclid
+// captured on /click. Campaigns can override pixel_code, access_token and
+// test_event_code.
+type TikTok struct {
+	PixelCode   string
+	AccessToken string
+	// EventNames maps conversion types to event names, e.g.
+	// lead -> SubmitForm; other types use DefaultEvent
+	EventNames    map[string]string
+	DefaultEvent  string
+	Currency      string
+	TestEventCode string
+}
+
+func (t *TikTok) Name() string { return "tiktok" }
+
+type tiktokPayload struct {
+	EventSource   string        `json:"event_source"`
+	EventSourceID string        `json:"event_source_id"`
+	TestEventCode string        `json:"test_event_code,omitempty"`
+	Data          []tiktokEvent `json:"data"`
+}
+
+type tiktokEvent struct {
+	Event      string           `json:"event"`
+	EventTime  int64            `json:"event_time"`
+	EventID    string           `json:"event_id"`
+	User       tiktokUser       `json:"user"`
+	Properties tiktokProperties `json:"properties"`
+	Page       *tiktokPage      `json:"page,omitempty"`
+}
+
+// tiktokUser holds the match keys. Email, phone and external ID are
+// SHA-256 hashed as the API requires.
+type tiktokUser struct {
+	TTCLID     string `json:"ttclid,omitempty"`
+	Email      string `json:"email,omitempty"`
+	Phone      string `json:"phone,omitempty"`
+	ExternalID string `json:"external_id,omitempty"`
+	IP         string `json:"ip,omitempty"`
+	UserAgent  string `json:"user_agent,omitempty"`
+}
+
+type tiktokProperties struct {
+	Value    float64 `json:"value"`
+	Currency string  `json:"currency"`
+}
+
+type tiktokPage struct {
+	URL string `json:"url"`
+}
+
+func (t *TikTok) Delivery(e *Event, settings map[string]string) (*db.Delivery, error) {
+	pixelCode := setting(settings, "pixel_code", t.PixelCode)
+	if pixelCode == "" || setting(settings, "access_token", t.AccessToken) == "" {
+		return nil, fmt.Errorf("no TikTok pixel configured")
+	}
+
+	conversion := e.Conversion
+	currency := conversion.Currency
+	if currency == "" {
+		currency = t.Currency
+	}
+
+	event := tiktokEvent{
+		Event:     eventName(t.EventNames, conversion.Type, t.DefaultEvent),
+		EventTime: conversion.CreatedAt.Unix(),
+		EventID:   EventID(conversion),
+		User: tiktokUser{
+			Email:      Hash(normalizeEmail(e.Contact.Email)),
+			Phone:      Hash(tiktokPhone(e.Contact.Phone)),
+			ExternalID: Hash(e.visitorID()),
+			IP:         e.ipAddress(),
+			UserAgent:  e.userAgent(),
+		},
+		Properties: tiktokProperties{
+			Value:    conversion.Amount,
+			Currency: currency,
+		},
+	}
+	if event.Event == "" {
+		event.Event = "CompletePayment"
+	}
+	if e.Click != nil {
+		event.User.TTCLID = e.Click.TTCLID
+	}
+	if url := e.pageURL(); url != "" {
+		event.Page = &tiktokPage{URL: url}
+	}
+
+	body, err := json.Marshal(tiktokPayload{
+		EventSource:   "web",
+		EventSourceID: pixelCode,
+		TestEventCode: setting(settings, "test_event_code", t.TestEventCode),
+		Data:          []tiktokEvent{event},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error marshaling event: %v", err)
+	}
+
+	return &db.Delivery{
+		Kind:        t.Name(),
+		Target:      pixelCode,
+		Method:      http.MethodPost,
+		URL:         tiktokEventsURL,
+		ContentType: "application/json",
+		Body:        string(body),
+	}, nil
+}
+
+// Authorize adds the access token as the Access-Token header
+func (t *TikTok) Authorize(req *http.Request, settings map[string]string) error {
+	accessToken := setting(settings, "access_token", t.AccessToken)
+	if accessToken == "" {
+		return fmt.Errorf("no TikTok access token configured")
+	}
+	req.Header.Set("Access-Token", accessToken)
+	return nil
+}
+
+// tiktokPhone is the phone number in E.164 format, which TikTok hashes
+// with its leading +
+func tiktokPhone(phone string) string {
+	digits := normalizePhone(phone)
+	if digits == "" || sha256Hex.MatchString(digits) {
+		return digits
+	}
+	return "+" + digits
+}
@@ -0,0 +1,41 @@
+package db
+
+import "fmt"
+
+// Campaign bot policies. Flagged bots are recorded with IsBot set and
+// reported apart from people; dropped bots aren't recorded at all. Off
+// skips bot detection. Campaigns without a policy flag bots.
+const (
+	BotPolicyFlag = "flag"
+	BotPolicyDrop = "drop"
+	BotPolicyOff  = "off"
+)
+
+// ValidBotPolicy reports whether policy is a bot policy, or none
+func ValidBotPolicy(policy string) bool {
+	switch policy {
+	case "", BotPolicyFlag, BotPolicyDrop, BotPolicyOff:
+		return true
+	}
+	return false
+}
+
+func validateBotPolicy(c *Campaign) error {
+	if !ValidBotPolicy(c.BotPolicy) {
+		return fmt.Errorf("unknown bot policy %q", c.BotPolicy)
+	}
+	if c.BotPolicy == "" {
+		c.BotPolicy = BotPolicyFlag
+	}
+	return nil
+}
+
+// humanOnly and botOnly count a row when the click or visit aliased as
+// table is a person's or a bot's, and not when there is none
+func humanOnly(table string) string {
+	return "CASE WHEN " + table + ".is_bot = 0 THEN 1 ELSE 0 END"
+}
+
+func botOnly(table string) string {
+	return "CASE WHEN " + table + ".is_bot = 1 THEN 1 ELSE 0 END"
+}
@@ -0,0 +1,144 @@
+package db
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+func encodeConnectorSettings(settings map[string]string) (sql.NullString, error) {
+	if len(settings) == 0 {
+		return sql.NullString{}, nil
+	}
+	b, err := json.Marshal(settings)
+	if err != nil {
+		return sql.NullString{}, err
+	}
+	return sql.NullString{String: string(b), Valid: true}, nil
+}
+
+func decodeConnectorSettings(s string) (map[string]string, error) {
+	if s == "" {
+		return nil, nil
+	}
+	var settings map[string]string
+	err := json.Unmarshal([]byte(s), &settings)
+	return settings, err
+}
+
+// GetCampaignConnectors lists the connectors enabled on a campaign
+func (db *Database) GetCampaignConnectors(campaignID string) ([]CampaignConnector, error) {
+	rows, err := db.Query(`
+		SELECT id, campaign_id, connector, COALESCE(settings, ''), `+db.dateTime("created_at")+`
+		FROM campaign_connector
+		WHERE campaign_id = ?
+		ORDER BY connector`,
+		campaignID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var connectors []CampaignConnector
+	for rows.Next() {
+		var c CampaignConnector
+		var settings, createdAtStr string
+		if err := rows.Scan(&c.ID, &c.CampaignID, &c.Connector, &settings, &createdAtStr); err != nil {
+			return nil, err
+		}
+		if c.Settings, err = decodeConnectorSettings(settings); err != nil {
+			return nil, fmt.Errorf("invalid settings for connector %s: %v", c.Connector, err)
+		}
+		if c.CreatedAt, err = time.Parse("2006-01-02 15:04:05", createdAtStr); err != nil {
+			return nil, err
+		}
+		connectors = append(connectors, c)
+	}
+	return connectors, rows.Err()
+}
+
+// SetCampaignConnectors replaces the connectors enabled on a campaign
+func (db *Database) SetCampaignConnectors(campaignID string, connectors []CampaignConnector) error {
+	tx, err := db.sqlDB.Begin()
+	if err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec("DELETE FROM campaign_connector WHERE campaign_id = ?", campaignID); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	for i := range connectors {
+		settings, err := encodeConnectorSettings(connectors[i].Settings)
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+		result, err := tx.Exec(
+			"INSERT INTO campaign_connector (campaign_id, connector, settings) VALUES (?, ?, ?)",
+			campaignID, connectors[i].Connector, settings,
+		)
+		if err != nil {
+			tx.Rollback()
+			return fmt.Errorf("error adding connector %s: %v", connectors[i].Connector, err)
+		}
+		connectors[i].ID, _ = result.LastInsertId()
+		connectors[i].CampaignID = campaignID
+	}
+
+	return tx.Commit()
+}
+
+// GetConnectorConversions lists the revenue conversions since the given
+// time on campaigns that have connector enabled, oldest first, optionally
+// for one campaign only. Conversions without a click are left out.
+func (db *Database) GetConnectorConversions(connector string, since time.Time, campaignID string) ([]ConnectorConversion, error) {
+	query := `
+		SELECT conv.id, COALESCE(conv.visitor_id, ''), conv.click_id, k.campaign_id,
+			COALESCE(conv.amount, 0), conv.status, COALESCE(conv.transaction_id, ''), conv.network,
+			COALESCE(conv.currency, ''), conv.type, COALESCE(conv.event_id, ''),
+			` + db.dateTime("conv.created_at") + `,
+			COALESCE(k.gclid, ''), COALESCE(k.ttclid, ''), COALESCE(cc.settings, '')
+		FROM conversion conv
+		JOIN click k ON k.click_id = conv.click_id
+		JOIN campaign_connector cc ON cc.campaign_id = k.campaign_id AND cc.connector = ?
+		WHERE conv.status IN ` + revenueStatuses + `
+			AND conv.created_at >= ?`
+	args := []interface{}{connector, since}
+	if campaignID != "" {
+		query += " AND k.campaign_id = ?"
+		args = append(args, campaignID)
+	}
+	query += " ORDER BY conv.created_at, conv.id"
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var conversions []ConnectorConversion
+	for rows.Next() {
+		var c ConnectorConversion
+		var createdAtStr, settings string
+		err := rows.Scan(
+			&c.ID, &c.VisitorID, &c.ClickID, &c.CampaignID,
+			&c.Amount, &c.Status, &c.TransactionID, &c.Network, &c.Currency, &c.Type, &c.EventID,
+			&createdAtStr, &c.GCLID, &c.TTCLID, &settings,
+		)
+		if err != nil {
+			return nil, err
+		}
+		if c.CreatedAt, err = time.Parse("2006-01-02 15:04:05", createdAtStr); err != nil {
+			return nil, err
+		}
+		if c.Settings, err = decodeConnectorSettings(settings); err != nil {
+			return nil, err
+		}
+		conversions = append(conversions, c)
+	}
+	return conversions, rows.Err()
+}
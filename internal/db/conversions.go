@@ -0,0 +1,205 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Conversion statuses. Pending and approved conversions count towards
+// revenue, rejected and chargeback ones don't. Unverified conversions come
+// from the browser pixel and held ones scored too high for fraud; neither
+// counts until someone approves it.
+const (
+	StatusUnverified = "unverified"
+	StatusHeld       = "held"
+	StatusPending    = "pending"
+	StatusApproved   = "approved"
+	StatusRejected   = "rejected"
+	StatusChargeback = "chargeback"
+)
+
+// revenueStatuses is the SQL list of statuses that count as revenue
+const revenueStatuses = "('pending', 'approved')"
+
+// CountsAsRevenue reports whether a conversion in status adds to revenue
+func CountsAsRevenue(status string) bool {
+	return status == StatusPending || status == StatusApproved
+}
+
+// statusTransitions lists where each status may move to. A chargeback is
+// final; a rejected lead can still be approved on appeal.
+var statusTransitions = map[string][]string{
+	StatusUnverified: {StatusApproved, StatusRejected},
+	StatusHeld:       {StatusApproved, StatusRejected},
+	StatusPending:    {StatusApproved, StatusRejected},
+	StatusApproved:   {StatusRejected, StatusChargeback},
+	StatusRejected:   {StatusApproved},
+	StatusChargeback: {},
+}
+
+// CanTransition reports whether a conversion may move from one status to
+// another. Staying in the same status is always allowed, which is how an
+// amount is adjusted without a status change.
+func CanTransition(from, to string) bool {
+	if from == to {
+		return true
+	}
+	for _, s := range statusTransitions[from] {
+		if s == to {
+			return true
+		}
+	}
+	return false
+}
+
+// NormalizeStatus maps the status values networks commonly send onto our
+// statuses. ok is false for values it doesn't recognize.
+func NormalizeStatus(status string) (normalized string, ok bool) {
+	switch strings.ToLower(strings.TrimSpace(status)) {
+	case "pending", "hold", "on_hold", "0":
+		return StatusPending, true
+	case "approved", "approve", "completed", "complete", "confirmed", "success", "paid", "1":
+		return StatusApproved, true
+	case "rejected", "reject", "declined", "denied", "invalid", "cancelled", "canceled", "-1", "2":
+		return StatusRejected, true
+	case "chargeback", "reversed", "reversal", "refund", "refunded":
+		return StatusChargeback, true
+	}
+	return "", false
+}
+
+// ConversionStatusChange is one entry in a conversion's history
+type ConversionStatusChange struct {
+	ID           int64     `json:"id"`
+	ConversionID int64     `json:"conversion_id"`
+	FromStatus   string    `json:"from_status"`
+	ToStatus     string    `json:"to_status"`
+	FromAmount   float64   `json:"from_amount"`
+	ToAmount     float64   `json:"to_amount"`
+	Source       string    `json:"source"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+const conversionColumns = `
+	id, COALESCE(visitor_id, ''), COALESCE(click_id, ''), COALESCE(campaign_id, ''),
+	COALESCE(amount, 0), COALESCE(status, ''), COALESCE(transaction_id, ''), network,
+	COALESCE(currency, ''), type, COALESCE(event_id, ''), fraud_score, fraud_reason`
+
+func (db *Database) getConversion(where string, args ...interface{}) (*Conversion, error) {
+	query := `SELECT ` + conversionColumns + `, ` + db.dateTime("created_at") + `
+		FROM conversion
+		WHERE ` + where
+
+	c := new(Conversion)
+	var createdAtStr string
+	err := db.QueryRow(query, args...).Scan(
+		&c.ID, &c.VisitorID, &c.ClickID, &c.CampaignID,
+		&c.Amount, &c.Status, &c.TransactionID, &c.Network, &c.Currency, &c.Type, &c.EventID,
+		&c.FraudScore, &c.FraudReason, &createdAtStr,
+	)
+	if err != nil {
+		return nil, err
+	}
+	c.CreatedAt, err = time.Parse("2006-01-02 15:04:05", createdAtStr)
+	if err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func (db *Database) GetConversionByID(id int64) (*Conversion, error) {
+	return db.getConversion("id = ?", id)
+}
+
+// GetConversionByTransactionID returns sql.ErrNoRows when the network
+// hasn't reported transactionID yet. Transaction IDs are unique per network.
+func (db *Database) GetConversionByTransactionID(network, transactionID string) (*Conversion, error) {
+	return db.getConversion("network = ? AND transaction_id = ?", network, transactionID)
+}
+
+// UpdateConversionStatus moves c to status with the given amount and
+// records the change in the conversion's history.
+func (db *Database) UpdateConversionStatus(c *Conversion, status string, amount float64, source string) error {
+	if !CanTransition(c.Status, status) {
+		return fmt.Errorf("conversion %d cannot move from %s to %s", c.ID, c.Status, status)
+	}
+
+	tx, err := db.sqlDB.Begin()
+	if err != nil {
+		return err
+	}
+
+	// Guard on the current status so concurrent postbacks can't both apply
+	result, err := tx.Exec(
+		"UPDATE conversion SET status = ?, amount = ?, updated_at = ? WHERE id = ? AND status = ?",
+		status, amount, time.Now().UTC(), c.ID, c.Status,
+	)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		tx.Rollback()
+		return fmt.Errorf("conversion %d changed concurrently", c.ID)
+	}
+
+	if err := insertStatusChange(tx, c.ID, c.Status, status, c.Amount, amount, source); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	c.Status = status
+	c.Amount = amount
+	db.refreshRollups(c.CreatedAt, c.CreatedAt.Add(time.Hour))
+	return nil
+}
+
+func insertStatusChange(tx *sql.Tx, conversionID int64, fromStatus, toStatus string, fromAmount, toAmount float64, source string) error {
+	_, err := tx.Exec(`
+		INSERT INTO conversion_status_history (
+			conversion_id, from_status, to_status, from_amount, to_amount, source, created_at
+		) VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		conversionID, fromStatus, toStatus, fromAmount, toAmount, source, time.Now().UTC(),
+	)
+	return err
+}
+
+func (db *Database) GetConversionHistory(conversionID int64) ([]ConversionStatusChange, error) {
+	query := `
+		SELECT id, conversion_id, from_status, to_status, from_amount, to_amount, source,
+			` + db.dateTime("created_at") + `
+		FROM conversion_status_history
+		WHERE conversion_id = ?
+		ORDER BY id
+	`
+
+	rows, err := db.Query(query, conversionID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var history []ConversionStatusChange
+	for rows.Next() {
+		var h ConversionStatusChange
+		var createdAtStr string
+		err := rows.Scan(
+			&h.ID, &h.ConversionID, &h.FromStatus, &h.ToStatus,
+			&h.FromAmount, &h.ToAmount, &h.Source, &createdAtStr,
+		)
+		if err != nil {
+			return nil, err
+		}
+		h.CreatedAt, err = time.Parse("2006-01-02 15:04:05", createdAtStr)
+		if err != nil {
+			return nil, err
+		}
+		history = append(history, h)
+	}
+	return history, rows.Err()
+}
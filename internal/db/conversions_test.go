@@ -0,0 +1,84 @@
+package db
+
+import (
+	"testing"
+	"time"
+)
+
+func TestConversionStatusLifecycle(t *testing.T) {
+	database := newTestDatabase(t)
+
+	visit := &Visit{VisitorID: "v", CampaignID: "test-campaign", CreatedAt: time.Now()}
+	if err := database.SaveVisit(visit); err != nil {
+		t.Fatalf("SaveVisit: %v", err)
+	}
+
+	c := &Conversion{
+		VisitorID:     "v",
+		CampaignID:    "test-campaign",
+		Amount:        10,
+		TransactionID: "tx-1",
+		CreatedAt:     time.Now(),
+	}
+	if err := database.SaveConversion(c); err != nil {
+		t.Fatalf("SaveConversion: %v", err)
+	}
+	if c.Status != StatusPending {
+		t.Fatalf("default status = %q, want pending", c.Status)
+	}
+
+	got, err := database.GetConversionByTransactionID("", "tx-1")
+	if err != nil || got.ID != c.ID {
+		t.Fatalf("GetConversionByTransactionID = %+v, %v", got, err)
+	}
+
+	if err := database.UpdateConversionStatus(got, StatusApproved, 12, "network:test"); err != nil {
+		t.Fatalf("approve: %v", err)
+	}
+	if err := database.UpdateConversionStatus(got, StatusChargeback, 12, "network:test"); err != nil {
+		t.Fatalf("chargeback: %v", err)
+	}
+	if err := database.UpdateConversionStatus(got, StatusApproved, 12, "manual"); err == nil {
+		t.Fatal("chargeback -> approved should be rejected")
+	}
+
+	stored, err := database.GetConversionByID(c.ID)
+	if err != nil || stored.Status != StatusChargeback || stored.Amount != 12 {
+		t.Fatalf("GetConversionByID = %+v, %v", stored, err)
+	}
+
+	history, err := database.GetConversionHistory(c.ID)
+	if err != nil {
+		t.Fatalf("GetConversionHistory: %v", err)
+	}
+	want := []string{StatusPending, StatusApproved, StatusChargeback}
+	if len(history) != len(want) {
+		t.Fatalf("history = %+v", history)
+	}
+	for i, h := range history {
+		if h.ToStatus != want[i] {
+			t.Errorf("history[%d].ToStatus = %q, want %q", i, h.ToStatus, want[i])
+		}
+	}
+	if history[1].FromAmount != 10 || history[1].ToAmount != 12 {
+		t.Errorf("approve amounts = %v -> %v", history[1].FromAmount, history[1].ToAmount)
+	}
+}
+
+func TestNormalizeStatus(t *testing.T) {
+	cases := map[string]string{
+		"completed": StatusApproved,
+		"1":         StatusApproved,
+		"Declined":  StatusRejected,
+		"reversed":  StatusChargeback,
+		" hold ":    StatusPending,
+	}
+	for in, want := range cases {
+		if got, ok := NormalizeStatus(in); !ok || got != want {
+			t.Errorf("NormalizeStatus(%q) = %q, %v; want %q", in, got, ok, want)
+		}
+	}
+	if _, ok := NormalizeStatus("bogus"); ok {
+		t.Error("NormalizeStatus(bogus) should fail")
+	}
+}
@@ -0,0 +1,135 @@
+package db
+
+import (
+	"fmt"
+	"time"
+)
+
+// Campaign cost models. CPC and CPM campaigns cost DefaultBid per click or
+// per thousand clicks, CPA campaigns DefaultBid per conversion and RevShare
+// campaigns DefaultBid percent of the revenue. Campaigns without a model
+// only have the costs passed with their clicks or imported for them.
+const (
+	CostModelCPC      = "cpc"
+	CostModelCPM      = "cpm"
+	CostModelCPA      = "cpa"
+	CostModelRevShare = "revshare"
+)
+
+// clickConversions totals the revenue conversions per click, so reports
+// can join it to clicks without counting a click's cost twice
+const clickConversions = `(
+	SELECT click_id, COUNT(*) as conversions, SUM(amount) as revenue
+	FROM conversion
+	WHERE status IN ` + revenueStatuses + `
+	GROUP BY click_id
+)`
+
+// ValidCostModel reports whether model is a cost model, or none
+func ValidCostModel(model string) bool {
+	switch model {
+	case "", CostModelCPC, CostModelCPM, CostModelCPA, CostModelRevShare:
+		return true
+	}
+	return false
+}
+
+func validateCostModel(c *Campaign) error {
+	if !ValidCostModel(c.CostModel) {
+		return fmt.Errorf("unknown cost model %q", c.CostModel)
+	}
+	if c.DefaultBid < 0 {
+		return fmt.Errorf("default bid can't be negative")
+	}
+	return nil
+}
+
+// ClickCost is what one click costs under the campaign's cost model, for
+// clicks the traffic source didn't pass a cost with
+func (c *Campaign) ClickCost() float64 {
+	switch c.CostModel {
+	case CostModelCPC:
+		return c.DefaultBid
+	case CostModelCPM:
+		return c.DefaultBid / 1000
+	}
+	return 0
+}
+
+// conversionCost is what CPA and RevShare campaigns pay for their
+// conversions, on top of the cost of their clicks
+func conversionCost(model string, bid float64, conversions int64, revenue float64) float64 {
+	switch model {
+	case CostModelCPA:
+		return bid * float64(conversions)
+	case CostModelRevShare:
+		return revenue * bid / 100
+	}
+	return 0
+}
+
+// campaignCostModel returns the cost model and default bid of a campaign
+func (db *Database) campaignCostModel(campaignID string) (string, float64, error) {
+	var model string
+	var bid float64
+	err := db.QueryRow(
+		"SELECT cost_model, default_bid FROM campaign WHERE campaign_id = ?", campaignID,
+	).Scan(&model, &bid)
+	return model, bid, err
+}
+
+// NewMetrics derives the report columns from the raw figures
+func NewMetrics(clicks, conversions int64, revenue, cost float64) Metrics {
+	m := Metrics{Cost: cost, Profit: revenue - cost}
+	if cost > 0 {
+		m.ROI = m.Profit / cost * 100
+	}
+	if clicks > 0 {
+		m.EPC = revenue / float64(clicks)
+		m.CR = float64(conversions) / float64(clicks) * 100
+	}
+	if conversions > 0 {
+		m.CPA = cost / float64(conversions)
+	}
+	return m
+}
+
+// DistributeCost spreads amount evenly over the campaign's clicks in
+// [start, end), replacing their cost, and returns how many clicks it
+// was spread over
+func (db *Database) DistributeCost(campaignID string, amount float64, start, end time.Time) (int64, error) {
+	if amount < 0 {
+		return 0, fmt.Errorf("cost can't be negative")
+	}
+	from := start.UTC().Format("2006-01-02 15:04:05")
+	to := end.UTC().Format("2006-01-02 15:04:05")
+
+	tx, err := db.sqlDB.Begin()
+	if err != nil {
+		return 0, err
+	}
+
+	var clicks int64
+	err = tx.QueryRow(
+		"SELECT COUNT(*) FROM click WHERE campaign_id = ? AND created_at >= ? AND created_at < ?",
+		campaignID, from, to,
+	).Scan(&clicks)
+	if err != nil || clicks == 0 {
+		tx.Rollback()
+		return 0, err
+	}
+
+	_, err = tx.Exec(
+		"UPDATE click SET cost = ? WHERE campaign_id = ? AND created_at >= ? AND created_at < ?",
+		amount/float64(clicks), campaignID, from, to,
+	)
+	if err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	db.refreshRollups(start, end)
+	return clicks, nil
+}
@@ -0,0 +1,73 @@
+package db
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestCampaignCosts(t *testing.T) {
+	database := newTestDatabase(t)
+
+	campaign, err := database.GetCampaignByID("test-campaign")
+	if err != nil {
+		t.Fatalf("GetCampaignByID: %v", err)
+	}
+	campaign.CostModel = CostModelCPA
+	campaign.DefaultBid = 3
+	if err := database.UpdateCampaign(campaign); err != nil {
+		t.Fatalf("UpdateCampaign: %v", err)
+	}
+
+	for _, id := range []string{"a", "b", "c", "d"} {
+		click := &Click{ClickID: id, VisitorID: "v", CampaignToken: "1234567890", CampaignID: "test-campaign", Subs: Subs{id}}
+		if err := database.SaveClick(click); err != nil {
+			t.Fatalf("SaveClick: %v", err)
+		}
+	}
+	database.SaveVisit(&Visit{VisitorID: "v", ClickID: "a", CampaignID: "test-campaign", CreatedAt: time.Now()})
+	database.SaveConversion(&Conversion{VisitorID: "v", ClickID: "a", CampaignID: "test-campaign", Amount: 10, CreatedAt: time.Now()})
+
+	now := time.Now().UTC()
+	clicks, err := database.DistributeCost("test-campaign", 2, now.Add(-time.Hour), now.Add(time.Hour))
+	if err != nil || clicks != 4 {
+		t.Fatalf("DistributeCost = %d, %v", clicks, err)
+	}
+	if click, _ := database.GetClickByID("b"); click.Cost != 0.5 {
+		t.Errorf("click cost = %v", click.Cost)
+	}
+
+	stats, err := database.GetSubStats("test-campaign", 0, TimeRange{})
+	if err != nil {
+		t.Fatalf("GetSubStats: %v", err)
+	}
+	for _, s := range stats {
+		if s.Value != "a" {
+			continue
+		}
+		// 0.50 imported for the click plus 3 for the conversion
+		if s.Cost != 3.5 || s.Profit != 6.5 || s.EPC != 10 || s.CR != 100 || s.CPA != 3.5 {
+			t.Errorf("sub stats = %+v", s)
+		}
+	}
+
+	all, err := database.GetCampaignStats(TimeRange{})
+	if err != nil || len(all) != 1 {
+		t.Fatalf("GetCampaignStats = %+v, %v", all, err)
+	}
+	s := all[0]
+	if s.Clicks != 4 || s.Cost != 5 || s.Profit != 5 || s.ROI != 100 || s.EPC != 2.5 || s.CR != 25 {
+		t.Errorf("campaign stats = %+v", s)
+	}
+}
+
+func TestNewMetrics(t *testing.T) {
+	m := NewMetrics(200, 4, 100, 80)
+	want := Metrics{Cost: 80, Profit: 20, ROI: 25, EPC: 0.5, CPA: 20, CR: 2}
+	if math.Abs(m.ROI-want.ROI) > 1e-9 || m.Profit != want.Profit || m.EPC != want.EPC || m.CPA != want.CPA || m.CR != want.CR {
+		t.Errorf("NewMetrics = %+v, want %+v", m, want)
+	}
+	if zero := NewMetrics(0, 0, 0, 0); zero != (Metrics{}) {
+		t.Errorf("NewMetrics with no traffic = %+v", zero)
+	}
+}
@@ -4,13 +4,22 @@ import (
 	"database/sql"
 	_ "github.com/go-sql-driver/mysql"
 	"fmt"
+	"strings"
 	"time"
 	"github.com/go-sql-driver/mysql"
+	"unchained-tracker/internal/db/migrations"
+)
+
+// Supported values for Database.Driver
+const (
+	DriverMySQL  = migrations.DriverMySQL
+	DriverSQLite = migrations.DriverSQLite
 )
 
 // Database wraps the sql.DB connection
 type Database struct {
-	sqlDB *sql.DB
+	sqlDB  *sql.DB
+	driver string
 }
 
 // DB returns the underlying *sql.DB instance
@@ -18,8 +27,26 @@ func (db *Database) DB() *sql.DB {
 	return db.sqlDB
 }
 
-// Connect creates a new database connection
-func Connect(dsn string) (*Database, error) {
+// Driver returns the name of the backend in use (DriverMySQL or DriverSQLite)
+func (db *Database) Driver() string {
+	return db.driver
+}
+
+// Connect creates a new database connection. The backend is chosen by the
+// scheme of databaseURL: "sqlite://path/to/file.db" (or "sqlite::memory:")
+// opens an embedded SQLite database, anything else is treated as a MySQL DSN,
+// with or without a leading "mysql://".
+func Connect(databaseURL string) (*Database, error) {
+	switch {
+	case strings.HasPrefix(databaseURL, "sqlite://"):
+		return connectSQLite(strings.TrimPrefix(databaseURL, "sqlite://"))
+	case strings.HasPrefix(databaseURL, "sqlite:"):
+		return connectSQLite(strings.TrimPrefix(databaseURL, "sqlite:"))
+	}
+	return connectMySQL(strings.TrimPrefix(databaseURL, "mysql://"))
+}
+
+func connectMySQL(dsn string) (*Database, error) {
 	fmt.Printf("Connecting with DSN: %s\n", dsn)  // Debug print
 
 	// Parse the DSN
@@ -48,8 +75,16 @@ func Connect(dsn string) (*Database, error) {
 		return nil, fmt.Errorf("error creating database: %v", err)
 	}
 
-	// Now connect to the database with full DSN
-	db, err = sql.Open("mysql", dsn)
+	// Now connect to the database, keeping every timestamp in UTC: the
+	// driver converts time.Time arguments to Loc and the session time zone
+	// applies to CURRENT_TIMESTAMP
+	cfg.DBName = dbName
+	cfg.Loc = time.UTC
+	if cfg.Params == nil {
+		cfg.Params = map[string]string{}
+	}
+	cfg.Params["time_zone"] = "'+00:00'"
+	db, err = sql.Open("mysql", cfg.FormatDSN())
 	if err != nil {
 		return nil, err
 	}
@@ -59,7 +94,7 @@ func Connect(dsn string) (*Database, error) {
 		return nil, err
 	}
 
-	return &Database{sqlDB: db}, nil
+	return &Database{sqlDB: db, driver: DriverMySQL}, nil
 }
 
 func (db *Database) Close() error {
@@ -68,15 +103,33 @@ func (db *Database) Close() error {
 
 // Add database methods
 func (db *Database) Exec(query string, args ...interface{}) (sql.Result, error) {
-	return db.sqlDB.Exec(query, args...)
+	return db.sqlDB.Exec(query, utcArgs(args)...)
 }
 
 func (db *Database) Query(query string, args ...interface{}) (*sql.Rows, error) {
-	return db.sqlDB.Query(query, args...)
+	return db.sqlDB.Query(query, utcArgs(args)...)
 }
 
 func (db *Database) QueryRow(query string, args ...interface{}) *sql.Row {
-	return db.sqlDB.QueryRow(query, args...)
+	return db.sqlDB.QueryRow(query, utcArgs(args)...)
+}
+
+// utcArgs converts time arguments to UTC, so timestamps are stored and
+// compared in UTC whatever the server's time zone
+func utcArgs(args []interface{}) []interface{} {
+	var converted []interface{}
+	for i, arg := range args {
+		if t, ok := arg.(time.Time); ok {
+			if converted == nil {
+				converted = append([]interface{}{}, args...)
+			}
+			converted[i] = t.UTC()
+		}
+	}
+	if converted == nil {
+		return args
+	}
+	return converted
 }
 
 func (db *Database) BackupTables() error {
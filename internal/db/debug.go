@@ -0,0 +1,133 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// secondsBetween returns an SQL expression for the whole seconds from the
+// DATETIME from to the DATETIME to
+func (db *Database) secondsBetween(from, to string) string {
+	if db.driver == DriverSQLite {
+		return fmt.Sprintf("CAST(strftime('%%s', %s) - strftime('%%s', %s) AS INTEGER)", to, from)
+	}
+	return fmt.Sprintf("TIMESTAMPDIFF(SECOND, %s, %s)", from, to)
+}
+
+// scanMaps reads rows into one map per row keyed by column name, leaving
+// out NULL columns
+func scanMaps(rows *sql.Rows) ([]map[string]interface{}, error) {
+	defer rows.Close()
+
+	cols, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]map[string]interface{}, 0)
+	for rows.Next() {
+		values := make([]interface{}, len(cols))
+		valuePtrs := make([]interface{}, len(cols))
+		for i := range values {
+			valuePtrs[i] = &values[i]
+		}
+		if err := rows.Scan(valuePtrs...); err != nil {
+			return nil, err
+		}
+		row := make(map[string]interface{})
+		for i, col := range cols {
+			switch v := values[i].(type) {
+			case nil:
+			case []byte:
+				row[col] = string(v)
+			default:
+				row[col] = v
+			}
+		}
+		result = append(result, row)
+	}
+	return result, rows.Err()
+}
+
+// DebugVisits lists the latest visits with their conversions for /debug
+func (db *Database) DebugVisits(limit int) ([]map[string]interface{}, error) {
+	rows, err := db.Query(`
+		SELECT
+			v.id, v.visitor_id, v.click_id, v.campaign_id, v.ip_address, v.browser, v.os,
+			v.device_type, v.screen_resolution, v.viewport_size,
+			`+db.dateTime("v.created_at")+` AS created_at,
+			COUNT(c.id) AS conversion_count,
+			GROUP_CONCAT(c.id) AS conversion_ids,
+			GROUP_CONCAT(c.amount) AS conversion_amounts,
+			GROUP_CONCAT(`+db.dateTime("c.created_at")+`) AS conversion_times
+		FROM visit v
+		LEFT JOIN conversion c ON v.visitor_id = c.visitor_id
+		GROUP BY v.id
+		ORDER BY v.created_at DESC
+		LIMIT ?`, limit)
+	if err != nil {
+		return nil, err
+	}
+	return scanMaps(rows)
+}
+
+// DebugConversions lists the latest conversions with their visits for /debug
+func (db *Database) DebugConversions(limit int) ([]map[string]interface{}, error) {
+	rows, err := db.Query(`
+		SELECT
+			c.id, c.visitor_id, c.click_id, c.campaign_id, c.amount, c.status,
+			`+db.dateTime("c.created_at")+` AS created_at,
+			v.browser, v.os, v.device_type, v.screen_resolution, v.viewport_size, v.ip_address,
+			camp.name AS campaign_name,
+			`+db.secondsBetween("v.created_at", "c.created_at")+` AS seconds_to_convert
+		FROM conversion c
+		LEFT JOIN visit v ON c.visitor_id = v.visitor_id
+		LEFT JOIN campaign camp ON c.campaign_id = camp.campaign_id
+		ORDER BY c.created_at DESC
+		LIMIT ?`, limit)
+	if err != nil {
+		return nil, err
+	}
+	return scanMaps(rows)
+}
+
+// DebugClicks lists the latest clicks with their campaigns for /debug/clicks
+func (db *Database) DebugClicks(limit int) ([]map[string]interface{}, error) {
+	rows, err := db.Query(`
+		SELECT
+			c.id, c.click_id, c.campaign_token, c.campaign_id, c.ip_address,
+			`+db.dateTime("c.created_at")+` AS created_at,
+			camp.name AS campaign_name,
+			COALESCE(camp.offer_url, 'http://localhost:8080/test-offer') AS offer_url
+		FROM click c
+		LEFT JOIN campaign camp ON c.campaign_id = camp.campaign_id
+		ORDER BY c.created_at DESC
+		LIMIT ?`, limit)
+	if err != nil {
+		return nil, err
+	}
+	return scanMaps(rows)
+}
+
+// RecentActivity returns when the latest row of table (visit or
+// conversion) since the given time was created, and how many there are
+func (db *Database) RecentActivity(table string, since time.Time) (last *time.Time, count int, err error) {
+	if table != "visit" && table != "conversion" {
+		return nil, 0, fmt.Errorf("unknown table %s", table)
+	}
+
+	var lastStr sql.NullString
+	err = db.QueryRow(`
+		SELECT `+db.dateTime("MAX(created_at)")+`, COUNT(*)
+		FROM `+table+`
+		WHERE created_at >= ?`, since).Scan(&lastStr, &count)
+	if err != nil || !lastStr.Valid {
+		return nil, count, err
+	}
+	t, err := time.Parse("2006-01-02 15:04:05", lastStr.String)
+	if err != nil {
+		return nil, count, err
+	}
+	return &t, count, nil
+}
@@ -0,0 +1,185 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Raw logs that can be exported
+const (
+	LogClicks      = "clicks"
+	LogVisits      = "visits"
+	LogConversions = "conversions"
+)
+
+// ExportColumn is a column of an export. Numeric columns are written as
+// numbers to spreadsheets.
+type ExportColumn struct {
+	Name    string
+	Numeric bool
+}
+
+// logColumn is an exported column and whether it holds a time
+type logColumn struct {
+	ExportColumn
+	time bool
+}
+
+// exportLogColumns lists each raw log's columns as name, name:number or
+// name:time. Logs are filtered and ordered by created_at.
+var exportLogColumns = map[string][]string{
+	LogClicks: {
+		"created_at:time", "click_id", "visitor_id", "campaign_id", "offer_id:number",
+		"landing_page_id:number", "cost:number", "ip_address", "user_agent", "device_type", "os",
+		"browser", "browser_version", "referrer",
+		"external_id", "gclid", "ttclid", "fbc", "is_bot:number", "bot_reason", "fraud_score:number",
+		"fraud_reason", "subs",
+	},
+	LogVisits: {
+		"created_at:time", "visitor_id", "click_id", "campaign_id", "country", "region", "city",
+		"device_type", "os", "browser", "browser_version", "language", "ip_address", "user_agent",
+		"landing_page", "referrer", "utm_source", "utm_medium", "utm_campaign", "utm_content",
+		"utm_term", "is_bot:number", "bot_reason", "subs",
+	},
+	LogConversions: {
+		"created_at:time", "id:number", "click_id", "visitor_id", "campaign_id", "network",
+		"transaction_id", "type", "status", "amount:number", "currency", "updated_at:time",
+		"fraud_score:number", "fraud_reason",
+	},
+}
+
+var exportLogs = map[string][]logColumn{}
+
+func init() {
+	for log, specs := range exportLogColumns {
+		var cols []logColumn
+		for _, spec := range specs {
+			name, kind, _ := strings.Cut(spec, ":")
+			if name == "subs" {
+				for i := 1; i <= SubCount; i++ {
+					cols = append(cols, logColumn{ExportColumn: ExportColumn{Name: fmt.Sprintf("sub%d", i)}})
+				}
+				continue
+			}
+			cols = append(cols, logColumn{
+				ExportColumn: ExportColumn{Name: name, Numeric: kind == "number"},
+				time:         kind == "time",
+			})
+		}
+		exportLogs[log] = cols
+	}
+}
+
+// LogQuery selects the rows of a raw log export
+type LogQuery struct {
+	Range      TimeRange
+	CampaignID string
+	// Location is the timezone times are written in, UTC when nil
+	Location *time.Location
+}
+
+// LogCursor walks an export's rows one at a time, so exports of any size
+// run in constant memory. Close it when done.
+type LogCursor struct {
+	rows    *sql.Rows
+	columns []logColumn
+	loc     *time.Location
+	scanned []sql.NullString
+	dests   []interface{}
+	values  []string
+	err     error
+}
+
+// ExportLog opens a cursor over a raw log's rows in q.Range, oldest first
+func (db *Database) ExportLog(log string, q LogQuery) (*LogCursor, error) {
+	columns, ok := exportLogs[log]
+	if !ok {
+		return nil, fmt.Errorf("unknown log %q", log)
+	}
+
+	exprs := make([]string, len(columns))
+	for i, col := range columns {
+		exprs[i] = col.Name
+		if col.time {
+			exprs[i] = db.dateTime(col.Name)
+		}
+	}
+	table := strings.TrimSuffix(log, "s")
+	rangeSQL, args := q.Range.where("created_at")
+	query := "SELECT " + strings.Join(exprs, ", ") + " FROM " + table + " WHERE 1 = 1" + rangeSQL
+	if q.CampaignID != "" {
+		query += " AND campaign_id = ?"
+		args = append(args, q.CampaignID)
+	}
+	query += " ORDER BY created_at, id"
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &LogCursor{
+		rows:    rows,
+		columns: columns,
+		loc:     q.Location,
+		scanned: make([]sql.NullString, len(columns)),
+		dests:   make([]interface{}, len(columns)),
+		values:  make([]string, len(columns)),
+	}
+	if c.loc == nil {
+		c.loc = time.UTC
+	}
+	for i := range c.scanned {
+		c.dests[i] = &c.scanned[i]
+	}
+	return c, nil
+}
+
+// Columns lists the export's columns
+func (c *LogCursor) Columns() []ExportColumn {
+	cols := make([]ExportColumn, len(c.columns))
+	for i, col := range c.columns {
+		cols[i] = col.ExportColumn
+	}
+	return cols
+}
+
+// Next moves to the next row, returning false at the end or on errors
+func (c *LogCursor) Next() bool {
+	if c.err != nil || !c.rows.Next() {
+		return false
+	}
+	if c.err = c.rows.Scan(c.dests...); c.err != nil {
+		return false
+	}
+	for i, v := range c.scanned {
+		c.values[i] = v.String
+		if c.columns[i].time && v.Valid {
+			t, err := time.Parse("2006-01-02 15:04:05", v.String)
+			if err != nil {
+				c.err = err
+				return false
+			}
+			c.values[i] = t.In(c.loc).Format("2006-01-02 15:04:05")
+		}
+	}
+	return true
+}
+
+// Values is the current row. The slice is reused by Next.
+func (c *LogCursor) Values() []string {
+	return c.values
+}
+
+func (c *LogCursor) Err() error {
+	if c.err != nil {
+		return c.err
+	}
+	return c.rows.Err()
+}
+
+func (c *LogCursor) Close() error {
+	return c.rows.Close()
+}
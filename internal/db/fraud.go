@@ -0,0 +1,45 @@
+package db
+
+import (
+	"strconv"
+	"time"
+)
+
+// Fraud risk levels of the fraud_risk report dimension, by fraud score.
+// High starts at the default score conversions are held at.
+const (
+	FraudRiskLow    = "low"
+	FraudRiskMedium = "medium"
+	FraudRiskHigh   = "high"
+
+	fraudRiskMediumScore = 30
+	fraudRiskHighScore   = 70
+)
+
+// fraudRisk buckets the score expression into a risk level
+func fraudRisk(score string) string {
+	return "CASE WHEN " + score + " >= " + strconv.Itoa(fraudRiskHighScore) + " THEN '" + FraudRiskHigh + "'" +
+		" WHEN " + score + " >= " + strconv.Itoa(fraudRiskMediumScore) + " THEN '" + FraudRiskMedium + "'" +
+		" ELSE '" + FraudRiskLow + "' END"
+}
+
+// ClickVelocity counts the clicks since the given time from an IP address
+// and from a visitor
+func (db *Database) ClickVelocity(ipAddress, visitorID string, since time.Time) (byIP, byVisitor int64, err error) {
+	from := since.UTC().Format("2006-01-02 15:04:05")
+	err = db.QueryRow(`
+		SELECT
+			(SELECT COUNT(*) FROM click WHERE ip_address = ? AND created_at >= ?),
+			(SELECT COUNT(*) FROM click WHERE visitor_id = ? AND created_at >= ?)`,
+		ipAddress, from, visitorID, from,
+	).Scan(&byIP, &byVisitor)
+	return byIP, byVisitor, err
+}
+
+// CountClickConversions counts the conversions of a type, such as lead or
+// purchase, recorded on a click
+func (db *Database) CountClickConversions(clickID, conversionType string) (int64, error) {
+	var n int64
+	err := db.QueryRow("SELECT COUNT(*) FROM conversion WHERE click_id = ? AND type = ?", clickID, conversionType).Scan(&n)
+	return n, err
+}
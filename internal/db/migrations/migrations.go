@@ -153,6 +153,343 @@ var All = []Migration{
             );
         `,
     },
+    {
+        Version:     7,
+        Description: "Add weighted offer rotation",
+        SQL: `
+            CREATE TABLE IF NOT EXISTS campaign_offer (
+                id INT AUTO_INCREMENT PRIMARY KEY,
+                campaign_id VARCHAR(36) NOT NULL,
+                offer_id INT NOT NULL,
+                weight INT NOT NULL DEFAULT 100,
+                created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+                UNIQUE KEY unique_campaign_offer (campaign_id, offer_id),
+                FOREIGN KEY (campaign_id) REFERENCES campaign(campaign_id),
+                FOREIGN KEY (offer_id) REFERENCES offer(id)
+            );
+
+            ALTER TABLE click ADD COLUMN offer_id INT DEFAULT NULL;
+            CREATE INDEX idx_click_offer_id ON click(campaign_id, offer_id);
+        `,
+    },
+    {
+        Version:     8,
+        Description: "Add campaign routing paths",
+        SQL: `
+            CREATE TABLE IF NOT EXISTS campaign_path (
+                id INT AUTO_INCREMENT PRIMARY KEY,
+                campaign_id VARCHAR(36) NOT NULL,
+                name VARCHAR(100) NOT NULL,
+                priority INT NOT NULL DEFAULT 0,
+                is_default BOOLEAN NOT NULL DEFAULT FALSE,
+                conditions TEXT NOT NULL,
+                landing_page_id INT DEFAULT NULL,
+                created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+                FOREIGN KEY (campaign_id) REFERENCES campaign(campaign_id),
+                FOREIGN KEY (landing_page_id) REFERENCES landing_page(id)
+            );
+
+            CREATE TABLE IF NOT EXISTS campaign_path_offer (
+                id INT AUTO_INCREMENT PRIMARY KEY,
+                path_id INT NOT NULL,
+                offer_id INT NOT NULL,
+                weight INT NOT NULL DEFAULT 100,
+                UNIQUE KEY unique_path_offer (path_id, offer_id),
+                FOREIGN KEY (path_id) REFERENCES campaign_path(id),
+                FOREIGN KEY (offer_id) REFERENCES offer(id)
+            );
+
+            CREATE INDEX idx_campaign_path_campaign_id ON campaign_path(campaign_id);
+            ALTER TABLE click ADD COLUMN path_id INT DEFAULT NULL;
+            ALTER TABLE click ADD COLUMN landing_page_id INT DEFAULT NULL;
+        `,
+    },
+    {
+        Version:     9,
+        Description: "Add custom tracking parameters",
+        SQL: `
+            ALTER TABLE campaign ADD COLUMN custom_params TEXT;
+
+            ALTER TABLE click
+                ADD COLUMN sub1 VARCHAR(255) DEFAULT NULL,
+                ADD COLUMN sub2 VARCHAR(255) DEFAULT NULL,
+                ADD COLUMN sub3 VARCHAR(255) DEFAULT NULL,
+                ADD COLUMN sub4 VARCHAR(255) DEFAULT NULL,
+                ADD COLUMN sub5 VARCHAR(255) DEFAULT NULL,
+                ADD COLUMN sub6 VARCHAR(255) DEFAULT NULL,
+                ADD COLUMN sub7 VARCHAR(255) DEFAULT NULL,
+                ADD COLUMN sub8 VARCHAR(255) DEFAULT NULL,
+                ADD COLUMN sub9 VARCHAR(255) DEFAULT NULL,
+                ADD COLUMN sub10 VARCHAR(255) DEFAULT NULL;
+
+            ALTER TABLE visit
+                ADD COLUMN sub1 VARCHAR(255) DEFAULT NULL,
+                ADD COLUMN sub2 VARCHAR(255) DEFAULT NULL,
+                ADD COLUMN sub3 VARCHAR(255) DEFAULT NULL,
+                ADD COLUMN sub4 VARCHAR(255) DEFAULT NULL,
+                ADD COLUMN sub5 VARCHAR(255) DEFAULT NULL,
+                ADD COLUMN sub6 VARCHAR(255) DEFAULT NULL,
+                ADD COLUMN sub7 VARCHAR(255) DEFAULT NULL,
+                ADD COLUMN sub8 VARCHAR(255) DEFAULT NULL,
+                ADD COLUMN sub9 VARCHAR(255) DEFAULT NULL,
+                ADD COLUMN sub10 VARCHAR(255) DEFAULT NULL;
+        `,
+    },
+    {
+        Version:     10,
+        Description: "Add conversion status lifecycle",
+        SQL: `
+            ALTER TABLE conversion
+                ADD COLUMN transaction_id VARCHAR(255) DEFAULT NULL,
+                ADD COLUMN updated_at DATETIME DEFAULT NULL;
+
+            CREATE INDEX idx_conversion_transaction_id ON conversion(transaction_id);
+
+            UPDATE conversion SET status = 'approved' WHERE status = 'completed' OR status IS NULL;
+
+            CREATE TABLE IF NOT EXISTS conversion_status_history (
+                id INT AUTO_INCREMENT PRIMARY KEY,
+                conversion_id INT NOT NULL,
+                from_status VARCHAR(50) NOT NULL,
+                to_status VARCHAR(50) NOT NULL,
+                from_amount FLOAT NOT NULL DEFAULT 0,
+                to_amount FLOAT NOT NULL DEFAULT 0,
+                source VARCHAR(100) NOT NULL,
+                created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+                FOREIGN KEY (conversion_id) REFERENCES conversion(id)
+            );
+
+            CREATE INDEX idx_conversion_status_history_conversion_id ON conversion_status_history(conversion_id);
+        `,
+    },
+    {
+        Version:     11,
+        Description: "Make network postbacks idempotent",
+        SQL: `
+            ALTER TABLE conversion ADD COLUMN network VARCHAR(100) NOT NULL DEFAULT '';
+
+            CREATE UNIQUE INDEX uq_conversion_network_transaction ON conversion(network, transaction_id);
+        `,
+    },
+    {
+        Version:     12,
+        Description: "Add affiliate networks and postback authentication",
+        SQL: `
+            CREATE TABLE IF NOT EXISTS affiliate_network (
+                id INT AUTO_INCREMENT PRIMARY KEY,
+                name VARCHAR(100) NOT NULL UNIQUE,
+                secret VARCHAR(255) NOT NULL DEFAULT '',
+                hmac_secret VARCHAR(255) NOT NULL DEFAULT '',
+                allowed_ips TEXT,
+                created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+            );
+
+            CREATE TABLE IF NOT EXISTS postback_rejection (
+                id INT AUTO_INCREMENT PRIMARY KEY,
+                network VARCHAR(100) NOT NULL,
+                ip_address VARCHAR(45) NOT NULL,
+                reason VARCHAR(255) NOT NULL,
+                request_url TEXT,
+                created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+            );
+
+            CREATE INDEX idx_postback_rejection_created_at ON postback_rejection(created_at);
+        `,
+    },
+    {
+        Version:     13,
+        Description: "Add per-network postback parameter mapping",
+        SQL: `
+            ALTER TABLE affiliate_network
+                ADD COLUMN preset VARCHAR(50) NOT NULL DEFAULT '',
+                ADD COLUMN click_id_param VARCHAR(100) NOT NULL DEFAULT '',
+                ADD COLUMN payout_param VARCHAR(100) NOT NULL DEFAULT '',
+                ADD COLUMN status_param VARCHAR(100) NOT NULL DEFAULT '',
+                ADD COLUMN status_values TEXT,
+                ADD COLUMN transaction_id_param VARCHAR(100) NOT NULL DEFAULT '',
+                ADD COLUMN currency_param VARCHAR(100) NOT NULL DEFAULT '';
+
+            ALTER TABLE conversion ADD COLUMN currency VARCHAR(3) DEFAULT NULL;
+        `,
+    },
+    {
+        Version:     14,
+        Description: "Add traffic source postbacks",
+        SQL: `
+            CREATE TABLE IF NOT EXISTS traffic_source (
+                id INT AUTO_INCREMENT PRIMARY KEY,
+                name VARCHAR(100) NOT NULL UNIQUE,
+                click_id_param VARCHAR(100) NOT NULL DEFAULT '',
+                postback_url TEXT,
+                postback_on VARCHAR(20) NOT NULL DEFAULT 'created',
+                created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+            );
+
+            ALTER TABLE click ADD COLUMN external_id VARCHAR(255) DEFAULT NULL;
+        `,
+    },
+    {
+        Version:     15,
+        Description: "Add outbound delivery outbox",
+        SQL: `
+            CREATE TABLE IF NOT EXISTS outbox (
+                id INT AUTO_INCREMENT PRIMARY KEY,
+                kind VARCHAR(50) NOT NULL,
+                target VARCHAR(255) NOT NULL DEFAULT '',
+                method VARCHAR(10) NOT NULL,
+                url TEXT NOT NULL,
+                content_type VARCHAR(100) NOT NULL DEFAULT '',
+                body MEDIUMTEXT,
+                conversion_id INT DEFAULT NULL,
+                status VARCHAR(20) NOT NULL DEFAULT 'pending',
+                attempts INT NOT NULL DEFAULT 0,
+                next_attempt_at DATETIME NOT NULL,
+                last_error TEXT,
+                response_status INT NOT NULL DEFAULT 0,
+                response_body TEXT,
+                created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+                delivered_at DATETIME DEFAULT NULL
+            );
+
+            CREATE INDEX idx_outbox_status_next_attempt ON outbox(status, next_attempt_at);
+            CREATE INDEX idx_outbox_conversion_id ON outbox(conversion_id);
+        `,
+    },
+    {
+        Version:     16,
+        Description: "Store Facebook click identifiers and conversion event data",
+        SQL: `
+            ALTER TABLE visit
+                ADD COLUMN fbc VARCHAR(255) DEFAULT NULL,
+                ADD COLUMN fbp VARCHAR(255) DEFAULT NULL;
+
+            ALTER TABLE click
+                ADD COLUMN fbc VARCHAR(255) DEFAULT NULL,
+                ADD COLUMN fbp VARCHAR(255) DEFAULT NULL;
+
+            ALTER TABLE conversion
+                ADD COLUMN type VARCHAR(50) NOT NULL DEFAULT '',
+                ADD COLUMN event_id VARCHAR(100) DEFAULT NULL;
+        `,
+    },
+    {
+        Version:     17,
+        Description: "Add per-campaign ad platform connectors",
+        SQL: `
+            CREATE TABLE IF NOT EXISTS campaign_connector (
+                id INT AUTO_INCREMENT PRIMARY KEY,
+                campaign_id VARCHAR(36) NOT NULL,
+                connector VARCHAR(50) NOT NULL,
+                settings TEXT,
+                created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+                UNIQUE KEY unique_campaign_connector (campaign_id, connector),
+                FOREIGN KEY (campaign_id) REFERENCES campaign(campaign_id)
+            );
+
+            ALTER TABLE click
+                ADD COLUMN ttclid VARCHAR(255) DEFAULT NULL,
+                ADD COLUMN gclid VARCHAR(255) DEFAULT NULL;
+
+            ALTER TABLE outbox ADD COLUMN headers TEXT;
+        `,
+    },
+    {
+        Version:     18,
+        Description: "Add campaign cost models and click costs",
+        SQL: `
+            ALTER TABLE campaign
+                ADD COLUMN cost_model VARCHAR(20) NOT NULL DEFAULT '',
+                ADD COLUMN default_bid DECIMAL(12,4) NOT NULL DEFAULT 0;
+
+            ALTER TABLE click ADD COLUMN cost DECIMAL(14,6) NOT NULL DEFAULT 0;
+            CREATE INDEX idx_click_campaign_created ON click(campaign_id, created_at);
+        `,
+    },
+    {
+        Version:     19,
+        Description: "Add hourly stats rollups",
+        SQL: `
+            CREATE TABLE IF NOT EXISTS stats_hourly (
+                hour DATETIME NOT NULL,
+                campaign_id VARCHAR(36) NOT NULL DEFAULT '',
+                offer_id BIGINT NOT NULL DEFAULT 0,
+                lander_id BIGINT NOT NULL DEFAULT 0,
+                country VARCHAR(2) NOT NULL DEFAULT '',
+                device VARCHAR(50) NOT NULL DEFAULT '',
+                visits BIGINT NOT NULL DEFAULT 0,
+                clicks BIGINT NOT NULL DEFAULT 0,
+                conversions BIGINT NOT NULL DEFAULT 0,
+                revenue DECIMAL(14,4) NOT NULL DEFAULT 0,
+                cost DECIMAL(14,6) NOT NULL DEFAULT 0,
+                PRIMARY KEY (hour, campaign_id, offer_id, lander_id, country, device)
+            );
+
+            CREATE TABLE IF NOT EXISTS rollup_state (
+                name VARCHAR(50) NOT NULL PRIMARY KEY,
+                rolled_until DATETIME NOT NULL
+            );
+
+            CREATE INDEX idx_click_created_at ON click(created_at);
+        `,
+    },
+    {
+        Version:     20,
+        Description: "Store timestamps in UTC",
+        SQL: `
+            UPDATE click SET created_at = COALESCE(CONVERT_TZ(created_at, @@global.time_zone, '+00:00'), created_at);
+            UPDATE offer SET created_at = COALESCE(CONVERT_TZ(created_at, @@global.time_zone, '+00:00'), created_at);
+            UPDATE landing_page SET created_at = COALESCE(CONVERT_TZ(created_at, @@global.time_zone, '+00:00'), created_at);
+            UPDATE tracking_domain SET created_at = COALESCE(CONVERT_TZ(created_at, @@global.time_zone, '+00:00'), created_at);
+            UPDATE campaign_offer SET created_at = COALESCE(CONVERT_TZ(created_at, @@global.time_zone, '+00:00'), created_at);
+            UPDATE campaign_path SET created_at = COALESCE(CONVERT_TZ(created_at, @@global.time_zone, '+00:00'), created_at);
+            UPDATE campaign_connector SET created_at = COALESCE(CONVERT_TZ(created_at, @@global.time_zone, '+00:00'), created_at);
+
+            DELETE FROM stats_hourly;
+            DELETE FROM rollup_state;
+        `,
+    },
+    {
+        Version:     21,
+        Description: "Flag bot visits and clicks",
+        SQL: `
+            ALTER TABLE visit
+                ADD COLUMN is_bot TINYINT(1) NOT NULL DEFAULT 0,
+                ADD COLUMN bot_reason VARCHAR(255) NOT NULL DEFAULT '';
+            ALTER TABLE click
+                ADD COLUMN is_bot TINYINT(1) NOT NULL DEFAULT 0,
+                ADD COLUMN bot_reason VARCHAR(255) NOT NULL DEFAULT '';
+            ALTER TABLE campaign ADD COLUMN bot_policy VARCHAR(10) NOT NULL DEFAULT 'flag';
+            ALTER TABLE stats_hourly
+                ADD COLUMN bot_visits BIGINT NOT NULL DEFAULT 0,
+                ADD COLUMN bot_clicks BIGINT NOT NULL DEFAULT 0;
+        `,
+    },
+    {
+        Version:     22,
+        Description: "Add click and conversion fraud scores",
+        SQL: `
+            ALTER TABLE click
+                ADD COLUMN fraud_score INT NOT NULL DEFAULT 0,
+                ADD COLUMN fraud_reason VARCHAR(255) NOT NULL DEFAULT '';
+            ALTER TABLE conversion
+                ADD COLUMN fraud_score INT NOT NULL DEFAULT 0,
+                ADD COLUMN fraud_reason VARCHAR(255) NOT NULL DEFAULT '';
+            CREATE INDEX idx_click_ip_created ON click(ip_address, created_at);
+            CREATE INDEX idx_click_visitor_created ON click(visitor_id, created_at);
+            CREATE INDEX idx_conversion_click_id ON conversion(click_id);
+        `,
+    },
+    {
+        Version:     23,
+        Description: "Store parsed user agents on clicks",
+        SQL: `
+            ALTER TABLE click
+                ADD COLUMN device_type VARCHAR(50) NOT NULL DEFAULT '',
+                ADD COLUMN os VARCHAR(50) NOT NULL DEFAULT '',
+                ADD COLUMN browser VARCHAR(50) NOT NULL DEFAULT '',
+                ADD COLUMN browser_version VARCHAR(50) NOT NULL DEFAULT '';
+        `,
+    },
 }
 
 // Create migrations table if it doesn't exist
@@ -163,7 +500,21 @@ CREATE TABLE IF NOT EXISTS schema_migrations (
     applied_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
 )`
 
-func Run(db *sql.DB) error {
+// Drivers Run knows, re-exported as db.DriverMySQL and db.DriverSQLite.
+// They live here because the db package's tests import this one.
+const (
+    DriverMySQL  = "mysql"
+    DriverSQLite = "sqlite"
+)
+
+// Run applies pending migrations for driver (DriverMySQL or DriverSQLite)
+func Run(db *sql.DB, driver string) error {
+    migrations := All
+    if driver == DriverSQLite {
+        migrations = SQLite
+    }
+
+
     // Create migrations table
     if _, err := db.Exec(createMigrationsTable); err != nil {
         return fmt.Errorf("error creating migrations table: %v", err)
@@ -186,7 +537,7 @@ func Run(db *sql.DB) error {
     }
 
     // Run pending migrations
-    for _, m := range All {
+    for _, m := range migrations {
         if !applied[m.Version] {
             fmt.Printf("Running migration %d: %s\n", m.Version, m.Description)
             
@@ -0,0 +1,465 @@
+package migrations
+
+// SQLite mirrors All for the embedded SQLite backend. Versions match the
+// MySQL list so schema_migrations means the same thing on both.
+var SQLite = []Migration{
+    {
+        Version:     1,
+        Description: "Create initial tables",
+        SQL: `
+            CREATE TABLE IF NOT EXISTS landing_page (
+                id INTEGER PRIMARY KEY AUTOINCREMENT,
+                name VARCHAR(100) NOT NULL,
+                url VARCHAR(500) NOT NULL,
+                created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+                CONSTRAINT unique_url UNIQUE (url)
+            );
+
+            CREATE TABLE IF NOT EXISTS campaign (
+                id INTEGER PRIMARY KEY AUTOINCREMENT,
+                name VARCHAR(100) NOT NULL,
+                campaign_id VARCHAR(36) UNIQUE,
+                campaign_token VARCHAR(10) UNIQUE,
+                offer_url VARCHAR(500),
+                landing_page_id INT,
+                traffic_source VARCHAR(100),
+                created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+                FOREIGN KEY (landing_page_id) REFERENCES landing_page(id)
+            );
+
+            CREATE TABLE IF NOT EXISTS visit (
+                id INTEGER PRIMARY KEY AUTOINCREMENT,
+                visitor_id VARCHAR(36) UNIQUE,
+                click_id VARCHAR(100),
+                campaign_id VARCHAR(36),
+                ip_address VARCHAR(45),
+                user_agent VARCHAR(500),
+                browser VARCHAR(100),
+                browser_version VARCHAR(50),
+                os VARCHAR(100),
+                device_type VARCHAR(50),
+                screen_resolution VARCHAR(50),
+                viewport_size VARCHAR(50),
+                language VARCHAR(10),
+                timezone VARCHAR(50),
+                landing_page VARCHAR(500),
+                referrer VARCHAR(500),
+                utm_source VARCHAR(100),
+                utm_medium VARCHAR(100),
+                utm_campaign VARCHAR(100),
+                utm_content VARCHAR(100),
+                utm_term VARCHAR(100),
+                country VARCHAR(2) DEFAULT NULL,
+                region VARCHAR(100) DEFAULT NULL,
+                city VARCHAR(100) DEFAULT NULL,
+                created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+                FOREIGN KEY (campaign_id) REFERENCES campaign(campaign_id)
+            );
+
+            CREATE TABLE IF NOT EXISTS conversion (
+                id INTEGER PRIMARY KEY AUTOINCREMENT,
+                visitor_id VARCHAR(36),
+                click_id VARCHAR(255),
+                campaign_id VARCHAR(36),
+                amount FLOAT,
+                status VARCHAR(50) DEFAULT 'pending',
+                created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+                FOREIGN KEY (visitor_id) REFERENCES visit(visitor_id),
+                FOREIGN KEY (campaign_id) REFERENCES campaign(campaign_id)
+            );
+
+            /* Insert test campaign */
+            INSERT OR IGNORE INTO campaign (
+                name, 
+                campaign_id, 
+                campaign_token,
+                offer_url,
+                landing_page_id,
+                traffic_source,
+                created_at
+            ) VALUES (
+                'Test Campaign',
+                'test-campaign',
+                '1234567890',
+                'http://localhost:8080/test-offer',
+                NULL,
+                'test',
+                CURRENT_TIMESTAMP
+            );
+        `,
+    },
+    {
+        Version:     2,
+        Description: "Add offers table",
+        SQL: `
+            CREATE TABLE IF NOT EXISTS offer (
+                id INTEGER PRIMARY KEY AUTOINCREMENT,
+                name VARCHAR(100) NOT NULL,
+                network VARCHAR(100) NOT NULL,
+                offer_url VARCHAR(500) NOT NULL,
+                created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+                CONSTRAINT unique_offer UNIQUE (name, network)
+            );
+        `,
+    },
+    {
+        Version:     3,
+        Description: "Add indexes for performance",
+        SQL: `
+            CREATE INDEX idx_visit_created_at ON visit(created_at);
+            CREATE INDEX idx_conversion_created_at ON conversion(created_at);
+            CREATE INDEX idx_visit_click_id ON visit(click_id);
+            CREATE INDEX idx_visit_campaign_id ON visit(campaign_id);
+            CREATE INDEX idx_conversion_visitor_id ON conversion(visitor_id);
+            CREATE INDEX idx_conversion_campaign_id ON conversion(campaign_id);
+        `,
+    },
+    {
+        Version: 6,
+        Description: "Add tracking domains and clicks",
+        SQL: `
+            CREATE TABLE IF NOT EXISTS tracking_domain (
+                id INTEGER PRIMARY KEY AUTOINCREMENT,
+                domain VARCHAR(255) NOT NULL UNIQUE,
+                cloudflare_zone_id VARCHAR(32),
+                created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+            );
+
+            CREATE TABLE IF NOT EXISTS click (
+                id INTEGER PRIMARY KEY AUTOINCREMENT,
+                click_id VARCHAR(32) NOT NULL UNIQUE,
+                visitor_id VARCHAR(36) NOT NULL,
+                campaign_token VARCHAR(10) NOT NULL,
+                campaign_id VARCHAR(36),
+                ip_address VARCHAR(45),
+                user_agent VARCHAR(500),
+                referrer VARCHAR(500),
+                created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+                FOREIGN KEY (campaign_id) REFERENCES campaign(campaign_id)
+            );
+        `,
+    },
+    {
+        Version:     7,
+        Description: "Add weighted offer rotation",
+        SQL: `
+            CREATE TABLE IF NOT EXISTS campaign_offer (
+                id INTEGER PRIMARY KEY AUTOINCREMENT,
+                campaign_id VARCHAR(36) NOT NULL,
+                offer_id INT NOT NULL,
+                weight INT NOT NULL DEFAULT 100,
+                created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+                CONSTRAINT unique_campaign_offer UNIQUE (campaign_id, offer_id),
+                FOREIGN KEY (campaign_id) REFERENCES campaign(campaign_id),
+                FOREIGN KEY (offer_id) REFERENCES offer(id)
+            );
+
+            ALTER TABLE click ADD COLUMN offer_id INT DEFAULT NULL;
+            CREATE INDEX idx_click_offer_id ON click(campaign_id, offer_id);
+        `,
+    },
+    {
+        Version:     8,
+        Description: "Add campaign routing paths",
+        SQL: `
+            CREATE TABLE IF NOT EXISTS campaign_path (
+                id INTEGER PRIMARY KEY AUTOINCREMENT,
+                campaign_id VARCHAR(36) NOT NULL,
+                name VARCHAR(100) NOT NULL,
+                priority INT NOT NULL DEFAULT 0,
+                is_default BOOLEAN NOT NULL DEFAULT FALSE,
+                conditions TEXT NOT NULL,
+                landing_page_id INT DEFAULT NULL,
+                created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+                FOREIGN KEY (campaign_id) REFERENCES campaign(campaign_id),
+                FOREIGN KEY (landing_page_id) REFERENCES landing_page(id)
+            );
+
+            CREATE TABLE IF NOT EXISTS campaign_path_offer (
+                id INTEGER PRIMARY KEY AUTOINCREMENT,
+                path_id INT NOT NULL,
+                offer_id INT NOT NULL,
+                weight INT NOT NULL DEFAULT 100,
+                CONSTRAINT unique_path_offer UNIQUE (path_id, offer_id),
+                FOREIGN KEY (path_id) REFERENCES campaign_path(id),
+                FOREIGN KEY (offer_id) REFERENCES offer(id)
+            );
+
+            CREATE INDEX idx_campaign_path_campaign_id ON campaign_path(campaign_id);
+            ALTER TABLE click ADD COLUMN path_id INT DEFAULT NULL;
+            ALTER TABLE click ADD COLUMN landing_page_id INT DEFAULT NULL;
+        `,
+    },
+    {
+        Version:     9,
+        Description: "Add custom tracking parameters",
+        SQL: `
+            ALTER TABLE campaign ADD COLUMN custom_params TEXT;
+
+            ALTER TABLE click ADD COLUMN sub1 VARCHAR(255) DEFAULT NULL;
+            ALTER TABLE click ADD COLUMN sub2 VARCHAR(255) DEFAULT NULL;
+            ALTER TABLE click ADD COLUMN sub3 VARCHAR(255) DEFAULT NULL;
+            ALTER TABLE click ADD COLUMN sub4 VARCHAR(255) DEFAULT NULL;
+            ALTER TABLE click ADD COLUMN sub5 VARCHAR(255) DEFAULT NULL;
+            ALTER TABLE click ADD COLUMN sub6 VARCHAR(255) DEFAULT NULL;
+            ALTER TABLE click ADD COLUMN sub7 VARCHAR(255) DEFAULT NULL;
+            ALTER TABLE click ADD COLUMN sub8 VARCHAR(255) DEFAULT NULL;
+            ALTER TABLE click ADD COLUMN sub9 VARCHAR(255) DEFAULT NULL;
+            ALTER TABLE click ADD COLUMN sub10 VARCHAR(255) DEFAULT NULL;
+
+            ALTER TABLE visit ADD COLUMN sub1 VARCHAR(255) DEFAULT NULL;
+            ALTER TABLE visit ADD COLUMN sub2 VARCHAR(255) DEFAULT NULL;
+            ALTER TABLE visit ADD COLUMN sub3 VARCHAR(255) DEFAULT NULL;
+            ALTER TABLE visit ADD COLUMN sub4 VARCHAR(255) DEFAULT NULL;
+            ALTER TABLE visit ADD COLUMN sub5 VARCHAR(255) DEFAULT NULL;
+            ALTER TABLE visit ADD COLUMN sub6 VARCHAR(255) DEFAULT NULL;
+            ALTER TABLE visit ADD COLUMN sub7 VARCHAR(255) DEFAULT NULL;
+            ALTER TABLE visit ADD COLUMN sub8 VARCHAR(255) DEFAULT NULL;
+            ALTER TABLE visit ADD COLUMN sub9 VARCHAR(255) DEFAULT NULL;
+            ALTER TABLE visit ADD COLUMN sub10 VARCHAR(255) DEFAULT NULL;
+        `,
+    },
+    {
+        Version:     10,
+        Description: "Add conversion status lifecycle",
+        SQL: `
+            ALTER TABLE conversion ADD COLUMN transaction_id VARCHAR(255) DEFAULT NULL;
+            ALTER TABLE conversion ADD COLUMN updated_at DATETIME DEFAULT NULL;
+
+            CREATE INDEX idx_conversion_transaction_id ON conversion(transaction_id);
+
+            UPDATE conversion SET status = 'approved' WHERE status = 'completed' OR status IS NULL;
+
+            CREATE TABLE IF NOT EXISTS conversion_status_history (
+                id INTEGER PRIMARY KEY AUTOINCREMENT,
+                conversion_id INT NOT NULL,
+                from_status VARCHAR(50) NOT NULL,
+                to_status VARCHAR(50) NOT NULL,
+                from_amount FLOAT NOT NULL DEFAULT 0,
+                to_amount FLOAT NOT NULL DEFAULT 0,
+                source VARCHAR(100) NOT NULL,
+                created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+                FOREIGN KEY (conversion_id) REFERENCES conversion(id)
+            );
+
+            CREATE INDEX idx_conversion_status_history_conversion_id ON conversion_status_history(conversion_id);
+        `,
+    },
+    {
+        Version:     11,
+        Description: "Make network postbacks idempotent",
+        SQL: `
+            ALTER TABLE conversion ADD COLUMN network VARCHAR(100) NOT NULL DEFAULT '';
+
+            CREATE UNIQUE INDEX uq_conversion_network_transaction ON conversion(network, transaction_id);
+        `,
+    },
+    {
+        Version:     12,
+        Description: "Add affiliate networks and postback authentication",
+        SQL: `
+            CREATE TABLE IF NOT EXISTS affiliate_network (
+                id INTEGER PRIMARY KEY AUTOINCREMENT,
+                name VARCHAR(100) NOT NULL UNIQUE,
+                secret VARCHAR(255) NOT NULL DEFAULT '',
+                hmac_secret VARCHAR(255) NOT NULL DEFAULT '',
+                allowed_ips TEXT,
+                created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+            );
+
+            CREATE TABLE IF NOT EXISTS postback_rejection (
+                id INTEGER PRIMARY KEY AUTOINCREMENT,
+                network VARCHAR(100) NOT NULL,
+                ip_address VARCHAR(45) NOT NULL,
+                reason VARCHAR(255) NOT NULL,
+                request_url TEXT,
+                created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+            );
+
+            CREATE INDEX idx_postback_rejection_created_at ON postback_rejection(created_at);
+        `,
+    },
+    {
+        Version:     13,
+        Description: "Add per-network postback parameter mapping",
+        SQL: `
+            ALTER TABLE affiliate_network ADD COLUMN preset VARCHAR(50) NOT NULL DEFAULT '';
+            ALTER TABLE affiliate_network ADD COLUMN click_id_param VARCHAR(100) NOT NULL DEFAULT '';
+            ALTER TABLE affiliate_network ADD COLUMN payout_param VARCHAR(100) NOT NULL DEFAULT '';
+            ALTER TABLE affiliate_network ADD COLUMN status_param VARCHAR(100) NOT NULL DEFAULT '';
+            ALTER TABLE affiliate_network ADD COLUMN status_values TEXT;
+            ALTER TABLE affiliate_network ADD COLUMN transaction_id_param VARCHAR(100) NOT NULL DEFAULT '';
+            ALTER TABLE affiliate_network ADD COLUMN currency_param VARCHAR(100) NOT NULL DEFAULT '';
+
+            ALTER TABLE conversion ADD COLUMN currency VARCHAR(3) DEFAULT NULL;
+        `,
+    },
+    {
+        Version:     14,
+        Description: "Add traffic source postbacks",
+        SQL: `
+            CREATE TABLE IF NOT EXISTS traffic_source (
+                id INTEGER PRIMARY KEY AUTOINCREMENT,
+                name VARCHAR(100) NOT NULL UNIQUE,
+                click_id_param VARCHAR(100) NOT NULL DEFAULT '',
+                postback_url TEXT,
+                postback_on VARCHAR(20) NOT NULL DEFAULT 'created',
+                created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+            );
+
+            ALTER TABLE click ADD COLUMN external_id VARCHAR(255) DEFAULT NULL;
+        `,
+    },
+    {
+        Version:     15,
+        Description: "Add outbound delivery outbox",
+        SQL: `
+            CREATE TABLE IF NOT EXISTS outbox (
+                id INTEGER PRIMARY KEY AUTOINCREMENT,
+                kind VARCHAR(50) NOT NULL,
+                target VARCHAR(255) NOT NULL DEFAULT '',
+                method VARCHAR(10) NOT NULL,
+                url TEXT NOT NULL,
+                content_type VARCHAR(100) NOT NULL DEFAULT '',
+                body TEXT,
+                conversion_id INT DEFAULT NULL,
+                status VARCHAR(20) NOT NULL DEFAULT 'pending',
+                attempts INT NOT NULL DEFAULT 0,
+                next_attempt_at DATETIME NOT NULL,
+                last_error TEXT,
+                response_status INT NOT NULL DEFAULT 0,
+                response_body TEXT,
+                created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+                delivered_at DATETIME DEFAULT NULL
+            );
+
+            CREATE INDEX idx_outbox_status_next_attempt ON outbox(status, next_attempt_at);
+            CREATE INDEX idx_outbox_conversion_id ON outbox(conversion_id);
+        `,
+    },
+    {
+        Version:     16,
+        Description: "Store Facebook click identifiers and conversion event data",
+        SQL: `
+            ALTER TABLE visit ADD COLUMN fbc VARCHAR(255) DEFAULT NULL;
+            ALTER TABLE visit ADD COLUMN fbp VARCHAR(255) DEFAULT NULL;
+
+            ALTER TABLE click ADD COLUMN fbc VARCHAR(255) DEFAULT NULL;
+            ALTER TABLE click ADD COLUMN fbp VARCHAR(255) DEFAULT NULL;
+
+            ALTER TABLE conversion ADD COLUMN type VARCHAR(50) NOT NULL DEFAULT '';
+            ALTER TABLE conversion ADD COLUMN event_id VARCHAR(100) DEFAULT NULL;
+        `,
+    },
+    {
+        Version:     17,
+        Description: "Add per-campaign ad platform connectors",
+        SQL: `
+            CREATE TABLE IF NOT EXISTS campaign_connector (
+                id INTEGER PRIMARY KEY AUTOINCREMENT,
+                campaign_id VARCHAR(36) NOT NULL,
+                connector VARCHAR(50) NOT NULL,
+                settings TEXT,
+                created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+                CONSTRAINT unique_campaign_connector UNIQUE (campaign_id, connector),
+                FOREIGN KEY (campaign_id) REFERENCES campaign(campaign_id)
+            );
+
+            ALTER TABLE click ADD COLUMN ttclid VARCHAR(255) DEFAULT NULL;
+            ALTER TABLE click ADD COLUMN gclid VARCHAR(255) DEFAULT NULL;
+
+            ALTER TABLE outbox ADD COLUMN headers TEXT;
+        `,
+    },
+    {
+        Version:     18,
+        Description: "Add campaign cost models and click costs",
+        SQL: `
+            ALTER TABLE campaign ADD COLUMN cost_model VARCHAR(20) NOT NULL DEFAULT '';
+            ALTER TABLE campaign ADD COLUMN default_bid DECIMAL(12,4) NOT NULL DEFAULT 0;
+
+            ALTER TABLE click ADD COLUMN cost DECIMAL(14,6) NOT NULL DEFAULT 0;
+            CREATE INDEX idx_click_campaign_created ON click(campaign_id, created_at);
+        `,
+    },
+    {
+        Version:     19,
+        Description: "Add hourly stats rollups",
+        SQL: `
+            CREATE TABLE IF NOT EXISTS stats_hourly (
+                hour DATETIME NOT NULL,
+                campaign_id VARCHAR(36) NOT NULL DEFAULT '',
+                offer_id INTEGER NOT NULL DEFAULT 0,
+                lander_id INTEGER NOT NULL DEFAULT 0,
+                country VARCHAR(2) NOT NULL DEFAULT '',
+                device VARCHAR(50) NOT NULL DEFAULT '',
+                visits INTEGER NOT NULL DEFAULT 0,
+                clicks INTEGER NOT NULL DEFAULT 0,
+                conversions INTEGER NOT NULL DEFAULT 0,
+                revenue DECIMAL(14,4) NOT NULL DEFAULT 0,
+                cost DECIMAL(14,6) NOT NULL DEFAULT 0,
+                PRIMARY KEY (hour, campaign_id, offer_id, lander_id, country, device)
+            );
+
+            CREATE TABLE IF NOT EXISTS rollup_state (
+                name VARCHAR(50) NOT NULL PRIMARY KEY,
+                rolled_until DATETIME NOT NULL
+            );
+
+            CREATE INDEX idx_click_created_at ON click(created_at);
+        `,
+    },
+    {
+        Version:     20,
+        Description: "Store timestamps in UTC",
+        SQL: `
+            UPDATE visit SET created_at = strftime('%Y-%m-%d %H:%M:%f', created_at) WHERE strftime('%Y-%m-%d %H:%M:%f', created_at) IS NOT NULL;
+            UPDATE conversion SET created_at = strftime('%Y-%m-%d %H:%M:%f', created_at) WHERE strftime('%Y-%m-%d %H:%M:%f', created_at) IS NOT NULL;
+            UPDATE conversion SET updated_at = strftime('%Y-%m-%d %H:%M:%f', updated_at) WHERE strftime('%Y-%m-%d %H:%M:%f', updated_at) IS NOT NULL;
+            UPDATE conversion_status_history SET created_at = strftime('%Y-%m-%d %H:%M:%f', created_at) WHERE strftime('%Y-%m-%d %H:%M:%f', created_at) IS NOT NULL;
+            UPDATE campaign SET created_at = strftime('%Y-%m-%d %H:%M:%f', created_at) WHERE strftime('%Y-%m-%d %H:%M:%f', created_at) IS NOT NULL;
+            UPDATE affiliate_network SET created_at = strftime('%Y-%m-%d %H:%M:%f', created_at) WHERE strftime('%Y-%m-%d %H:%M:%f', created_at) IS NOT NULL;
+            UPDATE postback_rejection SET created_at = strftime('%Y-%m-%d %H:%M:%f', created_at) WHERE strftime('%Y-%m-%d %H:%M:%f', created_at) IS NOT NULL;
+            UPDATE traffic_source SET created_at = strftime('%Y-%m-%d %H:%M:%f', created_at) WHERE strftime('%Y-%m-%d %H:%M:%f', created_at) IS NOT NULL;
+
+            DELETE FROM stats_hourly;
+            DELETE FROM rollup_state;
+        `,
+    },
+    {
+        Version:     21,
+        Description: "Flag bot visits and clicks",
+        SQL: `
+            ALTER TABLE visit ADD COLUMN is_bot INTEGER NOT NULL DEFAULT 0;
+            ALTER TABLE visit ADD COLUMN bot_reason VARCHAR(255) NOT NULL DEFAULT '';
+            ALTER TABLE click ADD COLUMN is_bot INTEGER NOT NULL DEFAULT 0;
+            ALTER TABLE click ADD COLUMN bot_reason VARCHAR(255) NOT NULL DEFAULT '';
+            ALTER TABLE campaign ADD COLUMN bot_policy VARCHAR(10) NOT NULL DEFAULT 'flag';
+            ALTER TABLE stats_hourly ADD COLUMN bot_visits BIGINT NOT NULL DEFAULT 0;
+            ALTER TABLE stats_hourly ADD COLUMN bot_clicks BIGINT NOT NULL DEFAULT 0;
+        `,
+    },
+    {
+        Version:     22,
+        Description: "Add click and conversion fraud scores",
+        SQL: `
+            ALTER TABLE click ADD COLUMN fraud_score INTEGER NOT NULL DEFAULT 0;
+            ALTER TABLE click ADD COLUMN fraud_reason VARCHAR(255) NOT NULL DEFAULT '';
+            ALTER TABLE conversion ADD COLUMN fraud_score INTEGER NOT NULL DEFAULT 0;
+            ALTER TABLE conversion ADD COLUMN fraud_reason VARCHAR(255) NOT NULL DEFAULT '';
+            CREATE INDEX idx_click_ip_created ON click(ip_address, created_at);
+            CREATE INDEX idx_click_visitor_created ON click(visitor_id, created_at);
+            CREATE INDEX idx_conversion_click_id ON conversion(click_id);
+        `,
+    },
+    {
+        Version:     23,
+        Description: "Store parsed user agents on clicks",
+        SQL: `
+            ALTER TABLE click ADD COLUMN device_type VARCHAR(50) NOT NULL DEFAULT '';
+            ALTER TABLE click ADD COLUMN os VARCHAR(50) NOT NULL DEFAULT '';
+            ALTER TABLE click ADD COLUMN browser VARCHAR(50) NOT NULL DEFAULT '';
+            ALTER TABLE click ADD COLUMN browser_version VARCHAR(50) NOT NULL DEFAULT '';
+        `,
+    },
+}
@@ -1,6 +1,8 @@
 package db
 
 import (
+	"fmt"
+	"strings"
 	"time"
 )
 
@@ -28,9 +30,14 @@ type Visit struct {
 	UTMTerm         string    `json:"utm_term"`
 	CreatedAt       time.Time `json:"created_at"`
 	Conversions     []Conversion `json:"conversions,omitempty"`
+	IsBot           bool      `json:"is_bot"`
+	BotReason       string    `json:"bot_reason,omitempty"`
 	Country         string    `json:"country"`
 	Region          string    `json:"region"`
 	City            string    `json:"city"`
+	Subs            Subs      `json:"subs"`
+	FBC             string    `json:"fbc,omitempty"`
+	FBP             string    `json:"fbp,omitempty"`
 }
 
 type Conversion struct {
@@ -40,6 +47,13 @@ type Conversion struct {
 	CampaignID  string    `json:"campaign_id"`
 	Amount      float64   `json:"amount"`
 	Status      string    `json:"status"`
+	TransactionID string  `json:"transaction_id,omitempty"`
+	Network     string    `json:"network,omitempty"`
+	Currency    string    `json:"currency,omitempty"`
+	Type        string    `json:"type,omitempty"`
+	EventID     string    `json:"event_id,omitempty"`
+	FraudScore  int       `json:"fraud_score"`
+	FraudReason string    `json:"fraud_reason,omitempty"`
 	CreatedAt   time.Time `json:"created_at"`
 }
 
@@ -51,7 +65,112 @@ type Campaign struct {
 	OfferURL      string    `json:"offer_url"`
 	LandingPage   string    `json:"landing_page"`
 	TrafficSource string    `json:"traffic_source"`
+	CustomParams  CustomParams `json:"custom_params"`
+	CostModel     string    `json:"cost_model"`
+	DefaultBid    float64   `json:"default_bid"`
+	BotPolicy     string    `json:"bot_policy"`
 	CreatedAt     time.Time `json:"created_at"`
+	Offers        []CampaignOffer `json:"offers,omitempty"`
+}
+
+// SubCount is the number of custom parameter slots (sub1..sub10)
+const SubCount = 10
+
+// CustomParams names the traffic source parameters a campaign captures into
+// the sub1..sub10 slots: CustomParams{"zoneid", "campaignid"} stores
+// ?zoneid= as sub1 and ?campaignid= as sub2. Unnamed slots capture ?subN=.
+type CustomParams []string
+
+// Param returns the query parameter captured into slot i (0-based)
+func (p CustomParams) Param(i int) string {
+	if i < len(p) && p[i] != "" {
+		return p[i]
+	}
+	return fmt.Sprintf("sub%d", i+1)
+}
+
+// Slot returns the 0-based slot capturing name, which may be a declared
+// parameter name or "subN", or -1 if there is none.
+func (p CustomParams) Slot(name string) int {
+	for i := 0; i < SubCount; i++ {
+		if strings.EqualFold(p.Param(i), name) {
+			return i
+		}
+	}
+	var n int
+	if _, err := fmt.Sscanf(strings.ToLower(name), "sub%d", &n); err == nil && n >= 1 && n <= SubCount {
+		return n - 1
+	}
+	return -1
+}
+
+// Subs holds the captured sub1..sub10 values
+type Subs [SubCount]string
+
+// Metrics are the report columns derived from clicks, conversions, revenue
+// and cost. ROI and CR are percentages.
+type Metrics struct {
+	Cost   float64 `json:"cost"`
+	Profit float64 `json:"profit"`
+	ROI    float64 `json:"roi"`
+	EPC    float64 `json:"epc"`
+	CPA    float64 `json:"cpa"`
+	CR     float64 `json:"cr"`
+}
+
+// SubStats breaks a campaign down by the values of one custom parameter
+type SubStats struct {
+	Value       string  `json:"value"`
+	Clicks      int64   `json:"clicks"`
+	Conversions int64   `json:"conversions"`
+	Revenue     float64 `json:"revenue"`
+	Metrics
+}
+
+// CampaignOffer is one offer in a campaign's weighted rotation. A weight of
+// zero keeps the offer attached to the campaign but out of rotation.
+type CampaignOffer struct {
+	ID         int64  `json:"id"`
+	CampaignID string `json:"campaign_id"`
+	OfferID    int64  `json:"offer_id"`
+	Weight     int    `json:"weight"`
+	Name       string `json:"name"`
+	OfferURL   string `json:"offer_url"`
+}
+
+// CampaignPath routes clicks that match all of its Conditions to its own
+// landing page and/or offer rotation. Paths are tried in Priority order and
+// the default path catches everything that matched nothing else.
+type CampaignPath struct {
+	ID             int64           `json:"id"`
+	CampaignID     string          `json:"campaign_id"`
+	Name           string          `json:"name"`
+	Priority       int             `json:"priority"`
+	IsDefault      bool            `json:"is_default"`
+	Conditions     []PathCondition `json:"conditions"`
+	LandingPageID  int64           `json:"landing_page_id,omitempty"`
+	LandingPageURL string          `json:"landing_page_url,omitempty"`
+	Offers         []CampaignOffer `json:"offers"`
+	CreatedAt      time.Time       `json:"created_at"`
+}
+
+// PathCondition matches one click attribute against a list of values, see
+// the routing package for the supported fields and operators.
+type PathCondition struct {
+	Field    string   `json:"field"`
+	Operator string   `json:"operator"`
+	Values   []string `json:"values"`
+}
+
+// OfferStats breaks a campaign's performance down by offer
+type OfferStats struct {
+	OfferID     int64   `json:"offer_id"`
+	Name        string  `json:"name"`
+	Weight      int     `json:"weight"`
+	Clicks      int64   `json:"clicks"`
+	Conversions int64   `json:"conversions"`
+	Revenue     float64 `json:"revenue"`
+	Metrics
 }
 
 type CampaignStats struct {
@@ -62,9 +181,16 @@ type CampaignStats struct {
 	LandingPage   string    `json:"landing_page"`
 	TrafficSource string    `json:"traffic_source"`
 	CreatedAt     time.Time `json:"created_at"`
+	CostModel     string    `json:"cost_model"`
+	DefaultBid    float64   `json:"default_bid"`
+	BotPolicy     string    `json:"bot_policy"`
 	Visits        int64     `json:"visits"`
+	Clicks        int64     `json:"clicks"`
+	BotVisits     int64     `json:"bot_visits"`
+	BotClicks     int64     `json:"bot_clicks"`
 	Conversions   int64     `json:"conversions"`
 	Revenue       float64   `json:"revenue"`
+	Metrics
 }
 
 type Offer struct {
@@ -75,6 +201,44 @@ type Offer struct {
 	CreatedAt time.Time `json:"created_at"`
 }
 
+// AffiliateNetwork is a network allowed to send server postbacks. A
+// postback must pass every check the network has configured: the shared
+// Secret, an HMAC signature keyed with HMACSecret and the AllowedIPs list
+// of IPs or CIDR ranges. Mapping says where its postbacks carry each value.
+// The secrets are never serialized.
+type AffiliateNetwork struct {
+	ID         int64           `json:"id"`
+	Name       string          `json:"name"`
+	Preset     string          `json:"preset"`
+	Secret     string          `json:"-"`
+	HMACSecret string          `json:"-"`
+	AllowedIPs []string        `json:"allowed_ips"`
+	Mapping    PostbackMapping `json:"mapping"`
+	CreatedAt  time.Time       `json:"created_at"`
+}
+
+// PostbackMapping names the query parameters of a network's postbacks.
+// StatusValues maps the network's status values onto ours; values it
+// doesn't list go through NormalizeStatus.
+type PostbackMapping struct {
+	ClickIDParam       string            `json:"click_id_param"`
+	PayoutParam        string            `json:"payout_param"`
+	StatusParam        string            `json:"status_param"`
+	StatusValues       map[string]string `json:"status_values,omitempty"`
+	TransactionIDParam string            `json:"transaction_id_param"`
+	CurrencyParam      string            `json:"currency_param"`
+}
+
+// PostbackRejection records a postback that failed authentication
+type PostbackRejection struct {
+	ID         int64     `json:"id"`
+	Network    string    `json:"network"`
+	IPAddress  string    `json:"ip_address"`
+	Reason     string    `json:"reason"`
+	RequestURL string    `json:"request_url"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
 type LandingPage struct {
 	ID           int64     `json:"id"`
 	Name         string    `json:"name"`
@@ -88,12 +252,104 @@ type Click struct {
 	VisitorID     string    `json:"visitor_id"`
 	CampaignToken string    `json:"campaign_token"`
 	CampaignID    string    `json:"campaign_id"`
+	OfferID       int64     `json:"offer_id,omitempty"`
+	PathID        int64     `json:"path_id,omitempty"`
+	LandingPageID int64     `json:"landing_page_id,omitempty"`
+	ExternalID    string    `json:"external_id,omitempty"`
+	FBC           string    `json:"fbc,omitempty"`
+	FBP           string    `json:"fbp,omitempty"`
+	TTCLID        string    `json:"ttclid,omitempty"`
+	GCLID         string    `json:"gclid,omitempty"`
+	Cost          float64   `json:"cost"`
 	IPAddress     string    `json:"ip_address"`
 	UserAgent     string    `json:"user_agent"`
+	// DeviceType, OS, Browser and BrowserVersion are parsed from the user
+	// agent and client hints
+	DeviceType    string    `json:"device_type"`
+	OS            string    `json:"os"`
+	Browser       string    `json:"browser"`
+	BrowserVersion string   `json:"browser_version"`
 	Referrer      string    `json:"referrer"`
+	Subs          Subs      `json:"subs"`
+	IsBot         bool      `json:"is_bot"`
+	BotReason     string    `json:"bot_reason,omitempty"`
+	FraudScore    int       `json:"fraud_score"`
+	FraudReason   string    `json:"fraud_reason,omitempty"`
 	CreatedAt     time.Time `json:"created_at"`
 }
 
+// TrafficSource is where a campaign buys its traffic. Its own click ID
+// arrives on /click in ClickIDParam and is stored as the click's
+// ExternalID. PostbackURL is a macro template, e.g.
+// https://ads.example/cv?clickid={external_id}&payout={payout}, requested
+// when a conversion is created or, with PostbackOn "approved", approved.
+type TrafficSource struct {
+	ID           int64     `json:"id"`
+	Name         string    `json:"name"`
+	ClickIDParam string    `json:"click_id_param"`
+	PostbackURL  string    `json:"postback_url"`
+	PostbackOn   string    `json:"postback_on"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// When a traffic source postback fires
+const (
+	PostbackOnCreated  = "created"
+	PostbackOnApproved = "approved"
+)
+
+// Delivery is an outbound request waiting in, or delivered from, the
+// outbox, e.g. a Facebook event or a traffic source postback. Response*
+// keep the receiver's last answer as proof of delivery.
+type Delivery struct {
+	ID             int64             `json:"id"`
+	Kind           string            `json:"kind"`
+	Target         string            `json:"target"`
+	Method         string            `json:"method"`
+	URL            string            `json:"url"`
+	ContentType    string            `json:"content_type,omitempty"`
+	Headers        map[string]string `json:"headers,omitempty"`
+	Body           string            `json:"body,omitempty"`
+	ConversionID   int64             `json:"conversion_id,omitempty"`
+	Status         string            `json:"status"`
+	Attempts       int               `json:"attempts"`
+	NextAttemptAt  time.Time         `json:"next_attempt_at"`
+	LastError      string            `json:"last_error,omitempty"`
+	ResponseStatus int               `json:"response_status,omitempty"`
+	ResponseBody   string            `json:"response_body,omitempty"`
+	CreatedAt      time.Time         `json:"created_at"`
+	DeliveredAt    *time.Time        `json:"delivered_at,omitempty"`
+}
+
+// Delivery statuses. Sending deliveries are claimed by a worker; dead ones
+// ran out of attempts and wait for a replay.
+const (
+	DeliveryPending   = "pending"
+	DeliverySending   = "sending"
+	DeliveryDelivered = "delivered"
+	DeliveryDead      = "dead"
+)
+
+// CampaignConnector enables an ad platform connector (facebook, tiktok,
+// google_ads) on a campaign. Settings override the connector's global
+// configuration for this campaign, e.g. {"pixel_id": "123"}.
+type CampaignConnector struct {
+	ID         int64             `json:"id"`
+	CampaignID string            `json:"campaign_id"`
+	Connector  string            `json:"connector"`
+	Settings   map[string]string `json:"settings,omitempty"`
+	CreatedAt  time.Time         `json:"created_at"`
+}
+
+// ConnectorConversion is a revenue conversion on a campaign that uses a
+// connector, with its click's ad platform IDs and the campaign's settings
+type ConnectorConversion struct {
+	Conversion
+	GCLID    string            `json:"gclid,omitempty"`
+	TTCLID   string            `json:"ttclid,omitempty"`
+	Settings map[string]string `json:"settings,omitempty"`
+}
+
 type TrackingDomain struct {
 	ID              int64     `json:"id"`
 	Domain          string    `json:"domain"`
@@ -0,0 +1,202 @@
+package db
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// MapStatus turns a status value from the network into one of ours
+func (m PostbackMapping) MapStatus(value string) (string, bool) {
+	if status, ok := m.StatusValues[strings.ToLower(strings.TrimSpace(value))]; ok {
+		return NormalizeStatus(status)
+	}
+	return NormalizeStatus(value)
+}
+
+const networkColumns = `
+	id, name, preset, secret, hmac_secret, COALESCE(allowed_ips, ''),
+	click_id_param, payout_param, status_param, COALESCE(status_values, ''),
+	transaction_id_param, currency_param`
+
+func scanNetwork(row interface{ Scan(...interface{}) error }) (*AffiliateNetwork, error) {
+	n := new(AffiliateNetwork)
+	var allowedIPs, statusValues, createdAtStr string
+	err := row.Scan(
+		&n.ID, &n.Name, &n.Preset, &n.Secret, &n.HMACSecret, &allowedIPs,
+		&n.Mapping.ClickIDParam, &n.Mapping.PayoutParam, &n.Mapping.StatusParam, &statusValues,
+		&n.Mapping.TransactionIDParam, &n.Mapping.CurrencyParam, &createdAtStr,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if allowedIPs != "" {
+		if err := json.Unmarshal([]byte(allowedIPs), &n.AllowedIPs); err != nil {
+			return nil, fmt.Errorf("invalid allowed_ips on network %s: %v", n.Name, err)
+		}
+	}
+	if statusValues != "" {
+		if err := json.Unmarshal([]byte(statusValues), &n.Mapping.StatusValues); err != nil {
+			return nil, fmt.Errorf("invalid status_values on network %s: %v", n.Name, err)
+		}
+	}
+	n.CreatedAt, err = time.Parse("2006-01-02 15:04:05", createdAtStr)
+	if err != nil {
+		return nil, err
+	}
+	return n, nil
+}
+
+func (db *Database) GetAffiliateNetworks() ([]*AffiliateNetwork, error) {
+	query := `SELECT ` + networkColumns + `, ` + db.dateTime("created_at") + `
+		FROM affiliate_network
+		ORDER BY name`
+
+	rows, err := db.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var networks []*AffiliateNetwork
+	for rows.Next() {
+		n, err := scanNetwork(rows)
+		if err != nil {
+			return nil, err
+		}
+		networks = append(networks, n)
+	}
+	return networks, rows.Err()
+}
+
+// GetAffiliateNetworkByName returns sql.ErrNoRows for unknown networks
+func (db *Database) GetAffiliateNetworkByName(name string) (*AffiliateNetwork, error) {
+	query := `SELECT ` + networkColumns + `, ` + db.dateTime("created_at") + `
+		FROM affiliate_network
+		WHERE name = ?`
+	return scanNetwork(db.QueryRow(query, name))
+}
+
+// GetAffiliateNetworkByID returns sql.ErrNoRows for unknown networks
+func (db *Database) GetAffiliateNetworkByID(id int64) (*AffiliateNetwork, error) {
+	query := `SELECT ` + networkColumns + `, ` + db.dateTime("created_at") + `
+		FROM affiliate_network
+		WHERE id = ?`
+	return scanNetwork(db.QueryRow(query, id))
+}
+
+// SaveAffiliateNetwork inserts n, or updates it when n.ID is set
+func (db *Database) SaveAffiliateNetwork(n *AffiliateNetwork) error {
+	allowedIPs, err := json.Marshal(n.AllowedIPs)
+	if err != nil {
+		return err
+	}
+	if n.AllowedIPs == nil {
+		allowedIPs = []byte("[]")
+	}
+	// Status values are matched case-insensitively
+	values := make(map[string]string, len(n.Mapping.StatusValues))
+	for k, v := range n.Mapping.StatusValues {
+		values[strings.ToLower(strings.TrimSpace(k))] = v
+	}
+	n.Mapping.StatusValues = values
+	statusValues, err := json.Marshal(values)
+	if err != nil {
+		return err
+	}
+	m := n.Mapping
+
+	if n.ID == 0 {
+		if n.CreatedAt.IsZero() {
+			n.CreatedAt = time.Now().UTC()
+		}
+		result, err := db.Exec(`
+			INSERT INTO affiliate_network (
+				name, preset, secret, hmac_secret, allowed_ips,
+				click_id_param, payout_param, status_param, status_values,
+				transaction_id_param, currency_param, created_at
+			) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			n.Name, n.Preset, n.Secret, n.HMACSecret, string(allowedIPs),
+			m.ClickIDParam, m.PayoutParam, m.StatusParam, string(statusValues),
+			m.TransactionIDParam, m.CurrencyParam, n.CreatedAt,
+		)
+		if err != nil {
+			return err
+		}
+		n.ID, _ = result.LastInsertId()
+		return nil
+	}
+
+	result, err := db.Exec(`
+		UPDATE affiliate_network
+		SET name = ?, preset = ?, secret = ?, hmac_secret = ?, allowed_ips = ?,
+			click_id_param = ?, payout_param = ?, status_param = ?, status_values = ?,
+			transaction_id_param = ?, currency_param = ?
+		WHERE id = ?`,
+		n.Name, n.Preset, n.Secret, n.HMACSecret, string(allowedIPs),
+		m.ClickIDParam, m.PayoutParam, m.StatusParam, string(statusValues),
+		m.TransactionIDParam, m.CurrencyParam, n.ID,
+	)
+	if err != nil {
+		return err
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+func (db *Database) DeleteAffiliateNetwork(id int64) error {
+	_, err := db.Exec("DELETE FROM affiliate_network WHERE id = ?", id)
+	return err
+}
+
+func (db *Database) SavePostbackRejection(r *PostbackRejection) error {
+	if r.CreatedAt.IsZero() {
+		r.CreatedAt = time.Now().UTC()
+	}
+	result, err := db.Exec(`
+		INSERT INTO postback_rejection (network, ip_address, reason, request_url, created_at)
+		VALUES (?, ?, ?, ?, ?)`,
+		r.Network, r.IPAddress, r.Reason, r.RequestURL, r.CreatedAt,
+	)
+	if err != nil {
+		return err
+	}
+	r.ID, _ = result.LastInsertId()
+	return nil
+}
+
+// GetPostbackRejections returns the most recent rejected postbacks first
+func (db *Database) GetPostbackRejections(limit int) ([]PostbackRejection, error) {
+	query := `
+		SELECT id, network, ip_address, reason, COALESCE(request_url, ''),
+			` + db.dateTime("created_at") + `
+		FROM postback_rejection
+		ORDER BY id DESC
+		LIMIT ?
+	`
+
+	rows, err := db.Query(query, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var rejections []PostbackRejection
+	for rows.Next() {
+		var r PostbackRejection
+		var createdAtStr string
+		if err := rows.Scan(&r.ID, &r.Network, &r.IPAddress, &r.Reason, &r.RequestURL, &createdAtStr); err != nil {
+			return nil, err
+		}
+		r.CreatedAt, err = time.Parse("2006-01-02 15:04:05", createdAtStr)
+		if err != nil {
+			return nil, err
+		}
+		rejections = append(rejections, r)
+	}
+	return rejections, rows.Err()
+}
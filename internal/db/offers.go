@@ -0,0 +1,115 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// GetCampaignOffers returns the offers in a campaign's rotation, including
+// paused (zero weight) ones.
+func (db *Database) GetCampaignOffers(campaignID string) ([]CampaignOffer, error) {
+	query := `
+		SELECT co.id, co.campaign_id, co.offer_id, co.weight, o.name, o.offer_url
+		FROM campaign_offer co
+		JOIN offer o ON o.id = co.offer_id
+		WHERE co.campaign_id = ?
+		ORDER BY co.id
+	`
+
+	rows, err := db.Query(query, campaignID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var offers []CampaignOffer
+	for rows.Next() {
+		var o CampaignOffer
+		if err := rows.Scan(&o.ID, &o.CampaignID, &o.OfferID, &o.Weight, &o.Name, &o.OfferURL); err != nil {
+			return nil, err
+		}
+		offers = append(offers, o)
+	}
+	return offers, rows.Err()
+}
+
+// SetCampaignOffers replaces a campaign's offer rotation
+func (db *Database) SetCampaignOffers(campaignID string, offers []CampaignOffer) error {
+	tx, err := db.sqlDB.Begin()
+	if err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec("DELETE FROM campaign_offer WHERE campaign_id = ?", campaignID); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	for i := range offers {
+		if offers[i].Weight < 0 {
+			tx.Rollback()
+			return fmt.Errorf("offer %d has a negative weight", offers[i].OfferID)
+		}
+		result, err := tx.Exec(
+			"INSERT INTO campaign_offer (campaign_id, offer_id, weight) VALUES (?, ?, ?)",
+			campaignID, offers[i].OfferID, offers[i].Weight,
+		)
+		if err != nil {
+			tx.Rollback()
+			return fmt.Errorf("error adding offer %d: %v", offers[i].OfferID, err)
+		}
+		offers[i].ID, _ = result.LastInsertId()
+		offers[i].CampaignID = campaignID
+	}
+
+	return tx.Commit()
+}
+
+// GetOfferStats reports clicks, conversions, revenue and cost per offer for
+// a campaign's clicks in r. Offers that received clicks but have since been removed from
+// the rotation are still listed, with a weight of zero.
+func (db *Database) GetOfferStats(campaignID string, r TimeRange) ([]OfferStats, error) {
+	model, bid, err := db.campaignCostModel(campaignID)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, err
+	}
+
+	rangeSQL, rangeArgs := r.where("cl.created_at")
+	query := `
+		SELECT
+			o.id,
+			o.name,
+			COALESCE(co.weight, 0) as weight,
+			COALESCE(SUM(` + humanOnly("cl") + `), 0) as clicks,
+			COALESCE(SUM(conv.conversions), 0) as conversions,
+			COALESCE(SUM(conv.revenue), 0) as revenue,
+			COALESCE(SUM(cl.cost), 0) as cost
+		FROM offer o
+		LEFT JOIN campaign_offer co ON co.offer_id = o.id AND co.campaign_id = ?
+		LEFT JOIN click cl ON cl.offer_id = o.id AND cl.campaign_id = ?` + rangeSQL + `
+		LEFT JOIN ` + clickConversions + ` conv ON conv.click_id = cl.click_id
+		WHERE co.id IS NOT NULL OR cl.id IS NOT NULL
+		GROUP BY o.id, o.name, co.weight
+		ORDER BY revenue DESC, o.id
+	`
+
+	args := append([]interface{}{campaignID, campaignID}, rangeArgs...)
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var stats []OfferStats
+	for rows.Next() {
+		var s OfferStats
+		var cost float64
+		if err := rows.Scan(&s.OfferID, &s.Name, &s.Weight, &s.Clicks, &s.Conversions, &s.Revenue, &cost); err != nil {
+			return nil, err
+		}
+		cost += conversionCost(model, bid, s.Conversions, s.Revenue)
+		s.Metrics = NewMetrics(s.Clicks, s.Conversions, s.Revenue, cost)
+		stats = append(stats, s)
+	}
+	return stats, rows.Err()
+}
@@ -0,0 +1,60 @@
+package db
+
+import (
+	"testing"
+	"time"
+)
+
+func TestOfferStatsPerCampaign(t *testing.T) {
+	database := newTestDatabase(t)
+
+	a := &Offer{Name: "A", Network: "net", OfferURL: "https://a.example"}
+	b := &Offer{Name: "B", Network: "net", OfferURL: "https://b.example"}
+	for _, o := range []*Offer{a, b} {
+		if err := database.SaveOffer(o); err != nil {
+			t.Fatalf("SaveOffer: %v", err)
+		}
+	}
+
+	err := database.SetCampaignOffers("test-campaign", []CampaignOffer{
+		{OfferID: a.ID, Weight: 70},
+		{OfferID: b.ID, Weight: 30},
+	})
+	if err != nil {
+		t.Fatalf("SetCampaignOffers: %v", err)
+	}
+
+	offers, err := database.GetCampaignOffers("test-campaign")
+	if err != nil || len(offers) != 2 || offers[0].OfferURL != "https://a.example" {
+		t.Fatalf("GetCampaignOffers = %+v, %v", offers, err)
+	}
+
+	for i, offerID := range []int64{a.ID, a.ID, b.ID} {
+		click := &Click{
+			ClickID:       string(rune('a' + i)),
+			VisitorID:     "v",
+			CampaignToken: "1234567890",
+			CampaignID:    "test-campaign",
+			OfferID:       offerID,
+		}
+		if err := database.SaveClick(click); err != nil {
+			t.Fatalf("SaveClick: %v", err)
+		}
+	}
+	database.SaveVisit(&Visit{VisitorID: "v", ClickID: "a", CampaignID: "test-campaign", CreatedAt: time.Now()})
+	database.SaveConversion(&Conversion{VisitorID: "v", ClickID: "a", CampaignID: "test-campaign", Amount: 10, CreatedAt: time.Now()})
+
+	stats, err := database.GetOfferStats("test-campaign", TimeRange{})
+	if err != nil {
+		t.Fatalf("GetOfferStats: %v", err)
+	}
+	if len(stats) != 2 {
+		t.Fatalf("expected 2 offers, got %+v", stats)
+	}
+	if stats[0].OfferID != a.ID || stats[0].Clicks != 2 || stats[0].Conversions != 1 || stats[0].Revenue != 10 {
+		t.Errorf("unexpected stats for A: %+v", stats[0])
+	}
+	if stats[1].OfferID != b.ID || stats[1].Clicks != 1 || stats[1].Conversions != 0 {
+		t.Errorf("unexpected stats for B: %+v", stats[1])
+	}
+}
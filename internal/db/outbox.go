@@ -0,0 +1,198 @@
+package db
+
+import (
+	"database/sql"
+	"encoding/json"
+	"time"
+)
+
+// EnqueueDelivery stores d in the outbox, due immediately
+func (db *Database) EnqueueDelivery(d *Delivery) error {
+	now := time.Now().UTC().Truncate(time.Second)
+	d.Status = DeliveryPending
+	d.NextAttemptAt = now
+	d.CreatedAt = now
+
+	var headers sql.NullString
+	if len(d.Headers) > 0 {
+		b, err := json.Marshal(d.Headers)
+		if err != nil {
+			return err
+		}
+		headers = sql.NullString{String: string(b), Valid: true}
+	}
+
+	result, err := db.Exec(`
+		INSERT INTO outbox (
+			kind, target, method, url, content_type, headers, body, conversion_id,
+			status, next_attempt_at, created_at
+		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		d.Kind, d.Target, d.Method, d.URL, d.ContentType, headers, d.Body, nullInt64(d.ConversionID),
+		d.Status, d.NextAttemptAt, d.CreatedAt,
+	)
+	if err != nil {
+		return err
+	}
+	d.ID, _ = result.LastInsertId()
+	return nil
+}
+
+func (db *Database) deliveryQuery(where string) string {
+	return `
+		SELECT id, kind, target, method, url, content_type, COALESCE(headers, ''), COALESCE(body, ''),
+			COALESCE(conversion_id, 0), status, attempts,
+			` + db.dateTime("next_attempt_at") + `,
+			COALESCE(last_error, ''), response_status, COALESCE(response_body, ''),
+			` + db.dateTime("created_at") + `,
+			COALESCE(` + db.dateTime("delivered_at") + `, '')
+		FROM outbox
+		WHERE ` + where
+}
+
+func scanDeliveries(rows *sql.Rows) ([]*Delivery, error) {
+	defer rows.Close()
+
+	var deliveries []*Delivery
+	for rows.Next() {
+		d := new(Delivery)
+		var headers, nextAttemptStr, createdAtStr, deliveredAtStr string
+		err := rows.Scan(
+			&d.ID, &d.Kind, &d.Target, &d.Method, &d.URL, &d.ContentType, &headers, &d.Body,
+			&d.ConversionID, &d.Status, &d.Attempts, &nextAttemptStr,
+			&d.LastError, &d.ResponseStatus, &d.ResponseBody, &createdAtStr, &deliveredAtStr,
+		)
+		if err != nil {
+			return nil, err
+		}
+		if headers != "" {
+			if err := json.Unmarshal([]byte(headers), &d.Headers); err != nil {
+				return nil, err
+			}
+		}
+		if d.NextAttemptAt, err = time.Parse("2006-01-02 15:04:05", nextAttemptStr); err != nil {
+			return nil, err
+		}
+		if d.CreatedAt, err = time.Parse("2006-01-02 15:04:05", createdAtStr); err != nil {
+			return nil, err
+		}
+		if deliveredAtStr != "" {
+			deliveredAt, err := time.Parse("2006-01-02 15:04:05", deliveredAtStr)
+			if err != nil {
+				return nil, err
+			}
+			d.DeliveredAt = &deliveredAt
+		}
+		deliveries = append(deliveries, d)
+	}
+	return deliveries, rows.Err()
+}
+
+// GetDeliveries lists the newest deliveries first, optionally only those
+// in status or for one conversion
+func (db *Database) GetDeliveries(status string, conversionID int64, limit int) ([]*Delivery, error) {
+	where := "1 = 1"
+	var args []interface{}
+	if status != "" {
+		where += " AND status = ?"
+		args = append(args, status)
+	}
+	if conversionID != 0 {
+		where += " AND conversion_id = ?"
+		args = append(args, conversionID)
+	}
+	args = append(args, limit)
+
+	rows, err := db.Query(db.deliveryQuery(where+" ORDER BY id DESC LIMIT ?"), args...)
+	if err != nil {
+		return nil, err
+	}
+	return scanDeliveries(rows)
+}
+
+// HasDelivery reports whether a delivery of kind was ever queued for a
+// conversion, whatever became of it
+func (db *Database) HasDelivery(kind string, conversionID int64) (bool, error) {
+	var n int
+	err := db.QueryRow(
+		"SELECT COUNT(*) FROM outbox WHERE kind = ? AND conversion_id = ?",
+		kind, conversionID,
+	).Scan(&n)
+	return n > 0, err
+}
+
+// ClaimDeliveries marks up to limit due deliveries as sending and returns
+// them. Rows another process claimed first are skipped.
+func (db *Database) ClaimDeliveries(now time.Time, limit int) ([]*Delivery, error) {
+	rows, err := db.Query(
+		db.deliveryQuery("status = ? AND next_attempt_at <= ? ORDER BY next_attempt_at, id LIMIT ?"),
+		DeliveryPending, now.UTC(), limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	due, err := scanDeliveries(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	var claimed []*Delivery
+	for _, d := range due {
+		result, err := db.Exec(
+			"UPDATE outbox SET status = ? WHERE id = ? AND status = ?",
+			DeliverySending, d.ID, DeliveryPending,
+		)
+		if err != nil {
+			return claimed, err
+		}
+		if n, _ := result.RowsAffected(); n == 1 {
+			d.Status = DeliverySending
+			claimed = append(claimed, d)
+		}
+	}
+	return claimed, nil
+}
+
+// CompleteDelivery stores the outcome of an attempt on d
+func (db *Database) CompleteDelivery(d *Delivery) error {
+	var deliveredAt interface{}
+	if d.DeliveredAt != nil {
+		deliveredAt = d.DeliveredAt.UTC()
+	}
+	_, err := db.Exec(`
+		UPDATE outbox
+		SET status = ?, attempts = ?, next_attempt_at = ?, last_error = ?,
+			response_status = ?, response_body = ?, delivered_at = ?
+		WHERE id = ?`,
+		d.Status, d.Attempts, d.NextAttemptAt.UTC(), d.LastError,
+		d.ResponseStatus, d.ResponseBody, deliveredAt, d.ID,
+	)
+	return err
+}
+
+// ReleaseDeliveries puts deliveries a crashed worker left in sending back
+// in the queue. Call it before starting the workers.
+func (db *Database) ReleaseDeliveries() error {
+	_, err := db.Exec(
+		"UPDATE outbox SET status = ? WHERE status = ?",
+		DeliveryPending, DeliverySending,
+	)
+	return err
+}
+
+// ReplayDelivery queues a dead or delivered delivery again with a fresh
+// set of attempts. It returns sql.ErrNoRows for unknown or queued IDs.
+func (db *Database) ReplayDelivery(id int64) error {
+	result, err := db.Exec(`
+		UPDATE outbox
+		SET status = ?, attempts = 0, next_attempt_at = ?, last_error = ''
+		WHERE id = ? AND status IN (?, ?)`,
+		DeliveryPending, time.Now().UTC().Truncate(time.Second), id, DeliveryDead, DeliveryDelivered,
+	)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
@@ -0,0 +1,187 @@
+package db
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// GetCampaignPaths returns a campaign's routing paths in evaluation order,
+// each with its landing page URL and offer rotation filled in.
+func (db *Database) GetCampaignPaths(campaignID string) ([]CampaignPath, error) {
+	query := `
+		SELECT
+			p.id, p.campaign_id, p.name, p.priority, p.is_default, p.conditions,
+			COALESCE(p.landing_page_id, 0), COALESCE(lp.url, ''),
+			` + db.dateTime("p.created_at") + ` as created_at
+		FROM campaign_path p
+		LEFT JOIN landing_page lp ON lp.id = p.landing_page_id
+		WHERE p.campaign_id = ?
+		ORDER BY p.is_default, p.priority, p.id
+	`
+
+	rows, err := db.Query(query, campaignID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var paths []CampaignPath
+	for rows.Next() {
+		var p CampaignPath
+		var conditions, createdAtStr string
+		err := rows.Scan(
+			&p.ID, &p.CampaignID, &p.Name, &p.Priority, &p.IsDefault, &conditions,
+			&p.LandingPageID, &p.LandingPageURL, &createdAtStr,
+		)
+		if err != nil {
+			return nil, err
+		}
+		if conditions != "" {
+			if err := json.Unmarshal([]byte(conditions), &p.Conditions); err != nil {
+				return nil, fmt.Errorf("invalid conditions on path %d: %v", p.ID, err)
+			}
+		}
+		p.CreatedAt, err = time.Parse("2006-01-02 15:04:05", createdAtStr)
+		if err != nil {
+			return nil, err
+		}
+		paths = append(paths, p)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+
+	for i := range paths {
+		paths[i].Offers, err = db.getPathOffers(paths[i].ID, campaignID)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return paths, nil
+}
+
+func (db *Database) getPathOffers(pathID int64, campaignID string) ([]CampaignOffer, error) {
+	query := `
+		SELECT po.id, po.offer_id, po.weight, o.name, o.offer_url
+		FROM campaign_path_offer po
+		JOIN offer o ON o.id = po.offer_id
+		WHERE po.path_id = ?
+		ORDER BY po.id
+	`
+
+	rows, err := db.Query(query, pathID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var offers []CampaignOffer
+	for rows.Next() {
+		o := CampaignOffer{CampaignID: campaignID}
+		if err := rows.Scan(&o.ID, &o.OfferID, &o.Weight, &o.Name, &o.OfferURL); err != nil {
+			return nil, err
+		}
+		offers = append(offers, o)
+	}
+	return offers, rows.Err()
+}
+
+// SaveCampaignPath inserts p, or updates it when p.ID is set, and replaces
+// its offer rotation. A campaign has at most one default path.
+func (db *Database) SaveCampaignPath(p *CampaignPath) error {
+	conditions, err := json.Marshal(p.Conditions)
+	if err != nil {
+		return err
+	}
+	if p.Conditions == nil {
+		conditions = []byte("[]")
+	}
+
+	tx, err := db.sqlDB.Begin()
+	if err != nil {
+		return err
+	}
+
+	if p.IsDefault {
+		_, err := tx.Exec(
+			"UPDATE campaign_path SET is_default = ? WHERE campaign_id = ? AND id <> ?",
+			false, p.CampaignID, p.ID,
+		)
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	if p.ID == 0 {
+		result, err := tx.Exec(`
+			INSERT INTO campaign_path (
+				campaign_id, name, priority, is_default, conditions, landing_page_id
+			) VALUES (?, ?, ?, ?, ?, ?)`,
+			p.CampaignID, p.Name, p.Priority, p.IsDefault, string(conditions), nullInt64(p.LandingPageID),
+		)
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+		p.ID, _ = result.LastInsertId()
+	} else {
+		result, err := tx.Exec(`
+			UPDATE campaign_path
+			SET name = ?, priority = ?, is_default = ?, conditions = ?, landing_page_id = ?
+			WHERE id = ? AND campaign_id = ?`,
+			p.Name, p.Priority, p.IsDefault, string(conditions), nullInt64(p.LandingPageID),
+			p.ID, p.CampaignID,
+		)
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+		if n, _ := result.RowsAffected(); n == 0 {
+			tx.Rollback()
+			return sql.ErrNoRows
+		}
+		if _, err := tx.Exec("DELETE FROM campaign_path_offer WHERE path_id = ?", p.ID); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	for i := range p.Offers {
+		if p.Offers[i].Weight < 0 {
+			tx.Rollback()
+			return fmt.Errorf("offer %d has a negative weight", p.Offers[i].OfferID)
+		}
+		result, err := tx.Exec(
+			"INSERT INTO campaign_path_offer (path_id, offer_id, weight) VALUES (?, ?, ?)",
+			p.ID, p.Offers[i].OfferID, p.Offers[i].Weight,
+		)
+		if err != nil {
+			tx.Rollback()
+			return fmt.Errorf("error adding offer %d: %v", p.Offers[i].OfferID, err)
+		}
+		p.Offers[i].ID, _ = result.LastInsertId()
+		p.Offers[i].CampaignID = p.CampaignID
+	}
+
+	return tx.Commit()
+}
+
+func (db *Database) DeleteCampaignPath(id int64) error {
+	tx, err := db.sqlDB.Begin()
+	if err != nil {
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM campaign_path_offer WHERE path_id = ?", id); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM campaign_path WHERE id = ?", id); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
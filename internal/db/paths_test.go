@@ -0,0 +1,53 @@
+package db
+
+import (
+	"testing"
+)
+
+func TestCampaignPathRoundTrip(t *testing.T) {
+	database := newTestDatabase(t)
+
+	offer := &Offer{Name: "Mobile", Network: "net", OfferURL: "https://m.example"}
+	if err := database.SaveOffer(offer); err != nil {
+		t.Fatalf("SaveOffer: %v", err)
+	}
+	lander := &LandingPage{Name: "Quiz", URL: "https://lp.example/quiz"}
+	if err := database.SaveLandingPage(lander); err != nil {
+		t.Fatalf("SaveLandingPage: %v", err)
+	}
+
+	mobile := &CampaignPath{
+		CampaignID:    "test-campaign",
+		Name:          "Mobile",
+		Priority:      1,
+		Conditions:    []PathCondition{{Field: "device_type", Values: []string{"mobile"}}},
+		LandingPageID: lander.ID,
+		Offers:        []CampaignOffer{{OfferID: offer.ID, Weight: 100}},
+	}
+	fallback := &CampaignPath{CampaignID: "test-campaign", Name: "Default", IsDefault: true}
+	for _, p := range []*CampaignPath{mobile, fallback} {
+		if err := database.SaveCampaignPath(p); err != nil {
+			t.Fatalf("SaveCampaignPath: %v", err)
+		}
+	}
+
+	paths, err := database.GetCampaignPaths("test-campaign")
+	if err != nil {
+		t.Fatalf("GetCampaignPaths: %v", err)
+	}
+	if len(paths) != 2 || paths[0].ID != mobile.ID || !paths[1].IsDefault {
+		t.Fatalf("unexpected paths: %+v", paths)
+	}
+	got := paths[0]
+	if got.LandingPageURL != lander.URL || len(got.Conditions) != 1 || len(got.Offers) != 1 || got.Offers[0].OfferURL != offer.OfferURL {
+		t.Errorf("path not round-tripped: %+v", got)
+	}
+
+	if err := database.DeleteCampaignPath(mobile.ID); err != nil {
+		t.Fatalf("DeleteCampaignPath: %v", err)
+	}
+	paths, _ = database.GetCampaignPaths("test-campaign")
+	if len(paths) != 1 {
+		t.Errorf("expected 1 path after delete, got %d", len(paths))
+	}
+}
@@ -16,38 +16,64 @@ func (db *Database) SaveVisit(v *Visit) error {
             browser, browser_version, os, device_type, screen_resolution,
             viewport_size, language, timezone, landing_page, referrer,
             utm_source, utm_medium, utm_campaign, utm_content, utm_term,
-            country, region, city,
-            created_at
-        ) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+            country, region, city, fbc, fbp, is_bot, bot_reason,
+            created_at, ` + subColumns("") + `
+        ) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ` + subPlaceholders() + `)
     `
     
-    _, err := db.Exec(query,
+    args := []interface{}{
         v.VisitorID, v.ClickID, v.CampaignID, v.IPAddress, v.UserAgent,
         v.Browser, v.BrowserVersion, v.OS, v.DeviceType, v.ScreenResolution,
         v.ViewportSize, v.Language, v.Timezone, v.LandingPage, v.Referrer,
         v.UTMSource, v.UTMMedium, v.UTMCampaign, v.UTMContent, v.UTMTerm,
-        v.Country, v.Region, v.City,
+        v.Country, v.Region, v.City, nullString(v.FBC), nullString(v.FBP), v.IsBot, v.BotReason,
         v.CreatedAt,
-    )
+    }
+    _, err := db.Exec(query, append(args, v.Subs.args()...)...)
     return err
 }
 
+// SaveConversion inserts a new conversion and starts its status history
 func (db *Database) SaveConversion(c *Conversion) error {
+    if c.Status == "" {
+        c.Status = StatusPending
+    } else if status, ok := NormalizeStatus(c.Status); ok {
+        c.Status = status
+    }
+
     query := `
         INSERT INTO conversion (
-            visitor_id, click_id, campaign_id, amount, status, created_at
-        ) VALUES (?, ?, ?, ?, ?, ?)
+            visitor_id, click_id, campaign_id, amount, status, transaction_id, network, currency,
+            type, event_id, fraud_score, fraud_reason, created_at
+        ) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
     `
     
-    result, err := db.Exec(query,
-        c.VisitorID, c.ClickID, c.CampaignID, c.Amount, c.Status, c.CreatedAt,
+    tx, err := db.sqlDB.Begin()
+    if err != nil {
+        return err
+    }
+
+    result, err := tx.Exec(query,
+        c.VisitorID, c.ClickID, c.CampaignID, c.Amount, c.Status, nullString(c.TransactionID), c.Network, nullString(c.Currency),
+        c.Type, nullString(c.EventID), c.FraudScore, c.FraudReason, c.CreatedAt,
     )
     if err != nil {
+        tx.Rollback()
         return err
     }
 
     id, err := result.LastInsertId()
     if err != nil {
+        tx.Rollback()
+        return err
+    }
+
+    if err := insertStatusChange(tx, id, "", c.Status, 0, c.Amount, "created"); err != nil {
+        tx.Rollback()
+        return err
+    }
+
+    if err := tx.Commit(); err != nil {
         return err
     }
 
@@ -57,7 +83,14 @@ func (db *Database) SaveConversion(c *Conversion) error {
 
 func (db *Database) GetVisitsByDate(start, end time.Time) ([]*Visit, error) {
     query := `
-        SELECT * FROM visit 
+        SELECT 
+            id, visitor_id, click_id, campaign_id, ip_address,
+            user_agent, browser, browser_version, os, device_type,
+            screen_resolution, viewport_size, language, timezone,
+            landing_page, referrer, utm_source, utm_medium,
+            utm_campaign, utm_content, utm_term,
+            ` + db.dateTime("created_at") + ` as created_at
+        FROM visit 
         WHERE created_at BETWEEN ? AND ?
         ORDER BY created_at DESC
     `
@@ -71,16 +104,21 @@ func (db *Database) GetVisitsByDate(start, end time.Time) ([]*Visit, error) {
     var visits []*Visit
     for rows.Next() {
         v := new(Visit)
+        var createdAtStr string
         err := rows.Scan(
             &v.ID, &v.VisitorID, &v.ClickID, &v.CampaignID, &v.IPAddress,
             &v.UserAgent, &v.Browser, &v.BrowserVersion, &v.OS, &v.DeviceType,
             &v.ScreenResolution, &v.ViewportSize, &v.Language, &v.Timezone,
             &v.LandingPage, &v.Referrer, &v.UTMSource, &v.UTMMedium,
-            &v.UTMCampaign, &v.UTMContent, &v.UTMTerm, &v.CreatedAt,
+            &v.UTMCampaign, &v.UTMContent, &v.UTMTerm, &createdAtStr,
         )
         if err != nil {
             return nil, err
         }
+        v.CreatedAt, err = time.Parse("2006-01-02 15:04:05", createdAtStr)
+        if err != nil {
+            return nil, err
+        }
         visits = append(visits, v)
     }
     return visits, nil
@@ -88,13 +126,20 @@ func (db *Database) GetVisitsByDate(start, end time.Time) ([]*Visit, error) {
 
 func (db *Database) GetVisitCountSince(t time.Time) (int64, error) {
     var count int64
-    err := db.QueryRow("SELECT COUNT(*) FROM visit WHERE created_at >= ?", t).Scan(&count)
+    err := db.QueryRow("SELECT COUNT(*) FROM visit WHERE created_at >= ? AND is_bot = 0", t).Scan(&count)
     return count, err
 }
 
 func (db *Database) GetRecentVisitsWithConversions(limit int) ([]*Visit, error) {
     query := `
-        SELECT v.*, c.id, c.amount, c.status, c.created_at
+        SELECT 
+            v.id, v.visitor_id, v.click_id, v.campaign_id, v.ip_address,
+            v.user_agent, v.browser, v.browser_version, v.os, v.device_type,
+            v.screen_resolution, v.viewport_size, v.language, v.timezone,
+            v.landing_page, v.referrer, v.utm_source, v.utm_medium,
+            v.utm_campaign, v.utm_content, v.utm_term,
+            ` + db.dateTime("v.created_at") + `,
+            c.id, c.amount, c.status, ` + db.dateTime("c.created_at") + `
         FROM visit v
         LEFT JOIN conversion c ON v.visitor_id = c.visitor_id
         ORDER BY v.created_at DESC
@@ -114,26 +159,33 @@ func (db *Database) GetRecentVisitsWithConversions(limit int) ([]*Visit, error)
         var convID sql.NullInt64
         var convAmount sql.NullFloat64
         var convStatus sql.NullString
-        var convCreatedAt sql.NullTime
+        var createdAtStr string
+        var convCreatedAt sql.NullString
 
         err := rows.Scan(
             &v.ID, &v.VisitorID, &v.ClickID, &v.CampaignID, &v.IPAddress,
             &v.UserAgent, &v.Browser, &v.BrowserVersion, &v.OS, &v.DeviceType,
             &v.ScreenResolution, &v.ViewportSize, &v.Language, &v.Timezone,
             &v.LandingPage, &v.Referrer, &v.UTMSource, &v.UTMMedium,
-            &v.UTMCampaign, &v.UTMContent, &v.UTMTerm, &v.CreatedAt,
+            &v.UTMCampaign, &v.UTMContent, &v.UTMTerm, &createdAtStr,
             &convID, &convAmount, &convStatus, &convCreatedAt,
         )
         if err != nil {
             return nil, err
         }
+        v.CreatedAt, err = time.Parse("2006-01-02 15:04:05", createdAtStr)
+        if err != nil {
+            return nil, err
+        }
+        if convCreatedAt.Valid {
+            conv.CreatedAt, _ = time.Parse("2006-01-02 15:04:05", convCreatedAt.String)
+        }
 
         if visit, exists := visits[v.ID]; exists {
             if convID.Valid {
                 conv.ID = convID.Int64
                 conv.Amount = convAmount.Float64
                 conv.Status = convStatus.String
-                conv.CreatedAt = convCreatedAt.Time
                 visit.Conversions = append(visit.Conversions, conv)
             }
         } else {
@@ -141,7 +193,6 @@ func (db *Database) GetRecentVisitsWithConversions(limit int) ([]*Visit, error)
                 conv.ID = convID.Int64
                 conv.Amount = convAmount.Float64
                 conv.Status = convStatus.String
-                conv.CreatedAt = convCreatedAt.Time
                 v.Conversions = []Conversion{conv}
             }
             visits[v.ID] = v
@@ -155,7 +206,9 @@ func (db *Database) GetRecentVisitsWithConversions(limit int) ([]*Visit, error)
     return result, nil
 }
 
-func (db *Database) GetCampaignStats() ([]CampaignStats, error) {
+// GetCampaignStats lists the campaigns with their figures in r, read from
+// the rollups where possible
+func (db *Database) GetCampaignStats(r TimeRange) ([]CampaignStats, error) {
     log.Printf("Getting campaign stats")
     query := `
         SELECT 
@@ -165,20 +218,15 @@ func (db *Database) GetCampaignStats() ([]CampaignStats, error) {
             c.campaign_token,
             COALESCE(lp.url, '') as landing_page,
             c.traffic_source,
-            DATE_FORMAT(c.created_at, '%Y-%m-%d %H:%i:%s') as created_at,
-            COUNT(DISTINCT v.id) as visits,
-            COUNT(DISTINCT conv.id) as conversions,
-            COALESCE(SUM(conv.amount), 0) as revenue
+            c.cost_model,
+            c.default_bid,
+            c.bot_policy,
+            ` + db.dateTime("c.created_at") + ` as created_at
         FROM campaign c
         LEFT JOIN landing_page lp ON c.landing_page_id = lp.id
-        LEFT JOIN visit v ON c.campaign_id = v.campaign_id
-        LEFT JOIN conversion conv ON v.visitor_id = conv.visitor_id
-        GROUP BY c.id, c.name, c.campaign_id, c.campaign_token,
-                 lp.url, c.traffic_source, c.created_at
         ORDER BY c.created_at DESC
     `
     
-    log.Printf("Running query: %s", query)
     rows, err := db.Query(query)
     if err != nil {
         log.Printf("Error querying campaigns: %v", err)
@@ -192,8 +240,7 @@ func (db *Database) GetCampaignStats() ([]CampaignStats, error) {
         var createdAtStr string
         err := rows.Scan(
             &s.ID, &s.Name, &s.CampaignID, &s.CampaignToken,
-            &s.LandingPage, &s.TrafficSource, &createdAtStr,
-            &s.Visits, &s.Conversions, &s.Revenue,
+            &s.LandingPage, &s.TrafficSource, &s.CostModel, &s.DefaultBid, &s.BotPolicy, &createdAtStr,
         )
         if err != nil {
             return nil, err
@@ -205,6 +252,34 @@ func (db *Database) GetCampaignStats() ([]CampaignStats, error) {
         }
         stats = append(stats, s)
     }
+    if err := rows.Err(); err != nil {
+        return nil, err
+    }
+    rows.Close()
+
+    q := ReportQuery{GroupBy: []string{"campaign"}, From: r.From, To: r.To}
+    if q.From.IsZero() {
+        q.From = time.Unix(0, 0)
+    }
+    if q.To.IsZero() {
+        q.To = time.Now().UTC().Truncate(time.Hour).Add(time.Hour)
+    }
+    report, err := db.RunReport(q)
+    if err != nil {
+        return nil, err
+    }
+    totals := make(map[string]*ReportRow, len(report.Rows))
+    for i := range report.Rows {
+        totals[report.Rows[i].Dimensions["campaign"]] = &report.Rows[i]
+    }
+    for i := range stats {
+        s := &stats[i]
+        if t, ok := totals[s.CampaignID]; ok {
+            s.Visits, s.Clicks, s.Conversions, s.Revenue = t.Visits, t.Clicks, t.Conversions, t.Revenue
+            s.BotVisits, s.BotClicks = t.BotVisits, t.BotClicks
+            s.Metrics = t.Metrics
+        }
+    }
     return stats, nil
 }
 
@@ -241,6 +316,13 @@ func (db *Database) GetConversionsByIDs(convIDsStr string) ([]Conversion, error)
     return conversions, nil
 }
 
+// GetVisitorIDByClickID returns sql.ErrNoRows when no visit has clickID
+func (db *Database) GetVisitorIDByClickID(clickID string) (string, error) {
+    var visitorID string
+    err := db.QueryRow("SELECT visitor_id FROM visit WHERE click_id = ?", clickID).Scan(&visitorID)
+    return visitorID, err
+}
+
 func (db *Database) GetVisitByClickID(clickID string) (*Visit, error) {
     log.Printf("DB: Looking for visit with click_id: %s", clickID)
     
@@ -251,7 +333,8 @@ func (db *Database) GetVisitByClickID(clickID string) (*Visit, error) {
             os, device_type, screen_resolution, viewport_size,
             language, timezone, landing_page, referrer,
             utm_source, utm_medium, utm_campaign, utm_content,
-            utm_term, DATE_FORMAT(created_at, '%Y-%m-%d %H:%i:%s') as created_at
+            utm_term, COALESCE(fbc, ''), COALESCE(fbp, ''),
+            ` + db.dateTime("created_at") + ` as created_at
         FROM visit 
         WHERE click_id = ? 
         ORDER BY created_at DESC 
@@ -266,7 +349,7 @@ func (db *Database) GetVisitByClickID(clickID string) (*Visit, error) {
         &visit.OS, &visit.DeviceType, &visit.ScreenResolution, &visit.ViewportSize,
         &visit.Language, &visit.Timezone, &visit.LandingPage, &visit.Referrer,
         &visit.UTMSource, &visit.UTMMedium, &visit.UTMCampaign, &visit.UTMContent,
-        &visit.UTMTerm, &createdAtStr,
+        &visit.UTMTerm, &visit.FBC, &visit.FBP, &createdAtStr,
     )
     
     if err == sql.ErrNoRows {
@@ -297,17 +380,28 @@ func generateCampaignToken() string {
 func (db *Database) SaveCampaign(c *Campaign) error {
     log.Printf("Saving campaign: %+v", c)
     
+    customParams, err := encodeCustomParams(c.CustomParams)
+    if err != nil {
+        return err
+    }
+    if err := validateCostModel(c); err != nil {
+        return err
+    }
+    if err := validateBotPolicy(c); err != nil {
+        return err
+    }
+
     c.CampaignToken = generateCampaignToken()
     query := `
         INSERT INTO campaign (
             name, campaign_id, campaign_token, offer_url,
-            traffic_source, created_at
-        ) VALUES (?, ?, ?, ?, ?, ?)
+            traffic_source, custom_params, cost_model, default_bid, bot_policy, created_at
+        ) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
     `
     
     result, err := db.Exec(query,
         c.Name, c.CampaignID, c.CampaignToken, c.OfferURL,
-        c.TrafficSource, c.CreatedAt,
+        c.TrafficSource, customParams, c.CostModel, c.DefaultBid, c.BotPolicy, c.CreatedAt,
     )
     if err != nil {
         log.Printf("Database error: %v", err)
@@ -371,7 +465,7 @@ func (db *Database) GetAllStats() (*FullStats, error) {
             c.campaign_id,
             c.amount,
             c.status,
-            DATE_FORMAT(c.created_at, '%Y-%m-%d %H:%i:%s') as created_at,
+            ` + db.dateTime("c.created_at") + ` as created_at,
             COALESCE(camp.name, 'Unknown') as campaign_name,
             COALESCE(v.browser, 'Unknown') as browser,
             COALESCE(v.os, 'Unknown') as os,
@@ -444,6 +538,9 @@ func (db *Database) GetAllStats() (*FullStats, error) {
             return nil, err
         }
         stats.Conversions = append(stats.Conversions, conv)
+        if !CountsAsRevenue(conv.Status) {
+            continue
+        }
         stats.Summary.TotalConversions++
         stats.Summary.TotalRevenue += conv.Amount
         stats.Summary.AverageAmount = stats.Summary.TotalRevenue / float64(stats.Summary.TotalConversions)
@@ -462,7 +559,8 @@ func (db *Database) GetVisitByVisitorID(visitorID string) (*Visit, error) {
             os, device_type, screen_resolution, viewport_size,
             language, timezone, landing_page, referrer,
             utm_source, utm_medium, utm_campaign, utm_content,
-            utm_term, DATE_FORMAT(created_at, '%Y-%m-%d %H:%i:%s') as created_at
+            utm_term, COALESCE(fbc, ''), COALESCE(fbp, ''),
+            ` + db.dateTime("created_at") + ` as created_at
         FROM visit 
         WHERE visitor_id = ? 
         ORDER BY created_at DESC 
@@ -477,7 +575,7 @@ func (db *Database) GetVisitByVisitorID(visitorID string) (*Visit, error) {
         &visit.OS, &visit.DeviceType, &visit.ScreenResolution, &visit.ViewportSize,
         &visit.Language, &visit.Timezone, &visit.LandingPage, &visit.Referrer,
         &visit.UTMSource, &visit.UTMMedium, &visit.UTMCampaign, &visit.UTMContent,
-        &visit.UTMTerm, &createdAtStr,
+        &visit.UTMTerm, &visit.FBC, &visit.FBP, &createdAtStr,
     )
     
     if err == sql.ErrNoRows {
@@ -541,7 +639,7 @@ func (db *Database) GetOffers() ([]*Offer, error) {
     query := `
         SELECT 
             id, name, network, offer_url,
-            DATE_FORMAT(created_at, '%Y-%m-%d %H:%i:%s') as created_at
+            ` + db.dateTime("created_at") + ` as created_at
         FROM offer
         ORDER BY created_at DESC
     `
@@ -574,7 +672,7 @@ func (db *Database) GetOffers() ([]*Offer, error) {
 
 func (db *Database) GetLandingPages() ([]*LandingPage, error) {
     query := `
-        SELECT id, name, url, created_at
+        SELECT id, name, url, ` + db.dateTime("created_at") + ` as created_at
         FROM landing_page
         ORDER BY created_at DESC
     `
@@ -641,22 +739,40 @@ func (db *Database) DeleteLandingPage(id int64) error {
 }
 
 func (db *Database) GetCampaignByToken(token string) (*Campaign, error) {
+    return db.getCampaign("c.campaign_token = ?", token)
+}
+
+func (db *Database) GetCampaignByID(campaignID string) (*Campaign, error) {
+    return db.getCampaign("c.campaign_id = ?", campaignID)
+}
+
+func (db *Database) getCampaign(where string, args ...interface{}) (*Campaign, error) {
     query := `
-        SELECT id, name, campaign_id, campaign_token, offer_url, landing_page, traffic_source, created_at
-        FROM campaign
-        WHERE campaign_token = ?
-    `
+        SELECT 
+            c.id, c.name, c.campaign_id, c.campaign_token,
+            COALESCE(c.offer_url, ''), COALESCE(lp.url, ''), COALESCE(c.traffic_source, ''),
+            COALESCE(c.custom_params, ''), c.cost_model, c.default_bid, c.bot_policy,
+            ` + db.dateTime("c.created_at") + ` as created_at
+        FROM campaign c
+        LEFT JOIN landing_page lp ON c.landing_page_id = lp.id
+        WHERE ` + where
     
     campaign := new(Campaign)
-    var createdAtStr string
-    err := db.QueryRow(query, token).Scan(
+    var customParams, createdAtStr string
+    err := db.QueryRow(query, args...).Scan(
         &campaign.ID, &campaign.Name, &campaign.CampaignID, &campaign.CampaignToken,
-        &campaign.OfferURL, &campaign.LandingPage, &campaign.TrafficSource, &createdAtStr,
+        &campaign.OfferURL, &campaign.LandingPage, &campaign.TrafficSource,
+        &customParams, &campaign.CostModel, &campaign.DefaultBid, &campaign.BotPolicy, &createdAtStr,
     )
     if err != nil {
         return nil, err
     }
 
+    campaign.CustomParams, err = decodeCustomParams(customParams)
+    if err != nil {
+        return nil, fmt.Errorf("invalid custom_params on campaign %s: %v", campaign.CampaignID, err)
+    }
+
     campaign.CreatedAt, err = time.Parse("2006-01-02 15:04:05", createdAtStr)
     if err != nil {
         return nil, err
@@ -665,19 +781,108 @@ func (db *Database) GetCampaignByToken(token string) (*Campaign, error) {
     return campaign, nil
 }
 
+// UpdateCampaign saves the editable fields of an existing campaign
+func (db *Database) UpdateCampaign(c *Campaign) error {
+    customParams, err := encodeCustomParams(c.CustomParams)
+    if err != nil {
+        return err
+    }
+    if err := validateCostModel(c); err != nil {
+        return err
+    }
+    if err := validateBotPolicy(c); err != nil {
+        return err
+    }
+
+    result, err := db.Exec(`
+        UPDATE campaign
+        SET name = ?, offer_url = ?, traffic_source = ?, custom_params = ?,
+            cost_model = ?, default_bid = ?, bot_policy = ?
+        WHERE campaign_id = ?
+    `, c.Name, c.OfferURL, c.TrafficSource, customParams, c.CostModel, c.DefaultBid, c.BotPolicy, c.CampaignID)
+    if err != nil {
+        return err
+    }
+    if n, _ := result.RowsAffected(); n == 0 {
+        return sql.ErrNoRows
+    }
+    return nil
+}
+
 func (db *Database) SaveClick(c *Click) error {
     query := `
         INSERT INTO click (
-            click_id, visitor_id, campaign_token, campaign_id,
-            ip_address, user_agent, referrer
-        ) VALUES (?, ?, ?, ?, ?, ?, ?)
+            click_id, visitor_id, campaign_token, campaign_id, offer_id,
+            path_id, landing_page_id, external_id, fbc, fbp, ttclid, gclid,
+            cost, ip_address, user_agent, device_type, os, browser, browser_version,
+            referrer, is_bot, bot_reason, fraud_score, fraud_reason, created_at,
+            ` + subColumns("") + `
+        ) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ` + subPlaceholders() + `)
     `
-    
-    _, err := db.Exec(query,
-        c.ClickID, c.VisitorID, c.CampaignToken, c.CampaignID,
-        c.IPAddress, c.UserAgent, c.Referrer,
-    )
-    return err
+
+    if c.CreatedAt.IsZero() {
+        c.CreatedAt = time.Now().UTC()
+    }
+    args := []interface{}{
+        c.ClickID, c.VisitorID, c.CampaignToken, c.CampaignID, nullInt64(c.OfferID),
+        nullInt64(c.PathID), nullInt64(c.LandingPageID), nullString(c.ExternalID),
+        nullString(c.FBC), nullString(c.FBP), nullString(c.TTCLID), nullString(c.GCLID),
+        c.Cost, c.IPAddress, c.UserAgent, c.DeviceType, c.OS, c.Browser, c.BrowserVersion,
+        c.Referrer, c.IsBot, c.BotReason, c.FraudScore, c.FraudReason, c.CreatedAt,
+    }
+    result, err := db.Exec(query, append(args, c.Subs.args()...)...)
+    if err != nil {
+        return err
+    }
+    c.ID, _ = result.LastInsertId()
+    return nil
+}
+
+func (db *Database) GetClickByID(clickID string) (*Click, error) {
+    query := `
+        SELECT 
+            id, click_id, visitor_id, campaign_token, COALESCE(campaign_id, ''),
+            COALESCE(offer_id, 0), COALESCE(path_id, 0), COALESCE(landing_page_id, 0),
+            COALESCE(external_id, ''), COALESCE(fbc, ''), COALESCE(fbp, ''),
+            COALESCE(ttclid, ''), COALESCE(gclid, ''), cost,
+            COALESCE(ip_address, ''), COALESCE(user_agent, ''), COALESCE(referrer, ''),
+            device_type, os, browser, browser_version,
+            is_bot, bot_reason, fraud_score, fraud_reason,
+            ` + db.dateTime("created_at") + ` as created_at,
+            ` + coalescedSubColumns("") + `
+        FROM click
+        WHERE click_id = ?
+    `
+
+    c := new(Click)
+    var createdAtStr string
+    dests := []interface{}{
+        &c.ID, &c.ClickID, &c.VisitorID, &c.CampaignToken, &c.CampaignID,
+        &c.OfferID, &c.PathID, &c.LandingPageID, &c.ExternalID, &c.FBC, &c.FBP,
+        &c.TTCLID, &c.GCLID, &c.Cost, &c.IPAddress, &c.UserAgent, &c.Referrer,
+        &c.DeviceType, &c.OS, &c.Browser, &c.BrowserVersion,
+        &c.IsBot, &c.BotReason, &c.FraudScore, &c.FraudReason, &createdAtStr,
+    }
+    err := db.QueryRow(query, clickID).Scan(append(dests, c.Subs.dests()...)...)
+    if err != nil {
+        return nil, err
+    }
+
+    c.CreatedAt, err = time.Parse("2006-01-02 15:04:05", createdAtStr)
+    if err != nil {
+        return nil, err
+    }
+    return c, nil
+}
+
+// nullString stores empty strings as NULL so unique indexes ignore them
+func nullString(v string) sql.NullString {
+    return sql.NullString{String: v, Valid: v != ""}
+}
+
+// nullInt64 stores zero IDs as NULL so optional foreign keys stay valid
+func nullInt64(v int64) sql.NullInt64 {
+    return sql.NullInt64{Int64: v, Valid: v != 0}
 }
 
 func (db *Database) SaveTrackingDomain(d *TrackingDomain) error {
@@ -702,7 +907,7 @@ func (db *Database) SaveTrackingDomain(d *TrackingDomain) error {
 
 func (db *Database) GetTrackingDomains() ([]*TrackingDomain, error) {
     query := `
-        SELECT id, domain, cloudflare_zone_id, created_at
+        SELECT id, domain, cloudflare_zone_id, ` + db.dateTime("created_at") + ` as created_at
         FROM tracking_domain
         ORDER BY created_at DESC
     `
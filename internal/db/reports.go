@@ -0,0 +1,501 @@
+package db
+
+import (
+	"cmp"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Time dimensions are grouped by the UTC hour in SQL and then bucketed in
+// the report's timezone, so DST and non-UTC days come out right. Timezones
+// whose offset isn't whole hours, such as Asia/Kolkata, are grouped by the
+// UTC quarter hour instead and don't read the hourly rollups.
+const (
+	DimensionDay  = "day"
+	DimensionHour = "hour"
+)
+
+// reportDimensions maps the dimensions reports can be grouped and filtered
+// by to SQL over the click (cl) and visit (v) behind each fact
+var reportDimensions = map[string]string{
+	"campaign":     "COALESCE(cl.campaign_id, v.campaign_id, '')",
+	"offer":        "COALESCE(cl.offer_id, 0)",
+	"lander":       "COALESCE(cl.landing_page_id, 0)",
+	"country":      "COALESCE(v.country, '')",
+	"device":       "COALESCE(NULLIF(cl.device_type, ''), v.device_type, '')",
+	"os":           "COALESCE(NULLIF(cl.os, ''), v.os, '')",
+	"browser":      "COALESCE(NULLIF(cl.browser, ''), v.browser, '')",
+	"utm_source":   "COALESCE(v.utm_source, '')",
+	"utm_medium":   "COALESCE(v.utm_medium, '')",
+	"utm_campaign": "COALESCE(v.utm_campaign, '')",
+	"utm_content":  "COALESCE(v.utm_content, '')",
+	"utm_term":     "COALESCE(v.utm_term, '')",
+	"fraud_risk":   fraudRisk("COALESCE(cl.fraud_score, 0)"),
+}
+
+func init() {
+	for i := 1; i <= SubCount; i++ {
+		reportDimensions[fmt.Sprintf("sub%d", i)] = fmt.Sprintf("COALESCE(NULLIF(cl.sub%d, ''), v.sub%d, '')", i, i)
+	}
+}
+
+// ReportDimensions lists the dimensions reports can be grouped by
+func ReportDimensions() []string {
+	names := []string{DimensionDay, DimensionHour}
+	for name := range reportDimensions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// IsReportDimension reports whether name can be grouped by. Only the
+// non-time dimensions can be filtered on.
+func IsReportDimension(name string) bool {
+	_, ok := reportDimensions[name]
+	return ok || isTimeDimension(name)
+}
+
+func isTimeDimension(name string) bool {
+	return name == DimensionDay || name == DimensionHour
+}
+
+// ReportQuery selects the facts in [From, To) matching Filters (dimension
+// to accepted values) and groups them by GroupBy. Location is the
+// timezone of the day and hour dimensions.
+type ReportQuery struct {
+	GroupBy  []string
+	Filters  map[string][]string
+	From     time.Time
+	To       time.Time
+	Location *time.Location
+}
+
+// TimeRange limits stats to [From, To). Zero bounds are open.
+type TimeRange struct {
+	From time.Time
+	To   time.Time
+}
+
+// where renders the range as conditions on column, each prefixed by AND
+func (r TimeRange) where(column string) (string, []interface{}) {
+	var sql string
+	var args []interface{}
+	if !r.From.IsZero() {
+		sql += " AND " + column + " >= ?"
+		args = append(args, r.From.UTC().Format("2006-01-02 15:04:05"))
+	}
+	if !r.To.IsZero() {
+		sql += " AND " + column + " < ?"
+		args = append(args, r.To.UTC().Format("2006-01-02 15:04:05"))
+	}
+	return sql, args
+}
+
+// ReportRow is one group of a report. Labels name the campaign, offer and
+// lander IDs among the dimensions. Visits and clicks are people's; bots
+// are counted in BotVisits and BotClicks, though their cost is included.
+type ReportRow struct {
+	Dimensions  map[string]string `json:"dimensions"`
+	Labels      map[string]string `json:"labels,omitempty"`
+	Visits      int64             `json:"visits"`
+	Clicks      int64             `json:"clicks"`
+	Conversions int64             `json:"conversions"`
+	Revenue     float64           `json:"revenue"`
+	BotVisits   int64             `json:"bot_visits"`
+	BotClicks   int64             `json:"bot_clicks"`
+	Metrics
+}
+
+func (r *ReportRow) add(o *ReportRow) {
+	r.Visits += o.Visits
+	r.Clicks += o.Clicks
+	r.Conversions += o.Conversions
+	r.Revenue += o.Revenue
+	r.Cost += o.Cost
+	r.BotVisits += o.BotVisits
+	r.BotClicks += o.BotClicks
+}
+
+func (r *ReportRow) finish() {
+	r.Metrics = NewMetrics(r.Clicks, r.Conversions, r.Revenue, r.Cost)
+}
+
+type Report struct {
+	GroupBy []string    `json:"group_by"`
+	Rows    []ReportRow `json:"rows"`
+	Totals  ReportRow   `json:"totals"`
+}
+
+// reportFact is a source of report rows: visits, clicks or conversions,
+// each counted at its own time. Rollups are a fact too, over their own
+// dimension columns.
+type reportFact struct {
+	from       string
+	time       string
+	where      string
+	measures   string
+	dimensions map[string]string
+	// overrides replaces some of the dimensions' SQL for this fact
+	overrides map[string]string
+}
+
+// firstVisit picks one visit of a click, so clicks landing twice aren't
+// counted twice
+const firstVisit = "(SELECT MIN(id) FROM visit WHERE click_id = %s)"
+
+// conversionCampaign opens a COALESCE of a conversion's campaign candidates
+const conversionCampaign = "COALESCE(NULLIF(conv.campaign_id, ''), cl.campaign_id, v.campaign_id"
+
+var reportFacts = []reportFact{
+	{
+		from:     "visit v LEFT JOIN click cl ON cl.click_id = v.click_id",
+		time:     "v.created_at",
+		measures: humanOnly("v") + " AS visits, 0 AS clicks, 0 AS conversions, 0 AS revenue, 0 AS cost, " +
+			botOnly("v") + " AS bot_visits, 0 AS bot_clicks",
+	},
+	{
+		from:     "click cl LEFT JOIN visit v ON v.id = " + fmt.Sprintf(firstVisit, "cl.click_id"),
+		time:     "cl.created_at",
+		measures: "0 AS visits, " + humanOnly("cl") + " AS clicks, 0 AS conversions, 0 AS revenue, cl.cost AS cost, " +
+			"0 AS bot_visits, " + botOnly("cl") + " AS bot_clicks",
+	},
+	{
+		from: `conversion conv
+			LEFT JOIN click cl ON cl.click_id = conv.click_id
+			LEFT JOIN visit v ON v.id = COALESCE(` + fmt.Sprintf(firstVisit, "conv.click_id") + `,
+				(SELECT MIN(id) FROM visit WHERE visitor_id = conv.visitor_id))
+			LEFT JOIN campaign camp ON camp.campaign_id = ` + conversionCampaign + `)`,
+		time:  "conv.created_at",
+		where: "conv.status IN " + revenueStatuses,
+		// Conversions are scored on their own and keep their campaign
+		// when their click or visit is unknown
+		overrides: map[string]string{
+			"campaign":   conversionCampaign + ", '')",
+			"fraud_risk": fraudRisk("conv.fraud_score"),
+		},
+		measures: `0 AS visits, 0 AS clicks, 1 AS conversions, conv.amount AS revenue,
+			CASE camp.cost_model
+				WHEN '` + CostModelCPA + `' THEN camp.default_bid
+				WHEN '` + CostModelRevShare + `' THEN conv.amount * camp.default_bid / 100
+				ELSE 0
+			END AS cost,
+			0 AS bot_visits, 0 AS bot_clicks`,
+	},
+}
+
+// factQuery selects a fact's rows in [from, to) matching filters, with the
+// dims as d0, d1, ... and, when bucket is set, the start of the UTC period
+// it truncates the fact's time to as hr
+func (db *Database) factQuery(fact reportFact, dims []string, bucket func(string) string, filters map[string][]string, from, to time.Time) (string, []interface{}) {
+	dimensions := fact.dimensions
+	if dimensions == nil {
+		dimensions = reportDimensions
+	}
+	if len(fact.overrides) > 0 {
+		merged := make(map[string]string, len(dimensions))
+		for name, sql := range dimensions {
+			merged[name] = sql
+		}
+		for name, sql := range fact.overrides {
+			merged[name] = sql
+		}
+		dimensions = merged
+	}
+
+	cols := make([]string, 0, len(dims)+2)
+	for i, name := range dims {
+		cols = append(cols, fmt.Sprintf("%s AS d%d", dimensions[name], i))
+	}
+	if bucket != nil {
+		cols = append(cols, bucket(fact.time)+" AS hr")
+	}
+	cols = append(cols, fact.measures)
+
+	where := []string{fact.time + " >= ?", fact.time + " < ?"}
+	args := []interface{}{
+		from.UTC().Format("2006-01-02 15:04:05"),
+		to.UTC().Format("2006-01-02 15:04:05"),
+	}
+	if fact.where != "" {
+		where = append(where, fact.where)
+	}
+	filterNames := make([]string, 0, len(filters))
+	for name, values := range filters {
+		if len(values) > 0 {
+			filterNames = append(filterNames, name)
+		}
+	}
+	sort.Strings(filterNames)
+	for _, name := range filterNames {
+		values := filters[name]
+		where = append(where, fmt.Sprintf("%s IN (%s)",
+			dimensions[name], strings.TrimSuffix(strings.Repeat("?, ", len(values)), ", ")))
+		for _, v := range values {
+			args = append(args, filterValue(name, v))
+		}
+	}
+
+	return "SELECT " + strings.Join(cols, ", ") + " FROM " + fact.from +
+		" WHERE " + strings.Join(where, " AND "), args
+}
+
+// CompareDimension orders two values of a dimension, offer and lander IDs
+// as numbers and everything else as text
+func CompareDimension(name, a, b string) int {
+	if name == "offer" || name == "lander" {
+		x, errA := strconv.ParseInt(a, 10, 64)
+		y, errB := strconv.ParseInt(b, 10, 64)
+		if errA == nil && errB == nil {
+			return cmp.Compare(x, y)
+		}
+	}
+	return strings.Compare(a, b)
+}
+
+// filterValue types offer and lander IDs, which SQLite won't compare to
+// strings
+func filterValue(name, value string) interface{} {
+	if name == "offer" || name == "lander" {
+		if id, err := strconv.ParseInt(value, 10, 64); err == nil {
+			return id
+		}
+	}
+	return value
+}
+
+// groupedQuery sums the measures of the fact queries by their dimensions
+func groupedQuery(facts []string, dims int, hourly bool) string {
+	var groupCols []string
+	for i := 0; i < dims; i++ {
+		groupCols = append(groupCols, fmt.Sprintf("d%d", i))
+	}
+	if hourly {
+		groupCols = append(groupCols, "hr")
+	}
+	selectCols := append(append([]string{}, groupCols...),
+		"COALESCE(SUM(visits), 0)", "COALESCE(SUM(clicks), 0)", "COALESCE(SUM(conversions), 0)",
+		"COALESCE(SUM(revenue), 0)", "COALESCE(SUM(cost), 0)",
+		"COALESCE(SUM(bot_visits), 0)", "COALESCE(SUM(bot_clicks), 0)")
+	query := "SELECT " + strings.Join(selectCols, ", ") +
+		" FROM (" + strings.Join(facts, " UNION ALL ") + ") facts"
+	if len(groupCols) > 0 {
+		query += " GROUP BY " + strings.Join(groupCols, ", ")
+	}
+	return query
+}
+
+// RunReport groups visits, clicks and revenue conversions. Cost is the
+// clicks' cost plus what CPA and RevShare campaigns pay per conversion.
+// Hours already rolled up are read from the rollups when the report only
+// needs their dimensions.
+func (db *Database) RunReport(q ReportQuery) (*Report, error) {
+	loc := q.Location
+	if loc == nil {
+		loc = time.UTC
+	}
+
+	var sqlDims []string
+	timeGrouped := false
+	for _, name := range q.GroupBy {
+		if isTimeDimension(name) {
+			timeGrouped = true
+			continue
+		}
+		if _, ok := reportDimensions[name]; !ok {
+			return nil, fmt.Errorf("unknown dimension %q", name)
+		}
+		sqlDims = append(sqlDims, name)
+	}
+	for name := range q.Filters {
+		if _, ok := reportDimensions[name]; !ok {
+			return nil, fmt.Errorf("can't filter on %q", name)
+		}
+	}
+
+	var bucket func(string) string
+	if timeGrouped {
+		bucket = db.hourStart
+		if !wholeHourOffsets(loc, q.From, q.To) {
+			bucket = db.quarterHourStart
+		}
+	}
+
+	// Raw facts cover [rawFrom, To), rollups what comes before
+	var facts []string
+	var args []interface{}
+	rawFrom := q.From
+	if rollupCovers(&q) && (!timeGrouped || wholeHourOffsets(loc, q.From, q.To)) {
+		rolledUntil, err := db.RolledUntil()
+		if err != nil {
+			return nil, err
+		}
+		if rolledUntil.After(q.From) {
+			rawFrom = rolledUntil
+			if rawFrom.After(q.To) {
+				rawFrom = q.To
+			}
+			query, factArgs := db.factQuery(rollupFact, sqlDims, bucket, q.Filters, q.From, rawFrom)
+			facts = append(facts, query)
+			args = append(args, factArgs...)
+		}
+	}
+	if len(facts) == 0 || q.To.After(rawFrom) {
+		for _, fact := range reportFacts {
+			query, factArgs := db.factQuery(fact, sqlDims, bucket, q.Filters, rawFrom, q.To)
+			facts = append(facts, query)
+			args = append(args, factArgs...)
+		}
+	}
+
+	rows, err := db.Query(groupedQuery(facts, len(sqlDims), timeGrouped), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	report := &Report{GroupBy: q.GroupBy, Rows: []ReportRow{}}
+	groups := map[string]*ReportRow{}
+	var order []string
+	for rows.Next() {
+		dims := make([]string, len(sqlDims))
+		var hour string
+		var row ReportRow
+		dests := make([]interface{}, 0, len(sqlDims)+8)
+		for i := range dims {
+			dests = append(dests, &dims[i])
+		}
+		if timeGrouped {
+			dests = append(dests, &hour)
+		}
+		dests = append(dests, &row.Visits, &row.Clicks, &row.Conversions, &row.Revenue, &row.Cost,
+			&row.BotVisits, &row.BotClicks)
+		if err := rows.Scan(dests...); err != nil {
+			return nil, err
+		}
+
+		row.Dimensions = make(map[string]string, len(q.GroupBy))
+		for i, name := range sqlDims {
+			row.Dimensions[name] = dims[i]
+		}
+		if timeGrouped {
+			t, err := time.Parse("2006-01-02 15:04:05", hour)
+			if err != nil {
+				return nil, err
+			}
+			t = t.In(loc)
+			row.Dimensions[DimensionDay] = t.Format("2006-01-02")
+			row.Dimensions[DimensionHour] = t.Format("2006-01-02 15:00")
+		}
+
+		keyParts := make([]string, len(q.GroupBy))
+		for i, name := range q.GroupBy {
+			keyParts[i] = row.Dimensions[name]
+		}
+		key := strings.Join(keyParts, "\x00")
+		if group, ok := groups[key]; ok {
+			group.add(&row)
+			continue
+		}
+		// Only keep the dimensions grouped by
+		dimensions := make(map[string]string, len(q.GroupBy))
+		for _, name := range q.GroupBy {
+			dimensions[name] = row.Dimensions[name]
+		}
+		row.Dimensions = dimensions
+		groups[key] = &row
+		order = append(order, key)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+
+	sort.Slice(order, func(i, j int) bool {
+		a, b := groups[order[i]].Dimensions, groups[order[j]].Dimensions
+		for _, name := range q.GroupBy {
+			if c := CompareDimension(name, a[name], b[name]); c != 0 {
+				return c < 0
+			}
+		}
+		return false
+	})
+	report.Totals.Dimensions = map[string]string{}
+	for _, key := range order {
+		row := groups[key]
+		row.finish()
+		report.Totals.add(row)
+		report.Rows = append(report.Rows, *row)
+	}
+	report.Totals.finish()
+
+	if err := db.labelReport(report); err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+// wholeHourOffsets reports whether loc is a whole number of hours off UTC
+// at both ends of [from, to), so UTC hours fall into a single local hour
+func wholeHourOffsets(loc *time.Location, from, to time.Time) bool {
+	for _, t := range []time.Time{from, to} {
+		if t.IsZero() {
+			t = time.Now()
+		}
+		if _, offset := t.In(loc).Zone(); offset%3600 != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// labelReport names the campaigns, offers and landers in a report
+func (db *Database) labelReport(report *Report) error {
+	lookups := map[string]string{
+		"campaign": "SELECT campaign_id, name FROM campaign",
+		"offer":    "SELECT id, name FROM offer",
+		"lander":   "SELECT id, name FROM landing_page",
+	}
+	for _, name := range report.GroupBy {
+		query, ok := lookups[name]
+		if !ok {
+			continue
+		}
+		names, err := db.names(query)
+		if err != nil {
+			return err
+		}
+		for i := range report.Rows {
+			row := &report.Rows[i]
+			if label, ok := names[row.Dimensions[name]]; ok {
+				if row.Labels == nil {
+					row.Labels = map[string]string{}
+				}
+				row.Labels[name] = label
+			}
+		}
+	}
+	return nil
+}
+
+// names runs a two column ID, name query into a map
+func (db *Database) names(query string) (map[string]string, error) {
+	rows, err := db.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	names := map[string]string{}
+	for rows.Next() {
+		var id, name string
+		if err := rows.Scan(&id, &name); err != nil {
+			return nil, err
+		}
+		names[id] = name
+	}
+	return names, rows.Err()
+}
@@ -0,0 +1,167 @@
+package db
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestRunReport(t *testing.T) {
+	database := newTestDatabase(t)
+
+	campaign, err := database.GetCampaignByID("test-campaign")
+	if err != nil {
+		t.Fatalf("GetCampaignByID: %v", err)
+	}
+	campaign.CostModel = CostModelCPA
+	campaign.DefaultBid = 2
+	if err := database.UpdateCampaign(campaign); err != nil {
+		t.Fatalf("UpdateCampaign: %v", err)
+	}
+
+	now := time.Now().UTC()
+	visits := map[string]string{"a": "US", "b": "US", "c": "DE"}
+	for id, country := range visits {
+		visit := &Visit{VisitorID: "v" + id, ClickID: id, CampaignID: "test-campaign", Country: country, CreatedAt: now}
+		if err := database.SaveVisit(visit); err != nil {
+			t.Fatalf("SaveVisit: %v", err)
+		}
+		click := &Click{ClickID: id, VisitorID: "v" + id, CampaignToken: "1234567890", CampaignID: "test-campaign", Cost: 0.5}
+		if err := database.SaveClick(click); err != nil {
+			t.Fatalf("SaveClick: %v", err)
+		}
+	}
+	database.SaveConversion(&Conversion{VisitorID: "va", ClickID: "a", CampaignID: "test-campaign", Amount: 10, CreatedAt: now})
+
+	q := ReportQuery{
+		GroupBy: []string{"campaign", "country"},
+		From:    now.Add(-time.Hour),
+		To:      now.Add(time.Hour),
+	}
+	report, err := database.RunReport(q)
+	if err != nil {
+		t.Fatalf("RunReport: %v", err)
+	}
+	if len(report.Rows) != 2 {
+		t.Fatalf("rows = %+v", report.Rows)
+	}
+	de, us := report.Rows[0], report.Rows[1]
+	if de.Dimensions["country"] != "DE" || de.Visits != 1 || de.Clicks != 1 || de.Conversions != 0 || de.Cost != 0.5 {
+		t.Errorf("DE row = %+v", de)
+	}
+	// two clicks at 0.50 plus 2 for the CPA conversion
+	if us.Visits != 2 || us.Clicks != 2 || us.Conversions != 1 || us.Revenue != 10 || us.Cost != 3 || us.Profit != 7 || us.CR != 50 {
+		t.Errorf("US row = %+v", us)
+	}
+	if us.Labels["campaign"] != campaign.Name {
+		t.Errorf("labels = %+v", us.Labels)
+	}
+	if report.Totals.Visits != 3 || report.Totals.Clicks != 3 || report.Totals.Cost != 3.5 {
+		t.Errorf("totals = %+v", report.Totals)
+	}
+
+	q.GroupBy = []string{DimensionDay}
+	q.Filters = map[string][]string{"country": {"DE"}}
+	q.Location = time.FixedZone("UTC+14", 14*3600)
+	report, err = database.RunReport(q)
+	if err != nil {
+		t.Fatalf("RunReport: %v", err)
+	}
+	day := now.In(q.Location).Format("2006-01-02")
+	if len(report.Rows) != 1 || report.Rows[0].Dimensions[DimensionDay] != day ||
+		report.Rows[0].Visits != 1 || report.Rows[0].Clicks != 1 {
+		t.Errorf("rows by day = %+v, want %s", report.Rows, day)
+	}
+
+	q.To = q.From
+	if report, err = database.RunReport(q); err != nil || len(report.Rows) != 0 {
+		t.Errorf("empty range = %+v, %v", report, err)
+	}
+}
+
+func TestReportHalfHourTimezone(t *testing.T) {
+	database := newTestDatabase(t)
+
+	// 23:45 and 00:15 in India, both in the 18:00 UTC hour
+	for id, at := range map[string]string{"a": "2026-01-10 18:15:00", "b": "2026-01-10 18:45:00"} {
+		createdAt, _ := time.Parse("2006-01-02 15:04:05", at)
+		visit := &Visit{VisitorID: "v" + id, ClickID: id, CampaignID: "test-campaign", CreatedAt: createdAt}
+		if err := database.SaveVisit(visit); err != nil {
+			t.Fatalf("SaveVisit: %v", err)
+		}
+	}
+	q := ReportQuery{
+		GroupBy:  []string{DimensionDay},
+		From:     time.Date(2026, 1, 10, 0, 0, 0, 0, time.UTC),
+		To:       time.Date(2026, 1, 11, 0, 0, 0, 0, time.UTC),
+		Location: time.FixedZone("IST", 5*3600+1800),
+	}
+	if err := database.RollupHours(q.From, q.To); err != nil {
+		t.Fatalf("RollupHours: %v", err)
+	}
+	report, err := database.RunReport(q)
+	if err != nil {
+		t.Fatalf("RunReport: %v", err)
+	}
+	if len(report.Rows) != 2 ||
+		report.Rows[0].Dimensions[DimensionDay] != "2026-01-10" || report.Rows[0].Visits != 1 ||
+		report.Rows[1].Dimensions[DimensionDay] != "2026-01-11" || report.Rows[1].Visits != 1 {
+		t.Errorf("rows = %+v", report.Rows)
+	}
+}
+
+func TestReportOrderAndConversionCampaigns(t *testing.T) {
+	database := newTestDatabase(t)
+
+	now := time.Now().UTC()
+	var offerIDs []int64
+	for i := 1; i <= 10; i++ {
+		offer := &Offer{Name: fmt.Sprintf("Offer %d", i), Network: "net", OfferURL: "https://offer.example/"}
+		if err := database.SaveOffer(offer); err != nil {
+			t.Fatalf("SaveOffer: %v", err)
+		}
+		offerIDs = append(offerIDs, offer.ID)
+	}
+	for _, id := range []int64{offerIDs[9], offerIDs[1]} {
+		click := &Click{ClickID: fmt.Sprint("c", id), CampaignToken: "1234567890", CampaignID: "test-campaign", OfferID: id}
+		if err := database.SaveClick(click); err != nil {
+			t.Fatalf("SaveClick: %v", err)
+		}
+	}
+	// A visitor of this campaign converting on another without a click
+	other := &Campaign{Name: "Other", CampaignID: "other-campaign", CampaignToken: "0987654321", CreatedAt: now}
+	if err := database.SaveCampaign(other); err != nil {
+		t.Fatalf("SaveCampaign: %v", err)
+	}
+	if err := database.SaveVisit(&Visit{VisitorID: "v1", CampaignID: "test-campaign", CreatedAt: now}); err != nil {
+		t.Fatalf("SaveVisit: %v", err)
+	}
+	conversion := &Conversion{VisitorID: "v1", CampaignID: other.CampaignID, Amount: 5, CreatedAt: now}
+	if err := database.SaveConversion(conversion); err != nil {
+		t.Fatalf("SaveConversion: %v", err)
+	}
+
+	q := ReportQuery{GroupBy: []string{"offer"}, From: now.Add(-time.Hour), To: now.Add(time.Hour)}
+	report, err := database.RunReport(q)
+	if err != nil {
+		t.Fatalf("RunReport: %v", err)
+	}
+	var order []string
+	for _, row := range report.Rows {
+		order = append(order, row.Dimensions["offer"])
+	}
+	if want := []string{"0", fmt.Sprint(offerIDs[1]), fmt.Sprint(offerIDs[9])}; fmt.Sprint(order) != fmt.Sprint(want) {
+		t.Errorf("offers in order %v, want %v", order, want)
+	}
+
+	q.GroupBy = []string{"campaign"}
+	report, err = database.RunReport(q)
+	if err != nil {
+		t.Fatalf("RunReport: %v", err)
+	}
+	if len(report.Rows) != 2 || report.Rows[0].Dimensions["campaign"] != other.CampaignID ||
+		report.Rows[0].Conversions != 1 || report.Rows[0].Revenue != 5 ||
+		report.Rows[1].Clicks != 2 || report.Rows[1].Conversions != 0 {
+		t.Errorf("rows by campaign = %+v", report.Rows)
+	}
+}
@@ -0,0 +1,237 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"time"
+)
+
+// Hourly rollups keep the report measures per UTC hour, campaign, offer,
+// lander, country and device in stats_hourly, so reports over those
+// dimensions don't scan the raw tables. Hours before rolled_until are
+// read from the rollups, later ones from the raw tables.
+
+// rollupName is the rollup_state row of stats_hourly
+const rollupName = "stats_hourly"
+
+// rollupDimensions are the stats_hourly key columns besides the hour, in
+// column order
+var rollupDimensions = []string{"campaign", "offer", "lander", "country", "device"}
+
+var rollupFact = reportFact{
+	from:     "stats_hourly r",
+	time:     "r.hour",
+	measures: "r.visits AS visits, r.clicks AS clicks, r.conversions AS conversions, r.revenue AS revenue, r.cost AS cost, " +
+		"r.bot_visits AS bot_visits, r.bot_clicks AS bot_clicks",
+	dimensions: map[string]string{
+		"campaign": "r.campaign_id",
+		"offer":    "r.offer_id",
+		"lander":   "r.lander_id",
+		"country":  "r.country",
+		"device":   "r.device",
+	},
+}
+
+// rollupChunk is how much is rolled up per transaction
+const rollupChunk = 24 * time.Hour
+
+// rollupCovers reports whether q can be answered from the rollups: it only
+// uses their dimensions and its range starts and ends on whole hours
+func rollupCovers(q *ReportQuery) bool {
+	for _, name := range q.GroupBy {
+		if _, ok := rollupFact.dimensions[name]; !ok && !isTimeDimension(name) {
+			return false
+		}
+	}
+	for name := range q.Filters {
+		if _, ok := rollupFact.dimensions[name]; !ok {
+			return false
+		}
+	}
+	return q.From.Equal(q.From.Truncate(time.Hour)) && q.To.Equal(q.To.Truncate(time.Hour))
+}
+
+// RolledUntil is the end of the hours rolled up so far, zero before the
+// first rollup
+func (db *Database) RolledUntil() (time.Time, error) {
+	var until string
+	err := db.QueryRow(
+		"SELECT "+db.dateTime("rolled_until")+" FROM rollup_state WHERE name = ?", rollupName,
+	).Scan(&until)
+	if err == sql.ErrNoRows {
+		return time.Time{}, nil
+	}
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.Parse("2006-01-02 15:04:05", until)
+}
+
+func (db *Database) setRolledUntil(until time.Time) error {
+	tx, err := db.sqlDB.Begin()
+	if err != nil {
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM rollup_state WHERE name = ?", rollupName); err != nil {
+		tx.Rollback()
+		return err
+	}
+	_, err = tx.Exec(
+		"INSERT INTO rollup_state (name, rolled_until) VALUES (?, ?)",
+		rollupName, until.UTC().Format("2006-01-02 15:04:05"),
+	)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// RollupHours recomputes the rollups of the hours in [from, to) from the
+// raw tables, replacing what was there, so it can be run again safely
+func (db *Database) RollupHours(from, to time.Time) error {
+	from = from.UTC().Truncate(time.Hour)
+	if t := to.UTC().Truncate(time.Hour); t.Before(to) {
+		to = t.Add(time.Hour)
+	}
+	for start := from; start.Before(to); start = start.Add(rollupChunk) {
+		end := start.Add(rollupChunk)
+		if end.After(to) {
+			end = to
+		}
+		if err := db.rollupRange(start, end); err != nil {
+			return fmt.Errorf("rolling up %s: %v", start.Format("2006-01-02 15:04"), err)
+		}
+	}
+	return nil
+}
+
+func (db *Database) rollupRange(from, to time.Time) error {
+	var facts []string
+	var args []interface{}
+	for _, fact := range reportFacts {
+		query, factArgs := db.factQuery(fact, rollupDimensions, db.hourStart, nil, from, to)
+		facts = append(facts, query)
+		args = append(args, factArgs...)
+	}
+
+	tx, err := db.sqlDB.Begin()
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(
+		"DELETE FROM stats_hourly WHERE hour >= ? AND hour < ?",
+		from.Format("2006-01-02 15:04:05"), to.Format("2006-01-02 15:04:05"),
+	)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	_, err = tx.Exec(`
+		INSERT INTO stats_hourly (
+			campaign_id, offer_id, lander_id, country, device, hour,
+			visits, clicks, conversions, revenue, cost, bot_visits, bot_clicks
+		) `+groupedQuery(facts, len(rollupDimensions), true), args...)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// UpdateRollups rolls up the whole hours before now that weren't yet,
+// redoing the last lookback of rolled up hours to pick up late clicks and
+// conversions. The first run backfills everything.
+func (db *Database) UpdateRollups(now time.Time, lookback time.Duration) error {
+	until := now.UTC().Truncate(time.Hour)
+	rolledUntil, err := db.RolledUntil()
+	if err != nil {
+		return err
+	}
+
+	from := rolledUntil.Add(-lookback)
+	if rolledUntil.IsZero() {
+		if from, err = db.firstFact(until); err != nil {
+			return err
+		}
+	}
+	if err := db.RollupHours(from, until); err != nil {
+		return err
+	}
+	if until.After(rolledUntil) {
+		return db.setRolledUntil(until)
+	}
+	return nil
+}
+
+// RebuildRollups recomputes the rollups of [from, to) from the raw tables.
+// A zero from rebuilds everything, a zero to goes up to the current hour.
+func (db *Database) RebuildRollups(from, to time.Time) error {
+	full := from.IsZero()
+	now := time.Now().UTC().Truncate(time.Hour)
+	if to.IsZero() || to.After(now) {
+		to = now
+	}
+	if full {
+		if _, err := db.Exec("DELETE FROM stats_hourly"); err != nil {
+			return err
+		}
+		var err error
+		if from, err = db.firstFact(to); err != nil {
+			return err
+		}
+	}
+	if err := db.RollupHours(from, to); err != nil {
+		return err
+	}
+
+	rolledUntil, err := db.RolledUntil()
+	if err != nil {
+		return err
+	}
+	// Only move rolled_until if no hours before from are left out
+	if to.After(rolledUntil) && (full || !from.After(rolledUntil)) {
+		return db.setRolledUntil(to)
+	}
+	return nil
+}
+
+// refreshRollups rolls up [from, to) again where it's already rolled up,
+// after the raw rows behind it changed
+func (db *Database) refreshRollups(from, to time.Time) {
+	rolledUntil, err := db.RolledUntil()
+	if err == nil && from.Before(rolledUntil) {
+		if to.After(rolledUntil) {
+			to = rolledUntil
+		}
+		err = db.RollupHours(from, to)
+	}
+	if err != nil {
+		log.Printf("Error refreshing rollups: %v", err)
+	}
+}
+
+// firstFact is when the first visit, click or conversion happened, or
+// fallback when there are none
+func (db *Database) firstFact(fallback time.Time) (time.Time, error) {
+	first := fallback
+	for _, table := range []string{"visit", "click", "conversion"} {
+		var min sql.NullString
+		err := db.QueryRow("SELECT " + db.dateTime("MIN(created_at)") + " FROM " + table).Scan(&min)
+		if err != nil {
+			return first, err
+		}
+		if !min.Valid {
+			continue
+		}
+		t, err := time.Parse("2006-01-02 15:04:05", min.String)
+		if err != nil {
+			return first, err
+		}
+		if t.Before(first) {
+			first = t
+		}
+	}
+	return first, nil
+}
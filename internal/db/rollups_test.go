@@ -0,0 +1,75 @@
+package db
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRollups(t *testing.T) {
+	database := newTestDatabase(t)
+
+	now := time.Now().UTC()
+	at := now.Add(-3 * time.Hour)
+	for _, id := range []string{"a", "b"} {
+		database.SaveVisit(&Visit{VisitorID: "v" + id, ClickID: id, CampaignID: "test-campaign", Country: "US", CreatedAt: at})
+		click := &Click{ClickID: id, VisitorID: "v" + id, CampaignToken: "1234567890", CampaignID: "test-campaign", Cost: 1}
+		if err := database.SaveClick(click); err != nil {
+			t.Fatalf("SaveClick: %v", err)
+		}
+	}
+	if _, err := database.Exec("UPDATE click SET created_at = ?", at.Format("2006-01-02 15:04:05")); err != nil {
+		t.Fatalf("backdating clicks: %v", err)
+	}
+	conversion := &Conversion{VisitorID: "va", ClickID: "a", CampaignID: "test-campaign", Amount: 10, Status: "pending", CreatedAt: at}
+	if err := database.SaveConversion(conversion); err != nil {
+		t.Fatalf("SaveConversion: %v", err)
+	}
+
+	q := ReportQuery{
+		GroupBy: []string{"campaign", "country", DimensionHour},
+		From:    now.Truncate(time.Hour).Add(-24 * time.Hour),
+		To:      now.Truncate(time.Hour).Add(time.Hour),
+	}
+	check := func(step string, clicks int64, revenue float64) {
+		t.Helper()
+		report, err := database.RunReport(q)
+		if err != nil {
+			t.Fatalf("%s: RunReport: %v", step, err)
+		}
+		if report.Totals.Clicks != clicks || report.Totals.Revenue != revenue || len(report.Rows) > 1 {
+			t.Errorf("%s: report = %+v", step, report)
+		}
+		if clicks > 0 && report.Rows[0].Dimensions["country"] != "US" {
+			t.Errorf("%s: rows = %+v", step, report.Rows)
+		}
+	}
+	check("raw", 2, 10)
+
+	// Rolling up twice must not count anything twice
+	for i := 0; i < 2; i++ {
+		if err := database.UpdateRollups(now, 48*time.Hour); err != nil {
+			t.Fatalf("UpdateRollups: %v", err)
+		}
+	}
+	if until, err := database.RolledUntil(); err != nil || !until.Equal(now.Truncate(time.Hour)) {
+		t.Fatalf("RolledUntil = %v, %v", until, err)
+	}
+	check("rolled up", 2, 10)
+
+	// Status changes of rolled up conversions are rolled up again
+	if err := database.UpdateConversionStatus(conversion, "rejected", 10, "test"); err != nil {
+		t.Fatalf("UpdateConversionStatus: %v", err)
+	}
+	check("rejected", 2, 0)
+
+	// Rolled up hours are read from the rollups, not the raw tables
+	if _, err := database.Exec("DELETE FROM click"); err != nil {
+		t.Fatalf("deleting clicks: %v", err)
+	}
+	check("from rollups", 2, 0)
+
+	if err := database.RebuildRollups(time.Time{}, time.Time{}); err != nil {
+		t.Fatalf("RebuildRollups: %v", err)
+	}
+	check("rebuilt", 0, 0)
+}
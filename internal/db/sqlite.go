@@ -0,0 +1,75 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+
+	_ "modernc.org/sqlite"
+)
+
+// connectSQLite opens (and creates if needed) an embedded SQLite database.
+// path may be a file name or ":memory:".
+func connectSQLite(path string) (*Database, error) {
+	if path == "" {
+		return nil, fmt.Errorf("missing SQLite database path")
+	}
+
+	dsn := path
+	if strings.Contains(dsn, "?") {
+		dsn += "&"
+	} else {
+		dsn += "?"
+	}
+	// Enforce foreign keys like InnoDB does, wait on locks instead of failing
+	// and store time.Time values in a layout SQLite's date functions understand
+	dsn += "_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)&_time_format=sqlite"
+
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	if strings.HasPrefix(path, ":memory:") {
+		// Every connection to :memory: is a separate database
+		db.SetMaxOpenConns(1)
+	} else if _, err := db.Exec("PRAGMA journal_mode=WAL"); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("error enabling WAL: %v", err)
+	}
+
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return &Database{sqlDB: db, driver: DriverSQLite}, nil
+}
+
+// dateTime returns an SQL expression rendering the DATETIME expr as
+// "2006-01-02 15:04:05", the layout the query helpers parse.
+func (db *Database) dateTime(expr string) string {
+	if db.driver == DriverSQLite {
+		return fmt.Sprintf("strftime('%%Y-%%m-%%d %%H:%%M:%%S', %s)", expr)
+	}
+	return fmt.Sprintf("DATE_FORMAT(%s, '%%Y-%%m-%%d %%H:%%i:%%s')", expr)
+}
+
+// hourStart renders the DATETIME expr truncated to the hour, in the
+// dateTime layout
+func (db *Database) hourStart(expr string) string {
+	if db.driver == DriverSQLite {
+		return fmt.Sprintf("strftime('%%Y-%%m-%%d %%H:00:00', %s)", expr)
+	}
+	return fmt.Sprintf("DATE_FORMAT(%s, '%%Y-%%m-%%d %%H:00:00')", expr)
+}
+
+// quarterHourStart renders the DATETIME expr truncated to the quarter
+// hour, in the dateTime layout. Every timezone's offset is a multiple of
+// a quarter hour.
+func (db *Database) quarterHourStart(expr string) string {
+	if db.driver == DriverSQLite {
+		return fmt.Sprintf("strftime('%%Y-%%m-%%d %%H:', %s) || printf('%%02d', CAST(strftime('%%M', %s) AS INTEGER) / 15 * 15) || ':00'", expr, expr)
+	}
+	return fmt.Sprintf("DATE_FORMAT(DATE_SUB(%s, INTERVAL MINUTE(%s) %% 15 MINUTE), '%%Y-%%m-%%d %%H:%%i:00')", expr, expr)
+}
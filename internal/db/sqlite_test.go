@@ -0,0 +1,109 @@
+package db
+
+import (
+	"testing"
+	"time"
+
+	"unchained-tracker/internal/db/migrations"
+)
+
+func newTestDatabase(t *testing.T) *Database {
+	t.Helper()
+
+	database, err := Connect("sqlite::memory:")
+	if err != nil {
+		t.Fatalf("Error opening database: %v", err)
+	}
+	t.Cleanup(func() { database.Close() })
+
+	if err := migrations.Run(database.DB(), database.Driver()); err != nil {
+		t.Fatalf("Error running migrations: %v", err)
+	}
+	return database
+}
+
+func TestSQLiteCampaignStats(t *testing.T) {
+	database := newTestDatabase(t)
+
+	campaign := &Campaign{
+		Name:          "Summer",
+		CampaignID:    "summer",
+		OfferURL:      "https://offer.example/lp",
+		TrafficSource: "facebook",
+		CreatedAt:     time.Now(),
+	}
+	if err := database.SaveCampaign(campaign); err != nil {
+		t.Fatalf("SaveCampaign: %v", err)
+	}
+
+	visit := &Visit{VisitorID: "v1", ClickID: "c1", CampaignID: "summer", CreatedAt: time.Now()}
+	if err := database.SaveVisit(visit); err != nil {
+		t.Fatalf("SaveVisit: %v", err)
+	}
+	conversion := &Conversion{VisitorID: "v1", ClickID: "c1", CampaignID: "summer", Amount: 12.5, Status: "completed", CreatedAt: time.Now()}
+	if err := database.SaveConversion(conversion); err != nil {
+		t.Fatalf("SaveConversion: %v", err)
+	}
+
+	stats, err := database.GetCampaignStats(TimeRange{})
+	if err != nil {
+		t.Fatalf("GetCampaignStats: %v", err)
+	}
+	var found *CampaignStats
+	for i := range stats {
+		if stats[i].CampaignID == "summer" {
+			found = &stats[i]
+		}
+	}
+	if found == nil {
+		t.Fatalf("campaign missing from stats: %+v", stats)
+	}
+	if found.Visits != 1 || found.Conversions != 1 || found.Revenue != 12.5 {
+		t.Errorf("unexpected stats: %+v", found)
+	}
+
+	got, err := database.GetVisitByClickID("c1")
+	if err != nil {
+		t.Fatalf("GetVisitByClickID: %v", err)
+	}
+	if time.Since(got.CreatedAt) > time.Hour {
+		t.Errorf("created_at not round-tripped: %v", got.CreatedAt)
+	}
+
+	recent, err := database.GetRecentVisitsWithConversions(10)
+	if err != nil {
+		t.Fatalf("GetRecentVisitsWithConversions: %v", err)
+	}
+	if len(recent) != 1 || len(recent[0].Conversions) != 1 {
+		t.Errorf("unexpected recent visits: %+v", recent)
+	}
+}
+
+func TestSQLiteDebugQueries(t *testing.T) {
+	database := newTestDatabase(t)
+
+	visitedAt := time.Now().Add(-time.Minute)
+	click := &Click{ClickID: "c1", VisitorID: "v1", CampaignToken: "1234567890", CampaignID: "test-campaign"}
+	if err := database.SaveClick(click); err != nil {
+		t.Fatalf("SaveClick: %v", err)
+	}
+	database.SaveVisit(&Visit{VisitorID: "v1", ClickID: "c1", CampaignID: "test-campaign", CreatedAt: visitedAt})
+	database.SaveConversion(&Conversion{VisitorID: "v1", ClickID: "c1", CampaignID: "test-campaign", Amount: 4, CreatedAt: visitedAt.Add(30 * time.Second)})
+
+	visits, err := database.DebugVisits(10)
+	if err != nil || len(visits) != 1 || visits[0]["conversion_count"] != int64(1) {
+		t.Fatalf("DebugVisits = %v, %v", visits, err)
+	}
+	conversions, err := database.DebugConversions(10)
+	if err != nil || len(conversions) != 1 || conversions[0]["seconds_to_convert"] != int64(30) {
+		t.Fatalf("DebugConversions = %v, %v", conversions, err)
+	}
+	clicks, err := database.DebugClicks(10)
+	if err != nil || len(clicks) != 1 || clicks[0]["click_id"] != "c1" {
+		t.Fatalf("DebugClicks = %v, %v", clicks, err)
+	}
+	last, count, err := database.RecentActivity("conversion", time.Now().Add(-time.Hour))
+	if err != nil || count != 1 || last == nil {
+		t.Fatalf("RecentActivity = %v, %d, %v", last, count, err)
+	}
+}
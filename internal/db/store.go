@@ -0,0 +1,83 @@
+package db
+
+import (
+	"time"
+)
+
+// Store is the persistence layer used by the HTTP handlers. *Database
+// implements it for both the MySQL and the embedded SQLite backends.
+type Store interface {
+	Close() error
+
+	SaveVisit(v *Visit) error
+	GetVisitsByDate(start, end time.Time) ([]*Visit, error)
+	GetVisitCountSince(t time.Time) (int64, error)
+	GetRecentVisitsWithConversions(limit int) ([]*Visit, error)
+	GetVisitByClickID(clickID string) (*Visit, error)
+	GetVisitByVisitorID(visitorID string) (*Visit, error)
+	GetVisitorIDByClickID(clickID string) (string, error)
+
+	SaveClick(c *Click) error
+	GetClickByID(clickID string) (*Click, error)
+	ClickVelocity(ipAddress, visitorID string, since time.Time) (byIP, byVisitor int64, err error)
+
+	SaveConversion(c *Conversion) error
+	GetConversionsByIDs(convIDsStr string) ([]Conversion, error)
+	GetConversionByID(id int64) (*Conversion, error)
+	GetConversionByTransactionID(network, transactionID string) (*Conversion, error)
+	UpdateConversionStatus(c *Conversion, status string, amount float64, source string) error
+	GetConversionHistory(conversionID int64) ([]ConversionStatusChange, error)
+	CountClickConversions(clickID, conversionType string) (int64, error)
+
+	SaveCampaign(c *Campaign) error
+	DeleteCampaign(campaignID string) error
+	GetCampaignByToken(token string) (*Campaign, error)
+	GetCampaignByID(campaignID string) (*Campaign, error)
+	UpdateCampaign(c *Campaign) error
+	GetCampaignOffers(campaignID string) ([]CampaignOffer, error)
+	SetCampaignOffers(campaignID string, offers []CampaignOffer) error
+	GetOfferStats(campaignID string, r TimeRange) ([]OfferStats, error)
+	DistributeCost(campaignID string, amount float64, start, end time.Time) (int64, error)
+	GetCampaignConnectors(campaignID string) ([]CampaignConnector, error)
+	SetCampaignConnectors(campaignID string, connectors []CampaignConnector) error
+	GetConnectorConversions(connector string, since time.Time, campaignID string) ([]ConnectorConversion, error)
+	GetCampaignPaths(campaignID string) ([]CampaignPath, error)
+	SaveCampaignPath(p *CampaignPath) error
+	DeleteCampaignPath(id int64) error
+	GetSubStats(campaignID string, slot int, r TimeRange) ([]SubStats, error)
+	GetCampaignStats(r TimeRange) ([]CampaignStats, error)
+	GetAllStats() (*FullStats, error)
+	RunReport(q ReportQuery) (*Report, error)
+	ExportLog(log string, q LogQuery) (*LogCursor, error)
+
+	SaveOffer(o *Offer) error
+	GetOffers() ([]*Offer, error)
+
+	GetLandingPages() ([]*LandingPage, error)
+	SaveLandingPage(p *LandingPage) error
+	UpdateLandingPage(p *LandingPage) error
+	DeleteLandingPage(id int64) error
+
+	GetAffiliateNetworks() ([]*AffiliateNetwork, error)
+	GetAffiliateNetworkByName(name string) (*AffiliateNetwork, error)
+	GetAffiliateNetworkByID(id int64) (*AffiliateNetwork, error)
+	SaveAffiliateNetwork(n *AffiliateNetwork) error
+	DeleteAffiliateNetwork(id int64) error
+	SavePostbackRejection(r *PostbackRejection) error
+	GetPostbackRejections(limit int) ([]PostbackRejection, error)
+
+	GetTrafficSources() ([]*TrafficSource, error)
+	GetTrafficSourceByName(name string) (*TrafficSource, error)
+	SaveTrafficSource(t *TrafficSource) error
+	DeleteTrafficSource(id int64) error
+
+	EnqueueDelivery(d *Delivery) error
+	GetDeliveries(status string, conversionID int64, limit int) ([]*Delivery, error)
+	HasDelivery(kind string, conversionID int64) (bool, error)
+	ReplayDelivery(id int64) error
+
+	SaveTrackingDomain(d *TrackingDomain) error
+	GetTrackingDomains() ([]*TrackingDomain, error)
+}
+
+var _ Store = (*Database)(nil)
@@ -0,0 +1,117 @@
+package db
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// subColumns lists the sub1..sub10 columns, each prefixed with prefix
+// (e.g. "c.") when given.
+func subColumns(prefix string) string {
+	cols := make([]string, SubCount)
+	for i := range cols {
+		cols[i] = fmt.Sprintf("%ssub%d", prefix, i+1)
+	}
+	return strings.Join(cols, ", ")
+}
+
+// subPlaceholders returns one "?" per sub column
+func subPlaceholders() string {
+	return strings.TrimSuffix(strings.Repeat("?, ", SubCount), ", ")
+}
+
+// args returns the values in column order for INSERTs
+func (s *Subs) args() []interface{} {
+	args := make([]interface{}, SubCount)
+	for i := range s {
+		args[i] = s[i]
+	}
+	return args
+}
+
+// dests returns scan destinations for subColumns, selected with COALESCE
+func (s *Subs) dests() []interface{} {
+	dests := make([]interface{}, SubCount)
+	for i := range s {
+		dests[i] = &s[i]
+	}
+	return dests
+}
+
+// coalescedSubColumns selects subColumns with NULLs turned into ''
+func coalescedSubColumns(prefix string) string {
+	cols := make([]string, SubCount)
+	for i := range cols {
+		cols[i] = fmt.Sprintf("COALESCE(%ssub%d, '')", prefix, i+1)
+	}
+	return strings.Join(cols, ", ")
+}
+
+func encodeCustomParams(p CustomParams) (string, error) {
+	if len(p) > SubCount {
+		return "", fmt.Errorf("at most %d custom parameters are supported", SubCount)
+	}
+	if len(p) == 0 {
+		return "[]", nil
+	}
+	b, err := json.Marshal(p)
+	return string(b), err
+}
+
+func decodeCustomParams(s string) (CustomParams, error) {
+	if s == "" {
+		return nil, nil
+	}
+	var p CustomParams
+	err := json.Unmarshal([]byte(s), &p)
+	return p, err
+}
+
+// GetSubStats groups a campaign's clicks in r by the value captured in one
+// custom parameter slot (0-based).
+func (db *Database) GetSubStats(campaignID string, slot int, r TimeRange) ([]SubStats, error) {
+	if slot < 0 || slot >= SubCount {
+		return nil, fmt.Errorf("invalid sub slot %d", slot)
+	}
+	column := fmt.Sprintf("cl.sub%d", slot+1)
+	model, bid, err := db.campaignCostModel(campaignID)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, err
+	}
+
+	rangeSQL, rangeArgs := r.where("cl.created_at")
+	query := `
+		SELECT
+			COALESCE(` + column + `, '') as value,
+			COALESCE(SUM(` + humanOnly("cl") + `), 0) as clicks,
+			COALESCE(SUM(conv.conversions), 0) as conversions,
+			COALESCE(SUM(conv.revenue), 0) as revenue,
+			COALESCE(SUM(cl.cost), 0) as cost
+		FROM click cl
+		LEFT JOIN ` + clickConversions + ` conv ON conv.click_id = cl.click_id
+		WHERE cl.campaign_id = ?` + rangeSQL + `
+		GROUP BY COALESCE(` + column + `, '')
+		ORDER BY clicks DESC, value
+	`
+
+	rows, err := db.Query(query, append([]interface{}{campaignID}, rangeArgs...)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var stats []SubStats
+	for rows.Next() {
+		var s SubStats
+		var cost float64
+		if err := rows.Scan(&s.Value, &s.Clicks, &s.Conversions, &s.Revenue, &cost); err != nil {
+			return nil, err
+		}
+		cost += conversionCost(model, bid, s.Conversions, s.Revenue)
+		s.Metrics = NewMetrics(s.Clicks, s.Conversions, s.Revenue, cost)
+		stats = append(stats, s)
+	}
+	return stats, rows.Err()
+}
@@ -0,0 +1,95 @@
+package db
+
+import (
+	"database/sql"
+	"time"
+)
+
+const trafficSourceColumns = `id, name, click_id_param, COALESCE(postback_url, ''), postback_on`
+
+func scanTrafficSource(row interface{ Scan(...interface{}) error }) (*TrafficSource, error) {
+	t := new(TrafficSource)
+	var createdAtStr string
+	err := row.Scan(&t.ID, &t.Name, &t.ClickIDParam, &t.PostbackURL, &t.PostbackOn, &createdAtStr)
+	if err != nil {
+		return nil, err
+	}
+	t.CreatedAt, err = time.Parse("2006-01-02 15:04:05", createdAtStr)
+	if err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+func (db *Database) GetTrafficSources() ([]*TrafficSource, error) {
+	query := `SELECT ` + trafficSourceColumns + `, ` + db.dateTime("created_at") + `
+		FROM traffic_source
+		ORDER BY name`
+
+	rows, err := db.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var sources []*TrafficSource
+	for rows.Next() {
+		t, err := scanTrafficSource(rows)
+		if err != nil {
+			return nil, err
+		}
+		sources = append(sources, t)
+	}
+	return sources, rows.Err()
+}
+
+// GetTrafficSourceByName looks up a campaign's traffic_source. It returns
+// sql.ErrNoRows for sources that were never set up.
+func (db *Database) GetTrafficSourceByName(name string) (*TrafficSource, error) {
+	query := `SELECT ` + trafficSourceColumns + `, ` + db.dateTime("created_at") + `
+		FROM traffic_source
+		WHERE name = ?`
+	return scanTrafficSource(db.QueryRow(query, name))
+}
+
+// SaveTrafficSource inserts t, or updates it when t.ID is set
+func (db *Database) SaveTrafficSource(t *TrafficSource) error {
+	if t.PostbackOn == "" {
+		t.PostbackOn = PostbackOnCreated
+	}
+
+	if t.ID == 0 {
+		if t.CreatedAt.IsZero() {
+			t.CreatedAt = time.Now().UTC()
+		}
+		result, err := db.Exec(`
+			INSERT INTO traffic_source (name, click_id_param, postback_url, postback_on, created_at)
+			VALUES (?, ?, ?, ?, ?)`,
+			t.Name, t.ClickIDParam, t.PostbackURL, t.PostbackOn, t.CreatedAt,
+		)
+		if err != nil {
+			return err
+		}
+		t.ID, _ = result.LastInsertId()
+		return nil
+	}
+
+	result, err := db.Exec(`
+		UPDATE traffic_source
+		SET name = ?, click_id_param = ?, postback_url = ?, postback_on = ?
+		WHERE id = ?`,
+		t.Name, t.ClickIDParam, t.PostbackURL, t.PostbackOn, t.ID,
+	)
+	if err != nil {
+		return err
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+func (db *Database) DeleteTrafficSource(id int64) error {
+	_, err := db.Exec("DELETE FROM traffic_source WHERE id = ?", id)
+	return err
+}
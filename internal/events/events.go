@@ -0,0 +1,130 @@
+// Package events fans out what the tracker records, as it records it, to
+// live subscribers such as the dashboard's event stream. Events are kept in
+// memory only: a subscriber that falls behind misses events rather than
+// slowing down tracking.
+package events
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Event types
+const (
+	TypeVisit            = "visit"
+	TypeClick            = "click"
+	TypeConversion       = "conversion"
+	TypeConversionStatus = "conversion_status"
+)
+
+// Event is something the tracker recorded. Data is the recorded row.
+type Event struct {
+	Type       string      `json:"type"`
+	CampaignID string      `json:"campaign_id"`
+	Time       time.Time   `json:"time"`
+	Data       interface{} `json:"data"`
+}
+
+// Filter picks the events a subscriber gets. Empty fields match everything.
+type Filter struct {
+	CampaignIDs []string
+	Types       []string
+}
+
+func (f Filter) matches(e Event) bool {
+	return (len(f.CampaignIDs) == 0 || contains(f.CampaignIDs, e.CampaignID)) &&
+		(len(f.Types) == 0 || contains(f.Types, e.Type))
+}
+
+func contains(values []string, v string) bool {
+	for _, value := range values {
+		if value == v {
+			return true
+		}
+	}
+	return false
+}
+
+// DefaultBuffer is how many events a subscriber can fall behind by before
+// it misses events
+const DefaultBuffer = 256
+
+// Bus delivers published events to its subscribers
+type Bus struct {
+	mu   sync.RWMutex
+	subs map[*Subscription]struct{}
+}
+
+func NewBus() *Bus {
+	return &Bus{subs: make(map[*Subscription]struct{})}
+}
+
+// Publish hands e to the subscribers it matches. It never blocks: a
+// subscriber whose buffer is full misses e, which its Dropped count tells.
+func (b *Bus) Publish(e Event) {
+	if e.Time.IsZero() {
+		e.Time = time.Now().UTC()
+	}
+
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	for sub := range b.subs {
+		if !sub.filter.matches(e) {
+			continue
+		}
+		select {
+		case sub.ch <- e:
+		default:
+			sub.dropped.Add(1)
+		}
+	}
+}
+
+// Subscribe starts receiving the events matching filter on the returned
+// subscription's C, buffering up to buffer of them (DefaultBuffer if 0)
+func (b *Bus) Subscribe(filter Filter, buffer int) *Subscription {
+	if buffer <= 0 {
+		buffer = DefaultBuffer
+	}
+	sub := &Subscription{bus: b, filter: filter, ch: make(chan Event, buffer)}
+	sub.C = sub.ch
+
+	b.mu.Lock()
+	b.subs[sub] = struct{}{}
+	b.mu.Unlock()
+	return sub
+}
+
+// Subscribers is how many subscriptions are open
+func (b *Bus) Subscribers() int {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return len(b.subs)
+}
+
+// Subscription is a subscriber's feed of events
+type Subscription struct {
+	C <-chan Event
+
+	bus     *Bus
+	filter  Filter
+	ch      chan Event
+	dropped atomic.Int64
+	once    sync.Once
+}
+
+// Dropped is how many events were missed because C was full
+func (s *Subscription) Dropped() int64 {
+	return s.dropped.Load()
+}
+
+// Close stops the subscription and closes C
+func (s *Subscription) Close() {
+	s.once.Do(func() {
+		s.bus.mu.Lock()
+		delete(s.bus.subs, s)
+		s.bus.mu.Unlock()
+		close(s.ch)
+	})
+}
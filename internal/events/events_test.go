@@ -0,0 +1,34 @@
+package events
+
+import "testing"
+
+func TestBus(t *testing.T) {
+	bus := NewBus()
+	all := bus.Subscribe(Filter{}, 0)
+	clicks := bus.Subscribe(Filter{CampaignIDs: []string{"a"}, Types: []string{TypeClick}}, 1)
+
+	bus.Publish(Event{Type: TypeClick, CampaignID: "a"})
+	bus.Publish(Event{Type: TypeVisit, CampaignID: "a"})
+	bus.Publish(Event{Type: TypeClick, CampaignID: "b"})
+	bus.Publish(Event{Type: TypeClick, CampaignID: "a"})
+
+	if len(all.C) != 4 {
+		t.Errorf("unfiltered subscriber got %d events, want 4", len(all.C))
+	}
+	if e := <-clicks.C; e.Type != TypeClick || e.CampaignID != "a" || e.Time.IsZero() {
+		t.Errorf("filtered subscriber got %+v", e)
+	}
+	if len(clicks.C) != 0 || clicks.Dropped() != 1 {
+		t.Errorf("full subscriber has %d events and dropped %d, want 0 and 1", len(clicks.C), clicks.Dropped())
+	}
+
+	clicks.Close()
+	clicks.Close()
+	if _, open := <-clicks.C; open {
+		t.Error("closed subscription still open")
+	}
+	bus.Publish(Event{Type: TypeClick, CampaignID: "a"})
+	if bus.Subscribers() != 1 {
+		t.Errorf("%d subscribers after Close, want 1", bus.Subscribers())
+	}
+}
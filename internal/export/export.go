@@ -0,0 +1,83 @@
+// Package export writes tabular exports as CSV or XLSX while the rows are
+// read, without holding them in memory.
+package export
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strings"
+
+	"unchained-tracker/internal/db"
+)
+
+// Export formats
+const (
+	FormatCSV  = "csv"
+	FormatXLSX = "xlsx"
+)
+
+// Writer writes the rows of an export. Close finishes the file; it doesn't
+// close the underlying writer.
+type Writer interface {
+	WriteRow(values []string) error
+	Close() error
+}
+
+// New writes the header of an export in format to w and returns the writer
+// for its rows
+func New(w io.Writer, format string, columns []db.ExportColumn) (Writer, error) {
+	switch format {
+	case FormatCSV:
+		return newCSV(w, columns)
+	case FormatXLSX:
+		return newXLSX(w, columns)
+	}
+	return nil, fmt.Errorf("unknown export format %q", format)
+}
+
+// ContentType is the MIME type of a format
+func ContentType(format string) string {
+	if format == FormatXLSX {
+		return "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+	}
+	return "text/csv; charset=utf-8"
+}
+
+type csvWriter struct {
+	w       *csv.Writer
+	columns []db.ExportColumn
+	row     []string
+}
+
+func newCSV(w io.Writer, columns []db.ExportColumn) (*csvWriter, error) {
+	c := &csvWriter{w: csv.NewWriter(w), columns: columns, row: make([]string, len(columns))}
+	for i, col := range columns {
+		c.row[i] = col.Name
+	}
+	return c, c.w.Write(c.row)
+}
+
+func (c *csvWriter) WriteRow(values []string) error {
+	for i, v := range values {
+		if !c.columns[i].Numeric {
+			v = escapeFormula(v)
+		}
+		c.row[i] = v
+	}
+	return c.w.Write(c.row)
+}
+
+func (c *csvWriter) Close() error {
+	c.w.Flush()
+	return c.w.Error()
+}
+
+// escapeFormula keeps spreadsheets from running text that looks like a
+// formula, such as a sub value sent by a traffic source
+func escapeFormula(v string) string {
+	if v != "" && strings.ContainsRune("=+-@\t\r", rune(v[0])) {
+		return "'" + v
+	}
+	return v
+}
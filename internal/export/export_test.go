@@ -0,0 +1,70 @@
+package export
+
+import (
+	"archive/zip"
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+
+	"unchained-tracker/internal/db"
+)
+
+var testColumns = []db.ExportColumn{{Name: "sub1"}, {Name: "cost", Numeric: true}}
+
+func TestCSV(t *testing.T) {
+	var buf bytes.Buffer
+	w, err := New(&buf, FormatCSV, testColumns)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	w.WriteRow([]string{"=HYPERLINK(\"http://evil\")", "-1.5"})
+	w.WriteRow([]string{"zone 7", "0.25"})
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	want := "sub1,cost\n\"'=HYPERLINK(\"\"http://evil\"\")\",-1.5\nzone 7,0.25\n"
+	if buf.String() != want {
+		t.Errorf("CSV = %q, want %q", buf.String(), want)
+	}
+}
+
+func TestXLSX(t *testing.T) {
+	var buf bytes.Buffer
+	w, err := New(&buf, FormatXLSX, testColumns)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	w.WriteRow([]string{"<b>&", "1.50"})
+	w.WriteRow([]string{"zone 7", "NaN"})
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	archive, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatalf("not a zip: %v", err)
+	}
+	var sheet string
+	for _, f := range archive.File {
+		if f.Name == "xl/worksheets/sheet1.xml" {
+			r, _ := f.Open()
+			b, _ := io.ReadAll(r)
+			sheet = string(b)
+		}
+	}
+	for _, want := range []string{
+		`<t xml:space="preserve">sub1</t>`,
+		`<t xml:space="preserve">&lt;b&gt;&amp;</t>`,
+		`<c><v>1.5</v></c>`,
+		`<t xml:space="preserve">NaN</t>`,
+	} {
+		if !strings.Contains(sheet, want) {
+			t.Errorf("sheet is missing %s:\n%s", want, sheet)
+		}
+	}
+	if len(archive.File) != 5 {
+		t.Errorf("%d parts in the workbook", len(archive.File))
+	}
+}
@@ -0,0 +1,178 @@
+// Package fraud scores clicks and conversions from 0 to 100 on how likely
+// they are to be fraud: click floods from one address or visitor,
+// conversions that come too soon after the click, repeated conversions on
+// one click and a click, visit and conversion that are in different
+// countries. Conversions that score HoldScore or more are held for review.
+package fraud
+
+import (
+	"strings"
+	"time"
+)
+
+// Reasons recorded with a score
+const (
+	ReasonIPVelocity      = "ip_velocity"
+	ReasonVisitorVelocity = "visitor_velocity"
+	ReasonFastConversion  = "fast_conversion"
+	ReasonDuplicateClick  = "duplicate_click"
+	ReasonGeoMismatch     = "geo_mismatch"
+)
+
+// Signal weights
+const (
+	weightIPVelocity      = 40
+	weightIPFlood         = 60
+	weightVisitorVelocity = 30
+	weightFastConversion  = 60
+	weightDuplicateClick  = 40
+	weightGeoMismatch     = 30
+)
+
+// MaxScore is the highest score
+const MaxScore = 100
+
+// Options are the limits clicks and conversions are scored against. Zero
+// values get the defaults.
+type Options struct {
+	// HoldScore is the score at which conversions are held for review
+	HoldScore int
+	// IPClicksPerHour and VisitorClicksPerHour are the most clicks an
+	// address and a visitor make in an hour before it counts against them
+	IPClicksPerHour      int
+	VisitorClicksPerHour int
+	// MinTimeToConvert is the least time a person takes from click to
+	// conversion
+	MinTimeToConvert time.Duration
+}
+
+func (o Options) withDefaults() Options {
+	if o.HoldScore <= 0 {
+		o.HoldScore = 70
+	}
+	if o.IPClicksPerHour <= 0 {
+		o.IPClicksPerHour = 20
+	}
+	if o.VisitorClicksPerHour <= 0 {
+		o.VisitorClicksPerHour = 10
+	}
+	if o.MinTimeToConvert <= 0 {
+		o.MinTimeToConvert = 10 * time.Second
+	}
+	return o
+}
+
+// ClickSignals are what a click is scored on. The counts include the
+// click itself.
+type ClickSignals struct {
+	IPClicks      int64
+	VisitorClicks int64
+}
+
+// ConversionSignals are what a conversion is scored on
+type ConversionSignals struct {
+	// ClickScore and ClickReasons are the score of the conversion's click
+	ClickScore   int
+	ClickReasons string
+	// TimeToConvert is the time since the click, zero when unknown
+	TimeToConvert time.Duration
+	// PriorConversions counts the conversions of the same type already on
+	// the click
+	PriorConversions int64
+	// Countries are where the click, the visit and, for browser
+	// conversions, the conversion came from; unknown ones are empty
+	Countries []string
+}
+
+// Score is a score and why
+type Score struct {
+	Score   int
+	Reasons []string
+}
+
+// Reason joins the reasons into the fraud_reason column
+func (s Score) Reason() string {
+	reason := strings.Join(s.Reasons, ",")
+	if len(reason) > 255 {
+		reason = reason[:255]
+	}
+	return reason
+}
+
+func (s *Score) add(weight int, reason string) {
+	s.Score += weight
+	if s.Score > MaxScore {
+		s.Score = MaxScore
+	}
+	for _, r := range s.Reasons {
+		if r == reason {
+			return
+		}
+	}
+	s.Reasons = append(s.Reasons, reason)
+}
+
+// Scorer scores clicks and conversions against its options
+type Scorer struct {
+	opts Options
+}
+
+func NewScorer(opts Options) *Scorer {
+	return &Scorer{opts: opts.withDefaults()}
+}
+
+// Hold reports whether a conversion with score s waits for review
+func (sc *Scorer) Hold(s Score) bool {
+	return s.Score >= sc.opts.HoldScore
+}
+
+// ScoreClick scores a click on how many clicks its address and visitor
+// made in the last hour. Floods of five times the limit score higher.
+func (sc *Scorer) ScoreClick(c ClickSignals) Score {
+	var s Score
+	switch limit := int64(sc.opts.IPClicksPerHour); {
+	case c.IPClicks > 5*limit:
+		s.add(weightIPFlood, ReasonIPVelocity)
+	case c.IPClicks > limit:
+		s.add(weightIPVelocity, ReasonIPVelocity)
+	}
+	if c.VisitorClicks > int64(sc.opts.VisitorClicksPerHour) {
+		s.add(weightVisitorVelocity, ReasonVisitorVelocity)
+	}
+	return s
+}
+
+// ScoreConversion scores a conversion on top of its click's score
+func (sc *Scorer) ScoreConversion(c ConversionSignals) Score {
+	s := Score{Score: c.ClickScore}
+	if c.ClickReasons != "" {
+		s.Reasons = strings.Split(c.ClickReasons, ",")
+	}
+	if c.TimeToConvert > 0 && c.TimeToConvert < sc.opts.MinTimeToConvert {
+		s.add(weightFastConversion, ReasonFastConversion)
+	}
+	if c.PriorConversions > 0 {
+		s.add(weightDuplicateClick, ReasonDuplicateClick)
+	}
+	if mismatch(c.Countries) {
+		s.add(weightGeoMismatch, ReasonGeoMismatch)
+	}
+	return s
+}
+
+// mismatch reports whether the known countries differ. Private addresses
+// are located in LO and don't count.
+func mismatch(countries []string) bool {
+	var first string
+	for _, country := range countries {
+		if country == "" || country == "LO" {
+			continue
+		}
+		if first == "" {
+			first = country
+		} else if country != first {
+			return true
+		}
+	}
+	return false
+}
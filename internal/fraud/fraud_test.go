@@ -0,0 +1,54 @@
+package fraud
+
+import (
+	"testing"
+	"time"
+)
+
+func TestScoreClick(t *testing.T) {
+	sc := NewScorer(Options{})
+	tests := []struct {
+		signals ClickSignals
+		score   int
+		reason  string
+	}{
+		{ClickSignals{IPClicks: 1, VisitorClicks: 1}, 0, ""},
+		{ClickSignals{IPClicks: 20, VisitorClicks: 10}, 0, ""},
+		{ClickSignals{IPClicks: 21, VisitorClicks: 1}, 40, ReasonIPVelocity},
+		{ClickSignals{IPClicks: 101, VisitorClicks: 1}, 60, ReasonIPVelocity},
+		{ClickSignals{IPClicks: 101, VisitorClicks: 11}, 90, "ip_velocity,visitor_velocity"},
+	}
+	for _, tt := range tests {
+		s := sc.ScoreClick(tt.signals)
+		if s.Score != tt.score || s.Reason() != tt.reason {
+			t.Errorf("ScoreClick(%+v) = %d %q, want %d %q", tt.signals, s.Score, s.Reason(), tt.score, tt.reason)
+		}
+	}
+}
+
+func TestScoreConversion(t *testing.T) {
+	sc := NewScorer(Options{HoldScore: 50})
+	tests := []struct {
+		name    string
+		signals ConversionSignals
+		score   int
+		reason  string
+		hold    bool
+	}{
+		{"clean", ConversionSignals{TimeToConvert: time.Minute, Countries: []string{"GB", "GB", ""}}, 0, "", false},
+		{"local addresses", ConversionSignals{TimeToConvert: time.Minute, Countries: []string{"LO", "GB"}}, 0, "", false},
+		{"unknown time", ConversionSignals{}, 0, "", false},
+		{"fast", ConversionSignals{TimeToConvert: 3 * time.Second}, 60, ReasonFastConversion, true},
+		{"second conversion", ConversionSignals{TimeToConvert: time.Hour, PriorConversions: 1}, 40, ReasonDuplicateClick, false},
+		{"elsewhere", ConversionSignals{TimeToConvert: time.Hour, Countries: []string{"GB", "", "VN"}}, 30, ReasonGeoMismatch, false},
+		{"flooded click", ConversionSignals{ClickScore: 60, ClickReasons: "ip_velocity", TimeToConvert: 2 * time.Second, PriorConversions: 2}, 100,
+			"ip_velocity,fast_conversion,duplicate_click", true},
+	}
+	for _, tt := range tests {
+		s := sc.ScoreConversion(tt.signals)
+		if s.Score != tt.score || s.Reason() != tt.reason || sc.Hold(s) != tt.hold {
+			t.Errorf("%s: ScoreConversion = %d %q hold %v, want %d %q hold %v",
+				tt.name, s.Score, s.Reason(), sc.Hold(s), tt.score, tt.reason, tt.hold)
+		}
+	}
+}
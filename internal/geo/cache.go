@@ -0,0 +1,59 @@
+package geo
+
+import (
+	"container/list"
+	"sync"
+)
+
+// cache keeps the most recently looked up locations, up to size of them
+type cache struct {
+	mu    sync.Mutex
+	size  int
+	order *list.List // of *cacheEntry, most recently used first
+	items map[string]*list.Element
+}
+
+type cacheEntry struct {
+	ip  string
+	loc Location
+}
+
+func newCache(size int) *cache {
+	return &cache{size: size, order: list.New(), items: make(map[string]*list.Element)}
+}
+
+// get returns a copy of the cached location of ip
+func (c *cache) get(ip string) (*Location, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	el, ok := c.items[ip]
+	if !ok {
+		return nil, false
+	}
+	c.order.MoveToFront(el)
+	loc := el.Value.(*cacheEntry).loc
+	return &loc, true
+}
+
+func (c *cache) add(ip string, loc *Location) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.items[ip]; ok {
+		el.Value.(*cacheEntry).loc = *loc
+		c.order.MoveToFront(el)
+		return
+	}
+	c.items[ip] = c.order.PushFront(&cacheEntry{ip: ip, loc: *loc})
+	if c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.items, oldest.Value.(*cacheEntry).ip)
+	}
+}
+
+func (c *cache) purge() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.order.Init()
+	c.items = make(map[string]*list.Element)
+}
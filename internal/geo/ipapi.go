@@ -0,0 +1,44 @@
+package geo
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+)
+
+// IPAPI looks addresses up on ip-api.com. It is free and needs no key, but
+// it is rate limited and sees every address it is asked about, so it is
+// only meant as a fallback for the local databases.
+type IPAPI struct {
+	client *http.Client
+}
+
+type ipAPIResponse struct {
+	Country  string `json:"countryCode"`
+	Region   string `json:"regionName"`
+	City     string `json:"city"`
+	TimeZone string `json:"timezone"`
+}
+
+func NewIPAPI() *IPAPI {
+	return &IPAPI{client: &http.Client{Timeout: 2 * time.Second}}
+}
+
+func (p *IPAPI) Lookup(ip net.IP) (*Location, error) {
+	resp, err := p.client.Get(fmt.Sprintf("http://ip-api.com/json/%s?fields=countryCode,regionName,city,timezone", ip.String()))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("ip-api.com: %s", resp.Status)
+	}
+
+	var result ipAPIResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, err
+	}
+	return &Location{Country: result.Country, Region: result.Region, City: result.City, TimeZone: result.TimeZone}, nil
+}
@@ -0,0 +1,170 @@
+package geo
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/oschwald/maxminddb-golang"
+)
+
+// The records of the City, ASN/ISP and Connection Type databases, as far
+// as they are used
+type cityRecord struct {
+	Country struct {
+		ISOCode string `maxminddb:"iso_code"`
+	} `maxminddb:"country"`
+	Subdivisions []struct {
+		Names map[string]string `maxminddb:"names"`
+	} `maxminddb:"subdivisions"`
+	City struct {
+		Names map[string]string `maxminddb:"names"`
+	} `maxminddb:"city"`
+	Location struct {
+		TimeZone string `maxminddb:"time_zone"`
+	} `maxminddb:"location"`
+}
+
+type asnRecord struct {
+	ASN          uint   `maxminddb:"autonomous_system_number"`
+	Organization string `maxminddb:"autonomous_system_organization"`
+	// ISP databases name the ISP besides the AS
+	ISP string `maxminddb:"isp"`
+}
+
+type connectionTypeRecord struct {
+	ConnectionType string `maxminddb:"connection_type"`
+}
+
+// database is a .mmdb file, read into memory so that it can be replaced
+// in place without disturbing lookups
+type database struct {
+	path    string
+	modTime time.Time
+	size    int64
+	reader  *maxminddb.Reader
+}
+
+// databases is the Provider of the local databases
+type databases struct {
+	mu             sync.RWMutex
+	city           *database
+	asn            *database
+	connectionType *database
+}
+
+func newDatabases(city, asn, connectionType string) *databases {
+	open := func(path string) *database {
+		if path == "" {
+			return nil
+		}
+		return &database{path: path}
+	}
+	return &databases{city: open(city), asn: open(asn), connectionType: open(connectionType)}
+}
+
+func (d *databases) all() []*database {
+	var all []*database
+	for _, db := range []*database{d.city, d.asn, d.connectionType} {
+		if db != nil {
+			all = append(all, db)
+		}
+	}
+	return all
+}
+
+// missing lists the files that aren't loaded
+func (d *databases) missing() []string {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	var paths []string
+	for _, db := range d.all() {
+		if db.reader == nil {
+			paths = append(paths, db.path)
+		}
+	}
+	return paths
+}
+
+// reload reads the files whose size or modification time changed and
+// returns their paths. A file that can't be read leaves the database as
+// it was.
+func (d *databases) reload() ([]string, error) {
+	var reloaded []string
+	var errs []error
+	for _, db := range d.all() {
+		info, err := os.Stat(db.path)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+
+		d.mu.RLock()
+		unchanged := info.ModTime().Equal(db.modTime) && info.Size() == db.size
+		d.mu.RUnlock()
+		if unchanged {
+			continue
+		}
+
+		data, err := os.ReadFile(db.path)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		reader, err := maxminddb.FromBytes(data)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", db.path, err))
+			continue
+		}
+
+		d.mu.Lock()
+		db.reader, db.modTime, db.size = reader, info.ModTime(), info.Size()
+		d.mu.Unlock()
+		reloaded = append(reloaded, db.path)
+	}
+	return reloaded, errors.Join(errs...)
+}
+
+func (d *databases) Lookup(ip net.IP) (*Location, error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	loc := &Location{}
+	if d.city != nil && d.city.reader != nil {
+		var record cityRecord
+		if err := d.city.reader.Lookup(ip, &record); err != nil {
+			return nil, err
+		}
+		loc.Country = record.Country.ISOCode
+		if len(record.Subdivisions) > 0 {
+			loc.Region = record.Subdivisions[0].Names["en"]
+		}
+		loc.City = record.City.Names["en"]
+		loc.TimeZone = record.Location.TimeZone
+	}
+	if d.asn != nil && d.asn.reader != nil {
+		var record asnRecord
+		if err := d.asn.reader.Lookup(ip, &record); err != nil {
+			return nil, err
+		}
+		loc.ASN, loc.ISP = record.ASN, record.ISP
+		if loc.ISP == "" {
+			loc.ISP = record.Organization
+		}
+	}
+	if d.connectionType != nil && d.connectionType.reader != nil {
+		var record connectionTypeRecord
+		if err := d.connectionType.reader.Lookup(ip, &record); err != nil {
+			return nil, err
+		}
+		loc.ConnectionType = record.ConnectionType
+	}
+	return loc, nil
+}
@@ -1,63 +1,177 @@
+// Package geo locates visitors by IP address using local MaxMind databases:
+// a City (or Country) database, and optionally an ASN or ISP database and a
+// Connection Type database. Databases are reloaded when their files change,
+// lookups are cached, and an HTTP provider can fill in what the local
+// databases don't know.
 package geo
 
 import (
-    "encoding/json"
-    "fmt"
-    "net"
-    "net/http"
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"time"
 )
 
+// Location is what is known about where an IP address is
+type Location struct {
+	Country string
+	Region  string
+	City    string
+	// TimeZone is the IANA time zone of the location, e.g. Europe/London
+	TimeZone string
+	// ASN and ISP are the network the address belongs to, from the ASN or
+	// ISP database
+	ASN uint
+	ISP string
+	// ConnectionType is Cable/DSL, Cellular, Corporate or Satellite, from
+	// the Connection Type database
+	ConnectionType string
+}
+
+// local is the location of private and loopback addresses
+var local = Location{Country: "LO", Region: "Local", City: "Local"}
+
+// Provider looks up IP addresses. A location without a country means the
+// provider doesn't know the address.
+type Provider interface {
+	Lookup(ip net.IP) (*Location, error)
+}
+
+// Options configure the service. Empty database paths are skipped, and
+// zero values get the defaults.
+type Options struct {
+	CityDB           string
+	ASNDB            string
+	ConnectionTypeDB string
+	// Fallback is asked for the addresses the local databases can't place
+	// in a country
+	Fallback       Provider
+	CacheSize      int
+	ReloadInterval time.Duration
+}
+
+// Service looks up IP addresses in the local databases, then the fallback
 type Service struct {
-    client *http.Client
+	databases *databases
+	fallback  Provider
+	cache     *cache
+	opts      Options
+}
+
+// NewService opens the databases in opts. Files that don't exist yet are
+// picked up by Run once they appear. The returned error lists databases
+// that couldn't be read; the service works without them.
+func NewService(opts Options) (*Service, error) {
+	if opts.CacheSize <= 0 {
+		opts.CacheSize = 10000
+	}
+	if opts.ReloadInterval <= 0 {
+		opts.ReloadInterval = time.Minute
+	}
+
+	s := &Service{
+		databases: newDatabases(opts.CityDB, opts.ASNDB, opts.ConnectionTypeDB),
+		fallback:  opts.Fallback,
+		cache:     newCache(opts.CacheSize),
+		opts:      opts,
+	}
+	_, err := s.Reload()
+	for _, path := range s.databases.missing() {
+		log.Printf("GeoIP database %s not found, looking up without it", path)
+	}
+	return s, err
 }
 
-type ipAPIResponse struct {
-    Country     string `json:"country_code"`
-    Region      string `json:"region"`
-    City        string `json:"city"`
+// Run reloads changed databases every reload interval until ctx is done
+func (s *Service) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.opts.ReloadInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if _, err := s.Reload(); err != nil {
+			log.Printf("Error reloading GeoIP databases: %v", err)
+		}
+	}
 }
 
-func NewService(_ string) (*Service, error) {
-    return &Service{
-        client: &http.Client{},
-    }, nil
+// Reload reads the database files that changed since they were last read
+// and clears the cache if any did
+func (s *Service) Reload() (bool, error) {
+	reloaded, err := s.databases.reload()
+	for _, path := range reloaded {
+		log.Printf("Loaded GeoIP database %s", path)
+	}
+	if len(reloaded) > 0 {
+		s.cache.purge()
+	}
+	return len(reloaded) > 0, err
 }
 
 func (s *Service) Close() {
-    // Nothing to close with HTTP client
+	// Databases are read into memory, so there is nothing to close
 }
 
+// Lookup locates an IP address, with or without a port
+func (s *Service) Lookup(ipStr string) (*Location, error) {
+	ip, err := parseIP(ipStr)
+	if err != nil {
+		return nil, err
+	}
+
+	// Don't lookup location for private/local IPs
+	if ip.IsPrivate() || ip.IsLoopback() {
+		loc := local
+		return &loc, nil
+	}
+
+	key := ip.String()
+	if loc, ok := s.cache.get(key); ok {
+		return loc, nil
+	}
+
+	loc, err := s.databases.Lookup(ip)
+	if err != nil {
+		return nil, err
+	}
+	if loc.Country == "" && s.fallback != nil {
+		found, err := s.fallback.Lookup(ip)
+		if err != nil {
+			// Not cached, so the fallback is asked again next time
+			return loc, err
+		}
+		loc.Country, loc.Region, loc.City, loc.TimeZone = found.Country, found.Region, found.City, found.TimeZone
+	}
+	s.cache.add(key, loc)
+	return loc, nil
+}
+
+// GetLocation returns the country code, region and city of an IP address
 func (s *Service) GetLocation(ipStr string) (string, string, string, error) {
-    // Clean IP address (remove port if present)
-    ip := net.ParseIP(ipStr)
-    if ip == nil {
-        // Try to handle [::1]:port format
-        host, _, err := net.SplitHostPort(ipStr)
-        if err != nil {
-            return "", "", "", fmt.Errorf("invalid IP address: %s", ipStr)
-        }
-        ip = net.ParseIP(host)
-        if ip == nil {
-            return "", "", "", fmt.Errorf("invalid IP address: %s", host)
-        }
-    }
-
-    // Don't lookup location for private/local IPs
-    if ip.IsPrivate() || ip.IsLoopback() {
-        return "LO", "Local", "Local", nil
-    }
-
-    // Use ip-api.com (free, no API key required)
-    resp, err := s.client.Get(fmt.Sprintf("http://ip-api.com/json/%s?fields=country_code,region,city", ip.String()))
-    if err != nil {
-        return "", "", "", err
-    }
-    defer resp.Body.Close()
-
-    var result ipAPIResponse
-    if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
-        return "", "", "", err
-    }
-
-    return result.Country, result.Region, result.City, nil
-} 
\ No newline at end of file
+	loc, err := s.Lookup(ipStr)
+	if loc == nil {
+		return "", "", "", err
+	}
+	return loc.Country, loc.Region, loc.City, err
+}
+
+func parseIP(ipStr string) (net.IP, error) {
+	// Clean IP address (remove port if present)
+	ip := net.ParseIP(ipStr)
+	if ip != nil {
+		return ip, nil
+	}
+	// Try to handle [::1]:port format
+	host, _, err := net.SplitHostPort(ipStr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid IP address: %s", ipStr)
+	}
+	if ip = net.ParseIP(host); ip == nil {
+		return nil, fmt.Errorf("invalid IP address: %s", host)
+	}
+	return ip, nil
+}
@@ -0,0 +1,254 @@
+package geo
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+)
+
+// writeMMDB writes an IPv6 MaxMind database holding records for the given
+// networks, which must not overlap
+func writeMMDB(t *testing.T, path, dbType string, records map[string]map[string]interface{}) {
+	t.Helper()
+
+	type node struct{ next, data [2]int }
+	nodes := []node{{next: [2]int{-1, -1}, data: [2]int{-1, -1}}}
+	var data bytes.Buffer
+
+	cidrs := make([]string, 0, len(records))
+	for cidr := range records {
+		cidrs = append(cidrs, cidr)
+	}
+	sort.Strings(cidrs)
+	for _, cidr := range cidrs {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// IPv4 networks live under ::/96
+		ip := network.IP.To16()
+		bits, _ := network.Mask.Size()
+		if ip4 := network.IP.To4(); ip4 != nil {
+			ip = append(make(net.IP, 12), ip4...)
+			bits += 96
+		}
+		offset := data.Len()
+		encodeMMDB(&data, records[cidr])
+
+		n := 0
+		for i := 0; i < bits; i++ {
+			bit := int(ip[i/8]>>(7-i%8)) & 1
+			if i == bits-1 {
+				nodes[n].data[bit] = offset
+				break
+			}
+			if nodes[n].next[bit] < 0 {
+				nodes = append(nodes, node{next: [2]int{-1, -1}, data: [2]int{-1, -1}})
+				nodes[n].next[bit] = len(nodes) - 1
+			}
+			n = nodes[n].next[bit]
+		}
+	}
+
+	var file bytes.Buffer
+	for _, n := range nodes {
+		for bit := 0; bit < 2; bit++ {
+			record := len(nodes)
+			if n.next[bit] >= 0 {
+				record = n.next[bit]
+			} else if n.data[bit] >= 0 {
+				record = len(nodes) + 16 + n.data[bit]
+			}
+			file.Write([]byte{byte(record >> 16), byte(record >> 8), byte(record)})
+		}
+	}
+	file.Write(make([]byte, 16))
+	file.Write(data.Bytes())
+	file.WriteString("\xab\xcd\xefMaxMind.com")
+	encodeMMDB(&file, map[string]interface{}{
+		"node_count":                  uint32(len(nodes)),
+		"record_size":                 uint32(24),
+		"ip_version":                  uint32(6),
+		"binary_format_major_version": uint32(2),
+		"binary_format_minor_version": uint32(0),
+		"database_type":               dbType,
+		"languages":                   []interface{}{"en"},
+	})
+	if err := os.WriteFile(path, file.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// encodeMMDB writes a value of the MaxMind data section format, for values
+// and containers of up to 284 bytes or 28 entries
+func encodeMMDB(buf *bytes.Buffer, v interface{}) {
+	switch v := v.(type) {
+	case string:
+		if len(v) < 29 {
+			buf.WriteByte(2<<5 | byte(len(v)))
+		} else {
+			buf.Write([]byte{2<<5 | 29, byte(len(v) - 29)})
+		}
+		buf.WriteString(v)
+	case uint32:
+		buf.WriteByte(6<<5 | 4)
+		binary.Write(buf, binary.BigEndian, v)
+	case []interface{}:
+		buf.Write([]byte{byte(len(v)), 11 - 7})
+		for _, item := range v {
+			encodeMMDB(buf, item)
+		}
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		buf.WriteByte(7<<5 | byte(len(v)))
+		for _, k := range keys {
+			encodeMMDB(buf, k)
+			encodeMMDB(buf, v[k])
+		}
+	}
+}
+
+func cityRecordOf(country, region, city string) map[string]interface{} {
+	return map[string]interface{}{
+		"country":      map[string]interface{}{"iso_code": country},
+		"subdivisions": []interface{}{map[string]interface{}{"names": map[string]interface{}{"en": region}}},
+		"city":         map[string]interface{}{"names": map[string]interface{}{"en": city}},
+		"location":     map[string]interface{}{"time_zone": "Europe/London"},
+	}
+}
+
+type fakeProvider struct {
+	calls int
+	err   error
+}
+
+func (p *fakeProvider) Lookup(ip net.IP) (*Location, error) {
+	p.calls++
+	if p.err != nil {
+		return nil, p.err
+	}
+	return &Location{Country: "FR", Region: "Fallback", City: "Paris"}, nil
+}
+
+func TestService(t *testing.T) {
+	dir := t.TempDir()
+	cityDB := filepath.Join(dir, "GeoLite2-City.mmdb")
+	asnDB := filepath.Join(dir, "GeoLite2-ASN.mmdb")
+	writeMMDB(t, cityDB, "GeoLite2-City", map[string]map[string]interface{}{
+		"81.2.69.0/24":  cityRecordOf("GB", "England", "London"),
+		"2a02:c7f::/32": cityRecordOf("GB", "Scotland", "Edinburgh"),
+	})
+	writeMMDB(t, asnDB, "GeoLite2-ASN", map[string]map[string]interface{}{
+		"81.2.69.0/24": {"autonomous_system_number": uint32(15169), "autonomous_system_organization": "GOOGLE"},
+	})
+	writeMMDB(t, filepath.Join(dir, "conn.mmdb"), "GeoIP2-Connection-Type", map[string]map[string]interface{}{
+		"81.2.0.0/16": {"connection_type": "Cable/DSL"},
+	})
+
+	fallback := &fakeProvider{}
+	s, err := NewService(Options{
+		CityDB:           cityDB,
+		ASNDB:            asnDB,
+		ConnectionTypeDB: filepath.Join(dir, "conn.mmdb"),
+		Fallback:         fallback,
+	})
+	if err != nil {
+		t.Fatalf("NewService: %v", err)
+	}
+
+	loc, err := s.Lookup("81.2.69.142:4321")
+	want := Location{Country: "GB", Region: "England", City: "London", TimeZone: "Europe/London", ASN: 15169, ISP: "GOOGLE", ConnectionType: "Cable/DSL"}
+	if err != nil || *loc != want {
+		t.Errorf("Lookup = %+v, %v, want %+v", loc, err, want)
+	}
+	if country, region, city, _ := s.GetLocation("[2a02:c7f:1::1]:443"); country != "GB" || region != "Scotland" || city != "Edinburgh" {
+		t.Errorf("IPv6 GetLocation = %s, %s, %s", country, region, city)
+	}
+	if country, _, _, _ := s.GetLocation("127.0.0.1"); country != "LO" {
+		t.Errorf("loopback country = %s", country)
+	}
+
+	// What the databases don't know is asked of the fallback, once
+	for i := 0; i < 2; i++ {
+		if country, _, _, _ := s.GetLocation("8.8.8.8"); country != "FR" {
+			t.Errorf("fallback country = %s", country)
+		}
+	}
+	if fallback.calls != 1 {
+		t.Errorf("fallback asked %d times, want 1", fallback.calls)
+	}
+	fallback.err = errors.New("rate limited")
+	s.GetLocation("9.9.9.9")
+	s.GetLocation("9.9.9.9")
+	if fallback.calls != 3 {
+		t.Errorf("failed fallback lookups were cached: %d calls, want 3", fallback.calls)
+	}
+
+	// Replacing a database takes effect on reload
+	writeMMDB(t, cityDB, "GeoLite2-City", map[string]map[string]interface{}{
+		"81.2.69.0/24": cityRecordOf("GB", "England", "Manchester"),
+	})
+	later := time.Now().Add(time.Minute)
+	os.Chtimes(cityDB, later, later)
+	if reloaded, err := s.Reload(); !reloaded || err != nil {
+		t.Fatalf("Reload = %v, %v", reloaded, err)
+	}
+	if _, _, city, _ := s.GetLocation("81.2.69.142"); city != "Manchester" {
+		t.Errorf("city after reload = %s", city)
+	}
+	if reloaded, _ := s.Reload(); reloaded {
+		t.Error("unchanged databases were reloaded")
+	}
+
+	// A broken file keeps the database that was loaded
+	os.WriteFile(cityDB, []byte("not a database"), 0o644)
+	os.Chtimes(cityDB, later.Add(time.Minute), later.Add(time.Minute))
+	if _, err := s.Reload(); err == nil {
+		t.Error("no error reloading a broken database")
+	}
+	if _, _, city, _ := s.GetLocation("81.2.69.142"); city != "Manchester" {
+		t.Errorf("city after a failed reload = %s", city)
+	}
+}
+
+func TestServiceWithoutDatabases(t *testing.T) {
+	s, err := NewService(Options{CityDB: filepath.Join(t.TempDir(), "missing.mmdb")})
+	if err != nil {
+		t.Fatalf("NewService: %v", err)
+	}
+	if loc, err := s.Lookup("81.2.69.142"); err != nil || *loc != (Location{}) {
+		t.Errorf("Lookup = %+v, %v", loc, err)
+	}
+	if _, err := s.Lookup("not an ip"); err == nil {
+		t.Error("no error for an invalid address")
+	}
+}
+
+func TestCache(t *testing.T) {
+	c := newCache(2)
+	c.add("a", &Location{City: "A"})
+	c.add("b", &Location{City: "B"})
+	c.get("a")
+	c.add("c", &Location{City: "C"})
+	if _, ok := c.get("b"); ok {
+		t.Error("least recently used entry was kept")
+	}
+	if loc, ok := c.get("a"); !ok || loc.City != "A" {
+		t.Errorf("get(a) = %+v, %v", loc, ok)
+	}
+	loc, _ := c.get("c")
+	loc.City = "changed"
+	if loc, _ := c.get("c"); loc.City != "C" {
+		t.Error("cached location changed through a returned copy")
+	}
+}
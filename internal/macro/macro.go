@@ -0,0 +1,70 @@
+// Package macro expands {placeholder} tokens in URL templates such as offer
+// URLs and postback URLs.
+package macro
+
+import (
+	"net/url"
+	"strings"
+)
+
+// Expand replaces every {name} in template for which values has an entry
+// (names are case-insensitive) with the URL-escaped value. Values in the path
+// are path-escaped, values after the '?' are query-escaped. Placeholders
+// without a value are left untouched, so unrelated braces survive.
+func Expand(template string, values map[string]string) string {
+	var b strings.Builder
+	b.Grow(len(template))
+
+	inQuery := false
+	for i := 0; i < len(template); i++ {
+		c := template[i]
+		switch c {
+		case '?', '#':
+			inQuery = true
+		case '{':
+			end := strings.IndexByte(template[i+1:], '}')
+			if end < 0 {
+				break
+			}
+			name := strings.ToLower(strings.TrimSpace(template[i+1 : i+1+end]))
+			value, ok := values[name]
+			if !ok {
+				break
+			}
+			if inQuery {
+				b.WriteString(url.QueryEscape(value))
+			} else {
+				b.WriteString(url.PathEscape(value))
+			}
+			i += end + 1
+			continue
+		}
+		b.WriteByte(c)
+	}
+	return b.String()
+}
+
+// HasAny reports whether template contains a {placeholder} that values has
+// an entry for, i.e. whether Expand would replace anything. Other braces,
+// such as a literal {x} in a query string, don't count.
+func HasAny(template string, values map[string]string) bool {
+	for rest := template; ; {
+		start := strings.IndexByte(rest, '{')
+		if start < 0 {
+			return false
+		}
+		end := strings.IndexByte(rest[start+1:], '}')
+		if end < 0 {
+			return false
+		}
+		if _, ok := values[strings.ToLower(strings.TrimSpace(rest[start+1:start+1+end]))]; ok {
+			return true
+		}
+		rest = rest[start+1:]
+	}
+}
+
+// Has reports whether template uses the {name} placeholder
+func Has(template, name string) bool {
+	return strings.Contains(strings.ToLower(template), "{"+strings.ToLower(name)+"}")
+}
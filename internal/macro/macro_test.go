@@ -0,0 +1,43 @@
+package macro
+
+import (
+	"testing"
+)
+
+func TestExpand(t *testing.T) {
+	values := map[string]string{
+		"clickid": "abc123",
+		"sub1":    "zone 7&x=1",
+		"country": "US",
+		"empty":   "",
+	}
+
+	tests := []struct {
+		template string
+		want     string
+	}{
+		{"https://net.example/?aff=5&s1={clickid}", "https://net.example/?aff=5&s1=abc123"},
+		{"https://net.example/?s2={sub1}", "https://net.example/?s2=zone+7%26x%3D1"},
+		{"https://net.example/{country}/{SUB1}?c={CountRy}", "https://net.example/US/zone%207&x=1?c=US"},
+		{"https://net.example/?s3={empty}&s4={unknown}", "https://net.example/?s3=&s4={unknown}"},
+		{"https://net.example/?json={\"a\"", "https://net.example/?json={\"a\""},
+		{"https://net.example/#{clickid}", "https://net.example/#abc123"},
+	}
+
+	for _, tt := range tests {
+		if got := Expand(tt.template, values); got != tt.want {
+			t.Errorf("Expand(%q) = %q, want %q", tt.template, got, tt.want)
+		}
+	}
+}
+
+func TestHas(t *testing.T) {
+	values := map[string]string{"clickid": "abc123"}
+	if !HasAny("https://x.example/?s={ClickID}", values) || !HasAny("https://x.example/?f={x}&s={clickid}", values) ||
+		HasAny("https://x.example/?s={}", values) || HasAny("https://x.example/?f={x}", values) || HasAny("https://x.example/", values) {
+		t.Errorf("HasAny misdetected placeholders")
+	}
+	if !Has("https://x.example/?c={Country}", "country") || Has("https://x.example/?c={clickid}", "country") {
+		t.Errorf("Has misdetected placeholders")
+	}
+}
@@ -0,0 +1,187 @@
+// Package outbox delivers the outbound requests queued in the outbox table,
+// such as ad platform events and traffic source postbacks. Deliveries survive
+// restarts, are retried with exponential backoff and end up dead after too
+// many failures, from where they can be replayed.
+package outbox
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"unchained-tracker/internal/db"
+)
+
+// Store is the part of the database the workers need
+type Store interface {
+	ClaimDeliveries(now time.Time, limit int) ([]*db.Delivery, error)
+	CompleteDelivery(d *db.Delivery) error
+	ReleaseDeliveries() error
+}
+
+// Options tune the worker pool. Zero values get the defaults.
+type Options struct {
+	Workers      int
+	PollInterval time.Duration
+	MaxAttempts  int
+	BaseBackoff  time.Duration
+	MaxBackoff   time.Duration
+	Client       *http.Client
+	// Authorize adds the credentials kept out of the stored delivery to
+	// its request, e.g. an ad platform's access token
+	Authorize func(d *db.Delivery, req *http.Request) error
+}
+
+// maxResponseBody is how much of the receiver's answer is kept
+const maxResponseBody = 2048
+
+// Worker is a pool of goroutines draining the outbox
+type Worker struct {
+	store Store
+	opts  Options
+}
+
+func NewWorker(store Store, opts Options) *Worker {
+	if opts.Workers <= 0 {
+		opts.Workers = 4
+	}
+	if opts.PollInterval <= 0 {
+		opts.PollInterval = time.Second
+	}
+	if opts.MaxAttempts <= 0 {
+		opts.MaxAttempts = 10
+	}
+	if opts.BaseBackoff <= 0 {
+		opts.BaseBackoff = 30 * time.Second
+	}
+	if opts.MaxBackoff <= 0 {
+		opts.MaxBackoff = 6 * time.Hour
+	}
+	if opts.Client == nil {
+		opts.Client = &http.Client{Timeout: 15 * time.Second}
+	}
+	return &Worker{store: store, opts: opts}
+}
+
+// Run delivers due deliveries until ctx is done
+func (w *Worker) Run(ctx context.Context) {
+	if err := w.store.ReleaseDeliveries(); err != nil {
+		log.Printf("Error releasing outbox deliveries: %v", err)
+	}
+
+	jobs := make(chan *db.Delivery)
+	var wg sync.WaitGroup
+	for i := 0; i < w.opts.Workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for d := range jobs {
+				w.Deliver(d)
+			}
+		}()
+	}
+	defer func() {
+		close(jobs)
+		wg.Wait()
+	}()
+
+	ticker := time.NewTicker(w.opts.PollInterval)
+	defer ticker.Stop()
+	for {
+		deliveries, err := w.store.ClaimDeliveries(time.Now(), w.opts.Workers*4)
+		if err != nil {
+			log.Printf("Error claiming outbox deliveries: %v", err)
+		}
+		for _, d := range deliveries {
+			select {
+			case jobs <- d:
+			case <-ctx.Done():
+				return
+			}
+		}
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// Deliver makes one attempt at d and records the outcome
+func (w *Worker) Deliver(d *db.Delivery) {
+	d.Attempts++
+	status, body, err := w.send(d)
+	d.ResponseStatus = status
+	d.ResponseBody = body
+
+	if err == nil {
+		now := time.Now()
+		d.Status = db.DeliveryDelivered
+		d.LastError = ""
+		d.DeliveredAt = &now
+		log.Printf("Delivered %s %d to %s after %d attempt(s)", d.Kind, d.ID, d.Target, d.Attempts)
+	} else {
+		d.LastError = err.Error()
+		if d.Attempts >= w.opts.MaxAttempts {
+			d.Status = db.DeliveryDead
+			log.Printf("Giving up on %s %d to %s after %d attempts: %v", d.Kind, d.ID, d.Target, d.Attempts, err)
+		} else {
+			d.Status = db.DeliveryPending
+			d.NextAttemptAt = time.Now().Add(w.Backoff(d.Attempts))
+			log.Printf("Delivery of %s %d to %s failed, retrying at %s: %v", d.Kind, d.ID, d.Target, d.NextAttemptAt.Format(time.RFC3339), err)
+		}
+	}
+
+	if err := w.store.CompleteDelivery(d); err != nil {
+		log.Printf("Error saving outcome of delivery %d: %v", d.ID, err)
+	}
+}
+
+func (w *Worker) send(d *db.Delivery) (status int, body string, err error) {
+	req, err := http.NewRequest(d.Method, d.URL, strings.NewReader(d.Body))
+	if err != nil {
+		return 0, "", err
+	}
+	if d.ContentType != "" {
+		req.Header.Set("Content-Type", d.ContentType)
+	}
+	for name, value := range d.Headers {
+		req.Header.Set(name, value)
+	}
+	if w.opts.Authorize != nil {
+		if err := w.opts.Authorize(d, req); err != nil {
+			return 0, "", err
+		}
+	}
+
+	resp, err := w.opts.Client.Do(req)
+	if err != nil {
+		return 0, "", err
+	}
+	defer resp.Body.Close()
+
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, maxResponseBody))
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return resp.StatusCode, string(data), fmt.Errorf("status %d", resp.StatusCode)
+	}
+	return resp.StatusCode, string(data), nil
+}
+
+// Backoff is how long to wait after the given number of failed attempts:
+// BaseBackoff doubled per attempt, capped at MaxBackoff
+func (w *Worker) Backoff(attempts int) time.Duration {
+	delay := w.opts.BaseBackoff
+	for i := 1; i < attempts; i++ {
+		delay *= 2
+		if delay >= w.opts.MaxBackoff {
+			return w.opts.MaxBackoff
+		}
+	}
+	return delay
+}
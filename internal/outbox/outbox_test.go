@@ -0,0 +1,142 @@
+package outbox
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"unchained-tracker/internal/db"
+	"unchained-tracker/internal/db/migrations"
+)
+
+func newTestDatabase(t *testing.T) *db.Database {
+	t.Helper()
+
+	database, err := db.Connect("sqlite::memory:")
+	if err != nil {
+		t.Fatalf("Connect: %v", err)
+	}
+	t.Cleanup(func() { database.Close() })
+	if err := migrations.Run(database.DB(), database.Driver()); err != nil {
+		t.Fatalf("migrations: %v", err)
+	}
+	return database
+}
+
+func TestBackoffDoublesUpToMax(t *testing.T) {
+	w := NewWorker(nil, Options{BaseBackoff: time.Second, MaxBackoff: 5 * time.Second})
+	want := []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second, 5 * time.Second}
+	for i, d := range want {
+		if got := w.Backoff(i + 1); got != d {
+			t.Errorf("Backoff(%d) = %v, want %v", i+1, got, d)
+		}
+	}
+}
+
+func TestFailingDeliveryGoesDeadAndReplays(t *testing.T) {
+	database := newTestDatabase(t)
+
+	var failing atomic.Bool
+	failing.Store(true)
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if failing.Load() {
+			http.Error(w, "down", http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte(`{"events_received":1}`))
+	}))
+	defer receiver.Close()
+
+	d := &db.Delivery{Kind: "webhook", Target: "test", Method: http.MethodPost, URL: receiver.URL, Body: "{}"}
+	if err := database.EnqueueDelivery(d); err != nil {
+		t.Fatalf("EnqueueDelivery: %v", err)
+	}
+
+	w := NewWorker(database, Options{MaxAttempts: 2, BaseBackoff: time.Hour})
+	claim := func() []*db.Delivery {
+		t.Helper()
+		// Look far enough ahead to include backed off deliveries
+		claimed, err := database.ClaimDeliveries(time.Now().Add(2*time.Hour), 10)
+		if err != nil {
+			t.Fatalf("ClaimDeliveries: %v", err)
+		}
+		return claimed
+	}
+
+	claimed := claim()
+	if len(claimed) != 1 {
+		t.Fatalf("claimed %d deliveries, want 1", len(claimed))
+	}
+	w.Deliver(claimed[0])
+	if claimed[0].Status != db.DeliveryPending || claimed[0].ResponseStatus != 503 {
+		t.Fatalf("after first failure: %+v", claimed[0])
+	}
+	if early, _ := database.ClaimDeliveries(time.Now(), 10); len(early) != 0 {
+		t.Fatalf("delivery claimed before its backoff: %+v", early)
+	}
+
+	claimed = claim()
+	w.Deliver(claimed[0])
+	dead, err := database.GetDeliveries(db.DeliveryDead, 0, 10)
+	if err != nil || len(dead) != 1 || dead[0].Attempts != 2 || dead[0].LastError == "" {
+		t.Fatalf("dead = %+v, %v", dead, err)
+	}
+
+	failing.Store(false)
+	if err := database.ReplayDelivery(d.ID); err != nil {
+		t.Fatalf("ReplayDelivery: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		NewWorker(database, Options{PollInterval: 10 * time.Millisecond}).Run(ctx)
+		close(done)
+	}()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		delivered, _ := database.GetDeliveries(db.DeliveryDelivered, 0, 10)
+		if len(delivered) == 1 {
+			if delivered[0].ResponseBody != `{"events_received":1}` || delivered[0].DeliveredAt == nil {
+				t.Errorf("delivered = %+v", delivered[0])
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("replayed delivery not delivered")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	cancel()
+	<-done
+}
+
+func TestAuthorizeAddsCredentialsWhenSending(t *testing.T) {
+	database := newTestDatabase(t)
+
+	var auth atomic.Value
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth.Store(r.Header.Get("Authorization"))
+	}))
+	defer receiver.Close()
+
+	d := &db.Delivery{Kind: "webhook", Target: "test", Method: http.MethodPost, URL: receiver.URL, Body: "{}"}
+	if err := database.EnqueueDelivery(d); err != nil {
+		t.Fatalf("EnqueueDelivery: %v", err)
+	}
+	w := NewWorker(database, Options{Authorize: func(d *db.Delivery, req *http.Request) error {
+		req.Header.Set("Authorization", "Bearer secret")
+		return nil
+	}})
+	claimed, err := database.ClaimDeliveries(time.Now(), 10)
+	if err != nil || len(claimed) != 1 {
+		t.Fatalf("ClaimDeliveries = %+v, %v", claimed, err)
+	}
+	w.Deliver(claimed[0])
+	if claimed[0].Status != db.DeliveryDelivered || auth.Load() != "Bearer secret" {
+		t.Errorf("delivery = %+v, Authorization %v", claimed[0], auth.Load())
+	}
+}
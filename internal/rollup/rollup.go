@@ -0,0 +1,64 @@
+// Package rollup keeps the hourly stats rollups up to date. Each run rolls
+// up the hours completed since the last one and redoes a lookback window
+// of already rolled up hours, so late conversions and status changes are
+// picked up. Runs are idempotent, so several instances can run the job.
+package rollup
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// Store is the part of the database the job needs
+type Store interface {
+	UpdateRollups(now time.Time, lookback time.Duration) error
+}
+
+// Options tune the job. Zero values get the defaults.
+type Options struct {
+	Interval time.Duration
+	Lookback time.Duration
+}
+
+// Job periodically rolls up the raw tables
+type Job struct {
+	store Store
+	opts  Options
+}
+
+func NewJob(store Store, opts Options) *Job {
+	if opts.Interval <= 0 {
+		opts.Interval = 5 * time.Minute
+	}
+	if opts.Lookback <= 0 {
+		opts.Lookback = 48 * time.Hour
+	}
+	return &Job{store: store, opts: opts}
+}
+
+// Run rolls up right away and then every interval until ctx is done
+func (j *Job) Run(ctx context.Context) {
+	ticker := time.NewTicker(j.opts.Interval)
+	defer ticker.Stop()
+	for {
+		j.RunOnce(time.Now())
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// RunOnce rolls up the hours completed by now
+func (j *Job) RunOnce(now time.Time) {
+	start := time.Now()
+	if err := j.store.UpdateRollups(now, j.opts.Lookback); err != nil {
+		log.Printf("Error updating rollups: %v", err)
+		return
+	}
+	if took := time.Since(start); took > j.opts.Interval/2 {
+		log.Printf("Rollups took %v", took)
+	}
+}
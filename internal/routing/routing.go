@@ -0,0 +1,177 @@
+// Package routing decides which campaign path a click takes, based on
+// attributes of the visitor known at click time.
+package routing
+
+import (
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"unchained-tracker/internal/db"
+)
+
+// Fields a PathCondition can test
+const (
+	FieldCountry    = "country"
+	FieldDeviceType = "device_type"
+	FieldOS         = "os"
+	FieldBrowser    = "browser"
+	FieldLanguage   = "language"
+	FieldReferrer   = "referrer_domain"
+	FieldHour       = "hour"
+)
+
+// Operators a PathCondition can use. An empty operator means OperatorIs.
+const (
+	OperatorIs    = "is"
+	OperatorIsNot = "is_not"
+)
+
+// Visitor holds the click attributes conditions are evaluated against
+type Visitor struct {
+	Country        string
+	DeviceType     string
+	OS             string
+	Browser        string
+	Language       string // Accept-Language header or a bare language tag
+	ReferrerDomain string
+	// Time is when the click happened; hour conditions use its location
+	Time time.Time
+}
+
+// SelectPath returns the first non-default path, in Priority order, whose
+// conditions all match v, or the campaign's default path when none does.
+// It returns nil when nothing matches and there is no default path.
+func SelectPath(paths []db.CampaignPath, v Visitor) *db.CampaignPath {
+	var match, fallback *db.CampaignPath
+	for i := range paths {
+		p := &paths[i]
+		if p.IsDefault {
+			if fallback == nil {
+				fallback = p
+			}
+			continue
+		}
+		if (match == nil || p.Priority < match.Priority) && MatchAll(p.Conditions, v) {
+			match = p
+		}
+	}
+	if match != nil {
+		return match
+	}
+	return fallback
+}
+
+// MatchAll reports whether every condition matches v
+func MatchAll(conditions []db.PathCondition, v Visitor) bool {
+	for _, c := range conditions {
+		if !Match(c, v) {
+			return false
+		}
+	}
+	return true
+}
+
+// Match reports whether a single condition matches v. Unknown fields never
+// match, so a typo in a rule can't send all traffic down the wrong path.
+func Match(c db.PathCondition, v Visitor) bool {
+	var matched bool
+	switch c.Field {
+	case FieldCountry:
+		matched = containsFold(c.Values, v.Country)
+	case FieldDeviceType:
+		matched = containsFold(c.Values, v.DeviceType)
+	case FieldOS:
+		matched = containsFold(c.Values, v.OS)
+	case FieldBrowser:
+		matched = containsFold(c.Values, v.Browser)
+	case FieldLanguage:
+		matched = containsFold(c.Values, primaryLanguage(v.Language))
+	case FieldReferrer:
+		matched = matchDomain(c.Values, v.ReferrerDomain)
+	case FieldHour:
+		matched = matchHour(c.Values, v.Time.Hour())
+	default:
+		return false
+	}
+
+	if c.Operator == OperatorIsNot {
+		return !matched
+	}
+	return matched
+}
+
+// ReferrerDomain extracts the host of a referrer URL without a "www." prefix
+func ReferrerDomain(referrer string) string {
+	u, err := url.Parse(referrer)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimPrefix(strings.ToLower(u.Hostname()), "www.")
+}
+
+// primaryLanguage returns the primary subtag of the first language in an
+// Accept-Language header, e.g. "en" for "en-US,en;q=0.9".
+func primaryLanguage(lang string) string {
+	lang = strings.TrimSpace(strings.SplitN(lang, ",", 2)[0])
+	lang = strings.SplitN(lang, ";", 2)[0]
+	lang = strings.SplitN(lang, "-", 2)[0]
+	return strings.ToLower(strings.SplitN(lang, "_", 2)[0])
+}
+
+func containsFold(values []string, s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, v := range values {
+		if strings.EqualFold(strings.TrimSpace(v), s) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchDomain matches the domain itself and any of its subdomains
+func matchDomain(values []string, domain string) bool {
+	if domain == "" {
+		return false
+	}
+	for _, v := range values {
+		v = strings.TrimPrefix(strings.ToLower(strings.TrimSpace(v)), "www.")
+		if domain == v || strings.HasSuffix(domain, "."+v) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchHour accepts single hours ("9") and half-open ranges ("9-17" is
+// 09:00 to 16:59). Ranges may wrap past midnight ("22-6").
+func matchHour(values []string, hour int) bool {
+	for _, v := range values {
+		from, to, isRange := strings.Cut(strings.TrimSpace(v), "-")
+		start, err := strconv.Atoi(strings.TrimSpace(from))
+		if err != nil {
+			continue
+		}
+		if !isRange {
+			if hour == start {
+				return true
+			}
+			continue
+		}
+		end, err := strconv.Atoi(strings.TrimSpace(to))
+		if err != nil {
+			continue
+		}
+		if start <= end {
+			if hour >= start && hour < end {
+				return true
+			}
+		} else if hour >= start || hour < end {
+			return true
+		}
+	}
+	return false
+}
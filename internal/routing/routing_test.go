@@ -0,0 +1,82 @@
+package routing
+
+import (
+	"testing"
+	"time"
+
+	"unchained-tracker/internal/db"
+)
+
+func TestMatch(t *testing.T) {
+	afternoon := time.Date(2024, 5, 1, 15, 30, 0, 0, time.UTC)
+	v := Visitor{
+		Country:        "US",
+		DeviceType:     "mobile",
+		OS:             "iOS",
+		Browser:        "Safari",
+		Language:       "en-US,en;q=0.9",
+		ReferrerDomain: "m.facebook.com",
+		Time:           afternoon,
+	}
+
+	tests := []struct {
+		name string
+		cond db.PathCondition
+		want bool
+	}{
+		{"country", db.PathCondition{Field: FieldCountry, Values: []string{"ca", "us"}}, true},
+		{"country miss", db.PathCondition{Field: FieldCountry, Values: []string{"DE"}}, false},
+		{"country is_not", db.PathCondition{Field: FieldCountry, Operator: OperatorIsNot, Values: []string{"DE"}}, true},
+		{"device", db.PathCondition{Field: FieldDeviceType, Values: []string{"Mobile"}}, true},
+		{"os", db.PathCondition{Field: FieldOS, Values: []string{"android"}}, false},
+		{"browser", db.PathCondition{Field: FieldBrowser, Values: []string{"safari"}}, true},
+		{"language", db.PathCondition{Field: FieldLanguage, Values: []string{"en"}}, true},
+		{"referrer subdomain", db.PathCondition{Field: FieldReferrer, Values: []string{"facebook.com"}}, true},
+		{"referrer other", db.PathCondition{Field: FieldReferrer, Values: []string{"book.com"}}, false},
+		{"hour range", db.PathCondition{Field: FieldHour, Values: []string{"9-17"}}, true},
+		{"hour wrap", db.PathCondition{Field: FieldHour, Values: []string{"22-6"}}, false},
+		{"hour single", db.PathCondition{Field: FieldHour, Values: []string{"15"}}, true},
+		{"unknown field", db.PathCondition{Field: "zone", Values: []string{"1"}}, false},
+	}
+
+	for _, tt := range tests {
+		if got := Match(tt.cond, v); got != tt.want {
+			t.Errorf("%s: Match = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestSelectPath(t *testing.T) {
+	paths := []db.CampaignPath{
+		{ID: 1, Name: "fallback", IsDefault: true},
+		{ID: 2, Name: "desktop", Priority: 2, Conditions: []db.PathCondition{
+			{Field: FieldDeviceType, Values: []string{"desktop"}},
+		}},
+		{ID: 3, Name: "US mobile", Priority: 1, Conditions: []db.PathCondition{
+			{Field: FieldCountry, Values: []string{"US"}},
+			{Field: FieldDeviceType, Values: []string{"mobile"}},
+		}},
+	}
+
+	if p := SelectPath(paths, Visitor{Country: "US", DeviceType: "mobile"}); p == nil || p.ID != 3 {
+		t.Errorf("US mobile: got %+v", p)
+	}
+	if p := SelectPath(paths, Visitor{Country: "US", DeviceType: "desktop"}); p == nil || p.ID != 2 {
+		t.Errorf("US desktop: got %+v", p)
+	}
+	if p := SelectPath(paths, Visitor{Country: "DE", DeviceType: "tablet"}); p == nil || p.ID != 1 {
+		t.Errorf("fallback: got %+v", p)
+	}
+	if p := SelectPath(paths[1:], Visitor{Country: "DE", DeviceType: "tablet"}); p != nil {
+		t.Errorf("expected no path without a default, got %+v", p)
+	}
+}
+
+func TestReferrerDomain(t *testing.T) {
+	if got := ReferrerDomain("https://www.Example.com/path?q=1"); got != "example.com" {
+		t.Errorf("ReferrerDomain = %q", got)
+	}
+	if got := ReferrerDomain(""); got != "" {
+		t.Errorf("ReferrerDomain of empty = %q", got)
+	}
+}
@@ -0,0 +1,127 @@
+package useragent
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// AcceptCH asks Chromium browsers for the client hints they don't send
+// unasked. Browsers send them on later requests to the same origin.
+const AcceptCH = "Sec-CH-UA-Full-Version-List, Sec-CH-UA-Platform-Version, Sec-CH-UA-Form-Factors"
+
+// brands maps Sec-CH-UA brands to browser names. Chromium is what every
+// Chromium browser lists besides its own brand, so it only names the
+// browser when nothing else does.
+var brands = map[string]string{
+	"Google Chrome":    "Chrome",
+	"Microsoft Edge":   "Edge",
+	"Opera":            "Opera",
+	"Opera GX":         "Opera",
+	"Samsung Internet": "Samsung Internet",
+	"YaBrowser":        "Yandex",
+	"Yandex":           "Yandex",
+	"Brave":            "Brave",
+	"Vivaldi":          "Vivaldi",
+}
+
+// platforms maps Sec-CH-UA-Platform values to OS names
+var platforms = map[string]string{
+	"Windows":   "Windows",
+	"macOS":     "macOS",
+	"iOS":       "iOS",
+	"Android":   "Android",
+	"Chrome OS": "Chrome OS",
+	"ChromeOS":  "Chrome OS",
+	"Linux":     "Linux",
+}
+
+// ParseRequest parses a user agent together with the client hints in h.
+// Chromium browsers freeze parts of the user agent, such as the Windows
+// and Android versions, so what the hints say wins.
+func (p *Parser) ParseRequest(ua string, h http.Header) Agent {
+	a := p.Parse(ua)
+
+	list := h.Get("Sec-CH-UA-Full-Version-List")
+	if list == "" {
+		list = h.Get("Sec-CH-UA")
+	}
+	if name, version := brand(list); name != "" && (name != "Chrome" || a.Browser == "" || a.Browser == "Chrome") {
+		if name != a.Browser || len(version) > len(a.BrowserVersion) {
+			a.BrowserVersion = version
+		}
+		a.Browser = name
+	}
+
+	if os, ok := platforms[unquote(h.Get("Sec-CH-UA-Platform"))]; ok {
+		if os != a.OS {
+			a.OSVersion = ""
+		}
+		a.OS = os
+		if version := unquote(h.Get("Sec-CH-UA-Platform-Version")); version != "" {
+			a.OSVersion = platformVersion(os, version)
+		}
+	}
+
+	switch {
+	case strings.Contains(h.Get("Sec-CH-UA-Form-Factors"), `"Tablet"`):
+		a.DeviceType = DeviceTablet
+	case h.Get("Sec-CH-UA-Mobile") == "?1" && a.DeviceType != DeviceTablet:
+		a.DeviceType = DeviceMobile
+	case a.DeviceType == "" && h.Get("Sec-CH-UA-Mobile") == "?0":
+		a.DeviceType = DeviceDesktop
+	}
+	return a
+}
+
+// brand picks the browser from a brand list such as
+// "Chromium";v="124", "Google Chrome";v="124", "Not-A.Brand";v="99".
+// Brands it doesn't know, like the made-up one, are skipped.
+func brand(list string) (name, version string) {
+	var chromium string
+	for _, entry := range strings.Split(list, ",") {
+		fields := strings.Split(entry, ";")
+		brand := unquote(fields[0])
+		var v string
+		for _, param := range fields[1:] {
+			if key, value, ok := strings.Cut(strings.TrimSpace(param), "="); ok && key == "v" {
+				v = unquote(value)
+			}
+		}
+		if known, ok := brands[brand]; ok {
+			return known, v
+		}
+		if brand == "Chromium" {
+			chromium = v
+		}
+	}
+	if chromium != "" {
+		return "Chrome", chromium
+	}
+	return "", ""
+}
+
+// platformVersion turns Sec-CH-UA-Platform-Version into the version people
+// know. Windows reports 13 and up for Windows 11 and 1 to 10 for Windows
+// 10.
+func platformVersion(os, version string) string {
+	if os == "Windows" {
+		major, _, _ := strings.Cut(version, ".")
+		n, err := strconv.Atoi(major)
+		switch {
+		case err != nil:
+			return ""
+		case n >= 13:
+			return "11"
+		case n > 0:
+			return "10"
+		}
+		return ""
+	}
+	return strings.TrimSuffix(version, ".0")
+}
+
+// unquote strips the quotes of a structured header string
+func unquote(s string) string {
+	return strings.Trim(strings.TrimSpace(s), `"`)
+}
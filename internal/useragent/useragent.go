@@ -0,0 +1,199 @@
+// Package useragent works out the browser, OS and device type of a
+// request from its user agent and, where the browser sends them, its
+// Sec-CH-UA client hints. The user agent is matched against regex
+// definitions: built-in ones, or a JSON file in the same format that is
+// reloaded when it changes.
+package useragent
+
+import (
+	"context"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Device types
+const (
+	DeviceDesktop = "desktop"
+	DeviceMobile  = "mobile"
+	DeviceTablet  = "tablet"
+	DeviceTV      = "tv"
+)
+
+// Agent is what is known about a browser
+type Agent struct {
+	Browser        string
+	BrowserVersion string
+	OS             string
+	OSVersion      string
+	DeviceType     string
+}
+
+//go:embed regexes.json
+var builtin []byte
+
+// rule matches a user agent. Name is the browser, the OS or the device
+// type. The version is Version when set, else the first group.
+type rule struct {
+	Regex   string `json:"regex"`
+	Name    string `json:"name"`
+	Version string `json:"version"`
+	re      *regexp.Regexp
+}
+
+// definitions are tried in order, the first matching rule of each list
+// winning
+type definitions struct {
+	Browsers []rule `json:"browsers"`
+	OS       []rule `json:"os"`
+	Devices  []rule `json:"devices"`
+}
+
+func parseDefinitions(data []byte) (*definitions, error) {
+	var defs definitions
+	if err := json.Unmarshal(data, &defs); err != nil {
+		return nil, err
+	}
+	for _, rules := range [][]rule{defs.Browsers, defs.OS, defs.Devices} {
+		for i := range rules {
+			re, err := regexp.Compile(rules[i].Regex)
+			if err != nil {
+				return nil, err
+			}
+			rules[i].re = re
+		}
+	}
+	if len(defs.Browsers) == 0 && len(defs.OS) == 0 && len(defs.Devices) == 0 {
+		return nil, errors.New("no definitions")
+	}
+	return &defs, nil
+}
+
+// Options configure the parser. Without a file the built-in definitions
+// are used.
+type Options struct {
+	File           string
+	ReloadInterval time.Duration
+}
+
+// Parser parses user agents with the current definitions
+type Parser struct {
+	mu      sync.RWMutex
+	defs    *definitions
+	modTime time.Time
+	size    int64
+	opts    Options
+}
+
+// NewParser loads the definitions file. A file that doesn't exist yet is
+// picked up by Run once it appears; until then, or when the file is
+// invalid, the built-in definitions are used.
+func NewParser(opts Options) (*Parser, error) {
+	if opts.ReloadInterval <= 0 {
+		opts.ReloadInterval = time.Minute
+	}
+	defs, err := parseDefinitions(builtin)
+	if err != nil {
+		panic(fmt.Sprintf("built-in user agent definitions: %v", err))
+	}
+	p := &Parser{defs: defs, opts: opts}
+	_, err = p.Reload()
+	return p, err
+}
+
+// Run reloads the definitions file every reload interval until ctx is
+// done
+func (p *Parser) Run(ctx context.Context) {
+	if p.opts.File == "" {
+		return
+	}
+	ticker := time.NewTicker(p.opts.ReloadInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if _, err := p.Reload(); err != nil {
+			log.Printf("Error reloading user agent definitions: %v", err)
+		}
+	}
+}
+
+// Reload reads the definitions file if it changed since it was last read.
+// Invalid definitions leave the current ones in place.
+func (p *Parser) Reload() (bool, error) {
+	if p.opts.File == "" {
+		return false, nil
+	}
+	info, err := os.Stat(p.opts.File)
+	if errors.Is(err, fs.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	p.mu.RLock()
+	unchanged := info.ModTime().Equal(p.modTime) && info.Size() == p.size
+	p.mu.RUnlock()
+	if unchanged {
+		return false, nil
+	}
+
+	data, err := os.ReadFile(p.opts.File)
+	if err != nil {
+		return false, err
+	}
+	defs, err := parseDefinitions(data)
+	if err != nil {
+		return false, fmt.Errorf("%s: %w", p.opts.File, err)
+	}
+
+	p.mu.Lock()
+	p.defs, p.modTime, p.size = defs, info.ModTime(), info.Size()
+	p.mu.Unlock()
+	log.Printf("Loaded user agent definitions %s", p.opts.File)
+	return true, nil
+}
+
+// Parse matches a user agent against the definitions. Any user agent that
+// isn't a mobile, tablet or TV is a desktop.
+func (p *Parser) Parse(ua string) Agent {
+	p.mu.RLock()
+	defs := p.defs
+	p.mu.RUnlock()
+
+	var a Agent
+	a.Browser, a.BrowserVersion = match(defs.Browsers, ua)
+	a.OS, a.OSVersion = match(defs.OS, ua)
+	a.DeviceType, _ = match(defs.Devices, ua)
+	if a.DeviceType == "" && strings.TrimSpace(ua) != "" {
+		a.DeviceType = DeviceDesktop
+	}
+	return a
+}
+
+func match(rules []rule, ua string) (name, version string) {
+	for _, r := range rules {
+		groups := r.re.FindStringSubmatch(ua)
+		if groups == nil {
+			continue
+		}
+		version = r.Version
+		if version == "" && len(groups) > 1 {
+			version = strings.ReplaceAll(groups[1], "_", ".")
+		}
+		return r.Name, version
+	}
+	return "", ""
+}
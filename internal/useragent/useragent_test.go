@@ -0,0 +1,127 @@
+package useragent
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestParse(t *testing.T) {
+	p, err := NewParser(Options{})
+	if err != nil {
+		t.Fatalf("NewParser: %v", err)
+	}
+
+	tests := []struct {
+		ua   string
+		want Agent
+	}{
+		{"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/124.0.0.0 Safari/537.36",
+			Agent{"Chrome", "124.0.0.0", "Windows", "10", DeviceDesktop}},
+		{"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/124.0.0.0 Safari/537.36 Edg/124.0.2478.80",
+			Agent{"Edge", "124.0.2478.80", "Windows", "10", DeviceDesktop}},
+		{"Mozilla/5.0 (iPhone; CPU iPhone OS 17_4_1 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.4.1 Mobile/15E148 Safari/604.1",
+			Agent{"Safari", "17.4.1", "iOS", "17.4.1", DeviceMobile}},
+		{"Mozilla/5.0 (iPad; CPU OS 16_6 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) CriOS/124.0.6367.88 Mobile/15E148 Safari/604.1",
+			Agent{"Chrome", "124.0.6367.88", "iOS", "16.6", DeviceTablet}},
+		{"Mozilla/5.0 (Linux; Android 10; K) AppleWebKit/537.36 (KHTML, like Gecko) SamsungBrowser/24.0 Chrome/117.0.0.0 Mobile Safari/537.36",
+			Agent{"Samsung Internet", "24.0", "Android", "10", DeviceMobile}},
+		{"Mozilla/5.0 (Linux; Android 13; SM-X710) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/124.0.0.0 Safari/537.36",
+			Agent{"Chrome", "124.0.0.0", "Android", "13", DeviceTablet}},
+		{"Mozilla/5.0 (Macintosh; Intel Mac OS X 10.15; rv:125.0) Gecko/20100101 Firefox/125.0",
+			Agent{"Firefox", "125.0", "macOS", "10.15", DeviceDesktop}},
+		{"Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/124.0.0.0 Safari/537.36 OPR/109.0.0.0",
+			Agent{"Opera", "109.0.0.0", "macOS", "10.15.7", DeviceDesktop}},
+		{"Mozilla/5.0 (SMART-TV; Linux; Tizen 6.0) AppleWebKit/537.36 (KHTML, like Gecko) SamsungBrowser/4.0 Chrome/76.0.3809.146 TV Safari/537.36",
+			Agent{"Samsung Internet", "4.0", "Linux", "", DeviceTV}},
+		{"", Agent{}},
+	}
+	for _, tt := range tests {
+		if got := p.Parse(tt.ua); got != tt.want {
+			t.Errorf("Parse(%q) = %+v, want %+v", tt.ua, got, tt.want)
+		}
+	}
+}
+
+func TestParseRequest(t *testing.T) {
+	p, _ := NewParser(Options{})
+	frozen := "Mozilla/5.0 (Linux; Android 10; K) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/124.0.0.0 Mobile Safari/537.36"
+	desktop := "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/124.0.0.0 Safari/537.36"
+
+	tests := []struct {
+		name   string
+		ua     string
+		header http.Header
+		want   Agent
+	}{
+		{"windows 11", desktop, http.Header{
+			"Sec-Ch-Ua":                   {`"Chromium";v="124", "Google Chrome";v="124", "Not-A.Brand";v="99"`},
+			"Sec-Ch-Ua-Full-Version-List": {`"Chromium";v="124.0.6367.91", "Google Chrome";v="124.0.6367.91", "Not-A.Brand";v="99.0.0.0"`},
+			"Sec-Ch-Ua-Mobile":            {"?0"},
+			"Sec-Ch-Ua-Platform":          {`"Windows"`},
+			"Sec-Ch-Ua-Platform-Version":  {`"15.0.0"`},
+		}, Agent{"Chrome", "124.0.6367.91", "Windows", "11", DeviceDesktop}},
+		{"brave", desktop, http.Header{
+			"Sec-Ch-Ua": {`"Chromium";v="124", "Brave";v="124", "Not-A.Brand";v="99"`},
+		}, Agent{"Brave", "124", "Windows", "10", DeviceDesktop}},
+		{"android", frozen, http.Header{
+			"Sec-Ch-Ua":                  {`"Not_A Brand";v="8", "Chromium";v="124", "Microsoft Edge";v="124"`},
+			"Sec-Ch-Ua-Mobile":           {"?1"},
+			"Sec-Ch-Ua-Platform":         {`"Android"`},
+			"Sec-Ch-Ua-Platform-Version": {`"14.0.0"`},
+		}, Agent{"Edge", "124", "Android", "14.0", DeviceMobile}},
+		{"tablet", frozen, http.Header{
+			"Sec-Ch-Ua-Form-Factors": {`"Tablet"`},
+		}, Agent{"Chrome", "124.0.0.0", "Android", "10", DeviceTablet}},
+		{"chromium keeps the named browser",
+			"Mozilla/5.0 (Windows NT 10.0) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/124.0.0.0 Safari/537.36 OPR/109.0.0.0",
+			http.Header{"Sec-Ch-Ua": {`"Chromium";v="124", "Not-A.Brand";v="99"`}},
+			Agent{"Opera", "109.0.0.0", "Windows", "10", DeviceDesktop}},
+		{"hints only", "", http.Header{
+			"Sec-Ch-Ua":          {`"Chromium";v="124"`},
+			"Sec-Ch-Ua-Mobile":   {"?0"},
+			"Sec-Ch-Ua-Platform": {`"Linux"`},
+		}, Agent{"Chrome", "124", "Linux", "", DeviceDesktop}},
+	}
+	for _, tt := range tests {
+		if got := p.ParseRequest(tt.ua, tt.header); got != tt.want {
+			t.Errorf("%s: ParseRequest = %+v, want %+v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "regexes.json")
+	p, err := NewParser(Options{File: path})
+	if err != nil {
+		t.Fatalf("NewParser without the file: %v", err)
+	}
+	if got := p.Parse("Mozilla/5.0 (X11; Linux x86_64) Firefox/125.0"); got.Browser != "Firefox" {
+		t.Errorf("built-in definitions: %+v", got)
+	}
+
+	defs := `{"browsers": [{"regex": "Kitten/(\\d+)", "name": "Kitten"}], "devices": [{"regex": "Kitten", "name": "mobile"}]}`
+	if err := os.WriteFile(path, []byte(defs), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if reloaded, err := p.Reload(); !reloaded || err != nil {
+		t.Fatalf("Reload = %v, %v", reloaded, err)
+	}
+	if got := p.Parse("Kitten/3"); got != (Agent{Browser: "Kitten", BrowserVersion: "3", DeviceType: DeviceMobile}) {
+		t.Errorf("reloaded definitions: %+v", got)
+	}
+
+	// Broken definitions keep the last good ones
+	if err := os.WriteFile(path, []byte(`{"browsers": [{"regex": "(", "name": "x"}]}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	os.Chtimes(path, time.Now(), time.Now().Add(time.Minute))
+	if _, err := p.Reload(); err == nil {
+		t.Error("no error for an invalid regex")
+	}
+	if got := p.Parse("Kitten/3"); got.Browser != "Kitten" {
+		t.Errorf("after a failed reload: %+v", got)
+	}
+}
@@ -4,6 +4,11 @@ class AffiliateTracker {
         this.campaignId = config.campaign_id || '';
     }
 
+    getCookie(name) {
+        const match = document.cookie.match(new RegExp("(?:^|; )" + name + "=([^;]*)"));
+        return match ? decodeURIComponent(match[1]) : "";
+    }
+
     async trackVisit() {
         try {
             const response = await fetch(`${this.endpoint}/track`, {
@@ -14,7 +19,12 @@ class AffiliateTracker {
                     campaign_id: this.campaignId,
                     ...this.deviceInfo,
                     screen_resolution: this.screenInfo.resolution,
-                    viewport_size: this.screenInfo.viewport
+                    viewport_size: this.screenInfo.viewport,
+                    timezone: Intl.DateTimeFormat().resolvedOptions().timeZone,
+                    webdriver: navigator.webdriver === true,
+                    params: Object.fromEntries(new URLSearchParams(window.location.search)),
+                    fbc: this.getCookie("_fbc"),
+                    fbp: this.getCookie("_fbp")
                 })
             });
             if (!response.ok) {
@@ -1 +1 @@
-class AffiliateTracker{constructor(config={}){this.endpoint=window.location.origin;this.campaignId=config.campaign_id||""}async trackVisit(){try{const response=await fetch(`${this.endpoint}/track`,{method:"POST",headers:{"Content-Type":"application/json"},body:JSON.stringify({click_id:this.clickId,campaign_id:this.campaignId,...this.deviceInfo,screen_resolution:this.screenInfo.resolution,viewport_size:this.screenInfo.viewport})});if(!response.ok){throw new Error(`HTTP error! status: ${response.status}`)}const data=await response.json();localStorage.setItem("visitor_id",data.visitor_id);return data}catch(err){console.error("Error tracking visit:",err);throw err}}}
\ No newline at end of file
+class AffiliateTracker{constructor(config={}){this.endpoint=window.location.origin;this.campaignId=config.campaign_id||""}getCookie(name){const match=document.cookie.match(new RegExp("(?:^|; )"+name+"=([^;]*)"));return match?decodeURIComponent(match[1]):""}async trackVisit(){try{const response=await fetch(`${this.endpoint}/track`,{method:"POST",headers:{"Content-Type":"application/json"},body:JSON.stringify({click_id:this.clickId,campaign_id:this.campaignId,...this.deviceInfo,screen_resolution:this.screenInfo.resolution,viewport_size:this.screenInfo.viewport,timezone:Intl.DateTimeFormat().resolvedOptions().timeZone,webdriver:navigator.webdriver===true,params:Object.fromEntries(new URLSearchParams(window.location.search)),fbc:this.getCookie("_fbc"),fbp:this.getCookie("_fbp")})});if(!response.ok){throw new Error(`HTTP error! status: ${response.status}`)}const data=await response.json();localStorage.setItem("visitor_id",data.visitor_id);return data}catch(err){console.error("Error tracking visit:",err);throw err}}}
\ No newline at end of file